@@ -15,13 +15,18 @@
 package app
 
 import (
+	"os"
+
+	"github.com/go-logr/logr"
 	"github.com/spf13/cobra"
 	"github.com/zoumo/golib/cli/injection"
 	"github.com/zoumo/golib/cli/plugin"
 	"github.com/zoumo/golib/log"
+	"github.com/zoumo/golib/log/consolog"
 	"github.com/zoumo/make-rules/version"
 
 	"github.com/zoumo/kube-codegen/pkg/cli"
+	"github.com/zoumo/kube-codegen/pkg/logging"
 )
 
 var (
@@ -29,17 +34,39 @@ var (
 )
 
 func NewRootCommand() *cobra.Command {
+	logFormat := logging.FormatText
 	root := &cobra.Command{
 		Use:          "kube-codegen",
 		SilenceUsage: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := logging.ValidateFormat(logFormat); err != nil {
+				return err
+			}
+			log.SetLogger(newLogger(logFormat))
+			return nil
+		},
 	}
+	root.PersistentFlags().StringVar(&logFormat, "log-format", logFormat, "log format, one of text|json. json writes one object per line with fields like generator, so that logs can be reassembled by structured consumers")
 
 	root.AddCommand(NewCodegenCommand())
 	root.AddCommand(NewClientGenCommand())
+	root.AddCommand(NewScaffoldControllerCommand())
+	root.AddCommand(NewInventoryCommand())
+	root.AddCommand(NewListKindsCommand())
 	root.AddCommand(version.NewCommand())
 	return root
 }
 
+// newLogger returns the logger of format. JSON logs are written to stderr,
+// so that they do not mix with YAML written to stdout by list-kinds and
+// inventory.
+func newLogger(format string) logr.Logger {
+	if format == logging.FormatJSON {
+		return logging.NewJSON(os.Stderr, 0)
+	}
+	return consolog.New()
+}
+
 func NewCodegenCommand() *cobra.Command {
 	cmd := plugin.NewCobraSubcommandOrDie(
 		cli.NewCodeGenSubcommand(),
@@ -60,3 +87,33 @@ func NewClientGenCommand() *cobra.Command {
 	cmd.Short = "client-gen runs client-gen,lister-gen,informer-gen code-generators for apis in local or remote repository, used to implement Kubernetes-style clients sdk."
 	return cmd
 }
+
+func NewScaffoldControllerCommand() *cobra.Command {
+	cmd := plugin.NewCobraSubcommandOrDie(
+		cli.NewScaffoldControllerSubcommand(),
+		injection.InjectLogger(genLogger.WithName("scaffold-controller")),
+		injection.InjectWorkspace(),
+	)
+	cmd.Short = "scaffold-controller generates a reconciler skeleton for a kind using generated clientset and informers."
+	return cmd
+}
+
+func NewInventoryCommand() *cobra.Command {
+	cmd := plugin.NewCobraSubcommandOrDie(
+		cli.NewInventorySubcommand(),
+		injection.InjectLogger(genLogger.WithName("inventory")),
+		injection.InjectWorkspace(),
+	)
+	cmd.Short = "inventory lists group/version/kinds of apis in YAML with whether clients, CRDs and conversions are generated for them."
+	return cmd
+}
+
+func NewListKindsCommand() *cobra.Command {
+	cmd := plugin.NewCobraSubcommandOrDie(
+		cli.NewListKindsSubcommand(),
+		injection.InjectLogger(genLogger.WithName("list-kinds")),
+		injection.InjectWorkspace(),
+	)
+	cmd.Short = "list-kinds lists group kinds of apis found by the crd parser with whether they are root objects, without generating files."
+	return cmd
+}
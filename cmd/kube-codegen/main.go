@@ -18,16 +18,9 @@ import (
 	"fmt"
 	"os"
 
-	"github.com/zoumo/golib/log"
-	"github.com/zoumo/golib/log/consolog"
-
 	"github.com/zoumo/kube-codegen/cmd/kube-codegen/app"
 )
 
-func init() {
-	log.SetLogger(consolog.New())
-}
-
 func main() {
 	command := app.NewRootCommand()
 	if err := command.Execute(); err != nil {
@@ -5,21 +5,28 @@ go 1.15
 require (
 	github.com/dave/jennifer v1.5.0
 	github.com/go-logr/logr v0.4.0
+	github.com/gobuffalo/flect v0.2.2
 	github.com/gogo/protobuf v1.3.2 // indirect
 	github.com/golang/protobuf v1.5.2 // indirect
 	github.com/json-iterator/go v1.1.11 // indirect
 	github.com/otiai10/copy v1.5.0
+	github.com/pmezard/go-difflib v1.0.0
 	github.com/spf13/afero v1.9.5
 	github.com/spf13/cobra v1.1.3
 	github.com/spf13/pflag v1.0.5
+	github.com/stretchr/testify v1.7.0
 	github.com/zoumo/golib v0.0.0-20220223062151-794bff922af0
 	github.com/zoumo/goset v0.2.0
 	github.com/zoumo/make-rules v0.2.0
 	go.uber.org/multierr v1.7.0 // indirect
-	golang.org/x/mod v0.4.2 // indirect
+	golang.org/x/mod v0.4.2
 	golang.org/x/term v0.0.0-20210927222741-03fcf44c2211 // indirect
+	golang.org/x/tools v0.1.8
+	k8s.io/apiextensions-apiserver v0.20.2
+	k8s.io/apimachinery v0.20.2
 	k8s.io/gengo v0.0.0-20210813121822-485abfe95c7c
 	sigs.k8s.io/controller-tools v0.5.0
+	sigs.k8s.io/yaml v1.2.0
 )
 
 replace (
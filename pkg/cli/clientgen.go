@@ -49,6 +49,12 @@ func (c *clientgenSubCommand) BindFlags(fs *pflag.FlagSet) {
 }
 
 func (c *clientgenSubCommand) PreRun(args []string) error {
+	ws, err := c.genOptions.Workspace(c.Workspace)
+	if err != nil {
+		return err
+	}
+	c.Workspace = ws
+
 	if err := c.genOptions.SetDefault(c.Workspace); err != nil {
 		return err
 	}
@@ -58,7 +64,7 @@ func (c *clientgenSubCommand) PreRun(args []string) error {
 	}
 
 	if len(c.genOptions.clientPath) == 0 {
-		c.Logger.Info("You are about to generate clients,listers,informers without specifying --client-path")
+		c.Logger.Info("clients,listers,informers will be skipped without specifying --client-path")
 	}
 
 	return nil
@@ -81,7 +87,34 @@ func (c *clientgenSubCommand) Run(args []string) error {
 		c.genOptions.informersDirName,
 		c.genOptions.listersDirName,
 		c.genOptions.verbose,
-	)
+	).
+		WithGoBin(c.genOptions.goBin).
+		WithGeneratorVersions(c.genOptions.generatorVersions).
+		WithUsePathGenerators(c.genOptions.usePathGenerators).
+		WithGenDocs(c.genOptions.genDocs).
+		WithVerifyBuild(c.genOptions.verifyBuild).
+		WithCopyParallelism(c.genOptions.copyParallelism).
+		WithCleanOutputDirs(c.genOptions.cleanOutputDirs).
+		WithExcludeGeneratedFiles(c.genOptions.excludeGeneratedFiles).
+		WithCommit(c.genOptions.commit, c.genOptions.commitMessage).
+		WithInPlace(c.genOptions.inPlace).
+		WithStrict(c.genOptions.strict).
+		WithVerify(c.genOptions.verify, c.genOptions.verboseDiff).
+		WithClientContentType(c.genOptions.clientContentType).
+		WithClientUserAgent(c.genOptions.clientUserAgent).
+		WithGenRateLimit(c.genOptions.genRateLimit).
+		WithGenSerializer(c.genOptions.genSerializer).
+		WithGenInformerErrors(c.genOptions.genInformerErrors).
+		WithGenericListers(c.genOptions.genericListers).
+		WithSourceDateEpoch(c.genOptions.sourceDateEpoch).
+		WithHeaderVars(c.genOptions.headerVars).
+		WithApplyConfigurationPackage(c.genOptions.applyConfigurationPackage).
+		WithApplyMethods(c.genOptions.enableApplyMethods).
+		WithClientOnlyKinds(c.genOptions.clientOnlyKinds).
+		WithNonNamespacedKinds(c.genOptions.nonNamespacedKinds).
+		WithListerKeyFields(c.genOptions.listerKeyFields).
+		WithInformerDefaultResync(c.genOptions.informerDefaultResync).
+		WithClientInputBase(c.genOptions.clientInputBase)
 
 	// run all generators
 	return generator.Run(nil)
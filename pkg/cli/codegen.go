@@ -16,6 +16,9 @@ package cli
 
 import (
 	"fmt"
+	"go/token"
+	"path/filepath"
+	"strings"
 
 	"github.com/spf13/pflag"
 	"github.com/zoumo/golib/cli/injection"
@@ -46,6 +49,7 @@ func NewCodeGenSubcommand() plugin.Subcommand {
 		"informer",
 		"crd",
 		"protobuf",
+		"applyconfiguration",
 	}
 
 	return c
@@ -59,6 +63,49 @@ type codegenSubcommand struct {
 
 	genOptions    *genOptions
 	generatorsOpt []string
+
+	applyExternalTypes  []string
+	openapiExtraInputs  []string
+	openapiOnlyTypes    []string
+	openapiReportFormat string
+
+	conversionSkipUnsafe bool
+	conversionBuildTag   string
+	conversionTaggedOnly bool
+	conversionSubdir     string
+	scaffoldConversions  bool
+	genConversionScheme  bool
+	genConversionBench   bool
+	genEvents            bool
+	genAPIDocs           bool
+	genPriority          bool
+	genRoundTripTests    bool
+	genRefs              bool
+	genDynamic           bool
+	genAdapter           bool
+	noDepCheck           bool
+	installSchemeOnly    bool
+	installReturnError   bool
+	schemeAddMetav1      bool
+	installPackageName   string
+	skipGroupProtection  bool
+	crdYAML              bool
+	crdOnlyYAML          bool
+	crdSingleFile        string
+	crdAggregateOnly     bool
+	crdConversionNone    bool
+	crdPreserveOrder     bool
+	crdServedOpt         []string
+	crdStorageOpt        []string
+	crdServed            map[string]bool
+	crdStorage           map[string]bool
+	crdMaxDepth          int
+	crdMaxDescLen        int
+	keepStaleProtobuf    bool
+	protoTempDir         string
+
+	codeGeneratedTemplate string
+	trimPathPrefix        string
 }
 
 func (c *codegenSubcommand) Name() string {
@@ -68,10 +115,54 @@ func (c *codegenSubcommand) Name() string {
 func (c *codegenSubcommand) BindFlags(fs *pflag.FlagSet) {
 	// project args
 	c.genOptions.BindFlags(fs)
+	fs.BoolVar(&c.conversionSkipUnsafe, "conversion-skip-unsafe", false, "if true, conversion-gen will not generate unsafe conversions that rely on identical memory layouts")
+	fs.StringVar(&c.conversionBuildTag, "conversion-build-tag", c.conversionBuildTag, "the build tag forwarded to conversion-gen, it is required when the types files of input packages are gated by a non-default build tag. Generated conversions are gated by the same tag. It takes a single tag, because conversion-gen parses files with only the one tag of its --build-tag")
+	fs.BoolVar(&c.conversionTaggedOnly, "conversion-tagged-only", false, "if true, conversion generator will only keep conversions of types tagged with +k8s:conversion-gen=true and of types they depend on, instead of all types in packages tagged with +k8s:conversion-gen. The tag must be put in the comment block above the doc comment of the type, since conversion-gen only accepts false in doc comments")
+	fs.StringVar(&c.conversionSubdir, "conversion-output-subdir", c.conversionSubdir, "the subdir of each version package to write conversions into, (e.g. conversions). The subpackage registers conversions by RegisterConversions and AddToScheme instead of the types package, and install packages add it to scheme. If it is empty, conversions are written into the version package")
+	fs.StringSliceVar(&c.applyExternalTypes, "apply-external-types", nil, "comma-separated list of third-party types mapped to their apply configuration packages in <type-package>/<Kind>=<applyconfiguration-package> form, (e.g. k8s.io/api/core/v1/PodSpec=k8s.io/client-go/applyconfigurations/core/v1). applyconfiguration generator references them instead of generating apply configurations for them")
+	fs.BoolVar(&c.genConversionScheme, "gen-conversion-scheme", false, "if true, conversion generator will generate zz_generated.conversion_scheme.go along with generated conversions, with AddConversionsToScheme registering them with a scheme explicitly")
+	fs.BoolVar(&c.genConversionBench, "gen-conversion-benchmarks", false, "if true, conversion generator will generate conversion_bench_test.go along with generated conversions, with a Benchmark_Convert_* function running each of them on a fuzzed object by go test -bench")
+	fs.BoolVar(&c.scaffoldConversions, "scaffold-manual-conversions", false, "if true, scaffold stubs with TODO of conversion functions which conversion-gen can not generate into conversion.go of the package, so that the build compiles")
+	fs.BoolVar(&c.installSchemeOnly, "install-scheme-only", false, "if true, install generator will only generate the top-level install package installing all groups, and skip install packages of each group")
+	fs.BoolVar(&c.installReturnError, "install-return-error", false, "if true, install generator will additionally generate InstallOrError in install packages, which returns errors of AddToScheme instead of panicking like Install")
+	fs.BoolVar(&c.schemeAddMetav1, "scheme-add-metav1", false, "if true, install generator will call metav1.AddToGroupVersion for each group version in install packages, which is required by apiservers serving list and watch")
+	fs.StringVar(&c.installPackageName, "install-package-name", c.installPackageName, "the go package name and directory name of install packages generated by install generator, e.g. scheme. (default \"install\")")
+	fs.BoolVar(&c.genEvents, "gen-events", false, "if true, install generator will generate event recorder helper NewRecorder for each group")
+	fs.BoolVar(&c.genPriority, "gen-priority", false, "if true, install generator will generate PrioritizedVersionsAllGroups returning installed group versions sorted by priority, stable before beta before alpha")
+	fs.BoolVar(&c.genRoundTripTests, "gen-roundtrip-tests", false, "if true, install generator will generate roundtrip_test.go for each group which fuzzes serialization of types installed by Install")
+	fs.BoolVar(&c.genRefs, "gen-refs", false, "if true, install generator will generate zz.generated.refs.go in each group version package with RefTo<Kind> and ObjectRefTo<Kind> building OwnerReference and ObjectReference to objects of each kind by SchemeGroupVersion, it requires k8s.io/api")
+	fs.BoolVar(&c.genDynamic, "gen-dynamic", false, "if true, informer generator will generate dynamic.go in informers package with GroupVersionResource and dynamicinformer backed informer of each kind, for kinds not registered in scheme")
+	fs.BoolVar(&c.genAdapter, "gen-unstructured-adapter", false, "if true, client generator will generate adapter.go in clientset package with FromUnstructured and ToUnstructured helpers of each kind for users of dynamic client")
+	fs.StringSliceVar(&c.openapiExtraInputs, "openapi-extra-inputs", nil, "comma-separated list of packages appended to input dirs of openapi generator besides the apimachinery packages, e.g. k8s.io/api/core/v1 referenced by types of apis. They must be resolvable by go list in the workspace")
+	fs.StringSliceVar(&c.openapiOnlyTypes, "openapi-only-types", nil, "comma-separated list of types whose definitions and the definitions they reference transitively are retained in generated GetOpenAPIDefinitions, (e.g. github.com/example/project/pkg/apis/apps/v1.Foo). Empty means all definitions")
+	fs.StringVar(&c.openapiReportFormat, "openapi-report-format", codegen.OpenapiReportFormatText, "the format of violations.report written by openapi generator, one of text|json. json writes a JSON array of {type, rule, message} objects of API rule violations for machine parsing")
+	fs.BoolVar(&c.crdYAML, "crd-yaml", false, "if true, crd generator will generate CRD YAML manifests in <apis-path>/<group>/crds along with the go constructors")
+	fs.BoolVar(&c.crdOnlyYAML, "crd-only-yaml", false, "if true, crd generator will only regenerate CRD YAML manifests and skip the go constructors, it is useful when only markers changed")
+	fs.StringVar(&c.crdSingleFile, "crd-single-file", c.crdSingleFile, "the path relative to workspace of a single multi-document YAML file, (e.g. charts/example/crds/crds.yaml), into which CRD YAML manifests of all groups are written sorted by group and kind, instead of a file per CRD. It requires --crd-yaml or --crd-only-yaml")
+	fs.BoolVar(&c.genAPIDocs, "gen-api-docs", false, "if true, crd generator will generate types.md in <apis-path>/<group> listing kinds and their fields, json tags and validation markers, for API documentation")
+	fs.BoolVar(&c.crdAggregateOnly, "crd-aggregate-only", false, "if true, crd generator will only generate NewCustomResourceDefinitions in go constructors, and skip the exported New<Kind>CRD functions")
+	fs.BoolVar(&c.crdConversionNone, "crd-force-conversion-none", false, "if true, crd generator will set conversion strategy of all CRDs to None instead of the inferred strategy, it is useful during initial bring-up of multi-version CRDs")
+	fs.BoolVar(&c.skipGroupProtection, "skip-group-protection", false, "if true, crd generator will not annotate CRDs of *.k8s.io and *.kubernetes.io groups with api-approved.kubernetes.io, it is useful for internal groups in disconnected clusters")
+	fs.BoolVar(&c.crdPreserveOrder, "crd-preserve-version-order", false, "if true, crd generator will keep versions of CRDs in the order of discovered or requested group versions instead of the order sorted by controller-tools")
+	fs.StringArrayVar(&c.crdServedOpt, "crd-served", c.crdServedOpt, "override served of a CRD version set by markers in group/version=bool form, (e.g. apps.example.com/v1=false). It can be specified multiple times")
+	fs.StringArrayVar(&c.crdStorageOpt, "crd-storage", c.crdStorageOpt, "override storage of a CRD version set by markers in group/version=bool form, (e.g. apps.example.com/v2=true). Every overridden CRD must have exactly one storage version. It can be specified multiple times")
+	fs.IntVar(&c.crdMaxDepth, "crd-max-depth", 0, "the maximum nesting depth of CRD validation schemas, deeper subtrees are replaced with x-kubernetes-preserve-unknown-fields. 0 means no limit")
+	fs.IntVar(&c.crdMaxDescLen, "crd-max-desc-len", -1, "the maximum length of field descriptions in CRD validation schemas, longer descriptions are truncated to keep CRDs under the size limit of etcd. 0 drops descriptions, negative means no truncation")
+	fs.StringVar(&c.codeGeneratedTemplate, "code-generated-template", c.codeGeneratedTemplate, "go template of the 'Code generated' comment in files generated by crd and install generators, {{.Generator}}, {{.Date}} and {{.Version}} are available. (default \"// Code generated by {{.Generator}}. DO NOT EDIT.\")")
+	fs.StringVar(&c.trimPathPrefix, "trim-path-prefix", c.trimPathPrefix, "the path prefix trimmed from files generated by deepcopy, defaulter and conversion generators, e.g. GOPATH or the workspace, so that generated files are reproducible across machines")
+	fs.BoolVar(&c.keepStaleProtobuf, "keep-stale-protobuf", false, "if true, existing generated.pb.go and generated.proto will not be removed before running protobuf generator")
+	fs.StringVar(&c.protoTempDir, "proto-temp-dir", c.protoTempDir, "the dir in which protobuf generator creates the temp dir to link all modules, it should be a large enough volume. (default to the system temp dir)")
+	fs.BoolVar(&c.noDepCheck, "no-dep-check", false, "if true, skip checking that conversion and protobuf generators run with deepcopy or generated deepcopy files already exist")
 	fs.StringSliceVar(&c.generatorsOpt, "generators", nil, fmt.Sprintf("comma-separated list of generators. generater prefixed with '-' are not generated, generator prefixed with '+' will be generated additionally. e.g. -crd will disable crd generator.  (default generators, enabled: %v, disabled: %v)", c.enabledGenerators, c.disabledGenerators))
 }
 
 func (c *codegenSubcommand) PreRun(args []string) error {
+	ws, err := c.genOptions.Workspace(c.Workspace)
+	if err != nil {
+		return err
+	}
+	c.Workspace = ws
+
 	if err := c.genOptions.SetDefault(c.Workspace); err != nil {
 		return err
 	}
@@ -79,15 +170,76 @@ func (c *codegenSubcommand) PreRun(args []string) error {
 	sorted := codegen.EnabledGenerators(c.enabledGenerators, c.disabledGenerators, c.generatorsOpt)
 	enabled := goset.NewSetFromStrings(sorted)
 	if enabled.ContainsAny("client", "lister", "informer") && len(c.genOptions.clientPath) == 0 {
-		if len(c.genOptions.clientPath) == 0 {
-			c.Logger.Info("You are about to generate clients,listers,informers without specifying --client-path")
-		}
+		c.Logger.Info("clients,listers,informers will be skipped without specifying --client-path")
 	}
 
 	if err := c.genOptions.Validate(); err != nil {
 		return err
 	}
 
+	for _, mapping := range c.applyExternalTypes {
+		if _, _, err := codegen.ParseApplyExternalType(mapping); err != nil {
+			return fmt.Errorf("invalid --apply-external-types, err: %v", err)
+		}
+	}
+
+	if len(c.conversionSubdir) > 0 {
+		if !token.IsIdentifier(c.conversionSubdir) {
+			return fmt.Errorf("invalid --conversion-output-subdir %v, it must be a dir name which is a valid go package name", c.conversionSubdir)
+		}
+		if c.scaffoldConversions {
+			return fmt.Errorf("--conversion-output-subdir and --scaffold-manual-conversions are mutually exclusive")
+		}
+	}
+
+	if len(c.openapiExtraInputs) > 0 {
+		pkgs, err := listPackages(c.genOptions.goBin, c.Workspace, c.openapiExtraInputs)
+		if err != nil {
+			return fmt.Errorf("invalid --openapi-extra-inputs, err: %v", err)
+		}
+		c.openapiExtraInputs = pkgs
+	}
+
+	if c.crdServed, err = codegen.ParseCRDVersionOverrides(c.crdServedOpt); err != nil {
+		return fmt.Errorf("invalid --crd-served, err: %v", err)
+	}
+	if c.crdStorage, err = codegen.ParseCRDVersionOverrides(c.crdStorageOpt); err != nil {
+		return fmt.Errorf("invalid --crd-storage, err: %v", err)
+	}
+
+	for _, t := range c.openapiOnlyTypes {
+		if i := strings.LastIndex(t, "."); i <= strings.LastIndex(t, "/") || i == len(t)-1 {
+			return fmt.Errorf("invalid --openapi-only-types %v, it must be in <package>.<Type> form", t)
+		}
+	}
+
+	switch c.openapiReportFormat {
+	case codegen.OpenapiReportFormatText, codegen.OpenapiReportFormatJSON:
+	default:
+		return fmt.Errorf("--openapi-report-format must be one of text|json")
+	}
+
+	if len(c.crdSingleFile) > 0 {
+		if !c.crdYAML && !c.crdOnlyYAML {
+			return fmt.Errorf("--crd-single-file requires --crd-yaml or --crd-only-yaml")
+		}
+		clean := filepath.ToSlash(filepath.Clean(c.crdSingleFile))
+		if filepath.IsAbs(c.crdSingleFile) || clean == ".." || strings.HasPrefix(clean, "../") {
+			return fmt.Errorf("invalid --crd-single-file %v, it must be a path relative to workspace and in it", c.crdSingleFile)
+		}
+		c.crdSingleFile = filepath.Clean(c.crdSingleFile)
+	}
+
+	if c.crdMaxDepth < 0 {
+		return fmt.Errorf("invalid --crd-max-depth %d, it must not be negative", c.crdMaxDepth)
+	}
+
+	if len(c.protoTempDir) > 0 {
+		if err := checkWritableDir(c.protoTempDir); err != nil {
+			return fmt.Errorf("invalid --proto-temp-dir, err: %v", err)
+		}
+	}
+
 	return nil
 }
 
@@ -108,7 +260,71 @@ func (c *codegenSubcommand) Run(args []string) error {
 		c.genOptions.informersDirName,
 		c.genOptions.listersDirName,
 		c.genOptions.verbose,
-	)
+	).
+		WithGoBin(c.genOptions.goBin).
+		WithGeneratorVersions(c.genOptions.generatorVersions).
+		WithUsePathGenerators(c.genOptions.usePathGenerators).
+		WithGenDocs(c.genOptions.genDocs).
+		WithVerifyBuild(c.genOptions.verifyBuild).
+		WithCopyParallelism(c.genOptions.copyParallelism).
+		WithCleanOutputDirs(c.genOptions.cleanOutputDirs).
+		WithExcludeGeneratedFiles(c.genOptions.excludeGeneratedFiles).
+		WithCommit(c.genOptions.commit, c.genOptions.commitMessage).
+		WithInPlace(c.genOptions.inPlace).
+		WithStrict(c.genOptions.strict).
+		WithVerify(c.genOptions.verify, c.genOptions.verboseDiff).
+		WithClientContentType(c.genOptions.clientContentType).
+		WithClientUserAgent(c.genOptions.clientUserAgent).
+		WithGenRateLimit(c.genOptions.genRateLimit).
+		WithGenSerializer(c.genOptions.genSerializer).
+		WithGenInformerErrors(c.genOptions.genInformerErrors).
+		WithGenericListers(c.genOptions.genericListers).
+		WithApplyConfigurationPackage(c.genOptions.applyConfigurationPackage).
+		WithApplyMethods(c.genOptions.enableApplyMethods).
+		WithApplyExternalTypes(c.applyExternalTypes).
+		WithClientOnlyKinds(c.genOptions.clientOnlyKinds).
+		WithNonNamespacedKinds(c.genOptions.nonNamespacedKinds).
+		WithListerKeyFields(c.genOptions.listerKeyFields).
+		WithInformerDefaultResync(c.genOptions.informerDefaultResync).
+		WithClientInputBase(c.genOptions.clientInputBase).
+		WithCRDVersion(c.genOptions.crdVersionAnnotation, c.genOptions.crdVersion).
+		WithConversionSkipUnsafe(c.conversionSkipUnsafe).
+		WithConversionBuildTag(c.conversionBuildTag).
+		WithConversionTaggedOnly(c.conversionTaggedOnly).
+		WithConversionSubdir(c.conversionSubdir).
+		WithScaffoldManualConversions(c.scaffoldConversions).
+		WithGenConversionScheme(c.genConversionScheme).
+		WithGenConversionBenchmarks(c.genConversionBench).
+		WithGenEvents(c.genEvents).
+		WithGenAPIDocs(c.genAPIDocs).
+		WithGenPriority(c.genPriority).
+		WithGenRoundTripTests(c.genRoundTripTests).
+		WithGenRefs(c.genRefs).
+		WithOpenapiExtraInputs(c.openapiExtraInputs).
+		WithOpenapiOnlyTypes(c.openapiOnlyTypes).
+		WithOpenapiReportFormat(c.openapiReportFormat).
+		WithGenDynamic(c.genDynamic).
+		WithGenUnstructuredAdapter(c.genAdapter).
+		WithNoDepCheck(c.noDepCheck).
+		WithInstallSchemeOnly(c.installSchemeOnly).
+		WithInstallReturnError(c.installReturnError).
+		WithSchemeAddMetav1(c.schemeAddMetav1).
+		WithInstallPackageName(c.installPackageName).
+		WithCRDYAML(c.crdYAML, c.crdOnlyYAML).
+		WithCRDSingleFile(c.crdSingleFile).
+		WithCRDAggregateOnly(c.crdAggregateOnly).
+		WithCRDForceConversionNone(c.crdConversionNone).
+		WithCRDPreserveVersionOrder(c.crdPreserveOrder).
+		WithCRDVersionOverrides(c.crdServed, c.crdStorage).
+		WithCRDMaxDepth(c.crdMaxDepth).
+		WithCRDMaxDescLen(c.crdMaxDescLen).
+		WithCRDSkipGroupProtection(c.skipGroupProtection).
+		WithCodeGeneratedTemplate(c.codeGeneratedTemplate).
+		WithTrimPathPrefix(c.trimPathPrefix).
+		WithSourceDateEpoch(c.genOptions.sourceDateEpoch).
+		WithHeaderVars(c.genOptions.headerVars).
+		WithKeepStaleProtobuf(c.keepStaleProtobuf).
+		WithProtoTempDir(c.protoTempDir)
 
 	return generator.Run(c.generatorsOpt)
 }
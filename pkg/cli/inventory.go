@@ -0,0 +1,215 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"fmt"
+	"go/ast"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"github.com/zoumo/golib/cli/injection"
+	"github.com/zoumo/golib/cli/plugin"
+	"golang.org/x/tools/go/packages"
+	crdmarkers "sigs.k8s.io/controller-tools/pkg/crd/markers"
+	"sigs.k8s.io/controller-tools/pkg/loader"
+	"sigs.k8s.io/controller-tools/pkg/markers"
+	"sigs.k8s.io/yaml"
+)
+
+// markers inspected by inventory besides the crd markers
+var inventoryMarkers = []*markers.Definition{
+	markers.Must(markers.MakeDefinition("genclient", markers.DescribesType, struct{}{})),
+	markers.Must(markers.MakeDefinition("genclient:nonNamespaced", markers.DescribesType, struct{}{})),
+	markers.Must(markers.MakeDefinition("k8s:conversion-gen", markers.DescribesPackage, "")),
+	markers.Must(markers.MakeDefinition("k8s:conversion-gen", markers.DescribesType, false)),
+}
+
+// Inventory lists group/version/kinds of apis and what is generated for them.
+type Inventory struct {
+	Repo      string              `json:"repo"`
+	Resources []InventoryResource `json:"resources"`
+}
+
+// InventoryResource is a group/version/kind in Inventory.
+type InventoryResource struct {
+	Group      string `json:"group"`
+	Version    string `json:"version"`
+	Kind       string `json:"kind"`
+	Path       string `json:"path"`
+	Namespaced bool   `json:"namespaced"`
+	// Client is true if clients, listers and informers are generated, the kind has +genclient
+	Client bool `json:"client"`
+	// CRD is true if CustomResourceDefinition is generated, the kind is in local module
+	// and its package is not marked with +kubebuilder:skip
+	CRD bool `json:"crd"`
+	// Conversion is true if conversions are generated, the package has +k8s:conversion-gen
+	Conversion bool `json:"conversion"`
+}
+
+func NewInventorySubcommand() plugin.Subcommand {
+	return &inventorySubcommand{
+		DefaultInjectionMixin: injection.NewDefaultInjectionMixin(),
+		genOptions:            &genOptions{},
+	}
+}
+
+type inventorySubcommand struct {
+	*injection.DefaultInjectionMixin
+
+	genOptions *genOptions
+
+	output string
+}
+
+func (c *inventorySubcommand) Name() string {
+	return "inventory"
+}
+
+func (c *inventorySubcommand) BindFlags(fs *pflag.FlagSet) {
+	c.genOptions.BindFlags(fs)
+	fs.StringVarP(&c.output, "output", "o", c.output, "the file to write the inventory YAML to. (default to stdout)")
+}
+
+func (c *inventorySubcommand) PreRun(args []string) error {
+	ws, err := c.genOptions.Workspace(c.Workspace)
+	if err != nil {
+		return err
+	}
+	c.Workspace = ws
+
+	if err := c.genOptions.SetDefault(c.Workspace); err != nil {
+		return err
+	}
+	if len(c.genOptions.module) == 0 {
+		return fmt.Errorf("--repo must be specified")
+	}
+	if len(c.genOptions.inputPackages) == 0 {
+		return fmt.Errorf("no apis package found in %v", path.Join(c.genOptions.apisModule, c.genOptions.apisPath))
+	}
+	return nil
+}
+
+func (c *inventorySubcommand) Run(args []string) error {
+	roots, err := loader.LoadRootsWithConfig(&packages.Config{Dir: c.Workspace}, c.genOptions.inputPackages...)
+	if err != nil {
+		return err
+	}
+	inventory, err := buildInventory(c.genOptions.module, roots)
+	if err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(inventory)
+	if err != nil {
+		return err
+	}
+	if len(c.output) == 0 {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	c.Logger.Info("writing inventory", "file", c.output)
+	return ioutil.WriteFile(c.output, data, 0644)
+}
+
+// buildInventory inspects markers of types in roots, and lists types embedding
+// metav1.TypeMeta and metav1.ObjectMeta as kinds, sorted by group, version and
+// kind. Only the syntax of roots is loaded.
+func buildInventory(module string, roots []*loader.Package) (*Inventory, error) {
+	registry := &markers.Registry{}
+	if err := crdmarkers.Register(registry); err != nil {
+		return nil, err
+	}
+	for _, def := range inventoryMarkers {
+		if err := registry.Register(def); err != nil {
+			return nil, err
+		}
+	}
+	collector := &markers.Collector{Registry: registry}
+
+	inventory := &Inventory{Repo: module, Resources: []InventoryResource{}}
+	for _, root := range roots {
+		pkgMarkers, err := markers.PackageMarkers(collector, root)
+		if err != nil {
+			return nil, err
+		}
+		group := path.Base(path.Dir(root.PkgPath))
+		if groupName, ok := pkgMarkers.Get("groupName").(string); ok && groupName != "" {
+			group = groupName
+		}
+		conversionPkg, _ := pkgMarkers.Get("k8s:conversion-gen").(string)
+		crd := (root.PkgPath == module || strings.HasPrefix(root.PkgPath, module+"/")) && pkgMarkers.Get("kubebuilder:skip") == nil
+
+		err = markers.EachType(collector, root, func(info *markers.TypeInfo) {
+			if !isKubeKind(info) {
+				return
+			}
+			conversion := conversionPkg != "" && conversionPkg != "false"
+			if skip, ok := info.Markers.Get("k8s:conversion-gen").(bool); ok && !skip {
+				conversion = false
+			}
+			inventory.Resources = append(inventory.Resources, InventoryResource{
+				Group:      group,
+				Version:    path.Base(root.PkgPath),
+				Kind:       info.Name,
+				Path:       root.PkgPath,
+				Namespaced: info.Markers.Get("genclient:nonNamespaced") == nil,
+				Client:     info.Markers.Get("genclient") != nil,
+				CRD:        crd,
+				Conversion: conversion,
+			})
+		})
+		if err != nil {
+			return nil, err
+		}
+		if errs := root.Errors; len(errs) > 0 {
+			return nil, fmt.Errorf("failed to load package %v: %v", root.PkgPath, errs[0])
+		}
+	}
+
+	sort.Slice(inventory.Resources, func(i, j int) bool {
+		a, b := inventory.Resources[i], inventory.Resources[j]
+		if a.Group != b.Group {
+			return a.Group < b.Group
+		}
+		if a.Version != b.Version {
+			return a.Version < b.Version
+		}
+		return a.Kind < b.Kind
+	})
+	return inventory, nil
+}
+
+// isKubeKind returns true if the struct embeds TypeMeta and has a field of
+// ObjectMeta, as crd.FindKubeKinds does without type checking.
+func isKubeKind(info *markers.TypeInfo) bool {
+	hasTypeMeta, hasObjectMeta := false, false
+	for _, field := range info.Fields {
+		sel, ok := field.RawField.Type.(*ast.SelectorExpr)
+		if !ok {
+			continue
+		}
+		switch {
+		case sel.Sel.Name == "TypeMeta" && field.Name == "":
+			hasTypeMeta = true
+		case sel.Sel.Name == "ObjectMeta":
+			hasObjectMeta = true
+		}
+	}
+	return hasTypeMeta && hasObjectMeta
+}
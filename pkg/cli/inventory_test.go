@@ -0,0 +1,62 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/controller-tools/pkg/loader"
+	"sigs.k8s.io/yaml"
+)
+
+func Test_buildInventory(t *testing.T) {
+	roots, err := loader.LoadRoots("./testdata/inventory/apps/v1beta1", "./testdata/inventory/apps/v1")
+	assert.NoError(t, err)
+
+	module := "github.com/zoumo/kube-codegen"
+	got, err := buildInventory(module, roots)
+	assert.NoError(t, err)
+
+	v1 := module + "/pkg/cli/testdata/inventory/apps/v1"
+	v1beta1 := module + "/pkg/cli/testdata/inventory/apps/v1beta1"
+	assert.Equal(t, &Inventory{
+		Repo: module,
+		Resources: []InventoryResource{
+			{Group: "apps.example.com", Version: "v1", Kind: "Bar", Path: v1, Namespaced: false, Client: true, CRD: true},
+			{Group: "apps.example.com", Version: "v1", Kind: "Foo", Path: v1, Namespaced: true, Client: true, CRD: true},
+			{Group: "apps.example.com", Version: "v1beta1", Kind: "Baz", Path: v1beta1, Namespaced: true, CRD: true},
+			{Group: "apps.example.com", Version: "v1beta1", Kind: "Foo", Path: v1beta1, Namespaced: true, CRD: true, Conversion: true},
+		},
+	}, got)
+
+	// remote apis have no CRD generated
+	remote, err := buildInventory("github.com/example/project", roots)
+	assert.NoError(t, err)
+	for _, r := range remote.Resources {
+		assert.False(t, r.CRD)
+	}
+
+	// output is stable
+	want, err := yaml.Marshal(got)
+	assert.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		again, err := buildInventory(module, roots)
+		assert.NoError(t, err)
+		data, err := yaml.Marshal(again)
+		assert.NoError(t, err)
+		assert.Equal(t, string(want), string(data))
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/types"
+	"io"
+	"os"
+	"path"
+	"runtime"
+	"sort"
+
+	"github.com/spf13/pflag"
+	"github.com/zoumo/golib/cli/injection"
+	"github.com/zoumo/golib/cli/plugin"
+	"golang.org/x/tools/go/packages"
+	"sigs.k8s.io/controller-tools/pkg/crd"
+	crdmarkers "sigs.k8s.io/controller-tools/pkg/crd/markers"
+	"sigs.k8s.io/controller-tools/pkg/loader"
+	"sigs.k8s.io/controller-tools/pkg/markers"
+)
+
+const (
+	listKindsOutputText = "text"
+	listKindsOutputJSON = "json"
+)
+
+// objectRootMarker marks types which are root objects of apis.
+var objectRootMarker = markers.Must(markers.MakeDefinition("kubebuilder:object:root", markers.DescribesType, false))
+
+// KubeKind is a group kind of apis found by the crd parser.
+type KubeKind struct {
+	Group string `json:"group"`
+	Kind  string `json:"kind"`
+	// Root is true if the kind is marked with +kubebuilder:object:root in any version
+	Root bool `json:"root"`
+}
+
+func NewListKindsSubcommand() plugin.Subcommand {
+	return &listKindsSubcommand{
+		DefaultInjectionMixin: injection.NewDefaultInjectionMixin(),
+		genOptions:            &genOptions{},
+	}
+}
+
+type listKindsSubcommand struct {
+	*injection.DefaultInjectionMixin
+
+	genOptions *genOptions
+
+	output string
+}
+
+func (c *listKindsSubcommand) Name() string {
+	return "list-kinds"
+}
+
+func (c *listKindsSubcommand) BindFlags(fs *pflag.FlagSet) {
+	c.genOptions.BindFlags(fs)
+	fs.StringVarP(&c.output, "output", "o", listKindsOutputText, "output format, one of text|json. text prints '<group> <kind> <root>' per line")
+}
+
+func (c *listKindsSubcommand) PreRun(args []string) error {
+	ws, err := c.genOptions.Workspace(c.Workspace)
+	if err != nil {
+		return err
+	}
+	c.Workspace = ws
+
+	switch c.output {
+	case listKindsOutputText, listKindsOutputJSON:
+	default:
+		return fmt.Errorf("--output must be one of text|json")
+	}
+	if err := c.genOptions.SetDefault(c.Workspace); err != nil {
+		return err
+	}
+	if len(c.genOptions.module) == 0 {
+		return fmt.Errorf("--repo must be specified")
+	}
+	if len(c.genOptions.inputPackages) == 0 {
+		return fmt.Errorf("no apis package found in %v", path.Join(c.genOptions.apisModule, c.genOptions.apisPath))
+	}
+	return nil
+}
+
+func (c *listKindsSubcommand) Run(args []string) error {
+	roots, err := loader.LoadRootsWithConfig(&packages.Config{Dir: c.Workspace}, c.genOptions.inputPackages...)
+	if err != nil {
+		return err
+	}
+	kinds, err := listKubeKinds(roots)
+	if err != nil {
+		return err
+	}
+	return writeKubeKinds(os.Stdout, kinds, c.output)
+}
+
+// listKubeKinds finds kinds in roots by crd.FindKubeKinds with type checking,
+// sorted by group and kind.
+func listKubeKinds(roots []*loader.Package) ([]KubeKind, error) {
+	registry := &markers.Registry{}
+	if err := crdmarkers.Register(registry); err != nil {
+		return nil, err
+	}
+	if err := registry.Register(objectRootMarker); err != nil {
+		return nil, err
+	}
+	parser := &crd.Parser{
+		Collector: &markers.Collector{Registry: registry},
+		Checker:   &loader.TypeChecker{},
+	}
+	crd.AddKnownTypes(parser)
+	setTypesSizes(roots)
+	for _, root := range roots {
+		parser.NeedPackage(root)
+	}
+
+	kinds := []KubeKind{}
+	metav1Pkg := crd.FindMetav1(roots)
+	if metav1Pkg == nil {
+		// no objects in the roots, since nothing imported metav1
+		return kinds, nil
+	}
+	kubeKinds := crd.FindKubeKinds(parser, metav1Pkg)
+	for _, root := range roots {
+		if errs := root.Errors; len(errs) > 0 {
+			return nil, fmt.Errorf("failed to load package %v: %v", root.PkgPath, errs[0])
+		}
+	}
+	for groupKind := range kubeKinds {
+		kind := KubeKind{Group: groupKind.Group, Kind: groupKind.Kind}
+		for ident, info := range parser.Types {
+			if ident.Name != groupKind.Kind || parser.GroupVersions[ident.Package].Group != groupKind.Group {
+				continue
+			}
+			if root, ok := info.Markers.Get(objectRootMarker.Name).(bool); ok && root {
+				kind.Root = true
+			}
+		}
+		kinds = append(kinds, kind)
+	}
+	sort.Slice(kinds, func(i, j int) bool {
+		if kinds[i].Group != kinds[j].Group {
+			return kinds[i].Group < kinds[j].Group
+		}
+		return kinds[i].Kind < kinds[j].Kind
+	})
+	return kinds, nil
+}
+
+// setTypesSizes sets sizes of roots and the packages they import for type
+// checking, the loader does not load them and go/types can not evaluate
+// constants depending on sizes without them.
+func setTypesSizes(roots []*loader.Package) {
+	sizes := types.SizesFor("gc", runtime.GOARCH)
+	pkgs := make([]*packages.Package, 0, len(roots))
+	for _, root := range roots {
+		pkgs = append(pkgs, root.Package)
+	}
+	packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+		// sizes are nil *types.StdSizes if they are not loaded
+		if std, ok := pkg.TypesSizes.(*types.StdSizes); pkg.TypesSizes == nil || ok && std == nil {
+			pkg.TypesSizes = sizes
+		}
+	})
+}
+
+// writeKubeKinds writes kinds to w in output format.
+func writeKubeKinds(w io.Writer, kinds []KubeKind, output string) error {
+	if output == listKindsOutputJSON {
+		data, err := json.MarshalIndent(kinds, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	}
+	for _, kind := range kinds {
+		if _, err := fmt.Fprintf(w, "%s %s %t\n", kind.Group, kind.Kind, kind.Root); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/controller-tools/pkg/loader"
+)
+
+func Test_listKubeKinds(t *testing.T) {
+	roots, err := loader.LoadRoots("./testdata/listkinds/batch/v1", "./testdata/listkinds/apps/v1")
+	assert.NoError(t, err)
+
+	got, err := listKubeKinds(roots)
+	assert.NoError(t, err)
+	want := []KubeKind{
+		{Group: "apps.example.com", Kind: "Bar"},
+		{Group: "apps.example.com", Kind: "Foo", Root: true},
+		{Group: "batch.example.com", Kind: "Job", Root: true},
+	}
+	assert.Equal(t, want, got)
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, writeKubeKinds(buf, got, listKindsOutputText))
+	assert.Equal(t, "apps.example.com Bar false\napps.example.com Foo true\nbatch.example.com Job true\n", buf.String())
+
+	buf.Reset()
+	assert.NoError(t, writeKubeKinds(buf, got, listKindsOutputJSON))
+	decoded := []KubeKind{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, want, decoded)
+}
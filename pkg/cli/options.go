@@ -17,32 +17,81 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/fs"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/spf13/afero"
 	"github.com/spf13/pflag"
 	"github.com/zoumo/goset"
 	"github.com/zoumo/make-rules/pkg/runner"
+
+	"github.com/zoumo/kube-codegen/pkg/codegen"
 )
 
 var (
-	versionRegexp = regexp.MustCompile("^v(0|[1-9][0-9]*)((alpha|beta)(0|[1-9][0-9]*))?$")
+	versionRegexp   = regexp.MustCompile("^v(0|[1-9][0-9]*)((alpha|beta)(0|[1-9][0-9]*))?$")
+	groupNameRegexp = regexp.MustCompile(`(?m)^//\s*\+groupName=(\S+)`)
 )
 
 type genOptions struct {
+	workspace            string
 	module               string
 	boilerplatePath      string
 	apisPath             string
 	clientPath           string
+	clientInternal       bool
 	groupVersionsOpt     []string
+	packagesOpt          []string
 	codeGeneratorVersion string
+	goBin                string
+	genDocs              bool
+	verifyBuild          bool
+	copyParallelism      int
+	cleanOutputDirs      bool
+	usePathGenerators    bool
+	inPlace              bool
+	strict               bool
+	verify               bool
+	verboseDiff          bool
+	sourceDateEpoch      int64
+	crdVersionAnnotation string
+	crdVersion           string
+
+	applyConfigurationPackage string
+	enableApplyMethods        bool
+	clientOnlyKinds           []string
+	nonNamespacedKinds        []string
+	listerKeyFields           []string
+	informerDefaultResync     time.Duration
+	clientInputBase           string
+	clientContentType         string
+	clientUserAgent           string
+	genRateLimit              bool
+	genSerializer             bool
+	genInformerErrors         bool
+	genericListers            bool
+	excludeGeneratedFiles     []string
+	commit                    bool
+	commitMessage             string
+
+	apisModulesOpt       []string
+	apisPathsOpt         []string
+	headerVarsOpt        []string
+	generatorVersionsOpt []string
+	// extraAPIs are apis sources besides apisModule and apisPath
+	extraAPIs []apisSource
 
 	apisModule            string
+	headerVars            map[string]string
+	generatorVersions     map[string]string
 	inputPackages         []string
 	inputInternalPackages []string
 	clientsetDirName      string
@@ -52,32 +101,141 @@ type genOptions struct {
 }
 
 func (c *genOptions) BindFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&c.workspace, "workspace", c.workspace, "the root dir of go module to generate files in. If it is empty, kube-codegen will use current working dir")
 	fs.StringVar(&c.module, "module", c.module, "generated files go module. If it is empty. kube-codegen will read it from go.mod")
 	fs.StringVar(&c.boilerplatePath, "go-header-file", c.boilerplatePath, "go header file path")
+	fs.StringArrayVar(&c.headerVarsOpt, "header-var", c.headerVarsOpt, "variable in key=value form substituted for {{.<key>}} in go header file, along with YEAR, (e.g. Company=Example). in files generated by all generators. It can be specified multiple times")
 	fs.StringVar(&c.codeGeneratorVersion, "code-generator-version", "", "k8s.io/code-generator version. If it is empty, kube-codegen will find the version from go mod")
-	fs.StringVar(&c.apisModule, "apis-module", c.apisModule, "the module of api types (e.g. github.com/example/api and k8s.io/api), if it is empty, kube-codgen use module in go.mod")
-	fs.StringVar(&c.apisPath, "apis-path", c.apisPath, "apis path relative to group-versions in apis-module, (e.g. pkg/apis). The whole api path will be '<apis-module>/<apis-path>/<group>/<version>'.")
-	fs.StringSliceVar(&c.groupVersionsOpt, "group-versions", c.groupVersionsOpt, "the groups and their versions in the format groupA:v1,groupA:v1,groupB:v1,groupC:v2 relative to '<apis-package>/<apis-path>'. Empty means all group versions")
+	fs.StringArrayVar(&c.generatorVersionsOpt, "generator-version", c.generatorVersionsOpt, "k8s.io/code-generator version in name=version form pinned for a generator, (e.g. deepcopy=v0.20.2), to work around regressions of a generator. Generators not pinned use --code-generator-version. It can be specified multiple times")
+	fs.BoolVar(&c.usePathGenerators, "use-path-generators", false, "if true, use generator binaries found on PATH instead of installing them into <workspace>/bin, if they are built from the k8s.io/code-generator version of the generators. Generators not found or mismatching the version are installed")
+	fs.StringSliceVar(&c.apisModulesOpt, "apis-module", c.apisModulesOpt, "the module of api types (e.g. github.com/example/api and k8s.io/api), if it is empty, kube-codgen use module in go.mod. It can be repeated along with --apis-path to generate one clientset for apis in multiple modules. Packages of all modules are inputs of every generator, but only files generated into the workspace module are written, and apis level outputs (e.g. openapi) are written into the first --apis-path")
+	fs.StringSliceVar(&c.apisPathsOpt, "apis-path", c.apisPathsOpt, "apis path relative to group-versions in apis-module, (e.g. pkg/apis). The whole api path will be '<apis-module>/<apis-path>/<group>/<version>'. If it is repeated, the nth path pairs with the nth --apis-module, a single path applies to all apis modules")
+	fs.StringSliceVar(&c.groupVersionsOpt, "group-versions", c.groupVersionsOpt, "the groups and their versions in the format groupA/v1,groupA/v2,groupB/v1 relative to '<apis-package>/<apis-path>', it can be repeated to append more group versions. Empty means all group versions")
+	fs.StringSliceVar(&c.packagesOpt, "packages", c.packagesOpt, "comma-separated list of api packages import paths used as input packages directly, (e.g. github.com/example/project/apis/foo/v1). It bypasses group versions discovery in '<apis-module>/<apis-path>' for layouts kube-codegen can not handle")
 	fs.StringVar(&c.clientPath, "client-path", c.clientPath, "the relative generated client output path, (e.g. pkg/clients). If you want generate client,lister,informer, it should be set")
+	fs.BoolVar(&c.clientInternal, "client-internal", false, "place generated clients, listers and informers under internal/ of the module, (e.g. internal/pkg/clients), to hide them from other modules")
 	fs.StringVar(&c.clientsetDirName, "clientset-dir", "kubernetes", "output clientset dir repative to client-path, all clients will be generated in <client-path>/<clientset-dir>")
 	fs.StringVar(&c.informersDirName, "informers-dir", "informers", "output informers dir repative to client-path, all informers will be generated in <client-path>/<informers-dir>")
 	fs.StringVar(&c.listersDirName, "listers-dir", "listers", "output informers dir repative to client-path, all listers will be generated in <client-path>/<listers-dir>")
 	fs.IntVar(&c.verbose, "verbose", 0, "number for the generator log level verbosity")
+	fs.BoolVar(&c.genDocs, "gen-docs", false, "generate doc.go with package documentation in clientset, listers and informers dirs")
+	fs.IntVar(&c.copyParallelism, "copy-parallelism", 1, "number of workers copying generated files into workspace, 1 means copying serially")
+	fs.BoolVar(&c.cleanOutputDirs, "clean-output-dirs", false, "if true, remove existing generated go files in each workspace dir receiving new output before copying, so that files no longer generated are removed")
+	fs.StringSliceVar(&c.excludeGeneratedFiles, "exclude-generated-files", c.excludeGeneratedFiles, "comma-separated list of glob patterns of generated files discarded instead of copied to workspace, matched against the path relative to the module and the base name, (e.g. '*.txt,pkg/apis/*/v1/zz_generated.openapi.go'). It can be repeated")
+	fs.BoolVar(&c.commit, "commit", false, "if true, stage changed generated files and the manifest after copying them to workspace, and create a git commit if any of them changed. The workspace must be in a git repository")
+	fs.StringVar(&c.commitMessage, "commit-message", c.commitMessage, "the message of the commit created by --commit. If it is empty, a default message is used")
+	fs.BoolVar(&c.inPlace, "in-place", false, "if true, gengo based generators write into workspace in place through a symlinked GOPATH-style layout in __output, instead of generating into __output and copying back")
+	fs.BoolVar(&c.strict, "strict", false, "if true, fail the run if any generator emits known warnings, e.g. 'namer: duplicate name', which usually mean subtly wrong output, or api groups of input packages depend on each other circularly")
+	fs.BoolVar(&c.verify, "verify", false, "if true, compare generated files with files in workspace instead of overwriting them, and fail if any of them is out of date")
+	fs.BoolVar(&c.verboseDiff, "verbose-diff", false, "if true, show unified diff of each out of date file in verify mode, at most 100 lines per file. It only takes effect with --verify")
+	fs.BoolVar(&c.verifyBuild, "verify-build", false, "run go build on generated apis and clients packages after generation, and on clientset and listers before informer-gen, and fail if they do not compile")
+	fs.StringVar(&c.applyConfigurationPackage, "apply-configuration-package", c.applyConfigurationPackage, "the package of apply configurations for api types, (e.g. github.com/example/project/pkg/clients/applyconfiguration). If it is empty, no apply configurations and Apply() methods will be generated")
+	fs.BoolVar(&c.enableApplyMethods, "enable-apply-methods", true, "generate typed Apply() methods on clientset. It only takes effect when --apply-configuration-package is set, apply configurations are generated regardless")
+	fs.StringSliceVar(&c.clientOnlyKinds, "client-only-kinds", c.clientOnlyKinds, "comma-separated list of kinds to generate listers and informers for, (e.g. Foo,Bar). Empty means all kinds with +genclient")
+	fs.StringSliceVar(&c.nonNamespacedKinds, "nonnamespaced-kinds", c.nonNamespacedKinds, "comma-separated list of cluster-scoped kinds to generate clients, listers and informers without namespace for, (e.g. Foo,Bar). It is useful for kinds which can not be marked with +genclient:nonNamespaced")
+	fs.StringArrayVar(&c.listerKeyFields, "lister-key-fields", c.listerKeyFields, "kind and its fields in <group>/<version>/<Kind>=<field1>,<field2> form, listers of the kind will have GetByCompositeKey retrieving objects by namespace and the fields from an indexer registered on the shared informer, (e.g. apps/v1/Foo=Spec.NodeName,labels.app). Fields are go field paths of the kind or labels.<key>. It can be specified multiple times")
+	fs.DurationVar(&c.informerDefaultResync, "informer-default-resync", 0, "generate resync.go in informers dir with NewDefaultSharedInformerFactory resyncing informers every the duration, (e.g. 10h). 0 means no resync and resync.go is not generated")
+	fs.StringVar(&c.clientInputBase, "client-input-base", c.clientInputBase, "the base package forwarded to client-gen --input-base, input packages will be relative to it, (e.g. github.com/example/project/pkg/apis). If it is empty, input packages are fully qualified")
+	fs.StringVar(&c.clientContentType, "client-content-type", c.clientContentType, "generate config.go in clientset dir with NewForConfigWithContentType creating clientset which negotiates the content type, one of json|protobuf. If it is empty, config.go is not generated")
+	fs.StringVar(&c.clientUserAgent, "client-user-agent", c.clientUserAgent, "generate useragent.go in clientset dir with NewForConfigWithUserAgent creating clientset whose rest.Config.UserAgent defaults to the value, (e.g. example-operator/v1.0.0). If it is empty, useragent.go is not generated")
+	fs.BoolVar(&c.genericListers, "generic-listers", false, "if true, require lister generator to generate listers on the generic lister API of k8s.io/client-go/listers instead of per-type listers, and fail if the code-generator version can not. It requires k8s.io/code-generator v0.31.0 or later, whose lister-gen always generates generic listers")
+	fs.BoolVar(&c.genRateLimit, "gen-ratelimit", false, "generate ratelimit.go in clientset dir with NewForConfigWithRateLimit and NewForConfigWithRateLimiter creating clientset whose requests are throttled by a rate limiter with QPS and burst, or a custom flowcontrol.RateLimiter")
+	fs.BoolVar(&c.genSerializer, "gen-serializer", false, "generate serializer.go in clientset dir with NewNegotiatedSerializer building a negotiated serializer from the generated scheme. CBOR is supported with k8s.io/code-generator v0.32.0 or later")
+	fs.BoolVar(&c.genInformerErrors, "gen-informer-errors", false, "generate run.go in informers dir with RunWithErrorHandler, which wires a WatchErrorHandler into informers of the factory for programmatic handling of watch errors. It requires k8s.io/client-go v0.19.0 or later")
+	fs.StringVar(&c.crdVersionAnnotation, "crd-version-annotation", c.crdVersionAnnotation, "annotation key used to stamp version on every generated CRD, (e.g. example.com/version). Empty means no version annotation")
+	fs.StringVar(&c.crdVersion, "crd-version", c.crdVersion, "version stamped on every generated CRD with --crd-version-annotation. If it is empty, kube-codegen will read it from VERSION file or git describe")
+	fs.Int64Var(&c.sourceDateEpoch, "source-date-epoch", -1, "unix timestamp used as the date stamped in generated files and manifest to make them reproducible. If it is negative, kube-codegen will read it from SOURCE_DATE_EPOCH env, and use now if the env is not set")
+	fs.StringVar(&c.goBin, "go-bin", "go", "go binary (name in PATH or path) used to install and run generators, (e.g. go1.21)")
+}
+
+// Workspace returns the workspace from --workspace if it is set, otherwise
+// returns the injected one.
+func (c *genOptions) Workspace(injected string) (string, error) {
+	if len(c.workspace) == 0 {
+		return injected, nil
+	}
+	ws, err := filepath.Abs(c.workspace)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(filepath.Join(ws, "go.mod")); err != nil {
+		return "", fmt.Errorf("invalid --workspace %v, go.mod not found: %v", c.workspace, err)
+	}
+	return ws, nil
 }
 
 func (c *genOptions) SetDefault(workdir string) error {
+	if len(c.goBin) == 0 {
+		c.goBin = "go"
+	}
+	// go binary is used by all following steps, check it first
+	if err := checkGoBin(c.goBin); err != nil {
+		return err
+	}
+
 	// Try to guess repository if flag is not set.
 	if len(c.module) == 0 {
 		// true to guess repo from go mod
-		repoPath, err := FindGoModulePath(true)
+		repoPath, err := FindGoModulePath(c.goBin, workdir, true)
 		if err != nil {
 			return fmt.Errorf("failed to find go module from mod, you must provide repo name, please set the flag --repo, err: %v", err)
 		}
 		c.module = repoPath
 	}
 
-	if len(c.apisModule) == 0 {
-		c.apisModule = c.module
+	modules, paths := c.apisModulesOpt, c.apisPathsOpt
+	if len(modules) == 0 && len(c.apisModule) > 0 {
+		modules = []string{c.apisModule}
+	}
+	if len(paths) == 0 && len(c.apisPath) > 0 {
+		paths = []string{c.apisPath}
+	}
+	apis, err := apisSources(c.module, modules, paths)
+	if err != nil {
+		return err
+	}
+	c.apisModule, c.apisPath = apis[0].module, apis[0].path
+	c.extraAPIs = apis[1:]
+
+	headerVars, err := codegen.ParseHeaderVars(c.headerVarsOpt)
+	if err != nil {
+		return fmt.Errorf("invalid --header-var, err: %v", err)
+	}
+	c.headerVars = headerVars
+
+	generatorVersions, err := codegen.ParseGeneratorVersions(c.generatorVersionsOpt)
+	if err != nil {
+		return fmt.Errorf("invalid --generator-version, err: %v", err)
+	}
+	c.generatorVersions = generatorVersions
+
+	if c.sourceDateEpoch < 0 {
+		epoch, err := sourceDateEpochFromEnv()
+		if err != nil {
+			return err
+		}
+		c.sourceDateEpoch = epoch
+	}
+
+	if c.clientInternal && len(c.clientPath) > 0 {
+		clientPath, err := internalClientPath(c.clientPath)
+		if err != nil {
+			return fmt.Errorf("invalid --client-path with --client-internal, err: %v", err)
+		}
+		c.clientPath = clientPath
+	}
+
+	// generators run in workdir, make header file path relative to it
+	if len(c.boilerplatePath) > 0 && !filepath.IsAbs(c.boilerplatePath) {
+		c.boilerplatePath = filepath.Join(workdir, c.boilerplatePath)
+	}
+
+	if len(c.crdVersionAnnotation) > 0 && len(c.crdVersion) == 0 {
+		version, err := detectVersion(workdir)
+		if err != nil {
+			return fmt.Errorf("failed to detect crd version, please set the flag --crd-version, err: %v", err)
+		}
+		c.crdVersion = version
 	}
 
 	inputPackages, inputInternalPackage, err := c.inputAPIPackages(workdir)
@@ -99,6 +257,57 @@ func (c *genOptions) Validate() error {
 	if len(c.boilerplatePath) == 0 {
 		return fmt.Errorf("--go-header-file must be specified")
 	}
+	if err := checkBoilerplate(c.boilerplatePath); err != nil {
+		return fmt.Errorf("invalid --go-header-file, err: %v", err)
+	}
+
+	switch c.clientContentType {
+	case "", codegen.ClientContentTypeJSON, codegen.ClientContentTypeProtobuf:
+	default:
+		return fmt.Errorf("--client-content-type must be one of json|protobuf")
+	}
+
+	if c.informerDefaultResync < 0 {
+		return fmt.Errorf("--informer-default-resync must not be negative")
+	}
+
+	if len(c.applyConfigurationPackage) > 0 && c.applyConfigurationPackage != c.module && !strings.HasPrefix(c.applyConfigurationPackage, c.module+"/") {
+		return fmt.Errorf("--apply-configuration-package %v must be in module %v", c.applyConfigurationPackage, c.module)
+	}
+
+	for _, option := range c.listerKeyFields {
+		if _, err := codegen.ParseListerKeyFields(option); err != nil {
+			return fmt.Errorf("invalid --lister-key-fields, err: %v", err)
+		}
+	}
+
+	if c.copyParallelism < 1 {
+		return fmt.Errorf("--copy-parallelism must be at least 1")
+	}
+
+	if c.cleanOutputDirs && (c.inPlace || c.verify) {
+		return fmt.Errorf("--clean-output-dirs can not be used with --in-place or --verify")
+	}
+	for _, pattern := range c.excludeGeneratedFiles {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid --exclude-generated-files pattern %q, err: %v", pattern, err)
+		}
+	}
+	if len(c.excludeGeneratedFiles) > 0 && c.inPlace {
+		return fmt.Errorf("--exclude-generated-files can not be used with --in-place")
+	}
+	if c.commit && (c.inPlace || c.verify) {
+		return fmt.Errorf("--commit can not be used with --in-place or --verify")
+	}
+	if len(c.commitMessage) > 0 && !c.commit {
+		return fmt.Errorf("--commit-message requires --commit")
+	}
+	if c.verify && c.inPlace {
+		return fmt.Errorf("--verify and --in-place are mutually exclusive")
+	}
+	if c.verboseDiff && !c.verify {
+		return fmt.Errorf("--verbose-diff requires --verify")
+	}
 
 	if len(c.inputPackages) == 0 {
 		return fmt.Errorf("no apis package found in %v", path.Join(c.apisModule, c.apisPath))
@@ -107,54 +316,216 @@ func (c *genOptions) Validate() error {
 }
 
 func (c *genOptions) inputAPIPackages(workdir string) (inputPackages, inputInternalPackages []string, err error) {
-	var apiModuleDir string
-	if c.apisModule == c.module {
-		apiModuleDir = workdir
-	} else {
-		goCmd := runner.NewRunner("go")
-		bytes, err := goCmd.RunOutput("list", "-f", "{{ .Dir }}", "-m", c.apisModule)
+	if len(c.packagesOpt) > 0 {
+		if len(c.groupVersionsOpt) > 0 {
+			return nil, nil, fmt.Errorf("--packages and --group-versions are mutually exclusive")
+		}
+		inputPackages, err := listPackages(c.goBin, workdir, c.packagesOpt)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid --packages, err: %v", err)
+		}
+		return inputPackages, nil, nil
+	}
+
+	// group version -> package and index of its apis
+	gvPackages, gvAPIs := map[string]string{}, map[string]int{}
+	fsyses := []fs.FS{}
+	allGroupVersions, allInternalGroupVersions := []string{}, []string{}
+	for i, apis := range append([]apisSource{{module: c.apisModule, path: c.apisPath}}, c.extraAPIs...) {
+		fsys, groupVersions, internalGroupVersions, err := c.findAPIsGroupVersions(workdir, apis)
+		if err != nil {
+			return nil, nil, err
+		}
+		fsyses = append(fsyses, fsys)
+		for _, gv := range append(append([]string{}, groupVersions...), internalGroupVersions...) {
+			pkg := path.Join(apis.module, apis.path, gv)
+			if existing, ok := gvPackages[gv]; ok {
+				return nil, nil, fmt.Errorf("group version %v is found in both %v and %v", gv, existing, pkg)
+			}
+			gvPackages[gv], gvAPIs[gv] = pkg, i
+		}
+		allGroupVersions = append(allGroupVersions, groupVersions...)
+		allInternalGroupVersions = append(allInternalGroupVersions, internalGroupVersions...)
+	}
+
+	groupVersions, internalGroupVersions := allGroupVersions, allInternalGroupVersions
+	if len(c.groupVersionsOpt) > 0 {
+		groupVersions, internalGroupVersions, err = filterGroupVersions(c.groupVersionsOpt, allGroupVersions, allInternalGroupVersions)
 		if err != nil {
+			return nil, nil, fmt.Errorf("invalid --group-versions, err: %v", err)
+		}
+	}
+
+	for i, fsys := range fsyses {
+		apisGroupVersions := []string{}
+		for _, gv := range groupVersions {
+			if gvAPIs[gv] == i {
+				apisGroupVersions = append(apisGroupVersions, gv)
+			}
+		}
+		if err := checkDuplicateGroupNames(fsys, apisRoot, apisGroupVersions); err != nil {
 			return nil, nil, err
 		}
-		apiModuleDir = strings.TrimSpace(string(bytes))
 	}
 
-	root := path.Join(apiModuleDir, c.apisPath)
+	for _, gv := range groupVersions {
+		inputPackages = append(inputPackages, gvPackages[gv])
+	}
+	for _, gv := range internalGroupVersions {
+		inputInternalPackages = append(inputInternalPackages, gvPackages[gv])
+	}
+	return inputPackages, inputInternalPackages, nil
+}
+
+// apisSource is a pair of --apis-module and --apis-path.
+type apisSource struct {
+	module string
+	path   string
+}
+
+// apisSources pairs modules and paths. An empty module means module in go.mod,
+// and a single module or path applies to all pairs.
+func apisSources(module string, modules, paths []string) ([]apisSource, error) {
+	n := len(modules)
+	if len(paths) > n {
+		n = len(paths)
+	}
+	if n == 0 {
+		return []apisSource{{module: module}}, nil
+	}
+	at := func(values []string, i int) string {
+		switch len(values) {
+		case 0:
+			return ""
+		case 1:
+			return values[0]
+		}
+		return values[i]
+	}
+	if (len(modules) > 1 && len(modules) != n) || (len(paths) > 1 && len(paths) != n) {
+		return nil, fmt.Errorf("--apis-module %v and --apis-path %v can not be paired, they must be repeated the same times or only once", modules, paths)
+	}
+	ret := []apisSource{}
+	for i := 0; i < n; i++ {
+		apis := apisSource{module: at(modules, i), path: at(paths, i)}
+		if len(apis.module) == 0 {
+			apis.module = module
+		}
+		ret = append(ret, apis)
+	}
+	return ret, nil
+}
+
+// apisRoot is the root dir of fs returned by findAPIsGroupVersions.
+const apisRoot = "."
+
+// findAPIsGroupVersions finds group versions in apis, and returns fs rooted at
+// dir of apis path. The dir of apis module is resolved by go list, which honors
+// go.work and replace directives, so that apis can be in another module.
+func (c *genOptions) findAPIsGroupVersions(workdir string, apis apisSource) (fs.FS, []string, []string, error) {
+	apiModuleDir := workdir
+	if apis.module != c.module {
+		dir, err := moduleDir(c.goBin, workdir, apis.module)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		apiModuleDir = dir
+	}
+
+	// io/fs only accepts unrooted paths, root fs at apis dir
+	fsys := afero.NewIOFS(afero.NewBasePathFs(afero.NewOsFs(), filepath.Join(apiModuleDir, apis.path)))
 	// find all apis group version package
-	allGroupVersions, allInternalGroupVersions, err := findGroupVersion(afero.NewIOFS(afero.NewOsFs()), root)
+	groupVersions, internalGroupVersions, err := findGroupVersion(fsys, apisRoot)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
+	}
+	return fsys, groupVersions, internalGroupVersions, nil
+}
+
+// moduleDir resolves the dir of module required by the module in workdir, e.g.
+// k8s.io/api for clients of built-in types. go list reports no dir for modules
+// in vendor mode, the dir in vendor tree is used then.
+func moduleDir(goBin, workdir, module string) (string, error) {
+	goCmd := runner.NewRunner(goBin).WithDir(workdir)
+	out, err := goCmd.RunOutput("list", "-f", "{{ .Dir }}", "-m", module)
+	if err != nil {
+		return "", fmt.Errorf("apis module %v can not be resolved by go list, make sure it is required in go.mod: %v", module, err)
 	}
+	if dir := strings.TrimSpace(string(out)); len(dir) > 0 {
+		return dir, nil
+	}
+	vendorDir := filepath.Join(workdir, "vendor", filepath.FromSlash(module))
+	if info, err := os.Stat(vendorDir); err == nil && info.IsDir() {
+		return vendorDir, nil
+	}
+	return "", fmt.Errorf("source of apis module %v is not found, run go mod download or go mod vendor", module)
+}
 
-	if len(c.groupVersionsOpt) == 0 {
-		for _, gv := range allGroupVersions {
-			inputPackages = append(inputPackages, path.Join(c.apisModule, c.apisPath, gv))
+// listPackages resolves pkgs by go list in workdir, and returns their import
+// paths in the order of pkgs. Packages resolved to the same import path are
+// ignored.
+func listPackages(goBin, workdir string, pkgs []string) ([]string, error) {
+	goCmd := runner.NewRunner(goBin).WithDir(workdir)
+	seen := goset.NewSet()
+	ret := []string{}
+	for _, pkg := range pkgs {
+		out, err := goCmd.RunOutput("list", "-f", "{{ .ImportPath }}", pkg)
+		if err != nil {
+			return nil, fmt.Errorf("package %v can not be resolved by go list: %v", pkg, err)
 		}
-		for _, gv := range allInternalGroupVersions {
-			inputInternalPackages = append(inputInternalPackages, path.Join(c.apisModule, c.apisPath, gv))
+		importPath := strings.TrimSpace(string(out))
+		if seen.Contains(importPath) {
+			continue
 		}
-		return inputPackages, inputInternalPackages, nil
+		seen.Add(importPath) //nolint
+		ret = append(ret, importPath)
 	}
+	return ret, nil
+}
 
+// internalClientPath places clientPath under internal/ of module root, so
+// that it can be imported by all packages in the module only. clientPath is
+// returned as is if it is already in an internal dir.
+func internalClientPath(clientPath string) (string, error) {
+	cleaned := path.Clean(clientPath)
+	if path.IsAbs(cleaned) || cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("%v must be a relative path in the module", clientPath)
+	}
+	for _, segment := range strings.Split(cleaned, "/") {
+		if segment == "internal" {
+			return cleaned, nil
+		}
+	}
+	return path.Join("internal", cleaned), nil
+}
+
+// filterGroupVersions filters group versions and internal group versions by
+// opts in the order of opts. Duplicate opts are ignored, and it returns error
+// if any opt is not found in discovered group versions.
+func filterGroupVersions(opts, allGroupVersions, allInternalGroupVersions []string) ([]string, []string, error) {
 	allGVSet := goset.NewSetFromStrings(allGroupVersions)
 	allInternalGVSet := goset.NewSetFromStrings(allInternalGroupVersions)
-	// filter group version
-	for _, gv := range c.groupVersionsOpt {
-		if !allGVSet.Contains(gv) {
+	seen := goset.NewSet()
+	groupVersions, internalGroupVersions := []string{}, []string{}
+	for _, gv := range opts {
+		if seen.Contains(gv) {
 			continue
 		}
-		inputPackages = append(inputPackages, path.Join(c.apisModule, c.apisPath, gv))
-	}
-	for _, gv := range c.groupVersionsOpt {
-		if !allInternalGVSet.Contains(gv) {
-			continue
+		seen.Add(gv) //nolint
+		switch {
+		case allGVSet.Contains(gv):
+			groupVersions = append(groupVersions, gv)
+		case allInternalGVSet.Contains(gv):
+			internalGroupVersions = append(internalGroupVersions, gv)
+		default:
+			return nil, nil, fmt.Errorf("group version %v not found, discovered: %v", gv, append(allGroupVersions, allInternalGroupVersions...))
 		}
-		inputInternalPackages = append(inputInternalPackages, path.Join(c.apisModule, c.apisPath, gv))
 	}
-	return inputPackages, inputInternalPackages, nil
+	return groupVersions, internalGroupVersions, nil
 }
 
-// findGroupVersion walk into apis root dir, and find all group/version under this apis path
+// findGroupVersion walk into apis root dir of fsys, and find all group/version under this apis path.
+// fsys is rooted at the apis dir on the OS filesystem in production, see findAPIsGroupVersions.
 func findGroupVersion(fsys fs.FS, root string) ([]string, []string, error) {
 	groupVersions := []string{}
 	internalGroupVersion := []string{}
@@ -180,7 +551,7 @@ func findGroupVersion(fsys fs.FS, root string) ([]string, []string, error) {
 			tokens := strings.Split(sub, "/")
 			groups.Add(tokens[0]) //nolint
 		}
-		return filepath.SkipDir
+		return fs.SkipDir
 	})
 
 	if err != nil {
@@ -190,8 +561,8 @@ func findGroupVersion(fsys fs.FS, root string) ([]string, []string, error) {
 	var rangeErr error
 	groups.Range(func(_ int, elem interface{}) bool {
 		group := elem.(string)
-		path := filepath.Join(root, group)
-		hasGoFile, err := goFileExists(fsys, path)
+		// paths of io/fs are always slash-separated
+		hasGoFile, err := goFileExists(fsys, path.Join(root, group))
 		if err != nil {
 			rangeErr = err
 			return false
@@ -209,6 +580,63 @@ func findGroupVersion(fsys fs.FS, root string) ([]string, []string, error) {
 	return groupVersions, internalGroupVersion, err
 }
 
+// checkDuplicateGroupNames parses the +groupName marker of each group/version
+// package under root, and returns error if two distinct group dirs declare the
+// same group name.
+func checkDuplicateGroupNames(fsys fs.FS, root string, groupVersions []string) error {
+	// group name -> group dirs
+	groupDirs := map[string][]string{}
+	for _, gv := range groupVersions {
+		dir := path.Join(root, gv)
+		groupName, err := findGroupName(fsys, dir)
+		if err != nil {
+			return err
+		}
+		if groupName == "" {
+			continue
+		}
+		groupDir := path.Dir(dir)
+		if goset.NewSetFromStrings(groupDirs[groupName]).Contains(groupDir) {
+			continue
+		}
+		groupDirs[groupName] = append(groupDirs[groupName], groupDir)
+	}
+
+	conflicts := []string{}
+	for groupName, dirs := range groupDirs {
+		if len(dirs) > 1 {
+			conflicts = append(conflicts, fmt.Sprintf("%s: [%s]", groupName, strings.Join(dirs, ", ")))
+		}
+	}
+	if len(conflicts) > 0 {
+		sort.Strings(conflicts)
+		return fmt.Errorf("found duplicate group names declared in different dirs, %s", strings.Join(conflicts, "; "))
+	}
+	return nil
+}
+
+// findGroupName finds the +groupName marker in go files of the package dir.
+func findGroupName(fsys fs.FS, dir string) (string, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return "", err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".go") || strings.HasSuffix(entry.Name(), "_test.go") {
+			continue
+		}
+		content, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return "", err
+		}
+		if match := groupNameRegexp.FindSubmatch(content); match != nil {
+			return string(match[1]), nil
+		}
+	}
+	return "", nil
+}
+
+// goFileExists returns true if there is any go file directly in root dir of fsys.
 func goFileExists(fsys fs.FS, root string) (bool, error) {
 	got := false
 	oerr := fs.WalkDir(fsys, root, func(path string, d fs.DirEntry, err error) error {
@@ -219,11 +647,12 @@ func goFileExists(fsys fs.FS, root string) (bool, error) {
 			return nil
 		}
 		if d.IsDir() {
-			return filepath.SkipDir
+			return fs.SkipDir
 		}
 		if strings.HasSuffix(d.Name(), ".go") {
 			got = true
-			return filepath.SkipAll
+			// skips the rest of root, fs.SkipAll requires go 1.20
+			return fs.SkipDir
 		}
 		return nil
 	})
@@ -238,9 +667,115 @@ type module struct {
 	Path string
 }
 
-// FindGoModulePath finds the path of the current module, if present.
-func FindGoModulePath(forceModules bool) (string, error) {
-	cmd := exec.Command("go", "mod", "edit", "-json")
+// detectVersion reads version from VERSION file in workdir, falls back to
+// git describe if it does not exist.
+func detectVersion(workdir string) (string, error) {
+	content, err := os.ReadFile(filepath.Join(workdir, "VERSION"))
+	if err == nil {
+		return strings.TrimSpace(string(content)), nil
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+	gitCmd := runner.NewRunner("git").WithDir(workdir)
+	out, err := gitCmd.RunOutput("describe", "--tags", "--always", "--dirty")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// sourceDateEpochFromEnv reads unix timestamp from SOURCE_DATE_EPOCH env,
+// it returns -1 if the env is not set, 0 is a valid timestamp.
+// See https://reproducible-builds.org/specs/source-date-epoch/
+func sourceDateEpochFromEnv() (int64, error) {
+	env := os.Getenv("SOURCE_DATE_EPOCH")
+	if len(env) == 0 {
+		return -1, nil
+	}
+	epoch, err := strconv.ParseInt(env, 10, 64)
+	if err != nil || epoch < 0 {
+		return 0, fmt.Errorf("invalid SOURCE_DATE_EPOCH %q, it must be a non-negative unix timestamp", env)
+	}
+	return epoch, nil
+}
+
+// checkGoBin checks that the go binary exists and prints a version.
+func checkGoBin(goBin string) error {
+	if _, err := exec.LookPath(goBin); err != nil {
+		return fmt.Errorf("go binary %q not found, please check the flag --go-bin, err: %v", goBin, err)
+	}
+	out, err := runner.NewRunner(goBin).RunOutput("version")
+	if err != nil {
+		return fmt.Errorf("failed to get version of go binary %q, err: %v", goBin, err)
+	}
+	if !strings.HasPrefix(string(out), "go version") {
+		return fmt.Errorf("%q is not a valid go binary, got version output: %s", goBin, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// checkBoilerplate checks that every non-empty line of the go header file is
+// in a // or /* */ comment, generators prepend it to generated go files verbatim.
+func checkBoilerplate(file string) error {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	inBlock := false
+	blockStart := 0
+	for i, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if inBlock {
+			end := strings.Index(line, "*/")
+			if end < 0 {
+				continue
+			}
+			inBlock = false
+			line = strings.TrimSpace(line[end+2:])
+		}
+		if len(line) == 0 || strings.HasPrefix(line, "//") {
+			continue
+		}
+		if !strings.HasPrefix(line, "/*") {
+			return fmt.Errorf("line %d of %v is not a go comment: %q", i+1, file, line)
+		}
+		end := strings.Index(line[2:], "*/")
+		if end < 0 {
+			inBlock, blockStart = true, i+1
+			continue
+		}
+		if rest := strings.TrimSpace(line[2+end+2:]); len(rest) > 0 && !strings.HasPrefix(rest, "//") {
+			return fmt.Errorf("line %d of %v is not a go comment: %q", i+1, file, line)
+		}
+	}
+	if inBlock {
+		return fmt.Errorf("block comment starting at line %d of %v is not closed", blockStart, file)
+	}
+	return nil
+}
+
+// checkWritableDir checks that dir exists and is writable by creating a temp file in it.
+func checkWritableDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%v is not a directory", dir)
+	}
+	f, err := ioutil.TempFile(dir, ".kube-codegen-*")
+	if err != nil {
+		return fmt.Errorf("%v is not writable: %v", dir, err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// FindGoModulePath finds the path of the module in dir, if present.
+func FindGoModulePath(goBin, dir string, forceModules bool) (string, error) {
+	cmd := exec.Command(goBin, "mod", "edit", "-json")
+	cmd.Dir = dir
 	cmd.Env = append(cmd.Env, os.Environ()...)
 	if forceModules {
 		cmd.Env = append(cmd.Env, "GO111MODULE=on" /* turn on modules just for these commands */)
@@ -15,9 +15,12 @@ package cli
 
 import (
 	"io/fs"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/spf13/afero"
+	"github.com/spf13/pflag"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -55,3 +58,321 @@ func Test_findGroupVersion(t *testing.T) {
 	assert.Equal(t, []string{"apps/v1", "apps/v2"}, groupVersions)
 	assert.Equal(t, []string{"apps"}, internalGroupVersions)
 }
+
+func Test_genOptions_findAPIsGroupVersions(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "pkg/apis/apps/v1"), 0755))
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "pkg/apis/apps/v2"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "pkg/apis/apps/types.go"), []byte("package apps\n"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "pkg/apis/apps/v2/types.go"), []byte("package v2\n"), 0644))
+
+	o := &genOptions{module: "example.com/test"}
+	fsys, groupVersions, internalGroupVersions, err := o.findAPIsGroupVersions(dir, apisSource{module: "example.com/test", path: "pkg/apis"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"apps/v1", "apps/v2"}, groupVersions)
+	assert.Equal(t, []string{"apps"}, internalGroupVersions)
+
+	// the returned fs is rooted at apis dir
+	got, err := goFileExists(fsys, "apps/v2")
+	assert.NoError(t, err)
+	assert.True(t, got)
+}
+
+func Test_genOptions_groupVersions(t *testing.T) {
+	o := &genOptions{}
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	o.BindFlags(fs)
+	assert.NoError(t, fs.Parse([]string{"--group-versions", "apps/v1", "--group-versions", "batch/v1,apps/v1,apps"}))
+	assert.Equal(t, []string{"apps/v1", "batch/v1", "apps/v1", "apps"}, o.groupVersionsOpt)
+
+	groupVersions, internalGroupVersions, err := filterGroupVersions(o.groupVersionsOpt, []string{"apps/v1", "apps/v2", "batch/v1"}, []string{"apps"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"apps/v1", "batch/v1"}, groupVersions)
+	assert.Equal(t, []string{"apps"}, internalGroupVersions)
+
+	_, _, err = filterGroupVersions([]string{"apps/v1", "batch/v2"}, []string{"apps/v1", "batch/v1"}, nil)
+	assert.Error(t, err)
+}
+
+func Test_genOptions_Workspace(t *testing.T) {
+	o := &genOptions{}
+	got, err := o.Workspace("/injected")
+	assert.NoError(t, err)
+	assert.Equal(t, "/injected", got)
+
+	dir := t.TempDir()
+	o.workspace = dir
+	_, err = o.Workspace("/injected")
+	assert.Error(t, err)
+
+	os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/test\n"), 0644)
+	got, err = o.Workspace("/injected")
+	assert.NoError(t, err)
+	assert.Equal(t, dir, got)
+}
+
+func Test_checkDuplicateGroupNames(t *testing.T) {
+	memFS := afero.NewMemMapFs()
+	afero.WriteFile(memFS, "pkg/apis/apps/v1/doc.go", []byte("// +groupName=apps.example.com\npackage v1\n"), fs.ModePerm)
+	afero.WriteFile(memFS, "pkg/apis/apps/v2/doc.go", []byte("// +groupName=apps.example.com\npackage v2\n"), fs.ModePerm)
+	afero.WriteFile(memFS, "pkg/apis/apps2/v1/doc.go", []byte("// +groupName=apps.example.com\npackage v1\n"), fs.ModePerm)
+	afero.WriteFile(memFS, "pkg/apis/batch/v1/doc.go", []byte("// +groupName=batch.example.com\npackage v1\n"), fs.ModePerm)
+	iofs := afero.NewIOFS(memFS)
+
+	err := checkDuplicateGroupNames(iofs, "pkg/apis", []string{"apps/v1", "apps/v2", "batch/v1"})
+	assert.NoError(t, err)
+
+	err = checkDuplicateGroupNames(iofs, "pkg/apis", []string{"apps/v1", "apps/v2", "apps2/v1", "batch/v1"})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "apps.example.com: [pkg/apis/apps, pkg/apis/apps2]")
+	}
+}
+
+func Test_checkBoilerplate(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{
+			name:    "line comments",
+			content: "// Copyright YEAR The Authors.\n//\n// Licensed under the Apache License.\n\n",
+		},
+		{
+			name:    "block comment",
+			content: "/*\nCopyright YEAR The Authors.\n\nLicensed under the Apache License.\n*/\n",
+		},
+		{
+			name:    "one line block comment",
+			content: "/* Copyright YEAR The Authors. */\n// +build tools\n",
+		},
+		{
+			name:    "not commented",
+			content: "// Copyright YEAR The Authors.\n\nLicensed under the Apache License.\n",
+			wantErr: `line 3 of ` + filepath.Join(dir, "not commented") + ` is not a go comment: "Licensed under the Apache License."`,
+		},
+		{
+			name:    "code after block comment",
+			content: "/*\nCopyright YEAR The Authors.\n*/ package foo\n",
+			wantErr: "line 3",
+		},
+		{
+			name:    "unclosed block comment",
+			content: "\n/*\nCopyright YEAR The Authors.\n",
+			wantErr: "block comment starting at line 2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(dir, tt.name)
+			assert.NoError(t, os.WriteFile(file, []byte(tt.content), 0644))
+			err := checkBoilerplate(file)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.wantErr)
+			}
+		})
+	}
+
+	assert.Error(t, checkBoilerplate(filepath.Join(dir, "not-exist")))
+}
+
+func Test_checkWritableDir(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, checkWritableDir(dir))
+
+	assert.Error(t, checkWritableDir(filepath.Join(dir, "not-exist")))
+
+	file := filepath.Join(dir, "file")
+	assert.NoError(t, os.WriteFile(file, nil, 0644))
+	assert.Error(t, checkWritableDir(file))
+}
+
+func Test_genOptions_Validate_applyConfigurationPackage(t *testing.T) {
+	boilerplate := filepath.Join(t.TempDir(), "boilerplate.go.txt")
+	assert.NoError(t, os.WriteFile(boilerplate, []byte("// Copyright YEAR The Authors.\n"), 0644))
+	c := &genOptions{
+		module:          "github.com/example/project",
+		boilerplatePath: boilerplate,
+		copyParallelism: 1,
+		inputPackages:   []string{"github.com/example/project/pkg/apis/apps/v1"},
+	}
+	assert.NoError(t, c.Validate())
+
+	// generated regardless of --enable-apply-methods, so it must be copied into the module
+	c.applyConfigurationPackage = "github.com/example/project/pkg/clients/applyconfiguration"
+	assert.NoError(t, c.Validate())
+	c.applyConfigurationPackage = "github.com/example/other/applyconfiguration"
+	assert.EqualError(t, c.Validate(), "--apply-configuration-package github.com/example/other/applyconfiguration must be in module github.com/example/project")
+	c.applyConfigurationPackage = "github.com/example/project-applyconfiguration"
+	assert.Error(t, c.Validate())
+}
+
+func Test_sourceDateEpochFromEnv(t *testing.T) {
+	t.Setenv("SOURCE_DATE_EPOCH", "")
+	got, err := sourceDateEpochFromEnv()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-1), got)
+
+	t.Setenv("SOURCE_DATE_EPOCH", "0")
+	got, err = sourceDateEpochFromEnv()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), got)
+
+	t.Setenv("SOURCE_DATE_EPOCH", "1640995200")
+	got, err = sourceDateEpochFromEnv()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1640995200), got)
+
+	t.Setenv("SOURCE_DATE_EPOCH", "yesterday")
+	_, err = sourceDateEpochFromEnv()
+	assert.Error(t, err)
+}
+
+func Test_internalClientPath(t *testing.T) {
+	tests := []struct {
+		clientPath string
+		want       string
+		wantErr    bool
+	}{
+		{"pkg/clients", "internal/pkg/clients", false},
+		{"./clients/", "internal/clients", false},
+		{"internal/clients", "internal/clients", false},
+		{"pkg/internal/clients", "pkg/internal/clients", false},
+		{"/pkg/clients", "", true},
+		{"../clients", "", true},
+		{".", "", true},
+	}
+	for _, tt := range tests {
+		got, err := internalClientPath(tt.clientPath)
+		if tt.wantErr {
+			assert.Error(t, err, tt.clientPath)
+			continue
+		}
+		assert.NoError(t, err, tt.clientPath)
+		assert.Equal(t, tt.want, got)
+	}
+}
+
+func Test_listPackages(t *testing.T) {
+	got, err := listPackages("go", ".", []string{"./", "github.com/zoumo/kube-codegen/pkg/cli"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"github.com/zoumo/kube-codegen/pkg/cli"}, got)
+
+	_, err = listPackages("go", ".", []string{"github.com/zoumo/kube-codegen/pkg/notfound"})
+	assert.Error(t, err)
+}
+
+func Test_apisSources(t *testing.T) {
+	got, err := apisSources("example.com/a", nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []apisSource{{module: "example.com/a"}}, got)
+
+	got, err = apisSources("example.com/a", []string{"", "example.com/b"}, []string{"pkg/apis"})
+	assert.NoError(t, err)
+	assert.Equal(t, []apisSource{{module: "example.com/a", path: "pkg/apis"}, {module: "example.com/b", path: "pkg/apis"}}, got)
+
+	_, err = apisSources("example.com/a", []string{"example.com/a", "example.com/b"}, []string{"pkg/apis", "apis", "api"})
+	assert.Error(t, err)
+}
+
+func Test_genOptions_inputAPIPackages_multipleModules(t *testing.T) {
+	workdir := t.TempDir()
+	writeFile := func(name, content string) {
+		file := filepath.Join(workdir, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(file), 0755))
+		assert.NoError(t, os.WriteFile(file, []byte(content), 0644))
+	}
+	writeFile("go.mod", "module example.com/a\n\ngo 1.16\n\nrequire example.com/b v0.0.0\n\nreplace example.com/b => ./b\n")
+	writeFile("pkg/apis/apps/v1/doc.go", "// +groupName=apps.example.com\npackage v1\n")
+	writeFile("b/go.mod", "module example.com/b\n\ngo 1.16\n")
+	writeFile("b/apis/batch/v1/doc.go", "// +groupName=batch.example.com\npackage v1\n")
+	writeFile("b/apis/batch/v2/doc.go", "// +groupName=batch.example.com\npackage v2\n")
+
+	o := &genOptions{
+		goBin:          "go",
+		module:         "example.com/a",
+		apisModulesOpt: []string{"example.com/a", "example.com/b"},
+		apisPathsOpt:   []string{"pkg/apis", "apis"},
+	}
+	apis, err := apisSources(o.module, o.apisModulesOpt, o.apisPathsOpt)
+	assert.NoError(t, err)
+	o.apisModule, o.apisPath, o.extraAPIs = apis[0].module, apis[0].path, apis[1:]
+
+	got, _, err := o.inputAPIPackages(workdir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"example.com/a/pkg/apis/apps/v1",
+		"example.com/b/apis/batch/v1",
+		"example.com/b/apis/batch/v2",
+	}, got)
+
+	o.groupVersionsOpt = []string{"batch/v2", "apps/v1"}
+	got, _, err = o.inputAPIPackages(workdir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"example.com/b/apis/batch/v2", "example.com/a/pkg/apis/apps/v1"}, got)
+
+	// the same group version in two modules conflicts in one clientset
+	writeFile("b/apis/apps/v1/doc.go", "// +groupName=apps.example.com\npackage v1\n")
+	o.groupVersionsOpt = nil
+	_, _, err = o.inputAPIPackages(workdir)
+	assert.Error(t, err)
+}
+
+func Test_genOptions_inputAPIPackages_builtinTypes(t *testing.T) {
+	workdir := t.TempDir()
+	writeFile := func(name, content string) {
+		file := filepath.Join(workdir, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(file), 0755))
+		assert.NoError(t, os.WriteFile(file, []byte(content), 0644))
+	}
+	// a synthetic mini k8s.io/api module
+	writeFile("go.mod", "module example.com/a\n\ngo 1.16\n\nrequire k8s.io/api v0.0.0\n\nreplace k8s.io/api => ./k8sapi\n")
+	writeFile("k8sapi/go.mod", "module k8s.io/api\n\ngo 1.16\n")
+	writeFile("k8sapi/core/v1/doc.go", "// +groupName=\npackage v1\n")
+	writeFile("k8sapi/apps/v1/doc.go", "// +groupName=apps\npackage v1\n")
+	writeFile("k8sapi/apps/v1beta1/doc.go", "// +groupName=apps\npackage v1beta1\n")
+
+	o := &genOptions{
+		goBin:            "go",
+		module:           "example.com/a",
+		apisModulesOpt:   []string{"k8s.io/api"},
+		groupVersionsOpt: []string{"core/v1"},
+	}
+	apis, err := apisSources(o.module, o.apisModulesOpt, o.apisPathsOpt)
+	assert.NoError(t, err)
+	o.apisModule, o.apisPath, o.extraAPIs = apis[0].module, apis[0].path, apis[1:]
+
+	got, internal, err := o.inputAPIPackages(workdir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"k8s.io/api/core/v1"}, got)
+	assert.Empty(t, internal)
+
+	// not required by go.mod
+	o.apisModulesOpt = []string{"k8s.io/notfound"}
+	o.apisModule = "k8s.io/notfound"
+	_, _, err = o.inputAPIPackages(workdir)
+	assert.Error(t, err)
+}
+
+func Test_moduleDir_vendor(t *testing.T) {
+	workdir := t.TempDir()
+	writeFile := func(name, content string) {
+		file := filepath.Join(workdir, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(file), 0755))
+		assert.NoError(t, os.WriteFile(file, []byte(content), 0644))
+	}
+	writeFile("go.mod", "module example.com/a\n\ngo 1.16\n\nrequire k8s.io/api v0.0.0\n")
+	writeFile("vendor/modules.txt", "# k8s.io/api v0.0.0\n## explicit\nk8s.io/api/core/v1\n")
+	writeFile("vendor/k8s.io/api/core/v1/types.go", "package v1\n")
+	// go list reports no dir of modules in vendor mode
+	t.Setenv("GOFLAGS", "-mod=vendor")
+
+	got, err := moduleDir("go", workdir, "k8s.io/api")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(workdir, "vendor", "k8s.io", "api"), got)
+}
@@ -0,0 +1,202 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"fmt"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dave/jennifer/jen"
+	"github.com/spf13/pflag"
+	"github.com/zoumo/golib/cli/injection"
+	"github.com/zoumo/golib/cli/plugin"
+	"k8s.io/gengo/namer"
+	"k8s.io/gengo/types"
+)
+
+const (
+	controllerRuntimePkg = "sigs.k8s.io/controller-runtime"
+	reconcilePkg         = "sigs.k8s.io/controller-runtime/pkg/reconcile"
+	apierrorsPkg         = "k8s.io/apimachinery/pkg/api/errors"
+)
+
+func NewScaffoldControllerSubcommand() plugin.Subcommand {
+	return &scaffoldControllerSubcommand{
+		DefaultInjectionMixin: injection.NewDefaultInjectionMixin(),
+		genOptions:            &genOptions{},
+	}
+}
+
+type scaffoldControllerSubcommand struct {
+	*injection.DefaultInjectionMixin
+
+	genOptions *genOptions
+
+	group          string
+	version        string
+	kind           string
+	namespaced     bool
+	controllerPath string
+}
+
+func (c *scaffoldControllerSubcommand) Name() string {
+	return "scaffold-controller"
+}
+
+func (c *scaffoldControllerSubcommand) BindFlags(fs *pflag.FlagSet) {
+	c.genOptions.BindFlags(fs)
+	fs.StringVar(&c.group, "group", c.group, "the group dir of kind relative to '<apis-module>/<apis-path>', (e.g. apps)")
+	fs.StringVar(&c.version, "version", c.version, "the version of kind, (e.g. v1)")
+	fs.StringVar(&c.kind, "kind", c.kind, "the kind to generate controller for, (e.g. Widget)")
+	fs.BoolVar(&c.namespaced, "namespaced", true, "whether the kind is namespace scoped")
+	fs.StringVar(&c.controllerPath, "controller-path", "pkg/controllers", "the relative controller output path, the controller will be generated in <controller-path>/<group>/<kind>_controller.go")
+}
+
+func (c *scaffoldControllerSubcommand) PreRun(args []string) error {
+	ws, err := c.genOptions.Workspace(c.Workspace)
+	if err != nil {
+		return err
+	}
+	c.Workspace = ws
+
+	if len(c.group) == 0 || len(c.version) == 0 || len(c.kind) == 0 {
+		return fmt.Errorf("--group, --version and --kind must be specified")
+	}
+	if !versionRegexp.MatchString(c.version) {
+		return fmt.Errorf("invalid --version %v", c.version)
+	}
+	if !token.IsIdentifier(c.kind) || !token.IsExported(c.kind) {
+		return fmt.Errorf("invalid --kind %v, it must be an exported go identifier", c.kind)
+	}
+	if len(c.genOptions.clientPath) == 0 {
+		return fmt.Errorf("--client-path must be specified to import generated clientset and informers")
+	}
+
+	// only discover the group version of kind
+	c.genOptions.groupVersionsOpt = []string{path.Join(c.group, c.version)}
+	if err := c.genOptions.SetDefault(c.Workspace); err != nil {
+		return err
+	}
+	return c.genOptions.Validate()
+}
+
+func (c *scaffoldControllerSubcommand) Run(args []string) error {
+	filename := path.Join(c.Workspace, c.controllerPath, c.group, strings.ToLower(c.kind)+"_controller.go")
+	if _, err := os.Stat(filename); err == nil {
+		return fmt.Errorf("controller file %v already exists, refuse to overwrite it", filename)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	header, err := ioutil.ReadFile(c.genOptions.boilerplatePath)
+	if err != nil {
+		return err
+	}
+	headerText := strings.ReplaceAll(string(header), " YEAR", " "+strconv.Itoa(time.Now().Year()))
+
+	f := c.render(headerText)
+	if err := os.MkdirAll(path.Dir(filename), 0755); err != nil {
+		return err
+	}
+	c.Logger.Info("generating controller", "file", filename)
+	return f.Save(filename)
+}
+
+func (c *scaffoldControllerSubcommand) render(headerText string) *jen.File {
+	typesPkg := path.Join(c.genOptions.apisModule, c.genOptions.apisPath, c.group, c.version)
+	clientsetPkg := path.Join(c.genOptions.module, c.genOptions.clientPath, c.genOptions.clientsetDirName)
+	informersPkg := path.Join(c.genOptions.module, c.genOptions.clientPath, c.genOptions.informersDirName)
+	listersPkg := path.Join(c.genOptions.module, c.genOptions.clientPath, c.genOptions.listersDirName, c.group, c.version)
+
+	pkgName := strings.NewReplacer("-", "", ".", "").Replace(c.group)
+	groupMethod := namer.IC(pkgName)
+	versionMethod := namer.IC(c.version)
+	kindsMethod := namer.NewPublicPluralNamer(nil).Name(&types.Type{Name: types.Name{Name: c.kind}})
+	reconciler := c.kind + "Reconciler"
+
+	f := jen.NewFile(pkgName)
+	f.HeaderComment(headerText)
+	f.ImportAlias(typesPkg, pkgName+c.version)
+	f.ImportAlias(clientsetPkg, "clientset")
+	f.ImportAlias(informersPkg, "informers")
+	f.ImportAlias(listersPkg, "listers")
+	f.ImportAlias(apierrorsPkg, "apierrors")
+	f.ImportName(controllerRuntimePkg, "ctrl")
+	f.ImportName(reconcilePkg, "reconcile")
+
+	result := jen.Qual(reconcilePkg, "Result")
+
+	f.Commentf("%s reconciles a %s object", reconciler, c.kind)
+	f.Type().Id(reconciler).Struct(
+		jen.Id("Client").Qual(clientsetPkg, "Interface"),
+		jen.Id("Lister").Qual(listersPkg, c.kind+"Lister"),
+	)
+	f.Line()
+
+	f.Commentf("New%s returns a %s using generated clientset and informers.", reconciler, reconciler)
+	f.Func().Id("New"+reconciler).Params(
+		jen.Id("client").Qual(clientsetPkg, "Interface"),
+		jen.Id("factory").Qual(informersPkg, "SharedInformerFactory"),
+	).Op("*").Id(reconciler).Block(
+		jen.Return(jen.Op("&").Id(reconciler).Values(jen.Dict{
+			jen.Id("Client"): jen.Id("client"),
+			jen.Id("Lister"): jen.Id("factory").Dot(groupMethod).Call().Dot(versionMethod).Call().Dot(kindsMethod).Call().Dot("Lister").Call(),
+		})),
+	)
+	f.Line()
+
+	get := jen.Id("r").Dot("Lister")
+	if c.namespaced {
+		get = get.Dot(kindsMethod).Call(jen.Id("req").Dot("Namespace"))
+	}
+	get = get.Dot("Get").Call(jen.Id("req").Dot("Name"))
+
+	f.Commentf("Reconcile reconciles the %s object.", c.kind)
+	f.Func().Params(jen.Id("r").Op("*").Id(reconciler)).Id("Reconcile").Params(
+		jen.Id("ctx").Qual("context", "Context"),
+		jen.Id("req").Qual(reconcilePkg, "Request"),
+	).Params(result.Clone(), jen.Error()).Block(
+		jen.List(jen.Id("obj"), jen.Err()).Op(":=").Add(get),
+		jen.If(jen.Qual(apierrorsPkg, "IsNotFound").Call(jen.Err())).Block(
+			jen.Return(result.Clone().Values(), jen.Nil()),
+		),
+		jen.If(jen.Err().Op("!=").Nil()).Block(
+			jen.Return(result.Clone().Values(), jen.Err()),
+		),
+		jen.Id("_").Op("=").Id("obj"),
+		jen.Line(),
+		jen.Comment("TODO: implement reconcile logic"),
+		jen.Return(result.Clone().Values(), jen.Nil()),
+	)
+	f.Line()
+
+	f.Comment("SetupWithManager sets up the controller with the Manager.")
+	f.Func().Params(jen.Id("r").Op("*").Id(reconciler)).Id("SetupWithManager").Params(
+		jen.Id("mgr").Qual(controllerRuntimePkg, "Manager"),
+	).Error().Block(
+		jen.Return(
+			jen.Qual(controllerRuntimePkg, "NewControllerManagedBy").Call(jen.Id("mgr")).Op(".").
+				Line().Id("For").Call(jen.Op("&").Qual(typesPkg, c.kind).Values()).Op(".").
+				Line().Id("Complete").Call(jen.Id("r")),
+		),
+	)
+	return f
+}
@@ -0,0 +1,47 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_scaffoldControllerSubcommand_render(t *testing.T) {
+	c := &scaffoldControllerSubcommand{
+		genOptions: &genOptions{
+			module:           "github.com/example/project",
+			apisModule:       "github.com/example/project",
+			apisPath:         "pkg/apis",
+			clientPath:       "pkg/clients",
+			clientsetDirName: "kubernetes",
+			informersDirName: "informers",
+			listersDirName:   "listers",
+		},
+		group:      "apps",
+		version:    "v1",
+		kind:       "Policy",
+		namespaced: true,
+	}
+
+	got := fmt.Sprintf("%#v", c.render("// header\n"))
+	assert.Contains(t, got, `clientset "github.com/example/project/pkg/clients/kubernetes"`)
+	assert.Contains(t, got, `informers "github.com/example/project/pkg/clients/informers"`)
+	assert.Contains(t, got, "Lister: factory.Apps().V1().Policies().Lister()")
+	assert.Contains(t, got, "obj, err := r.Lister.Policies(req.Namespace).Get(req.Name)")
+	assert.Contains(t, got, "func (r *PolicyReconciler) SetupWithManager(mgr ctrl.Manager) error {")
+}
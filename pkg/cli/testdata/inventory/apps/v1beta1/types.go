@@ -0,0 +1,17 @@
+// +groupName=apps.example.com
+// +k8s:conversion-gen=github.com/zoumo/kube-codegen/pkg/cli/testdata/inventory/apps
+package v1beta1
+
+import metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+type Foo struct {
+	metav1.TypeMeta `json:",inline"`
+	// +optional
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+}
+
+// +k8s:conversion-gen=false
+type Baz struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+}
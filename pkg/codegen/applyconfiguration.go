@@ -0,0 +1,81 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"fmt"
+	"go/token"
+	"path"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/zoumo/make-rules/pkg/runner"
+)
+
+// ParseApplyExternalType parses mapping in <type-package>/<Kind>=<applyconfiguration-package>
+// form, e.g. k8s.io/api/core/v1/PodSpec=k8s.io/client-go/applyconfigurations/core/v1,
+// and returns the type in <type-package>.<Kind> form and the apply configuration package.
+func ParseApplyExternalType(mapping string) (string, string, error) {
+	parts := strings.SplitN(mapping, "=", 2)
+	if len(parts) != 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+		return "", "", fmt.Errorf("invalid apply external type %q, it must be in <type-package>/<Kind>=<applyconfiguration-package> form", mapping)
+	}
+	pkg, kind := path.Split(parts[0])
+	pkg = strings.TrimSuffix(pkg, "/")
+	if len(pkg) == 0 || !token.IsIdentifier(kind) || !token.IsExported(kind) {
+		return "", "", fmt.Errorf("invalid apply external type %q, %q is not a <type-package>/<Kind>", mapping, parts[0])
+	}
+	return pkg + "." + kind, parts[1], nil
+}
+
+// applyConfigurationArgs returns args of applyconfiguration-gen without the
+// common args.
+func (c *CodeGenerator) applyConfigurationArgs() ([]string, error) {
+	args := []string{
+		"--go-header-file", c.goHeaderFile(),
+		"--input-dirs", strings.Join(c.inputPackages, ","),
+		"--output-base", c.outputBase,
+		"--output-package", c.applyConfigurationPackage,
+	}
+	if len(c.applyExternalTypes) == 0 {
+		return args, nil
+	}
+	externals := make([]string, 0, len(c.applyExternalTypes))
+	for _, mapping := range c.applyExternalTypes {
+		typeName, applyPackage, err := ParseApplyExternalType(mapping)
+		if err != nil {
+			return nil, err
+		}
+		externals = append(externals, typeName+":"+applyPackage)
+	}
+	return append(args, "--external-applyconfigurations", strings.Join(externals, ",")), nil
+}
+
+func (c *CodeGenerator) genApplyConfiguration(logger logr.Logger, run *runner.Runner) error {
+	generatorName := "applyconfiguration-gen"
+
+	args, err := c.applyConfigurationArgs()
+	if err != nil {
+		return err
+	}
+	args = c.appendArgs(args)
+	logger.Info(generatorName, "args", strings.Join(args, " "))
+	out, err := run.RunCombinedOutput(args...)
+	if err != nil {
+		logger.Error(err, "failed to run generator", "generator", generatorName)
+		return err
+	}
+	return c.checkWarnings(generatorName, out)
+}
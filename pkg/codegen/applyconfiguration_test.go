@@ -0,0 +1,77 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseApplyExternalType(t *testing.T) {
+	tests := []struct {
+		mapping      string
+		typeName     string
+		applyPackage string
+		wantErr      bool
+	}{
+		{
+			mapping:      "k8s.io/api/core/v1/PodSpec=k8s.io/client-go/applyconfigurations/core/v1",
+			typeName:     "k8s.io/api/core/v1.PodSpec",
+			applyPackage: "k8s.io/client-go/applyconfigurations/core/v1",
+		},
+		{mapping: "k8s.io/api/core/v1/PodSpec", wantErr: true},
+		{mapping: "k8s.io/api/core/v1/PodSpec=", wantErr: true},
+		{mapping: "PodSpec=k8s.io/client-go/applyconfigurations/core/v1", wantErr: true},
+		{mapping: "k8s.io/api/core/v1/podSpec=k8s.io/client-go/applyconfigurations/core/v1", wantErr: true},
+		{mapping: "k8s.io/api/core/v1/=k8s.io/client-go/applyconfigurations/core/v1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mapping, func(t *testing.T) {
+			typeName, applyPackage, err := ParseApplyExternalType(tt.mapping)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.typeName, typeName)
+			assert.Equal(t, tt.applyPackage, applyPackage)
+		})
+	}
+}
+
+func Test_applyConfigurationArgs(t *testing.T) {
+	c := newTestCodeGenerator().WithApplyConfigurationPackage("github.com/example/project/pkg/clients/applyconfiguration")
+	assert.Equal(t, "--apply-configuration-package is not specified", newTestCodeGenerator().skipReason("applyconfiguration"))
+	assert.Empty(t, c.skipReason("applyconfiguration"))
+	// apply configurations are generated without Apply() methods as well
+	assert.Empty(t, newTestCodeGenerator().WithApplyConfigurationPackage("github.com/example/project/pkg/clients/applyconfiguration").WithApplyMethods(false).skipReason("applyconfiguration"))
+
+	args, err := c.applyConfigurationArgs()
+	assert.NoError(t, err)
+	assert.Contains(t, args, "github.com/example/project/pkg/clients/applyconfiguration")
+	assert.NotContains(t, args, "--external-applyconfigurations")
+
+	c.WithApplyExternalTypes([]string{
+		"k8s.io/api/core/v1/PodSpec=k8s.io/client-go/applyconfigurations/core/v1",
+		"k8s.io/api/apps/v1/DeploymentSpec=k8s.io/client-go/applyconfigurations/apps/v1",
+	})
+	args, err = c.applyConfigurationArgs()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"--external-applyconfigurations",
+		"k8s.io/api/core/v1.PodSpec:k8s.io/client-go/applyconfigurations/core/v1,k8s.io/api/apps/v1.DeploymentSpec:k8s.io/client-go/applyconfigurations/apps/v1",
+	}, args[len(args)-2:])
+}
@@ -0,0 +1,69 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+)
+
+// gateGeneratedFiles rewrites the build constraints of <fileBase>.go
+// generated for pkgs by a gengo generator run with --build-tag tag. gengo
+// parses files gated by the tag, but gates its output by the negated tag to
+// identify generated files, which would exclude the output exactly when the
+// types it is generated from are built. The output is gated by the tag
+// instead, the same as the types files.
+func (c *CodeGenerator) gateGeneratedFiles(fileBase, tag string, pkgs []string) error {
+	if len(tag) == 0 {
+		return nil
+	}
+	for _, pkg := range pkgs {
+		file := path.Join(c.outputBase, pkg, fileBase+".go")
+		content, err := ioutil.ReadFile(file)
+		if os.IsNotExist(err) {
+			// nothing generated for the package
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(file, gateBuildConstraints(content, tag), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// gateBuildConstraints replaces the leading build constraints of go file
+// content negating tag with ones requiring it.
+func gateBuildConstraints(content []byte, tag string) []byte {
+	lines := strings.SplitAfter(string(content), "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch trimmed {
+		case "//go:build !" + tag:
+			lines[i] = "//go:build " + tag + "\n"
+		case "// +build !" + tag:
+			lines[i] = "// +build " + tag + "\n"
+		default:
+			if !strings.HasPrefix(trimmed, "//go:build ") && !strings.HasPrefix(trimmed, "// +build ") {
+				return []byte(strings.Join(lines, ""))
+			}
+		}
+	}
+	return []byte(strings.Join(lines, ""))
+}
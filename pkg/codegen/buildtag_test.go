@@ -0,0 +1,72 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_gateBuildConstraints(t *testing.T) {
+	content := "//go:build !conversion\n// +build !conversion\n\n// Code generated by conversion-gen. DO NOT EDIT.\n\npackage v1\n\n// +build !conversion\n"
+	want := "//go:build conversion\n// +build conversion\n\n// Code generated by conversion-gen. DO NOT EDIT.\n\npackage v1\n\n// +build !conversion\n"
+	assert.Equal(t, want, string(gateBuildConstraints([]byte(content), "conversion")))
+	// other constraints are kept
+	content = "//go:build !ignore_autogenerated\n// +build !ignore_autogenerated\n\npackage v1\n"
+	assert.Equal(t, content, string(gateBuildConstraints([]byte(content), "conversion")))
+}
+
+func Test_genConversion_buildTag(t *testing.T) {
+	c := newTestWorkspaceGenerator(t, map[string]string{
+		"pkg/apis/apps/types.go":  "package apps\n\ntype Foo struct {\n\tName string\n}\n",
+		"pkg/apis/apps/v1/doc.go": "// +k8s:conversion-gen=github.com/example/project/pkg/apis/apps\npackage v1\n",
+		// only built with the tag
+		"pkg/apis/apps/v1/types.go": `//go:build v1api
+// +build v1api
+
+package v1
+
+import "k8s.io/apimachinery/pkg/runtime"
+
+var (
+	localSchemeBuilder = runtime.NewSchemeBuilder()
+	AddToScheme        = localSchemeBuilder.AddToScheme
+)
+
+type Foo struct {
+	Name string
+}
+`,
+	})
+	c.WithConversionBuildTag("v1api")
+	run := testGeneratorRunner(t, c, "conversion")
+	assert.NoError(t, c.genConversion(c.logger, run))
+
+	content, err := ioutil.ReadFile(filepath.Join(c.outputBase, "github.com/example/project/pkg/apis/apps/v1/zz_generated.conversion.go"))
+	assert.NoError(t, err)
+	got := string(content)
+	assert.Contains(t, got, "//go:build v1api\n// +build v1api\n")
+	assert.Contains(t, got, "func Convert_v1_Foo_To_apps_Foo(")
+
+	// the conversions are built along with the types gated by the tag
+	writeTestFiles(t, c.workspace, map[string]string{
+		"pkg/apis/apps/v1/zz_generated.conversion.go": got,
+	})
+	goBuild(t, c, "-tags", "v1api", "./pkg/apis/...")
+	goBuild(t, c, "./pkg/apis/...")
+}
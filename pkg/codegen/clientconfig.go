@@ -0,0 +1,86 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"fmt"
+	"path"
+	"text/template"
+)
+
+const (
+	ClientContentTypeJSON     = "json"
+	ClientContentTypeProtobuf = "protobuf"
+)
+
+var clientConfigTemplate = template.Must(template.New("config").Parse(`{{ .Header }}
+// Code generated by kube-codegen. DO NOT EDIT.
+
+package {{ .Package }}
+
+import (
+	"k8s.io/apimachinery/pkg/runtime"
+	rest "k8s.io/client-go/rest"
+)
+
+// ContentType is the content type negotiated by clientsets created by NewForConfigWithContentType.
+const ContentType = {{ .ContentType }}
+
+// ConfigWithContentType returns a copy of c which negotiates ContentType with apiserver.
+// JSON is always accepted, because not all resources support protobuf, e.g. CRDs.
+func ConfigWithContentType(c *rest.Config) *rest.Config {
+	config := rest.CopyConfig(c)
+	config.ContentType = ContentType
+	if ContentType == runtime.ContentTypeJSON {
+		config.AcceptContentTypes = runtime.ContentTypeJSON
+	} else {
+		config.AcceptContentTypes = ContentType + "," + runtime.ContentTypeJSON
+	}
+	return config
+}
+
+// NewForConfigWithContentType creates a new Clientset for the given config which negotiates ContentType.
+func NewForConfigWithContentType(c *rest.Config) (*Clientset, error) {
+	return NewForConfig(ConfigWithContentType(c))
+}
+`))
+
+// clientContentTypeConst returns the runtime constant of content type.
+func clientContentTypeConst(contentType string) (string, error) {
+	switch contentType {
+	case "", ClientContentTypeJSON:
+		return "runtime.ContentTypeJSON", nil
+	case ClientContentTypeProtobuf:
+		return "runtime.ContentTypeProtobuf", nil
+	}
+	return "", fmt.Errorf("unsupported client content type %q, must be one of %v", contentType, []string{ClientContentTypeJSON, ClientContentTypeProtobuf})
+}
+
+// genClientConfig generates config.go in clientset dir with helpers building
+// clientset which negotiates content type.
+func (c *CodeGenerator) genClientConfig(dir string) error {
+	if len(c.clientContentType) == 0 {
+		return nil
+	}
+	contentType, err := clientContentTypeConst(c.clientContentType)
+	if err != nil {
+		return err
+	}
+	configFile := path.Join(dir, "config.go")
+	c.logger.Info("generating client config", "file", configFile, "contentType", c.clientContentType)
+	return c.writeHelperFile(dir, "config.go", clientConfigTemplate, map[string]interface{}{
+		"ContentType": contentType,
+	})
+}
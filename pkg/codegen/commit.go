@@ -0,0 +1,148 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+
+	"github.com/zoumo/make-rules/pkg/runner"
+)
+
+// defaultCommitMessage is the commit message used by WithCommit if it is empty.
+const defaultCommitMessage = "Regenerate code with kube-codegen"
+
+func (c *CodeGenerator) gitCmd() *runner.Runner {
+	return runner.NewRunner("git").WithDir(c.workspace)
+}
+
+// checkGitRepo returns error if workspace is not in a git work tree.
+func (c *CodeGenerator) checkGitRepo() error {
+	if _, err := c.gitCmd().RunOutput("rev-parse", "--is-inside-work-tree"); err != nil {
+		return fmt.Errorf("--commit requires workspace %v to be in a git repository, err: %v", c.workspace, err)
+	}
+	return nil
+}
+
+// generatedFileList returns slash separated paths of all files in src relative to src.
+func generatedFileList(src string) ([]string, error) {
+	files := []string{}
+	err := filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	return files, err
+}
+
+// commitGenerated stages generated files of last Run along with the manifest
+// and creates a commit of them if any of them changed. Files ignored by git
+// are not committed, and other changes in workspace are left untouched.
+func (c *CodeGenerator) commitGenerated() error {
+	git := c.gitCmd()
+	pathspecs := append([]string{manifestFileName}, c.generatedFiles...)
+	if c.cleanOutputDirs {
+		// generated files removed by cleaning are tracked but deleted
+		out, err := git.RunOutput(append([]string{"ls-files", "-z", "--deleted", "--"}, c.generatedDirs()...)...)
+		if err != nil {
+			return err
+		}
+		pathspecs = append(pathspecs, splitNul(out)...)
+	}
+
+	ignored, err := git.RunOutput(append([]string{"ls-files", "-z", "--others", "--ignored", "--exclude-standard", "--"}, pathspecs...)...)
+	if err != nil {
+		return err
+	}
+	pathspecs = subtract(pathspecs, splitNul(ignored))
+	if len(pathspecs) == 0 {
+		c.logger.Info("no generated files to commit")
+		return nil
+	}
+
+	if _, err := git.RunCombinedOutput(append([]string{"add", "-A", "--"}, pathspecs...)...); err != nil {
+		return err
+	}
+	out, err := git.RunOutput(append([]string{"diff", "--cached", "--name-only", "-z", "--"}, pathspecs...)...)
+	if err != nil {
+		return err
+	}
+	changed := splitNul(out)
+	if len(changed) == 0 || (len(changed) == 1 && filepath.Base(changed[0]) == manifestFileName) {
+		// the manifest alone changes only when the source date epoch changes
+		c.logger.Info("generated files not changed, skip committing")
+		return nil
+	}
+
+	message := c.commitMessage
+	if len(message) == 0 {
+		message = defaultCommitMessage
+	}
+	c.logger.Info("committing generated files", "files", len(changed), "message", message)
+	if _, err := git.RunCombinedOutput(append([]string{"commit", "-q", "-m", message, "--"}, pathspecs...)...); err != nil {
+		return err
+	}
+	return nil
+}
+
+// generatedDirs returns slash separated dirs of generated files relative to workspace.
+func (c *CodeGenerator) generatedDirs() []string {
+	dirs := []string{}
+	seen := map[string]bool{}
+	for _, f := range c.generatedFiles {
+		dir := filepath.Dir(filepath.FromSlash(f))
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, filepath.ToSlash(dir))
+		}
+	}
+	return dirs
+}
+
+func splitNul(out []byte) []string {
+	result := []string{}
+	for _, s := range bytes.Split(out, []byte{0}) {
+		if len(s) > 0 {
+			result = append(result, string(s))
+		}
+	}
+	return result
+}
+
+func subtract(list, remove []string) []string {
+	removed := map[string]bool{}
+	for _, s := range remove {
+		removed[strings.TrimSuffix(s, "/")] = true
+	}
+	result := []string{}
+	for _, s := range list {
+		if !removed[s] {
+			result = append(result, s)
+		}
+	}
+	return result
+}
@@ -0,0 +1,112 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func runGit(t *testing.T, dir string, args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	assert.NoError(t, err, string(out))
+	return strings.TrimSpace(string(out))
+}
+
+func Test_commitGenerated(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not found")
+	}
+
+	c := newTestCodeGenerator()
+	c.workspace = t.TempDir()
+	assert.Error(t, c.checkGitRepo())
+
+	runGit(t, c.workspace, "init", "-q")
+	runGit(t, c.workspace, "config", "user.name", "test")
+	runGit(t, c.workspace, "config", "user.email", "test@example.com")
+	assert.NoError(t, c.checkGitRepo())
+	writeTestFiles(t, c.workspace, map[string]string{
+		".gitignore":                "*.report\n",
+		"pkg/apis/apps/v1/types.go": "package v1\n",
+	})
+	runGit(t, c.workspace, "add", "-A")
+	runGit(t, c.workspace, "commit", "-q", "-m", "init")
+
+	// generated files and an unrelated change
+	writeTestFiles(t, c.workspace, map[string]string{
+		manifestFileName: "{}\n",
+		"pkg/apis/apps/v1/zz_generated.deepcopy.go": "package v1\n",
+		"pkg/apis/apps/v1/violations.report":        "",
+		"pkg/apis/apps/v1/types.go":                 "package v1\n\ntype Foo struct{}\n",
+	})
+	c.generatedFiles = []string{"pkg/apis/apps/v1/zz_generated.deepcopy.go", "pkg/apis/apps/v1/violations.report"}
+	c.WithCommit(true, "regenerate")
+	assert.NoError(t, c.commitGenerated())
+	assert.Equal(t, "regenerate", runGit(t, c.workspace, "log", "-1", "--format=%s"))
+	assert.ElementsMatch(t,
+		[]string{manifestFileName, "pkg/apis/apps/v1/zz_generated.deepcopy.go"},
+		strings.Split(runGit(t, c.workspace, "show", "--name-only", "--format=", "HEAD"), "\n"),
+	)
+	// unrelated change is left untouched
+	assert.Equal(t, "M pkg/apis/apps/v1/types.go", runGit(t, c.workspace, "status", "--porcelain"))
+
+	// only the manifest changed
+	writeTestFiles(t, c.workspace, map[string]string{manifestFileName: "{\"generatedAt\": \"now\"}\n"})
+	assert.NoError(t, c.commitGenerated())
+	assert.Equal(t, "2", runGit(t, c.workspace, "rev-list", "--count", "HEAD"))
+}
+
+func Test_commitGenerated_inProcess(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not found")
+	}
+
+	c := newTestCodeGenerator().WithCommit(true, "regenerate")
+	c.workspace = t.TempDir()
+	c.outputBase = filepath.Join(c.workspace, "__output", "generated")
+	c.boilerplatePath = filepath.Join(c.workspace, "hack", "boilerplate.go.txt")
+	runGit(t, c.workspace, "init", "-q")
+	runGit(t, c.workspace, "config", "user.name", "test")
+	runGit(t, c.workspace, "config", "user.email", "test@example.com")
+	writeTestFiles(t, c.workspace, map[string]string{
+		".gitignore":                                    "/__output\n",
+		"hack/boilerplate.go.txt":                       "// header\n",
+		"pkg/apis/apps/v1/types.go":                     "package v1\n",
+		"pkg/apis/apps/crds/apps.example.com_foos.yaml": "kind: CustomResourceDefinition\n",
+	})
+	runGit(t, c.workspace, "add", "-A")
+	runGit(t, c.workspace, "commit", "-q", "-m", "init")
+
+	// written by crd and install generators in process
+	writeTestFiles(t, c.generatedDir(c.apisPath), map[string]string{
+		"apps/crds/apps.example.com_foos.yaml": "kind: CustomResourceDefinition\nspec: {}\n",
+		"apps/v1/zz.generated.refs.go":         "package v1\n",
+		"apps/types.md":                        "# apps\n",
+	})
+	assert.NoError(t, c.postRun([]string{"crd", "install"}))
+	assert.NoError(t, c.commitGenerated())
+	assert.ElementsMatch(t,
+		[]string{manifestFileName, "pkg/apis/apps/crds/apps.example.com_foos.yaml", "pkg/apis/apps/v1/zz.generated.refs.go", "pkg/apis/apps/types.md"},
+		strings.Split(runGit(t, c.workspace, "show", "--name-only", "--format=", "HEAD"), "\n"),
+	)
+	assert.Empty(t, runGit(t, c.workspace, "status", "--porcelain"))
+}
@@ -0,0 +1,549 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/zoumo/goset"
+)
+
+const labelsKeyFieldPrefix = "labels."
+
+// generatedMarker marks files generated by kube-codegen itself.
+const generatedMarker = "// Code generated by kube-codegen. DO NOT EDIT."
+
+var (
+	nonIdentifierRegexp = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+	compositeKeyTemplate = template.Must(template.New("compositekey").Funcs(template.FuncMap{
+		"join": strings.Join,
+	}).Parse(`{{ .Header }}
+` + generatedMarker + `
+
+package {{ .Package }}
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	{{ .Alias }} "{{ .TypesPackage }}"
+)
+
+// {{ .Kind }}ListerExpansion allows custom methods to be added to
+// {{ .Kind }}Lister.
+type {{ .Kind }}ListerExpansion interface {
+	// GetByCompositeKey retrieves the {{ .Kind }}s from the index for a given composite key.
+	// Objects returned here must be treated as read-only.
+	GetByCompositeKey(namespace{{ range .Fields }}, {{ .Param }}{{ end }} string) ([]*{{ .Alias }}.{{ .Kind }}, error)
+}
+{{ if .Namespaced }}
+// {{ .Kind }}NamespaceListerExpansion allows custom methods to be added to
+// {{ .Kind }}NamespaceLister.
+type {{ .Kind }}NamespaceListerExpansion interface{}
+{{ end }}
+// {{ .Kind }}CompositeKeyIndex is the name of the index of {{ .Kind }}s by
+// namespace{{ range .Fields }}, {{ .Field }}{{ end }}.
+const {{ .Kind }}CompositeKeyIndex = "{{ .Kind }}CompositeKey"
+
+// {{ .Kind }}CompositeKey returns the key of {{ .Kind }}s in {{ .Kind }}CompositeKeyIndex,
+// namespace is empty for cluster-scoped {{ .Kind }}s. Values are quoted, so that
+// keys of different values never collide.
+func {{ .Kind }}CompositeKey(namespace{{ range .Fields }}, {{ .Param }}{{ end }} string) string {
+	return strings.Join([]string{strconv.Quote(namespace){{ range .Fields }}, strconv.Quote({{ .Param }}){{ end }}}, "/")
+}
+
+// {{ .Kind }}CompositeKeyFunc is the cache.IndexFunc of {{ .Kind }}CompositeKeyIndex,
+// fields behind nil pointers are empty.
+func {{ .Kind }}CompositeKeyFunc(obj interface{}) ([]string, error) {
+	o, ok := obj.(*{{ .Alias }}.{{ .Kind }})
+	if !ok {
+		return nil, fmt.Errorf("expected *{{ .Alias }}.{{ .Kind }}, got %T", obj)
+	}
+{{- range .Fields }}
+{{- if .Guards }}
+	{{ .Param }} := ""
+	if {{ join .Guards " && " }} {
+		{{ .Param }} = {{ .Value }}
+	}
+{{- else }}
+	{{ .Param }} := {{ .Value }}
+{{- end }}
+{{- end }}
+	return []string{ {{- .Kind }}CompositeKey(o.Namespace{{ range .Fields }}, {{ .Param }}{{ end }})}, nil
+}
+
+// GetByCompositeKey retrieves the {{ .Kind }}s from the index for a given composite key.
+func (s *{{ .Private }}Lister) GetByCompositeKey(namespace{{ range .Fields }}, {{ .Param }}{{ end }} string) ([]*{{ .Alias }}.{{ .Kind }}, error) {
+	objs, err := s.indexer.ByIndex({{ .Kind }}CompositeKeyIndex, {{ .Kind }}CompositeKey(namespace{{ range .Fields }}, {{ .Param }}{{ end }}))
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]*{{ .Alias }}.{{ .Kind }}, 0, len(objs))
+	for _, obj := range objs {
+		ret = append(ret, obj.(*{{ .Alias }}.{{ .Kind }}))
+	}
+	return ret, nil
+}
+`))
+)
+
+// ListerKeyFields is a kind whose listers retrieve objects by a composite key
+// of namespace and fields.
+type ListerKeyFields struct {
+	Group   string
+	Version string
+	Kind    string
+	// Fields are go field paths of the kind, e.g. Spec.NodeName, or
+	// labels.<key> for the value of label key.
+	Fields []string
+}
+
+// ParseListerKeyFields parses option in <group>/<version>/<Kind>=<field1>,<field2>
+// form, e.g. apps/v1/Foo=Spec.NodeName,labels.app.
+func ParseListerKeyFields(option string) (ListerKeyFields, error) {
+	parts := strings.SplitN(option, "=", 2)
+	if len(parts) != 2 || len(parts[1]) == 0 {
+		return ListerKeyFields{}, fmt.Errorf("invalid lister key fields %q, it must be in <group>/<version>/<Kind>=<field1>,<field2> form", option)
+	}
+	gvk := strings.Split(parts[0], "/")
+	if len(gvk) != 3 || len(gvk[0]) == 0 || len(gvk[1]) == 0 || !token.IsIdentifier(gvk[2]) || !token.IsExported(gvk[2]) {
+		return ListerKeyFields{}, fmt.Errorf("invalid lister key fields %q, %q is not a <group>/<version>/<Kind>", option, parts[0])
+	}
+	fields := strings.Split(parts[1], ",")
+	for _, field := range fields {
+		if strings.HasPrefix(field, labelsKeyFieldPrefix) && len(field) > len(labelsKeyFieldPrefix) {
+			continue
+		}
+		for _, name := range strings.Split(field, ".") {
+			if !token.IsIdentifier(name) || !token.IsExported(name) {
+				return ListerKeyFields{}, fmt.Errorf("invalid lister key fields %q, %q is neither a go field path nor labels.<key>", option, field)
+			}
+		}
+	}
+	return ListerKeyFields{Group: gvk[0], Version: gvk[1], Kind: gvk[2], Fields: fields}, nil
+}
+
+// keyField is a field of the composite key rendered in go source.
+type keyField struct {
+	Field string
+	// Param is the parameter name of the field in CompositeKey and GetByCompositeKey
+	Param string
+	// Guards are the conditions of pointers on the path of the field not being
+	// nil, which must hold before Value is evaluated
+	Guards []string
+	// Value is the string expression of the field value of object o
+	Value string
+}
+
+// keyPackage is an input package containing kinds of composite keys.
+type keyPackage struct {
+	path  string
+	fset  *token.FileSet
+	files []*ast.File
+	srcs  map[string][]byte
+	// groups are names the group of package matches, i.e. the parent dir, the
+	// +groupName and its first label
+	groups goset.Set
+	types  *types.Package
+}
+
+// compositeKeyKind is a kind of ListerKeyFields found in input packages.
+type compositeKeyKind struct {
+	ListerKeyFields
+	pkg *keyPackage
+}
+
+// compositeKeyKinds finds input packages of kinds of WithListerKeyFields.
+func (c *CodeGenerator) compositeKeyKinds() ([]compositeKeyKind, error) {
+	options, err := c.parseListerKeyFields()
+	if err != nil {
+		return nil, err
+	}
+	loaded := map[string]*keyPackage{}
+	kinds := make([]compositeKeyKind, 0, len(options))
+	for _, k := range options {
+		var found *keyPackage
+		for _, pkg := range c.inputPackages {
+			if path.Base(pkg) != k.Version {
+				continue
+			}
+			p, ok := loaded[pkg]
+			if !ok {
+				p, err = c.parseKeyPackage(pkg)
+				if err != nil {
+					return nil, err
+				}
+				loaded[pkg] = p
+			}
+			if p.groups.Contains(k.Group) {
+				found = p
+				break
+			}
+		}
+		if found == nil {
+			return nil, fmt.Errorf("input package of %v/%v/%v is not found", k.Group, k.Version, k.Kind)
+		}
+		kinds = append(kinds, compositeKeyKind{ListerKeyFields: k, pkg: found})
+	}
+	return kinds, nil
+}
+
+// parseKeyPackage parses go files of pkg.
+func (c *CodeGenerator) parseKeyPackage(pkg string) (*keyPackage, error) {
+	out, err := c.goCmd.RunOutput("list", "-f", "{{ .Dir }}{{ range .GoFiles }}\n{{ . }}{{ end }}", pkg)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	dir := lines[0]
+	p := &keyPackage{
+		path:   pkg,
+		fset:   token.NewFileSet(),
+		srcs:   map[string][]byte{},
+		groups: goset.NewSetFromStrings([]string{path.Base(path.Dir(pkg))}),
+	}
+	for _, name := range lines[1:] {
+		filename := filepath.Join(dir, name)
+		src, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		f, err := parser.ParseFile(p.fset, filename, src, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		p.files = append(p.files, f)
+		p.srcs[filename] = src
+		if f.Doc == nil {
+			continue
+		}
+		for _, line := range strings.Split(f.Doc.Text(), "\n") {
+			if group := strings.TrimPrefix(strings.TrimSpace(line), "+groupName="); group != strings.TrimSpace(line) {
+				p.groups.Add(group, strings.SplitN(group, ".", 2)[0]) //nolint
+			}
+		}
+	}
+	return p, nil
+}
+
+// listerDir returns the dir of the lister of k relative to listers dir, which
+// is named by lister-gen after the parent dir and the version of the package.
+func (k compositeKeyKind) listerDir() string {
+	return path.Join(strings.ToLower(path.Base(path.Dir(k.pkg.path))), strings.ToLower(k.Version))
+}
+
+// namespaced returns false if k is marked with +genclient:nonNamespaced.
+func (k compositeKeyKind) namespaced() (bool, error) {
+	nonNamespaced := false
+	for filename, src := range k.pkg.srcs {
+		_, err := retagFile(filename, src, func(kind string, lines []string) []string {
+			if kind == k.Kind {
+				for _, line := range lines {
+					nonNamespaced = nonNamespaced || commentTag(line) == "genclient:nonNamespaced"
+				}
+			}
+			return lines
+		})
+		if err != nil {
+			return false, err
+		}
+	}
+	return !nonNamespaced, nil
+}
+
+// keyFields type checks the package of k, and resolves fields of k to string
+// values of object o.
+func (k compositeKeyKind) keyFields() ([]keyField, error) {
+	if k.pkg.types == nil {
+		conf := types.Config{Importer: importer.ForCompiler(k.pkg.fset, "source", nil)}
+		pkg, err := conf.Check(k.pkg.path, k.pkg.fset, k.pkg.files, nil)
+		if err != nil {
+			return nil, err
+		}
+		k.pkg.types = pkg
+	}
+	obj, ok := k.pkg.types.Scope().Lookup(k.Kind).(*types.TypeName)
+	if !ok {
+		return nil, fmt.Errorf("type %v is not found in %v", k.Kind, k.pkg.path)
+	}
+
+	// reserved names in generated functions
+	params := map[string]bool{"namespace": true, "o": true, "ok": true, "obj": true, "objs": true, "err": true, "ret": true, "s": true,
+		"fmt": true, "strconv": true, "strings": true, k.pkg.types.Name(): true}
+	fields := make([]keyField, 0, len(k.Fields))
+	for i, field := range k.Fields {
+		name := field[strings.LastIndex(field, ".")+1:]
+		fieldPath := field
+		if strings.HasPrefix(field, labelsKeyFieldPrefix) {
+			key := strings.TrimPrefix(field, labelsKeyFieldPrefix)
+			name = ""
+			for _, word := range nonIdentifierRegexp.Split(key, -1) {
+				if len(word) > 0 {
+					name += strings.ToUpper(word[:1]) + word[1:]
+				}
+			}
+			fieldPath = "Labels"
+		}
+		guards, expr, typ, err := selectField(obj.Type(), fieldPath)
+		if err != nil {
+			return nil, fmt.Errorf("invalid field %v of %v: %v", field, k.Kind, err)
+		}
+		var value string
+		if fieldPath == "Labels" {
+			if m, ok := typ.Underlying().(*types.Map); !ok || !isString(m.Key()) || !isString(m.Elem()) {
+				return nil, fmt.Errorf("invalid field %v of %v: Labels is %v, not map[string]string", field, k.Kind, typ)
+			}
+			value = expr + "[" + strconv.Quote(strings.TrimPrefix(field, labelsKeyFieldPrefix)) + "]"
+		} else {
+			if p, ok := typ.Underlying().(*types.Pointer); ok {
+				guards = append(guards, expr+" != nil")
+				expr, typ = "*"+expr, p.Elem()
+			}
+			if !isString(typ) {
+				return nil, fmt.Errorf("invalid field %v of %v: %v is not a string", field, k.Kind, typ)
+			}
+			value = expr
+			if !types.Identical(typ, types.Typ[types.String]) {
+				value = "string(" + expr + ")"
+			}
+		}
+
+		param := private(name)
+		if !token.IsIdentifier(param) || token.IsKeyword(param) || params[param] {
+			param = fmt.Sprintf("value%d", i)
+		}
+		params[param] = true
+		fields = append(fields, keyField{Field: field, Param: param, Guards: guards, Value: value})
+	}
+	return fields, nil
+}
+
+// selectField resolves go field path of object o of type t, fields promoted
+// from embedded structs are selected explicitly. It returns the conditions of
+// pointers on the path not being nil, the expression and the type of the field.
+func selectField(t types.Type, fieldPath string) ([]string, string, types.Type, error) {
+	guards := []string{}
+	expr := "o"
+	for _, name := range strings.Split(fieldPath, ".") {
+		obj, index, _ := types.LookupFieldOrMethod(t, false, nil, name)
+		if _, ok := obj.(*types.Var); !ok {
+			return nil, "", nil, fmt.Errorf("field %v is not found in %v", name, t)
+		}
+		for _, idx := range index {
+			if p, ok := t.Underlying().(*types.Pointer); ok {
+				guards = append(guards, expr+" != nil")
+				t = p.Elem()
+			}
+			field := t.Underlying().(*types.Struct).Field(idx)
+			expr += "." + field.Name()
+			t = field.Type()
+		}
+	}
+	return guards, expr, t, nil
+}
+
+// isString returns true if the underlying type of t is string.
+func isString(t types.Type) bool {
+	basic, ok := t.Underlying().(*types.Basic)
+	return ok && basic.Info()&types.IsString != 0
+}
+
+// genCompositeKeyExpansions generates <kind>_expansion.go of kinds in lister-gen
+// output dir, it must run before lister-gen, which takes them as expansions of
+// listers, so that <Kind>Lister has GetByCompositeKey.
+//
+// Expansions generated by previous runs are removed first, kinds having
+// expansions written by hand are not supported.
+func (c *CodeGenerator) genCompositeKeyExpansions(root string, kinds []compositeKeyKind) error {
+	err := filepath.WalkDir(root, func(fpath string, d fs.DirEntry, ierr error) error {
+		if os.IsNotExist(ierr) {
+			return filepath.SkipDir
+		}
+		if ierr != nil || d.IsDir() || !strings.HasSuffix(d.Name(), "_expansion.go") {
+			return ierr
+		}
+		content, err := ioutil.ReadFile(fpath)
+		if err != nil {
+			return err
+		}
+		if !bytes.Contains(content, []byte(generatedMarker)) {
+			return nil
+		}
+		return os.Remove(fpath)
+	})
+	if err != nil {
+		return err
+	}
+
+	header, err := c.boilerplate()
+	if err != nil {
+		return err
+	}
+	for _, k := range kinds {
+		dir := filepath.Join(root, k.listerDir())
+		expansion := filepath.Join(dir, strings.ToLower(k.Kind)+"_expansion.go")
+		if _, err := os.Stat(expansion); err == nil {
+			return fmt.Errorf("lister expansion %v is written by hand, GetByCompositeKey of %v can not be generated", expansion, k.Kind)
+		}
+		fields, err := k.keyFields()
+		if err != nil {
+			return err
+		}
+		namespaced, err := k.namespaced()
+		if err != nil {
+			return err
+		}
+		if goset.NewSetFromStrings(c.nonNamespacedKinds).Contains(k.Kind) {
+			namespaced = false
+		}
+		buf := bytes.Buffer{}
+		err = compositeKeyTemplate.Execute(&buf, map[string]interface{}{
+			"Header":       header,
+			"Package":      goPackageName(dir),
+			"Alias":        k.pkg.types.Name(),
+			"TypesPackage": k.pkg.path,
+			"Kind":         k.Kind,
+			"Private":      private(k.Kind),
+			"Namespaced":   namespaced,
+			"Fields":       fields,
+		})
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		c.logger.Info("generating composite key lister expansion", "file", expansion, "kind", k.Kind, "fields", k.Fields)
+		if err := writeGoFile(expansion, buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// registerCompositeKeyIndexers adds the composite key indexers of kinds to the
+// indexers of default informers in informer-gen output dir.
+func (c *CodeGenerator) registerCompositeKeyIndexers(root string, kinds []compositeKeyKind) error {
+	for _, k := range kinds {
+		listerPackage := path.Join(c.workspaceModule, c.clientPath, c.listerDirName, k.listerDir())
+		found := false
+		err := walkGeneratedFiles(root, strings.ToLower(k.Kind)+".go", func(dir string, content []byte) ([]byte, error) {
+			fset := token.NewFileSet()
+			f, err := parser.ParseFile(fset, "", content, parser.ParseComments)
+			if err != nil {
+				return nil, err
+			}
+			lister := importName(f, listerPackage)
+			if lister == "" {
+				// not the informer of kind
+				return content, nil
+			}
+			indexers := defaultInformerIndexers(f, private(k.Kind)+"Informer")
+			if indexers == nil {
+				return nil, fmt.Errorf("default informer of %v is not found in %v", k.Kind, dir)
+			}
+			found = true
+			c.logger.Info("registering composite key indexer", "dir", dir, "kind", k.Kind)
+			indexers.Elts = append(indexers.Elts, &ast.KeyValueExpr{
+				Key:   &ast.SelectorExpr{X: ast.NewIdent(lister), Sel: ast.NewIdent(k.Kind + "CompositeKeyIndex")},
+				Value: &ast.SelectorExpr{X: ast.NewIdent(lister), Sel: ast.NewIdent(k.Kind + "CompositeKeyFunc")},
+			})
+			buf := bytes.Buffer{}
+			if err := format.Node(&buf, fset, f); err != nil {
+				return nil, err
+			}
+			return buf.Bytes(), nil
+		})
+		if err != nil {
+			return err
+		}
+		if !found {
+			return fmt.Errorf("informer of %v/%v/%v is not found in %v", k.Group, k.Version, k.Kind, root)
+		}
+	}
+	return nil
+}
+
+// importName returns the name of importPath in f, empty means it is not
+// imported.
+func importName(f *ast.File, importPath string) string {
+	for _, imp := range f.Imports {
+		if p, _ := strconv.Unquote(imp.Path.Value); p != importPath {
+			continue
+		}
+		if imp.Name != nil {
+			return imp.Name.Name
+		}
+		return path.Base(importPath)
+	}
+	return ""
+}
+
+// defaultInformerIndexers returns the cache.Indexers literal in defaultInformer
+// method of informer type in f.
+func defaultInformerIndexers(f *ast.File, informer string) *ast.CompositeLit {
+	for _, decl := range f.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Name.Name != "defaultInformer" || fn.Recv == nil || len(fn.Recv.List) != 1 {
+			continue
+		}
+		star, ok := fn.Recv.List[0].Type.(*ast.StarExpr)
+		if !ok {
+			continue
+		}
+		if ident, ok := star.X.(*ast.Ident); !ok || ident.Name != informer {
+			continue
+		}
+		var ret *ast.CompositeLit
+		ast.Inspect(fn.Body, func(n ast.Node) bool {
+			lit, ok := n.(*ast.CompositeLit)
+			if !ok {
+				return ret == nil
+			}
+			if sel, ok := lit.Type.(*ast.SelectorExpr); ok && sel.Sel.Name == "Indexers" {
+				ret = lit
+			}
+			return ret == nil
+		})
+		return ret
+	}
+	return nil
+}
+
+// private lowers the first letter of name as informer-gen and lister-gen do.
+func private(name string) string {
+	r, size := utf8.DecodeRuneInString(name)
+	return string(unicode.ToLower(r)) + name[size:]
+}
@@ -0,0 +1,270 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/otiai10/copy"
+	"github.com/stretchr/testify/assert"
+	"github.com/zoumo/make-rules/pkg/runner"
+)
+
+func TestParseListerKeyFields(t *testing.T) {
+	tests := []struct {
+		option  string
+		want    ListerKeyFields
+		wantErr bool
+	}{
+		{
+			option: "infra/v1/Cluster=Spec.Region,labels.app.kubernetes.io/name",
+			want:   ListerKeyFields{Group: "infra", Version: "v1", Kind: "Cluster", Fields: []string{"Spec.Region", "labels.app.kubernetes.io/name"}},
+		},
+		{option: "infra/v1/Cluster", wantErr: true},
+		{option: "infra/Cluster=Spec.Region", wantErr: true},
+		{option: "infra/v1/cluster=Spec.Region", wantErr: true},
+		{option: "infra/v1/Cluster=spec.region", wantErr: true},
+		{option: "infra/v1/Cluster=labels.", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.option, func(t *testing.T) {
+			got, err := ParseListerKeyFields(tt.option)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_selectField(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "types.go", `package v1
+
+type Zone string
+
+type Base struct {
+	Owner *string
+}
+
+type Placement struct {
+	Zone Zone
+}
+
+type Spec struct {
+	Region    string
+	Placement *Placement
+}
+
+type Cluster struct {
+	*Base
+	Spec Spec
+}
+`, 0)
+	assert.NoError(t, err)
+	pkg, err := (&types.Config{Importer: importer.Default()}).Check("example.com/apis/infra/v1", fset, []*ast.File{f}, nil)
+	assert.NoError(t, err)
+	cluster := pkg.Scope().Lookup("Cluster").Type()
+
+	guards, expr, typ, err := selectField(cluster, "Spec.Region")
+	assert.NoError(t, err)
+	assert.Empty(t, guards)
+	assert.Equal(t, "o.Spec.Region", expr)
+	assert.Equal(t, "string", typ.String())
+
+	guards, expr, typ, err = selectField(cluster, "Spec.Placement.Zone")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"o.Spec.Placement != nil"}, guards)
+	assert.Equal(t, "o.Spec.Placement.Zone", expr)
+	assert.Equal(t, "example.com/apis/infra/v1.Zone", typ.String())
+
+	// promoted field of embedded pointer is selected explicitly
+	guards, expr, typ, err = selectField(cluster, "Owner")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"o.Base != nil"}, guards)
+	assert.Equal(t, "o.Base.Owner", expr)
+	assert.Equal(t, "*string", typ.String())
+
+	_, _, _, err = selectField(cluster, "Spec.Zone")
+	assert.Error(t, err)
+}
+
+func Test_genCompositeKeyExpansions_handWritten(t *testing.T) {
+	root := t.TempDir()
+	c := newTestCodeGenerator()
+	c.boilerplatePath = filepath.Join(root, "boilerplate.go.txt")
+	stale := "// Code generated by kube-codegen. DO NOT EDIT.\n\npackage v1\n"
+	writeTestFiles(t, root, map[string]string{
+		"boilerplate.go.txt":            "// Copyright 2022 The Authors.\n",
+		"apps/v1/foo_expansion.go":      stale,
+		"infra/v1/bar_expansion.go":     "package v1\n",
+		"infra/v1/cluster_expansion.go": "package v1\n",
+	})
+	kinds := []compositeKeyKind{{
+		ListerKeyFields: ListerKeyFields{Group: "infra", Version: "v1", Kind: "Cluster", Fields: []string{"Spec.Region"}},
+		pkg:             &keyPackage{path: "github.com/example/project/pkg/apis/infra/v1"},
+	}}
+
+	err := c.genCompositeKeyExpansions(root, kinds)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "is written by hand")
+	// expansions generated by previous runs are removed, others are kept
+	assert.NoFileExists(t, filepath.Join(root, "apps/v1/foo_expansion.go"))
+	assert.FileExists(t, filepath.Join(root, "infra/v1/bar_expansion.go"))
+}
+
+const testCompositeKeyTypes = `package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	runtime "k8s.io/apimachinery/pkg/runtime"
+	schema "k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var SchemeGroupVersion = schema.GroupVersion{Group: "infra.example.com", Version: "v1"}
+
+var (
+	SchemeBuilder = runtime.NewSchemeBuilder(func(scheme *runtime.Scheme) error {
+		scheme.AddKnownTypes(SchemeGroupVersion, &Cluster{}, &ClusterList{})
+		metav1.AddToGroupVersion(scheme, SchemeGroupVersion)
+		return nil
+	})
+	AddToScheme = SchemeBuilder.AddToScheme
+)
+
+func Resource(resource string) schema.GroupResource {
+	return SchemeGroupVersion.WithResource(resource).GroupResource()
+}
+
+type Zone string
+
+type Placement struct {
+	Zone Zone ` + "`json:\"zone\"`" + `
+}
+
+type ClusterSpec struct {
+	Region    string     ` + "`json:\"region\"`" + `
+	Placement *Placement ` + "`json:\"placement,omitempty\"`" + `
+}
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+type Cluster struct {
+	metav1.TypeMeta   ` + "`json:\",inline\"`" + `
+	metav1.ObjectMeta ` + "`json:\"metadata,omitempty\"`" + `
+	Spec              ClusterSpec ` + "`json:\"spec\"`" + `
+}
+
+func (in *Cluster) DeepCopyObject() runtime.Object {
+	out := *in
+	return &out
+}
+
+type ClusterList struct {
+	metav1.TypeMeta ` + "`json:\",inline\"`" + `
+	metav1.ListMeta ` + "`json:\"metadata,omitempty\"`" + `
+	Items           []Cluster ` + "`json:\"items\"`" + `
+}
+
+func (in *ClusterList) DeepCopyObject() runtime.Object {
+	out := *in
+	return &out
+}
+`
+
+func Test_genListers_compositeKey(t *testing.T) {
+	c := newTestWorkspaceGenerator(t, map[string]string{
+		"pkg/apis/infra/v1/doc.go":   "// +groupName=infra.example.com\npackage v1\n",
+		"pkg/apis/infra/v1/types.go": testCompositeKeyTypes,
+		"cmd/check/main.go": `package main
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+
+	infrav1 "github.com/example/project/pkg/apis/infra/v1"
+	"github.com/example/project/pkg/clients/informers"
+	"github.com/example/project/pkg/clients/kubernetes"
+)
+
+func main() {
+	factory := informers.NewSharedInformerFactory(kubernetes.NewForConfigOrDie(&rest.Config{Host: "http://localhost"}), 0)
+	informer := factory.Infra().V1().Clusters()
+	indexer := informer.Informer().GetIndexer()
+	for _, c := range []*infrav1.Cluster{
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "a", Labels: map[string]string{"app.kubernetes.io/name": "x"}},
+			Spec: infrav1.ClusterSpec{Region: "r/1", Placement: &infrav1.Placement{Zone: "z"}}},
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "b", Labels: map[string]string{"app.kubernetes.io/name": "x"}},
+			Spec: infrav1.ClusterSpec{Region: "r", Placement: &infrav1.Placement{Zone: "1/z"}}},
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "c"}, Spec: infrav1.ClusterSpec{Region: "r"}},
+	} {
+		if err := indexer.Add(c); err != nil {
+			panic(err)
+		}
+	}
+	for _, key := range [][]string{{"r/1", "z", "x"}, {"r", "1/z", "x"}, {"r", "", ""}} {
+		clusters, err := informer.Lister().GetByCompositeKey("ns", key[0], key[1], key[2])
+		if err != nil {
+			panic(err)
+		}
+		for _, c := range clusters {
+			fmt.Print(c.Name)
+		}
+	}
+	fmt.Println()
+}
+`,
+	})
+	c.boilerplatePath = filepath.Join(c.workspace, "hack/boilerplate.go.txt")
+	c.goCmd = runner.NewRunner("go").WithDir(c.workspace).WithEnvs("GOFLAGS", "-mod=mod")
+	c.inputPackages = []string{"github.com/example/project/pkg/apis/infra/v1"}
+	c.WithListerKeyFields([]string{"infra.example.com/v1/Cluster=Spec.Region,Spec.Placement.Zone,labels.app.kubernetes.io/name"})
+
+	assert.NoError(t, c.genClient(c.logger, testGeneratorRunner(t, c, "client")))
+	assert.NoError(t, c.genLister(c.logger, testGeneratorRunner(t, c, "lister")))
+	assert.NoError(t, c.genInformer(c.logger, testGeneratorRunner(t, c, "informer")))
+
+	output := filepath.Join(c.outputBase, "github.com/example/project/pkg/clients")
+	content, err := os.ReadFile(filepath.Join(output, "listers/infra/v1/cluster_expansion.go"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "GetByCompositeKey(namespace, region, zone, appKubernetesIoName string) ([]*v1.Cluster, error)")
+	assert.Contains(t, string(content), "type ClusterNamespaceListerExpansion interface{}")
+	content, err = os.ReadFile(filepath.Join(output, "listers/infra/v1/expansion_generated.go"))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(content), "ClusterListerExpansion")
+
+	assert.NoError(t, copy.Copy(output, filepath.Join(c.workspace, "pkg/clients")))
+	cmd := exec.Command("go", "run", "./cmd/check")
+	cmd.Dir = c.workspace
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod")
+	out, err := cmd.Output()
+	assert.NoError(t, err, exitStderr(err))
+	// keys of values containing separators do not collide, and values behind
+	// nil pointers are empty
+	assert.Equal(t, "abc\n", string(out))
+}
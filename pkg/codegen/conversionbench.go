@@ -0,0 +1,244 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"golang.org/x/mod/semver"
+)
+
+const (
+	conversionBenchFile = "conversion_bench_test.go"
+	// randfillMinVersion is the first apimachinery version whose api testing
+	// fuzzer is sigs.k8s.io/randfill filling objects by Fill instead of gofuzz.
+	randfillMinVersion = "v0.33.0"
+)
+
+var conversionBenchTemplate = template.Must(template.New("conversionbench").Parse(`{{ .BuildConstraints }}{{ .Header }}
+// Code generated by kube-codegen. DO NOT EDIT.
+
+package {{ .Package }}
+
+import (
+	"math/rand"
+	"testing"
+
+	apitestingfuzzer "k8s.io/apimachinery/pkg/api/apitesting/fuzzer"
+	metafuzzer "k8s.io/apimachinery/pkg/apis/meta/fuzzer"
+	conversion "k8s.io/apimachinery/pkg/conversion"
+	runtime "k8s.io/apimachinery/pkg/runtime"
+	runtimeserializer "k8s.io/apimachinery/pkg/runtime/serializer"
+{{- range .Imports }}
+	{{ .Name }} "{{ .Path }}"
+{{- end }}
+)
+
+// conversionBenchmarkScope is the conversion.Scope passed to conversions in
+// benchmarks, it converts through a scheme with the generated conversions.
+type conversionBenchmarkScope struct {
+	scheme *runtime.Scheme
+}
+
+func (s conversionBenchmarkScope) Convert(src, dest interface{}) error {
+	return s.scheme.Convert(src, dest, nil)
+}
+
+func (s conversionBenchmarkScope) Meta() *conversion.Meta {
+	return nil
+}
+
+var _ conversion.Scope = conversionBenchmarkScope{}
+
+// newConversionBenchmarkScope returns a scope converting through a scheme
+// with conversions registered by RegisterConversions.
+func newConversionBenchmarkScope(b *testing.B) conversionBenchmarkScope {
+	scheme := runtime.NewScheme()
+	if err := RegisterConversions(scheme); err != nil {
+		b.Fatal(err)
+	}
+	return conversionBenchmarkScope{scheme: scheme}
+}
+
+// fuzzConversionBenchmarkObject fills obj with random values by a fixed seed,
+// so that benchmarks of different runs convert the same objects.
+func fuzzConversionBenchmarkObject(obj interface{}) {
+	codecs := runtimeserializer.NewCodecFactory(runtime.NewScheme())
+	apitestingfuzzer.FuzzerFor(apitestingfuzzer.MergeFuzzerFuncs(metafuzzer.Funcs), rand.NewSource(1), codecs).{{ .FuzzMethod }}(obj)
+}
+{{ range .Conversions }}
+func Benchmark_{{ .Name }}(b *testing.B) {
+	scope := newConversionBenchmarkScope(b)
+	in := new({{ .In }})
+	fuzzConversionBenchmarkObject(in)
+	out := new({{ .Out }})
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := {{ .Name }}(in, out, scope); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+{{ end }}`))
+
+// conversionBenchmark is a generated conversion function benchmarked, In and
+// Out are the types its arguments point to.
+type conversionBenchmark struct {
+	Name string
+	In   string
+	Out  string
+}
+
+// benchImport is an import of zz_generated.conversion.go which argument types
+// of conversions refer to.
+type benchImport struct {
+	Name string
+	Path string
+}
+
+// genConversionBenchmarks generates conversion_bench_test.go along with
+// zz_generated.conversion.go generated for each of pkgs, which benchmarks
+// each generated conversion on a fuzzed object.
+func (c *CodeGenerator) genConversionBenchmarks(pkgs []string) error {
+	if !c.genConversionBench {
+		return nil
+	}
+	header, err := c.boilerplate()
+	if err != nil {
+		return err
+	}
+	fuzzMethod := "Fuzz"
+	if version := c.generatorVersion("conversion"); semver.IsValid(version) && semver.Compare(version, randfillMinVersion) >= 0 {
+		fuzzMethod = "Fill"
+	}
+	for _, pkg := range pkgs {
+		dir := path.Join(c.outputBase, pkg, c.conversionSubdir)
+		content, err := ioutil.ReadFile(path.Join(dir, conversionFileBase+".go"))
+		if os.IsNotExist(err) {
+			// no conversions generated for the package
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		pkgName, imports, conversions, err := generatedConversions(content)
+		if err != nil {
+			return fmt.Errorf("failed to parse conversions of %v: %v", pkg, err)
+		}
+		if len(conversions) == 0 {
+			continue
+		}
+		buf := bytes.Buffer{}
+		err = conversionBenchTemplate.Execute(&buf, map[string]interface{}{
+			"BuildConstraints": buildConstraints(content),
+			"Header":           header,
+			"Package":          pkgName,
+			"Imports":          imports,
+			"Conversions":      conversions,
+			"FuzzMethod":       fuzzMethod,
+		})
+		if err != nil {
+			return err
+		}
+		benchFile := path.Join(dir, conversionBenchFile)
+		c.logger.Info("generating conversion benchmarks", "file", benchFile)
+		if err := writeGoFile(benchFile, buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// generatedConversions returns the package name, exported Convert_* functions
+// of zz_generated.conversion.go content, and the imports their argument types
+// refer to. Other imports, e.g. unsafe, are only used by function bodies.
+func generatedConversions(content []byte) (string, []benchImport, []conversionBenchmark, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", content, 0)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	conversions := []conversionBenchmark{}
+	referred := map[string]bool{}
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Recv != nil || !strings.HasPrefix(fn.Name.Name, "Convert_") {
+			continue
+		}
+		params := fn.Type.Params.List
+		if len(params) != 3 || len(params[0].Names) > 1 || len(params[1].Names) > 1 {
+			continue
+		}
+		in, inOK := params[0].Type.(*ast.StarExpr)
+		out, outOK := params[1].Type.(*ast.StarExpr)
+		if !inOK || !outOK {
+			continue
+		}
+		inType, outType := bytes.Buffer{}, bytes.Buffer{}
+		if err := printer.Fprint(&inType, fset, in.X); err != nil {
+			return "", nil, nil, err
+		}
+		if err := printer.Fprint(&outType, fset, out.X); err != nil {
+			return "", nil, nil, err
+		}
+		for _, expr := range []ast.Expr{in.X, out.X} {
+			ast.Inspect(expr, func(n ast.Node) bool {
+				if sel, ok := n.(*ast.SelectorExpr); ok {
+					if ident, ok := sel.X.(*ast.Ident); ok {
+						referred[ident.Name] = true
+					}
+				}
+				return true
+			})
+		}
+		conversions = append(conversions, conversionBenchmark{
+			Name: fn.Name.Name,
+			In:   inType.String(),
+			Out:  outType.String(),
+		})
+	}
+
+	imported := map[benchImport]bool{
+		// imports of the template
+		{Name: "conversion", Path: "k8s.io/apimachinery/pkg/conversion"}: true,
+		{Name: "runtime", Path: "k8s.io/apimachinery/pkg/runtime"}:       true,
+	}
+	imports := []benchImport{}
+	for _, imp := range file.Imports {
+		importPath, _ := strconv.Unquote(imp.Path.Value)
+		bi := benchImport{Name: goPackageName(importPath), Path: importPath}
+		if imp.Name != nil {
+			bi.Name = imp.Name.Name
+		}
+		if !referred[bi.Name] || imported[bi] {
+			continue
+		}
+		imported[bi] = true
+		imports = append(imports, bi)
+	}
+	return file.Name.Name, imports, conversions, nil
+}
@@ -0,0 +1,139 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_genConversionBenchmarks(t *testing.T) {
+	c := newTestWorkspaceGenerator(t, map[string]string{
+		"pkg/apis/apps/types.go":                      "package apps\n\ntype Foo struct {\n\tName     string\n\tReplicas int\n}\n",
+		"pkg/apis/apps/v1/types.go":                   testConversionTypes,
+		"pkg/apis/apps/v1/zz_generated.conversion.go": testConversionGenerated,
+	})
+	c.boilerplatePath = filepath.Join(c.workspace, "hack", "boilerplate.go.txt")
+	pkgs := []string{
+		"github.com/example/project/pkg/apis/apps/v1",
+		"github.com/example/project/pkg/apis/apps",
+	}
+
+	// not generated by default
+	assert.NoError(t, c.genConversionBenchmarks(pkgs))
+
+	writeTestFiles(t, c.outputBase, map[string]string{
+		"github.com/example/project/pkg/apis/apps/v1/zz_generated.conversion.go": testConversionGenerated,
+	})
+
+	c.WithGenConversionBenchmarks(true)
+	assert.NoError(t, c.genConversionBenchmarks(pkgs))
+	assert.NoFileExists(t, filepath.Join(c.outputBase, "github.com/example/project/pkg/apis/apps", conversionBenchFile))
+	got, err := ioutil.ReadFile(filepath.Join(c.outputBase, "github.com/example/project/pkg/apis/apps/v1", conversionBenchFile))
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(got), "//go:build !ignore_autogenerated\n// +build !ignore_autogenerated\n\n// Copyright 2022 The Authors.\n"), string(got))
+	assert.Contains(t, string(got), "package v1\n")
+	assert.Contains(t, string(got), "func Benchmark_Convert_v1_Foo_To_apps_Foo(b *testing.B) {")
+	assert.Contains(t, string(got), "out := new(apps.Foo)")
+	// manual conversions are not in the generated file
+	assert.NotContains(t, string(got), "Benchmark_Convert_apps_Foo_To_v1_Foo")
+	assert.Contains(t, string(got), ".Fuzz(obj)")
+	writeTestFiles(t, c.workspace, map[string]string{
+		filepath.Join("pkg/apis/apps/v1", conversionBenchFile): string(got),
+	})
+
+	// apimachinery fuzzer fills objects by randfill since v0.33.0
+	c.WithGeneratorVersions(map[string]string{"conversion": "v0.33.0"})
+	assert.NoError(t, c.genConversionBenchmarks(pkgs))
+	got, err = ioutil.ReadFile(filepath.Join(c.outputBase, "github.com/example/project/pkg/apis/apps/v1", conversionBenchFile))
+	assert.NoError(t, err)
+	assert.Contains(t, string(got), ".Fill(obj)")
+
+	// the generated benchmarks compile and run
+	out := goTest(t, c, "-run", "^$", "-bench", ".", "-benchtime", "10x", "./pkg/apis/apps/v1")
+	assert.Contains(t, out, "Benchmark_Convert_v1_Foo_To_apps_Foo")
+}
+
+func Test_genConversionBenchmarks_generated(t *testing.T) {
+	c := newTestWorkspaceGenerator(t, map[string]string{
+		"pkg/apis/apps/types.go": `package apps
+
+import metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+type Foo struct {
+	metav1.TypeMeta
+	metav1.ObjectMeta
+	Hosts []string
+	Ports []Port
+}
+
+type Port struct {
+	Name string
+	Port int32
+}
+`,
+		"pkg/apis/apps/v1/doc.go": "// +k8s:conversion-gen=github.com/example/project/pkg/apis/apps\npackage v1\n",
+		"pkg/apis/apps/v1/types.go": `package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+var (
+	localSchemeBuilder = runtime.NewSchemeBuilder()
+	AddToScheme        = localSchemeBuilder.AddToScheme
+)
+
+type Foo struct {
+	metav1.TypeMeta   ` + "`json:\",inline\"`" + `
+	metav1.ObjectMeta ` + "`json:\"metadata,omitempty\"`" + `
+	Hosts []string    ` + "`json:\"hosts,omitempty\"`" + `
+	Ports []Port      ` + "`json:\"ports,omitempty\"`" + `
+}
+
+type Port struct {
+	Name string ` + "`json:\"name\"`" + `
+	Port int32  ` + "`json:\"port\"`" + `
+}
+`,
+	})
+	c.boilerplatePath = filepath.Join(c.workspace, "hack", "boilerplate.go.txt")
+	c.WithGenConversionBenchmarks(true)
+	run := testGeneratorRunner(t, c, "conversion")
+	assert.NoError(t, c.genConversion(c.logger, run))
+
+	dir := filepath.Join(c.outputBase, "github.com/example/project/pkg/apis/apps/v1")
+	generated, err := ioutil.ReadFile(filepath.Join(dir, "zz_generated.conversion.go"))
+	assert.NoError(t, err)
+	// conversion-gen uses unsafe and meta/v1 in function bodies only
+	assert.Contains(t, string(generated), "unsafe \"unsafe\"")
+	assert.Contains(t, string(generated), "(*[]apps.Port)(unsafe.Pointer(&in.Ports))")
+	got, err := ioutil.ReadFile(filepath.Join(dir, conversionBenchFile))
+	assert.NoError(t, err)
+	assert.Contains(t, string(got), "func Benchmark_Convert_v1_Foo_To_apps_Foo(b *testing.B) {")
+	assert.NotContains(t, string(got), "\"unsafe\"")
+
+	writeTestFiles(t, c.workspace, map[string]string{
+		"pkg/apis/apps/v1/zz_generated.conversion.go":          string(generated),
+		filepath.Join("pkg/apis/apps/v1", conversionBenchFile): string(got),
+	})
+	out := goTest(t, c, "-run", "^$", "-bench", ".", "-benchtime", "10x", "./pkg/apis/apps/v1")
+	assert.Contains(t, out, "Benchmark_Convert_apps_Port_To_v1_Port")
+}
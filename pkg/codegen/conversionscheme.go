@@ -0,0 +1,107 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"bytes"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"text/template"
+)
+
+const conversionSchemeFileBase = "zz_generated.conversion_scheme"
+
+var conversionSchemeTemplate = template.Must(template.New("conversionscheme").Parse(`{{ .BuildConstraints }}{{ .Header }}
+// Code generated by kube-codegen. DO NOT EDIT.
+
+package {{ .Package }}
+
+import (
+	runtime "k8s.io/apimachinery/pkg/runtime"
+)
+
+var (
+	// ConversionSchemeBuilder registers conversions generated by conversion-gen.
+	ConversionSchemeBuilder = runtime.NewSchemeBuilder(RegisterConversions)
+	// AddConversionsToScheme registers conversions generated by conversion-gen with the given scheme,
+	// so that they are used by conversions of the scheme.
+	AddConversionsToScheme = ConversionSchemeBuilder.AddToScheme
+)
+`))
+
+// genConversionSchemeFile generates zz_generated.conversion_scheme.go along
+// with zz_generated.conversion.go generated for each of pkgs, which registers
+// the generated conversions with a scheme explicitly instead of relying on
+// localSchemeBuilder of the package.
+func (c *CodeGenerator) genConversionSchemeFile(pkgs []string) error {
+	if !c.genConversionScheme {
+		return nil
+	}
+	header, err := c.boilerplate()
+	if err != nil {
+		return err
+	}
+	for _, pkg := range pkgs {
+		dir := path.Join(c.outputBase, pkg, c.conversionSubdir)
+		content, err := ioutil.ReadFile(path.Join(dir, conversionFileBase+".go"))
+		if os.IsNotExist(err) {
+			// no conversions generated for the package
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		file, err := parser.ParseFile(token.NewFileSet(), "", content, parser.PackageClauseOnly)
+		if err != nil {
+			return err
+		}
+		buf := bytes.Buffer{}
+		err = conversionSchemeTemplate.Execute(&buf, map[string]string{
+			"BuildConstraints": buildConstraints(content),
+			"Header":           header,
+			"Package":          file.Name.Name,
+		})
+		if err != nil {
+			return err
+		}
+		schemeFile := path.Join(dir, conversionSchemeFileBase+".go")
+		c.logger.Info("generating conversion scheme", "file", schemeFile)
+		if err := writeGoFile(schemeFile, buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// buildConstraints returns the leading build constraint lines of go file
+// content followed by a blank line, so that a file built along with it has
+// the same constraints, e.g. --build-tag of conversion-gen.
+func buildConstraints(content []byte) string {
+	constraints := []string{}
+	for _, line := range strings.Split(string(content), "\n") {
+		if !strings.HasPrefix(line, "//go:build ") && !strings.HasPrefix(line, "// +build ") {
+			break
+		}
+		constraints = append(constraints, line)
+	}
+	if len(constraints) == 0 {
+		return ""
+	}
+	return strings.Join(constraints, "\n") + "\n\n"
+}
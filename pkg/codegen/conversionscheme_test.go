@@ -0,0 +1,110 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_genConversionSchemeFile(t *testing.T) {
+	v2Types := strings.ReplaceAll(testConversionTypes, "package v1", "package v2")
+	v2Generated := strings.ReplaceAll(testConversionGenerated, "package v1", "package v2")
+	c := newTestWorkspaceGenerator(t, map[string]string{
+		"pkg/apis/apps/types.go":    "package apps\n\ntype Foo struct {\n\tName     string\n\tReplicas int\n}\n",
+		"pkg/apis/apps/v1/types.go": testConversionTypes,
+		"pkg/apis/apps/v2/types.go": v2Types,
+		"cmd/check/main.go": `package main
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/example/project/pkg/apis/apps"
+	"github.com/example/project/pkg/apis/apps/v1"
+	"github.com/example/project/pkg/apis/apps/v2"
+)
+
+func main() {
+	scheme := runtime.NewScheme()
+	if err := v1.AddConversionsToScheme(scheme); err != nil {
+		panic(err)
+	}
+	if err := v2.AddConversionsToScheme(scheme); err != nil {
+		panic(err)
+	}
+	internal := &apps.Foo{}
+	if err := scheme.Convert(&v1.Foo{Name: "foo", Replicas: 1}, internal, nil); err != nil {
+		panic(err)
+	}
+	out := &v2.Foo{}
+	if err := scheme.Convert(internal, out, nil); err != nil {
+		panic(err)
+	}
+	fmt.Println(out.Name, out.Replicas)
+}
+`,
+	})
+	c.boilerplatePath = filepath.Join(c.workspace, "hack", "boilerplate.go.txt")
+	pkgs := []string{
+		"github.com/example/project/pkg/apis/apps/v1",
+		"github.com/example/project/pkg/apis/apps/v2",
+		"github.com/example/project/pkg/apis/apps",
+	}
+
+	// not generated by default
+	assert.NoError(t, c.genConversionSchemeFile(pkgs))
+
+	generated := map[string]string{"v1": testConversionGenerated, "v2": v2Generated}
+	for version, content := range generated {
+		writeTestFiles(t, c.outputBase, map[string]string{
+			"github.com/example/project/pkg/apis/apps/" + version + "/zz_generated.conversion.go": content,
+		})
+	}
+
+	c.WithGenConversionScheme(true)
+	assert.NoError(t, c.genConversionSchemeFile(pkgs))
+	assert.NoFileExists(t, filepath.Join(c.outputBase, "github.com/example/project/pkg/apis/apps/zz_generated.conversion_scheme.go"))
+	for _, version := range []string{"v1", "v2"} {
+		dir := filepath.Join("pkg/apis/apps", version)
+		got, err := ioutil.ReadFile(filepath.Join(c.outputBase, "github.com/example/project", dir, "zz_generated.conversion_scheme.go"))
+		assert.NoError(t, err)
+		assert.True(t, strings.HasPrefix(string(got), "//go:build !ignore_autogenerated\n// +build !ignore_autogenerated\n\n// Copyright 2022 The Authors.\n"), string(got))
+		assert.Contains(t, string(got), "package "+version+"\n")
+		assert.Regexp(t, `ConversionSchemeBuilder\s+= runtime.NewSchemeBuilder\(RegisterConversions\)`, string(got))
+
+		writeTestFiles(t, c.workspace, map[string]string{
+			filepath.Join(dir, "zz_generated.conversion.go"):        generated[version],
+			filepath.Join(dir, "zz_generated.conversion_scheme.go"): string(got),
+		})
+	}
+
+	// the generated file compiles and registers conversions of both versions
+	goBuild(t, c, "-o", filepath.Join("bin", "check"), "./cmd/check")
+	out, err := exec.Command(filepath.Join(c.workspace, "bin", "check")).Output()
+	assert.NoError(t, err, exitStderr(err))
+	assert.Equal(t, "foo 1\n", string(out))
+}
+
+func Test_buildConstraints(t *testing.T) {
+	assert.Equal(t, "//go:build !ignore_autogenerated\n// +build !ignore_autogenerated\n\n", buildConstraints([]byte(testConversionGenerated)))
+	assert.Equal(t, "", buildConstraints([]byte("// Copyright 2022 The Authors.\n\npackage v1\n")))
+}
@@ -0,0 +1,250 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+const conversionFileBase = "zz_generated.conversion"
+
+// moveConversionsToSubdir moves zz_generated.conversion.go generated in each
+// of pkgs into the conversionSubdir subpackage of it.
+func (c *CodeGenerator) moveConversionsToSubdir(pkgs []string) error {
+	if len(c.conversionSubdir) == 0 {
+		return nil
+	}
+	for _, pkg := range pkgs {
+		localDir, ok := localPackageDir(c.workspace, c.workspaceModule, pkg)
+		if !ok {
+			continue
+		}
+		src := path.Join(c.outputBase, pkg, conversionFileBase+".go")
+		content, err := ioutil.ReadFile(src)
+		if os.IsNotExist(err) {
+			// no conversions generated for the package
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		names, err := packageDecls(localDir)
+		if err != nil {
+			return err
+		}
+		moved, err := conversionSubpackage(content, pkg, goPackageName(c.conversionSubdir), names)
+		if err != nil {
+			return fmt.Errorf("failed to move conversions of %v into %v: %v", pkg, c.conversionSubdir, err)
+		}
+		dst := path.Join(c.outputBase, pkg, c.conversionSubdir, conversionFileBase+".go")
+		c.logger.Info("moving conversions into subpackage", "package", pkg, "file", dst)
+		if err := os.MkdirAll(path.Dir(dst), 0755); err != nil {
+			return err
+		}
+		if err := writeGoFile(dst, moved); err != nil {
+			return err
+		}
+		if err := os.Remove(src); err != nil {
+			return err
+		}
+		if !c.verify && !c.inPlace {
+			// conversions generated by previous runs are in the types package
+			for _, base := range []string{conversionFileBase, conversionSchemeFileBase} {
+				if err := removeGeneratedFile(c.logger, path.Join(localDir, base+".go")); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// conversionPackages maps input packages in workspace whose conversions are
+// moved into conversionSubdir to their conversion subpackages. Install packages
+// add the subpackages to scheme instead, because conversions are no longer
+// registered by init of the input packages.
+func (c *CodeGenerator) conversionPackages() (map[string]string, error) {
+	if len(c.conversionSubdir) == 0 {
+		return nil, nil
+	}
+	conversions := map[string]string{}
+	for _, pkg := range c.inputPackages {
+		localDir, ok := localPackageDir(c.workspace, c.workspaceModule, pkg)
+		if !ok {
+			continue
+		}
+		// generated by this run, or by previous runs if conversion generator is skipped
+		for _, dir := range []string{path.Join(c.outputBase, pkg), localDir} {
+			content, err := ioutil.ReadFile(path.Join(dir, c.conversionSubdir, conversionFileBase+".go"))
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			file, err := parser.ParseFile(token.NewFileSet(), "", content, 0)
+			if err != nil {
+				return nil, err
+			}
+			// AddToScheme is declared only if the input package declares it
+			if file.Scope.Lookup("AddToScheme") != nil {
+				conversions[pkg] = path.Join(pkg, c.conversionSubdir)
+			}
+			break
+		}
+	}
+	return conversions, nil
+}
+
+// packageDecls returns names of top-level declarations in non-generated go
+// files of dir. It returns error if they call autoConvert functions, which are
+// unexported in the conversions subpackage.
+func packageDecls(dir string) (map[string]bool, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(info os.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go") && info.Name() != conversionFileBase+".go"
+	}, 0)
+	if err != nil {
+		return nil, err
+	}
+	names := map[string]bool{}
+	for _, p := range pkgs {
+		for name, f := range p.Files {
+			for _, decl := range f.Decls {
+				switch d := decl.(type) {
+				case *ast.FuncDecl:
+					if d.Recv == nil {
+						names[d.Name.Name] = true
+					}
+				case *ast.GenDecl:
+					for _, spec := range d.Specs {
+						switch s := spec.(type) {
+						case *ast.TypeSpec:
+							names[s.Name.Name] = true
+						case *ast.ValueSpec:
+							for _, n := range s.Names {
+								names[n.Name] = true
+							}
+						}
+					}
+				}
+			}
+			for _, ident := range f.Unresolved {
+				if strings.HasPrefix(ident.Name, "autoConvert_") {
+					return nil, fmt.Errorf("%v calls %v, conversions calling generated autoConvert functions can not be moved into a subpackage", filepath.Base(name), ident.Name)
+				}
+			}
+		}
+	}
+	return names, nil
+}
+
+// conversionSubpackage rewrites content of zz_generated.conversion.go of pkg
+// to package pkgName, which imports pkg and refers to names declared in pkg
+// by it. The init function registering conversions to the scheme builder of
+// pkg is dropped, SchemeBuilder and AddToScheme adding both types and
+// conversions are declared instead if pkg declares AddToScheme.
+func conversionSubpackage(content []byte, pkg, pkgName string, names map[string]bool) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", content, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	alias := importAlias(file, file.Name.Name)
+	file.Name.Name = pkgName
+
+	// unexported scheme builder of pkg is not accessible
+	decls := []ast.Decl{}
+	for _, decl := range file.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil && fn.Name.Name == "init" {
+			continue
+		}
+		decls = append(decls, decl)
+	}
+	file.Decls = decls
+
+	qualified := false
+	astutil.Apply(file, func(cur *astutil.Cursor) bool {
+		ident, ok := cur.Node().(*ast.Ident)
+		if !ok || ident.Obj != nil || !names[ident.Name] || !ast.IsExported(ident.Name) {
+			return true
+		}
+		switch cur.Parent().(type) {
+		case *ast.SelectorExpr:
+			if cur.Name() == "Sel" {
+				return true
+			}
+		case *ast.KeyValueExpr:
+			if cur.Name() == "Key" {
+				return true
+			}
+		case *ast.File, *ast.Field, *ast.FuncDecl, *ast.TypeSpec, *ast.ValueSpec, *ast.LabeledStmt, *ast.BranchStmt:
+			// declared names
+			return true
+		}
+		cur.Replace(&ast.SelectorExpr{X: ast.NewIdent(alias), Sel: ast.NewIdent(ident.Name)})
+		qualified = true
+		return true
+	}, nil)
+	if qualified || names["AddToScheme"] {
+		astutil.AddNamedImport(fset, file, alias, pkg)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := format.Node(buf, fset, file); err != nil {
+		return nil, err
+	}
+	if names["AddToScheme"] {
+		fmt.Fprintf(buf, "\nvar (\n"+
+			"\t// SchemeBuilder registers the types of %s and their conversions.\n"+
+			"\tSchemeBuilder = runtime.NewSchemeBuilder(%s.AddToScheme, RegisterConversions)\n"+
+			"\t// AddToScheme adds the types of %s and their conversions to the scheme.\n"+
+			"\tAddToScheme = SchemeBuilder.AddToScheme\n)\n", alias, alias, alias)
+	}
+	return format.Source(buf.Bytes())
+}
+
+// importAlias returns name if it is not used by imports of file, otherwise
+// name with the smallest number suffix not used.
+func importAlias(file *ast.File, name string) string {
+	used := map[string]bool{}
+	for _, spec := range file.Imports {
+		if spec.Name != nil {
+			used[spec.Name.Name] = true
+			continue
+		}
+		if p, err := strconv.Unquote(spec.Path.Value); err == nil {
+			used[path.Base(p)] = true
+		}
+	}
+	alias := name
+	for i := 1; used[alias]; i++ {
+		alias = name + strconv.Itoa(i)
+	}
+	return alias
+}
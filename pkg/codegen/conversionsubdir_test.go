@@ -0,0 +1,150 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testConversionTypes = `package v1
+
+import (
+	"k8s.io/apimachinery/pkg/conversion"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/example/project/pkg/apis/apps"
+)
+
+var (
+	localSchemeBuilder = runtime.NewSchemeBuilder()
+	AddToScheme        = localSchemeBuilder.AddToScheme
+)
+
+type Foo struct {
+	Name     string
+	Replicas int32
+}
+
+func Convert_apps_Foo_To_v1_Foo(in *apps.Foo, out *Foo, s conversion.Scope) error {
+	out.Name = in.Name
+	out.Replicas = int32(in.Replicas)
+	return nil
+}
+`
+	testConversionGenerated = `//go:build !ignore_autogenerated
+// +build !ignore_autogenerated
+
+// Copyright 2022 The Authors.
+
+// Code generated by conversion-gen. DO NOT EDIT.
+
+package v1
+
+import (
+	apps "github.com/example/project/pkg/apis/apps"
+	conversion "k8s.io/apimachinery/pkg/conversion"
+	runtime "k8s.io/apimachinery/pkg/runtime"
+)
+
+func init() {
+	localSchemeBuilder.Register(RegisterConversions)
+}
+
+// RegisterConversions adds conversion functions to the given scheme.
+// Public to allow building arbitrary schemes.
+func RegisterConversions(s *runtime.Scheme) error {
+	if err := s.AddGeneratedConversionFunc((*Foo)(nil), (*apps.Foo)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1_Foo_To_apps_Foo(a.(*Foo), b.(*apps.Foo), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddConversionFunc((*apps.Foo)(nil), (*Foo)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_apps_Foo_To_v1_Foo(a.(*apps.Foo), b.(*Foo), scope)
+	}); err != nil {
+		return err
+	}
+	return nil
+}
+
+func autoConvert_v1_Foo_To_apps_Foo(in *Foo, out *apps.Foo, s conversion.Scope) error {
+	out.Name = in.Name
+	out.Replicas = int(in.Replicas)
+	return nil
+}
+
+// Convert_v1_Foo_To_apps_Foo is an autogenerated conversion function.
+func Convert_v1_Foo_To_apps_Foo(in *Foo, out *apps.Foo, s conversion.Scope) error {
+	return autoConvert_v1_Foo_To_apps_Foo(in, out, s)
+}
+`
+)
+
+func Test_moveConversionsToSubdir(t *testing.T) {
+	c := newTestWorkspaceGenerator(t, map[string]string{
+		"pkg/apis/apps/types.go":    "package apps\n\ntype Foo struct {\n\tName     string\n\tReplicas int\n}\n",
+		"pkg/apis/apps/v1/types.go": testConversionTypes,
+		// generated by previous runs
+		"pkg/apis/apps/v1/zz_generated.conversion.go": testConversionGenerated,
+	})
+	c.WithConversionSubdir("conversions")
+	writeTestFiles(t, c.outputBase, map[string]string{
+		"github.com/example/project/pkg/apis/apps/v1/zz_generated.conversion.go": testConversionGenerated,
+	})
+
+	assert.NoError(t, c.moveConversionsToSubdir([]string{"github.com/example/project/pkg/apis/apps/v1", "github.com/example/project/pkg/apis/apps"}))
+	_, err := os.Stat(filepath.Join(c.outputBase, "github.com/example/project/pkg/apis/apps/v1/zz_generated.conversion.go"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(c.workspace, "pkg/apis/apps/v1/zz_generated.conversion.go"))
+	assert.True(t, os.IsNotExist(err))
+
+	moved, err := ioutil.ReadFile(filepath.Join(c.outputBase, "github.com/example/project/pkg/apis/apps/v1/conversions/zz_generated.conversion.go"))
+	assert.NoError(t, err)
+	got := string(moved)
+	assert.Contains(t, got, "// Code generated by conversion-gen. DO NOT EDIT.\n\npackage conversions\n")
+	assert.Contains(t, got, `v1 "github.com/example/project/pkg/apis/apps/v1"`)
+	assert.NotContains(t, got, "localSchemeBuilder")
+	assert.Contains(t, got, "func Convert_v1_Foo_To_apps_Foo(in *v1.Foo, out *apps.Foo, s conversion.Scope) error {")
+	assert.Contains(t, got, "return v1.Convert_apps_Foo_To_v1_Foo(a.(*apps.Foo), b.(*v1.Foo), scope)")
+	assert.Regexp(t, `SchemeBuilder\s+= runtime.NewSchemeBuilder\(v1.AddToScheme, RegisterConversions\)`, got)
+
+	// install packages add the subpackage to scheme
+	c.inputPackages = []string{"github.com/example/project/pkg/apis/apps/v1", "github.com/example/project/pkg/apis/apps"}
+	conversions, err := c.conversionPackages()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"github.com/example/project/pkg/apis/apps/v1": "github.com/example/project/pkg/apis/apps/v1/conversions",
+	}, conversions)
+
+	// the subdir layout compiles
+	writeTestFiles(t, c.workspace, map[string]string{
+		"pkg/apis/apps/v1/conversions/zz_generated.conversion.go": got,
+	})
+	goBuild(t, c, "./pkg/apis/...")
+}
+
+func Test_packageDecls_autoConvert(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"conversion.go": "package v1\n\nfunc Convert_v1_Foo_To_apps_Foo(in, out interface{}) error {\n\treturn autoConvert_v1_Foo_To_apps_Foo(in, out)\n}\n",
+	})
+	_, err := packageDecls(dir)
+	assert.Error(t, err)
+}
@@ -0,0 +1,273 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	goparser "go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/gengo/parser"
+	"k8s.io/gengo/types"
+)
+
+const conversionTagName = "k8s:conversion-gen"
+
+// conversionTaggedTypes returns names of types tagged with
+// +k8s:conversion-gen=true in each of pkgs. conversion-gen only accepts false
+// as the tag value in the doc comment of a type, so the tag is read from the
+// comment block above the doc comment, e.g.
+//
+//	// +k8s:conversion-gen=true
+//
+//	// Foo is ...
+//	type Foo struct {}
+func conversionTaggedTypes(b *parser.Builder, pkgs []string) (map[string]map[string]bool, error) {
+	u, err := b.FindTypes()
+	if err != nil {
+		return nil, err
+	}
+	ret := map[string]map[string]bool{}
+	for _, pkg := range pkgs {
+		names := map[string]bool{}
+		for name, t := range u.Package(pkg).Types {
+			if value := conversionTag(t.CommentLines); value != "" && value != "false" {
+				return nil, fmt.Errorf("type %v: conversion-gen only accepts +%v=false in doc comments, put +%v=%v in the comment block above the doc comment", t.Name, conversionTagName, conversionTagName, value)
+			}
+			if conversionTag(t.SecondClosestCommentLines) == "true" {
+				names[name] = true
+			}
+		}
+		ret[pkg] = names
+	}
+	return ret, nil
+}
+
+// conversionTag returns the value of +k8s:conversion-gen tag in comments.
+func conversionTag(comments []string) string {
+	values := types.ExtractCommentTags("+", comments)[conversionTagName]
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// pruneUntaggedConversions removes conversions of types not in tagged from
+// zz_generated.conversion.go generated in each of pkgs.
+func (c *CodeGenerator) pruneUntaggedConversions(pkgs []string, tagged map[string]map[string]bool) error {
+	used, err := c.packageReferences(pkgs)
+	if err != nil {
+		return err
+	}
+	for _, pkg := range pkgs {
+		if _, ok := localPackageDir(c.workspace, c.workspaceModule, pkg); !ok {
+			continue
+		}
+		file := path.Join(c.outputBase, pkg, conversionFileBase+".go")
+		content, err := ioutil.ReadFile(file)
+		if os.IsNotExist(err) {
+			// no conversions generated for the package
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		pruned, removed, err := pruneConversions(content, tagged[pkg], used[pkg])
+		if err != nil {
+			return fmt.Errorf("failed to prune conversions of untagged types in %v: %v", pkg, err)
+		}
+		if len(removed) == 0 {
+			continue
+		}
+		c.logger.Info("pruning conversions of untagged types", "package", pkg, "functions", strings.Join(removed, ","))
+		if err := writeGoFile(file, pruned); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// packageReferences returns names of each of pkgs referred to by non-generated
+// go files of all pkgs in the workspace, e.g. autoConvert functions called by
+// conversions written by hand in the same package, or Convert functions
+// called by conversions of a peer version.
+func (c *CodeGenerator) packageReferences(pkgs []string) (map[string]map[string]bool, error) {
+	ret := map[string]map[string]bool{}
+	for _, pkg := range pkgs {
+		ret[pkg] = map[string]bool{}
+	}
+	for _, pkg := range pkgs {
+		dir, ok := localPackageDir(c.workspace, c.workspaceModule, pkg)
+		if !ok {
+			continue
+		}
+		fset := token.NewFileSet()
+		parsed, err := goparser.ParseDir(fset, dir, func(info os.FileInfo) bool {
+			return !strings.HasSuffix(info.Name(), "_test.go") && !strings.HasPrefix(info.Name(), "zz_generated.")
+		}, 0)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		for _, p := range parsed {
+			for _, f := range p.Files {
+				for _, ident := range f.Unresolved {
+					ret[pkg][ident.Name] = true
+				}
+				imports := map[string]string{}
+				for _, imp := range f.Imports {
+					importPath, _ := strconv.Unquote(imp.Path.Value)
+					name := goPackageName(importPath)
+					if imp.Name != nil {
+						name = imp.Name.Name
+					}
+					if ret[importPath] != nil {
+						imports[name] = importPath
+					}
+				}
+				ast.Inspect(f, func(n ast.Node) bool {
+					sel, ok := n.(*ast.SelectorExpr)
+					if !ok {
+						return true
+					}
+					if ident, ok := sel.X.(*ast.Ident); ok && ident.Obj == nil && imports[ident.Name] != "" {
+						ret[imports[ident.Name]][sel.Sel.Name] = true
+					}
+					return true
+				})
+			}
+		}
+	}
+	return ret, nil
+}
+
+// pruneConversions removes generated conversion functions from content of
+// zz_generated.conversion.go, together with their registrations and imports
+// left unused, unless they
+// convert types in tagged, or are called by kept functions or functions in
+// used. It returns the pruned content and names of removed functions.
+func pruneConversions(content []byte, tagged, used map[string]bool) ([]byte, []string, error) {
+	fset := token.NewFileSet()
+	file, err := goparser.ParseFile(fset, "", content, goparser.ParseComments)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	funcs := map[string]*ast.FuncDecl{}
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Recv != nil || fn.Body == nil {
+			continue
+		}
+		if strings.HasPrefix(fn.Name.Name, "autoConvert_") || strings.HasPrefix(fn.Name.Name, "Convert_") {
+			funcs[fn.Name.Name] = fn
+		}
+	}
+
+	keep := map[string]bool{}
+	queue := []string{}
+	for name, fn := range funcs {
+		if used[name] || tagged[conversionLocalType(fn)] {
+			queue = append(queue, name)
+		}
+	}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		if keep[name] {
+			continue
+		}
+		keep[name] = true
+		ast.Inspect(funcs[name].Body, func(n ast.Node) bool {
+			if ident, ok := n.(*ast.Ident); ok && funcs[ident.Name] != nil && !keep[ident.Name] {
+				queue = append(queue, ident.Name)
+			}
+			return true
+		})
+	}
+
+	removed := []string{}
+	removedNodes := []ast.Node{}
+	decls := []ast.Decl{}
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if ok && funcs[fn.Name.Name] == fn && !keep[fn.Name.Name] {
+			removed = append(removed, fn.Name.Name)
+			removedNodes = append(removedNodes, fn)
+			continue
+		}
+		decls = append(decls, decl)
+	}
+	if len(removed) == 0 {
+		return content, nil, nil
+	}
+	file.Decls = decls
+	file.Comments = commentsOutside(file.Comments, removedNodes)
+
+	// drop registrations calling removed functions
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Recv != nil || fn.Name.Name != "RegisterConversions" || fn.Body == nil {
+			continue
+		}
+		stmts := []ast.Stmt{}
+		for _, stmt := range fn.Body.List {
+			calls := false
+			ast.Inspect(stmt, func(n ast.Node) bool {
+				if ident, ok := n.(*ast.Ident); ok && funcs[ident.Name] != nil && !keep[ident.Name] {
+					calls = true
+				}
+				return !calls
+			})
+			if !calls {
+				stmts = append(stmts, stmt)
+			}
+		}
+		fn.Body.List = stmts
+	}
+	// e.g. unsafe used only by removed functions
+	deleteUnusedImports(fset, file)
+
+	buf := &bytes.Buffer{}
+	if err := format.Node(buf, fset, file); err != nil {
+		return nil, nil, err
+	}
+	sort.Strings(removed)
+	return buf.Bytes(), removed, nil
+}
+
+// conversionLocalType returns name of the type declared in the package which
+// the generated conversion function fn converts from or to, e.g. Foo of
+// func autoConvert_v1_Foo_To_apps_Foo(in *Foo, out *apps.Foo, s conversion.Scope) error.
+func conversionLocalType(fn *ast.FuncDecl) string {
+	for _, field := range fn.Type.Params.List {
+		star, ok := field.Type.(*ast.StarExpr)
+		if !ok {
+			continue
+		}
+		if ident, ok := star.X.(*ast.Ident); ok {
+			return ident.Name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,234 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/gengo/parser"
+)
+
+const (
+	testTaggedConversionTypes = `package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+var (
+	localSchemeBuilder = runtime.NewSchemeBuilder()
+	AddToScheme        = localSchemeBuilder.AddToScheme
+)
+
+// +k8s:conversion-gen=true
+
+// Foo is converted.
+type Foo struct {
+	Name string
+	Bar  Bar
+}
+
+type Bar struct {
+	Replicas int32
+}
+
+type Baz struct {
+	Name     string
+	Selector *metav1.LabelSelector
+}
+`
+	testTaggedConversionGenerated = `//go:build !ignore_autogenerated
+// +build !ignore_autogenerated
+
+// Code generated by conversion-gen. DO NOT EDIT.
+
+package v1
+
+import (
+	unsafe "unsafe"
+
+	apps "github.com/example/project/pkg/apis/apps"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	conversion "k8s.io/apimachinery/pkg/conversion"
+	runtime "k8s.io/apimachinery/pkg/runtime"
+)
+
+func init() {
+	localSchemeBuilder.Register(RegisterConversions)
+}
+
+// RegisterConversions adds conversion functions to the given scheme.
+// Public to allow building arbitrary schemes.
+func RegisterConversions(s *runtime.Scheme) error {
+	if err := s.AddGeneratedConversionFunc((*Bar)(nil), (*apps.Bar)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1_Bar_To_apps_Bar(a.(*Bar), b.(*apps.Bar), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*Baz)(nil), (*apps.Baz)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1_Baz_To_apps_Baz(a.(*Baz), b.(*apps.Baz), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*Foo)(nil), (*apps.Foo)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1_Foo_To_apps_Foo(a.(*Foo), b.(*apps.Foo), scope)
+	}); err != nil {
+		return err
+	}
+	return nil
+}
+
+func autoConvert_v1_Bar_To_apps_Bar(in *Bar, out *apps.Bar, s conversion.Scope) error {
+	out.Replicas = in.Replicas
+	return nil
+}
+
+// Convert_v1_Bar_To_apps_Bar is an autogenerated conversion function.
+func Convert_v1_Bar_To_apps_Bar(in *Bar, out *apps.Bar, s conversion.Scope) error {
+	return autoConvert_v1_Bar_To_apps_Bar(in, out, s)
+}
+
+func autoConvert_v1_Baz_To_apps_Baz(in *Baz, out *apps.Baz, s conversion.Scope) error {
+	out.Name = in.Name
+	out.Selector = (*v1.LabelSelector)(unsafe.Pointer(in.Selector))
+	return nil
+}
+
+// Convert_v1_Baz_To_apps_Baz is an autogenerated conversion function.
+func Convert_v1_Baz_To_apps_Baz(in *Baz, out *apps.Baz, s conversion.Scope) error {
+	return autoConvert_v1_Baz_To_apps_Baz(in, out, s)
+}
+
+func autoConvert_v1_Foo_To_apps_Foo(in *Foo, out *apps.Foo, s conversion.Scope) error {
+	out.Name = in.Name
+	if err := Convert_v1_Bar_To_apps_Bar(&in.Bar, &out.Bar, s); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Convert_v1_Foo_To_apps_Foo is an autogenerated conversion function.
+func Convert_v1_Foo_To_apps_Foo(in *Foo, out *apps.Foo, s conversion.Scope) error {
+	return autoConvert_v1_Foo_To_apps_Foo(in, out, s)
+}
+`
+)
+
+func Test_conversionTaggedTypes(t *testing.T) {
+	b := parser.New()
+	assert.NoError(t, b.AddFileForTest("example.com/apis/v1", "example.com/apis/v1/types.go", []byte(testTaggedConversionTypes)))
+	got, err := conversionTaggedTypes(b, []string{"example.com/apis/v1"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]map[string]bool{"example.com/apis/v1": {"Foo": true}}, got)
+
+	// conversion-gen fails on the tag in doc comments
+	b = parser.New()
+	assert.NoError(t, b.AddFileForTest("example.com/apis/v1", "example.com/apis/v1/types.go", []byte("package v1\n\n// +k8s:conversion-gen=true\ntype Foo struct{}\n")))
+	_, err = conversionTaggedTypes(b, []string{"example.com/apis/v1"})
+	assert.Error(t, err)
+}
+
+func Test_pruneUntaggedConversions(t *testing.T) {
+	c := newTestWorkspaceGenerator(t, map[string]string{
+		"pkg/apis/apps/types.go":    "package apps\n\nimport metav1 \"k8s.io/apimachinery/pkg/apis/meta/v1\"\n\ntype Foo struct {\n\tName string\n\tBar  Bar\n}\n\ntype Bar struct {\n\tReplicas int32\n}\n\ntype Baz struct {\n\tName     string\n\tSelector *metav1.LabelSelector\n}\n",
+		"pkg/apis/apps/v1/types.go": testTaggedConversionTypes,
+	})
+	file := filepath.Join(c.outputBase, "github.com/example/project/pkg/apis/apps/v1/zz_generated.conversion.go")
+	writeTestFiles(t, c.outputBase, map[string]string{
+		"github.com/example/project/pkg/apis/apps/v1/zz_generated.conversion.go": testTaggedConversionGenerated,
+	})
+
+	tagged := map[string]map[string]bool{"github.com/example/project/pkg/apis/apps/v1": {"Foo": true}}
+	assert.NoError(t, c.pruneUntaggedConversions([]string{"github.com/example/project/pkg/apis/apps/v1"}, tagged))
+	content, err := ioutil.ReadFile(file)
+	assert.NoError(t, err)
+	got := string(content)
+	assert.Contains(t, got, "func Convert_v1_Foo_To_apps_Foo(")
+	// Bar is untagged but used by Foo
+	assert.Contains(t, got, "func Convert_v1_Bar_To_apps_Bar(")
+	assert.Contains(t, got, "func autoConvert_v1_Bar_To_apps_Bar(")
+	assert.NotContains(t, got, "Baz")
+	// imports used only by removed conversions
+	assert.NotContains(t, got, "\"unsafe\"")
+	assert.NotContains(t, got, "k8s.io/apimachinery/pkg/apis/meta/v1")
+
+	// the pruned conversions compile
+	writeTestFiles(t, c.workspace, map[string]string{
+		"pkg/apis/apps/v1/zz_generated.conversion.go": got,
+	})
+	goBuild(t, c, "./pkg/apis/...")
+}
+
+func Test_pruneConversions_handwritten(t *testing.T) {
+	// autoConvert of Baz is called by its conversion written by hand
+	got, removed, err := pruneConversions([]byte(testTaggedConversionGenerated), map[string]bool{"Foo": true}, map[string]bool{"autoConvert_v1_Baz_To_apps_Baz": true})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Convert_v1_Baz_To_apps_Baz"}, removed)
+	assert.Contains(t, string(got), "func autoConvert_v1_Baz_To_apps_Baz(")
+	assert.NotContains(t, string(got), "// Convert_v1_Baz_To_apps_Baz is an autogenerated conversion function.")
+	assert.NotContains(t, string(got), "return Convert_v1_Baz_To_apps_Baz(")
+	// still used by the kept autoConvert function
+	assert.Contains(t, string(got), "unsafe \"unsafe\"")
+}
+
+func Test_packageReferences(t *testing.T) {
+	c := newTestCodeGenerator()
+	c.workspace = t.TempDir()
+	c.workspaceModule = "github.com/example/project"
+	writeTestFiles(t, c.workspace, map[string]string{
+		"pkg/apis/apps/v1/conversion.go": "package v1\n\nfunc Convert_v1_Foo_To_apps_Foo() error {\n\treturn autoConvert_v1_Foo_To_apps_Foo()\n}\n",
+		// conversions of a peer version reuse those of v1
+		"pkg/apis/apps/v1beta1/conversion.go": `package v1beta1
+
+import (
+	appsv1 "github.com/example/project/pkg/apis/apps/v1"
+)
+
+func Convert_v1beta1_Baz_To_apps_Baz() error {
+	return appsv1.Convert_v1_Baz_To_apps_Baz()
+}
+`,
+	})
+	got, err := c.packageReferences([]string{
+		"github.com/example/project/pkg/apis/apps/v1",
+		"github.com/example/project/pkg/apis/apps/v1beta1",
+	})
+	assert.NoError(t, err)
+	assert.True(t, got["github.com/example/project/pkg/apis/apps/v1"]["autoConvert_v1_Foo_To_apps_Foo"])
+	assert.True(t, got["github.com/example/project/pkg/apis/apps/v1"]["Convert_v1_Baz_To_apps_Baz"])
+	assert.False(t, got["github.com/example/project/pkg/apis/apps/v1beta1"]["Convert_v1_Baz_To_apps_Baz"])
+}
+
+func Test_genConversion_taggedOnly(t *testing.T) {
+	c := newTestWorkspaceGenerator(t, map[string]string{
+		"pkg/apis/apps/types.go":    "package apps\n\ntype Foo struct {\n\tName string\n\tBar  Bar\n}\n\ntype Bar struct {\n\tReplicas int32\n}\n\ntype Baz struct {\n\tName string\n}\n",
+		"pkg/apis/apps/v1/doc.go":   "// +k8s:conversion-gen=github.com/example/project/pkg/apis/apps\npackage v1\n",
+		"pkg/apis/apps/v1/types.go": strings.Replace(strings.Replace(testTaggedConversionTypes, "\tmetav1 \"k8s.io/apimachinery/pkg/apis/meta/v1\"\n", "", 1), "\tSelector *metav1.LabelSelector\n", "", 1),
+	})
+	c.WithConversionTaggedOnly(true)
+	run := testGeneratorRunner(t, c, "conversion")
+	// types are parsed in workspace rather than the module the test runs in
+	assert.NoError(t, c.genConversion(c.logger, run))
+
+	content, err := ioutil.ReadFile(filepath.Join(c.outputBase, "github.com/example/project/pkg/apis/apps/v1/zz_generated.conversion.go"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "func Convert_v1_Foo_To_apps_Foo(")
+	assert.NotContains(t, string(content), "Baz")
+}
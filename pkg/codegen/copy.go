@@ -0,0 +1,240 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sync"
+
+	"github.com/go-logr/logr"
+	"github.com/otiai10/copy"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+var (
+	codeGeneratedRegexp = regexp.MustCompile(`(?m)^// Code generated .* DO NOT EDIT\.$`)
+	packageClauseRegexp = regexp.MustCompile(`(?m)^package \w+`)
+)
+
+// copyTree copies generated files from src to dst. If parallelism is greater
+// than 1, files are copied by a bounded pool of workers after all directories
+// are created in walk order, and errors of all files are aggregated.
+func copyTree(src, dst string, parallelism int) error {
+	if parallelism <= 1 {
+		return copy.Copy(src, dst)
+	}
+
+	files := []string{}
+	err := filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			return os.MkdirAll(filepath.Join(dst, rel), info.Mode().Perm())
+		}
+		files = append(files, rel)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if parallelism > len(files) {
+		parallelism = len(files)
+	}
+	queue := make(chan int)
+	errs := make([]error, len(files))
+	wg := sync.WaitGroup{}
+	for i := 0; i < parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				errs[i] = copyFile(filepath.Join(src, files[i]), filepath.Join(dst, files[i]))
+			}
+		}()
+	}
+	for i := range files {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+
+	return utilerrors.NewAggregate(errs)
+}
+
+// copyFile copies regular file or symlink src to dst, dst is overwritten if
+// it exists.
+func copyFile(src, dst string) error {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		if err := os.RemoveAll(dst); err != nil {
+			return err
+		}
+		return os.Symlink(target, dst)
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// excludeGeneratedFiles removes files in src matching any of patterns so that
+// they are not copied to workspace. A pattern is matched against the slash
+// separated path relative to src and the base name of the file, in
+// filepath.Match syntax.
+func excludeGeneratedFiles(logger logr.Logger, src string, patterns []string) error {
+	if len(patterns) == 0 {
+		return nil
+	}
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if os.IsNotExist(err) && p == src {
+			// not generated
+			return fs.SkipDir
+		}
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		for _, pattern := range patterns {
+			matched, err := path.Match(pattern, filepath.ToSlash(rel))
+			if err != nil {
+				return err
+			}
+			if !matched {
+				if matched, err = filepath.Match(pattern, d.Name()); err != nil {
+					return err
+				}
+			}
+			if matched {
+				logger.Info("excluding generated file", "file", filepath.ToSlash(rel), "pattern", pattern)
+				return os.Remove(p)
+			}
+		}
+		return nil
+	})
+}
+
+// cleanOutputDirs removes existing generated go files from each dir of dst
+// into which src has files to copy, so that files no longer generated do not
+// remain after copying. Files without "Code generated" comment before the
+// package clause and dirs without new output are left alone.
+func cleanOutputDirs(logger logr.Logger, src, dst string) error {
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		entries, err := os.ReadDir(p)
+		if err != nil {
+			return err
+		}
+		hasOutput := false
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				hasOutput = true
+				break
+			}
+		}
+		if !hasOutput {
+			return nil
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		return removeGeneratedFiles(logger, filepath.Join(dst, rel))
+	})
+}
+
+// removeGeneratedFiles removes generated go files directly in dir.
+func removeGeneratedFiles(logger logr.Logger, dir string) error {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".go" {
+			continue
+		}
+		if err := removeGeneratedFile(logger, filepath.Join(dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeGeneratedFile removes go file if it exists and is generated, a file
+// is generated if the "Code generated" comment is before its package clause.
+func removeGeneratedFile(logger logr.Logger, file string) error {
+	content, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if loc := packageClauseRegexp.FindIndex(content); loc != nil {
+		content = content[:loc[0]]
+	}
+	if !codeGeneratedRegexp.Match(content) {
+		return nil
+	}
+	logger.V(1).Info("removing generated file", "file", file)
+	return os.Remove(file)
+}
@@ -0,0 +1,141 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_copyTree(t *testing.T) {
+	src := t.TempDir()
+	for i := 0; i < 100; i++ {
+		dir := filepath.Join(src, fmt.Sprintf("group%d", i%10), "v1")
+		assert.NoError(t, os.MkdirAll(dir, 0755))
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, fmt.Sprintf("file%d.go", i)), []byte(fmt.Sprintf("package v1 // %d\n", i)), 0644))
+	}
+
+	for _, parallelism := range []int{1, 8} {
+		t.Run(fmt.Sprintf("parallelism-%d", parallelism), func(t *testing.T) {
+			dst := t.TempDir()
+			// existing files are overwritten
+			assert.NoError(t, os.MkdirAll(filepath.Join(dst, "group0", "v1"), 0755))
+			assert.NoError(t, ioutil.WriteFile(filepath.Join(dst, "group0", "v1", "file0.go"), []byte("stale"), 0644))
+
+			assert.NoError(t, copyTree(src, dst, parallelism))
+			for i := 0; i < 100; i++ {
+				got, err := ioutil.ReadFile(filepath.Join(dst, fmt.Sprintf("group%d", i%10), "v1", fmt.Sprintf("file%d.go", i)))
+				assert.NoError(t, err)
+				assert.Equal(t, fmt.Sprintf("package v1 // %d\n", i), string(got))
+			}
+		})
+	}
+
+	// errors of all files are aggregated
+	dst := t.TempDir()
+	for _, group := range []string{"group1", "group2"} {
+		assert.NoError(t, os.MkdirAll(filepath.Join(dst, group, "v1"), 0755))
+		assert.NoError(t, os.Mkdir(filepath.Join(dst, group, "v1", "file"+group[5:]+".go"), 0755))
+	}
+	err := copyTree(src, dst, 4)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "file1.go")
+	assert.Contains(t, err.Error(), "file2.go")
+}
+
+func Test_cleanOutputDirs(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	writeTestFiles(t, src, map[string]string{
+		"listers/apps/v1/foo.go": "// Code generated by lister-gen. DO NOT EDIT.\n\npackage v1\n",
+	})
+	writeTestFiles(t, dst, map[string]string{
+		// orphan of a removed kind
+		"listers/apps/v1/bar.go": "// Copyright\n\n// Code generated by lister-gen. DO NOT EDIT.\n\npackage v1\n",
+		// hand-written expansion
+		"listers/apps/v1/expansion.go":  "package v1\n\n// Code generated by lister-gen. DO NOT EDIT.\n",
+		"listers/apps/v1/crds/foo.yaml": "kind: CustomResourceDefinition\n",
+		// dir without new output
+		"listers/batch/v1/job.go": "// Code generated by lister-gen. DO NOT EDIT.\n\npackage v1\n",
+	})
+
+	assert.NoError(t, cleanOutputDirs(logr.Discard(), src, dst))
+	assert.NoFileExists(t, filepath.Join(dst, "listers/apps/v1/bar.go"))
+	assert.FileExists(t, filepath.Join(dst, "listers/apps/v1/expansion.go"))
+	assert.FileExists(t, filepath.Join(dst, "listers/apps/v1/crds/foo.yaml"))
+	assert.FileExists(t, filepath.Join(dst, "listers/batch/v1/job.go"))
+
+	assert.NoError(t, copyTree(src, dst, 1))
+	assert.FileExists(t, filepath.Join(dst, "listers/apps/v1/foo.go"))
+}
+
+func Test_excludeGeneratedFiles(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	writeTestFiles(t, src, map[string]string{
+		"pkg/apis/apps/v1/zz_generated.openapi.go":  "package v1\n",
+		"pkg/apis/apps/v1/modelstxt":                "models\n",
+		"pkg/apis/apps/v1/zz_generated.deepcopy.go": "package v1\n",
+	})
+
+	assert.NoError(t, excludeGeneratedFiles(logr.Discard(), src, []string{"modelstxt"}))
+	assert.NoError(t, copyTree(src, dst, 1))
+	assert.NoFileExists(t, filepath.Join(dst, "pkg/apis/apps/v1/modelstxt"))
+	assert.FileExists(t, filepath.Join(dst, "pkg/apis/apps/v1/zz_generated.openapi.go"))
+	assert.FileExists(t, filepath.Join(dst, "pkg/apis/apps/v1/zz_generated.deepcopy.go"))
+
+	// relative path
+	assert.NoError(t, excludeGeneratedFiles(logr.Discard(), src, []string{"pkg/apis/*/v1/zz_generated.openapi.go"}))
+	assert.NoFileExists(t, filepath.Join(src, "pkg/apis/apps/v1/zz_generated.openapi.go"))
+	assert.FileExists(t, filepath.Join(src, "pkg/apis/apps/v1/zz_generated.deepcopy.go"))
+
+	// not generated
+	assert.NoError(t, excludeGeneratedFiles(logr.Discard(), filepath.Join(src, "missing"), []string{"*"}))
+	assert.Error(t, excludeGeneratedFiles(logr.Discard(), src, []string{"["}))
+}
+
+func Test_postRun_cleanOutputDirs(t *testing.T) {
+	c := newTestCodeGenerator().WithCleanOutputDirs(true)
+	c.workspace = t.TempDir()
+	c.outputBase = filepath.Join(c.workspace, "__output", "generated")
+	c.boilerplatePath = filepath.Join(c.workspace, "hack", "boilerplate.go.txt")
+	writeTestFiles(t, c.workspace, map[string]string{
+		"hack/boilerplate.go.txt": "// header\n",
+		// generated by previous runs
+		"pkg/apis/apps/v1/zz_generated.deepcopy.go": "// Code generated by deepcopy-gen. DO NOT EDIT.\n\npackage v1\n",
+		"pkg/apis/apps/v1/zz.generated.refs.go":     "// Code generated by install-gen. DO NOT EDIT.\n\npackage v1\n",
+		"pkg/apis/apps/v1/zz_generated.orphan.go":   "// Code generated by orphan-gen. DO NOT EDIT.\n\npackage v1\n",
+	})
+	// in-process generators write into output base along with gengo generators
+	writeTestFiles(t, c.generatedDir("pkg/apis"), map[string]string{
+		"apps/v1/zz.generated.refs.go": "// Code generated by install-gen. DO NOT EDIT.\n\npackage v1\n\n// refs\n",
+	})
+	writeTestFiles(t, filepath.Join(c.outputBase, c.workspaceModule), map[string]string{
+		"pkg/apis/apps/v1/zz_generated.deepcopy.go": "// Code generated by deepcopy-gen. DO NOT EDIT.\n\npackage v1\n\n// deepcopy\n",
+	})
+
+	assert.NoError(t, c.postRun([]string{"deepcopy", "install"}))
+	assert.NoFileExists(t, filepath.Join(c.workspace, "pkg/apis/apps/v1/zz_generated.orphan.go"))
+	refs, err := ioutil.ReadFile(filepath.Join(c.workspace, "pkg/apis/apps/v1/zz.generated.refs.go"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(refs), "// refs\n")
+	deepcopy, err := ioutil.ReadFile(filepath.Join(c.workspace, "pkg/apis/apps/v1/zz_generated.deepcopy.go"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(deepcopy), "// deepcopy\n")
+}
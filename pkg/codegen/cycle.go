@@ -0,0 +1,148 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/zoumo/goset"
+)
+
+// checkGroupCycles detects circular dependencies among api groups of input
+// packages before deepcopy-gen and conversion-gen, which walk types across
+// groups and may hang or generate wrong output for them. It only warns unless
+// strict is enabled.
+func (c *CodeGenerator) checkGroupCycles(generators []string) error {
+	if !goset.NewSetFromStrings(generators).ContainsAny("deepcopy", "conversion") {
+		return nil
+	}
+	inputPackages := append(append([]string{}, c.inputPackages...), c.inputInternalPackages...)
+	if len(inputPackages) < 2 {
+		return nil
+	}
+	args := append([]string{"list", "-deps", "-f", "{{ .ImportPath }}{{ range .Imports }} {{ . }}{{ end }}"}, inputPackages...)
+	out, err := c.goCmd.RunOutput(args...)
+	if err != nil {
+		return err
+	}
+	imports := map[string][]string{}
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 0 {
+			imports[fields[0]] = fields[1:]
+		}
+	}
+
+	cycle := findGroupCycle(imports, c.inputPackages, c.inputInternalPackages)
+	if len(cycle) == 0 {
+		return nil
+	}
+	if c.strict {
+		return fmt.Errorf("found circular dependencies among api groups in strict mode: %s", strings.Join(cycle, " -> "))
+	}
+	c.logger.Info("found circular dependencies among api groups, generators may hang or generate wrong output", "cycle", strings.Join(cycle, " -> "))
+	return nil
+}
+
+// findGroupCycle returns the first cycle among groups of input packages in the
+// import graph, the group of a versioned package is its parent dir and the
+// group of an internal package is itself. Dependencies through packages other
+// than input packages, e.g. a common types package, are counted. It returns
+// nil if there is no cycle.
+func findGroupCycle(imports map[string][]string, inputPackages, inputInternalPackages []string) []string {
+	groupOf := map[string]string{}
+	for _, pkg := range inputPackages {
+		groupOf[pkg] = path.Dir(pkg)
+	}
+	for _, pkg := range inputInternalPackages {
+		groupOf[pkg] = pkg
+	}
+
+	// group -> groups it depends on
+	deps := map[string]goset.Set{}
+	for pkg, group := range groupOf {
+		if deps[group] == nil {
+			deps[group] = goset.NewSet()
+		}
+		visited := map[string]bool{pkg: true}
+		queue := append([]string{}, imports[pkg]...)
+		for len(queue) > 0 {
+			dep := queue[0]
+			queue = queue[1:]
+			if visited[dep] {
+				continue
+			}
+			visited[dep] = true
+			if depGroup, ok := groupOf[dep]; ok {
+				// dependencies of input packages are counted on their own groups
+				if depGroup != group {
+					deps[group].Add(depGroup) //nolint
+				}
+				continue
+			}
+			queue = append(queue, imports[dep]...)
+		}
+	}
+
+	groups := make([]string, 0, len(deps))
+	for group := range deps {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := map[string]int{}
+	stack := []string{}
+	var visit func(group string) []string
+	visit = func(group string) []string {
+		state[group] = visiting
+		stack = append(stack, group)
+		next := deps[group].ToStrings()
+		sort.Strings(next)
+		for _, dep := range next {
+			switch state[dep] {
+			case visiting:
+				for i := range stack {
+					if stack[i] == dep {
+						return append(append([]string{}, stack[i:]...), dep)
+					}
+				}
+			case unvisited:
+				if cycle := visit(dep); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[group] = done
+		return nil
+	}
+	for _, group := range groups {
+		if state[group] != unvisited {
+			continue
+		}
+		if cycle := visit(group); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_findGroupCycle(t *testing.T) {
+	const apis = "github.com/example/project/pkg/apis"
+	inputPackages := []string{apis + "/apps/v1", apis + "/batch/v1", apis + "/batch/v2", apis + "/core/v1"}
+	inputInternalPackages := []string{apis + "/apps"}
+
+	imports := map[string][]string{
+		apis + "/apps/v1":  {"fmt", apis + "/apps", apis + "/core/v1"},
+		apis + "/apps":     {apis + "/core/v1"},
+		apis + "/batch/v1": {apis + "/core/v1"},
+		apis + "/batch/v2": {apis + "/common"},
+		apis + "/common":   {apis + "/apps/v1"},
+		apis + "/core/v1":  {"fmt"},
+	}
+	// versions of the same group and dependencies without cycle
+	assert.Nil(t, findGroupCycle(imports, inputPackages, inputInternalPackages))
+
+	// batch/v2 -> common -> apps/v1 -> core/v1 -> batch/v1
+	imports[apis+"/core/v1"] = []string{"fmt", apis + "/batch/v1"}
+	assert.Equal(t, []string{apis + "/apps", apis + "/core", apis + "/batch", apis + "/apps"},
+		findGroupCycle(imports, inputPackages, inputInternalPackages))
+}
@@ -0,0 +1,165 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"k8s.io/gengo/parser"
+	"k8s.io/gengo/types"
+)
+
+const (
+	deepcopyTagName  = "k8s:deepcopy-gen"
+	deepcopyFileBase = "zz_generated.deepcopy"
+)
+
+// deepcopyDependents are generators relying on generated deepcopy functions.
+var deepcopyDependents = []string{"conversion", "protobuf"}
+
+// checkDeepcopyDependency warns if any generator in deepcopyDependents is
+// going to run without deepcopy, and generated deepcopy file is missing in
+// any local input package. It returns error instead in strict mode.
+func (c *CodeGenerator) checkDeepcopyDependency(generators []string) error {
+	dependents := []string{}
+	for _, g := range generators {
+		if g == "deepcopy" {
+			return nil
+		}
+		for _, d := range deepcopyDependents {
+			if g == d {
+				dependents = append(dependents, g)
+			}
+		}
+	}
+	if len(dependents) == 0 {
+		return nil
+	}
+
+	missing := []string{}
+	for _, dir := range c.getLocalInputPackagePaths() {
+		_, err := os.Stat(filepath.Join(dir, deepcopyFileBase+".go"))
+		if os.IsNotExist(err) {
+			missing = append(missing, dir)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	if c.strict {
+		return fmt.Errorf("generators %v require deepcopy functions, but %v is not found in %v, please add deepcopy to --generators or set --no-dep-check", dependents, deepcopyFileBase+".go", strings.Join(missing, ","))
+	}
+	c.logger.Info("generators require deepcopy functions, but generated deepcopy file is not found, add deepcopy to --generators if they fail",
+		"generators", dependents, "file", deepcopyFileBase+".go", "dirs", missing)
+	return nil
+}
+
+// checkDeepcopyAliases warns root slice and map alias types used as API
+// fields which deepcopy-gen will not generate DeepCopy for.
+func (c *CodeGenerator) checkDeepcopyAliases() error {
+	inputPackages := append(append([]string{}, c.inputPackages...), c.inputInternalPackages...)
+	b := parser.New()
+	err := c.inWorkspace(func() error {
+		for _, pkg := range inputPackages {
+			if err := b.AddDir(pkg); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	missing, err := findMissingDeepcopyAliases(b, inputPackages)
+	if err != nil {
+		return err
+	}
+	for _, name := range missing {
+		c.logger.Info("slice or map alias type used as field has no DeepCopy, add +k8s:deepcopy-gen=true on it or +k8s:deepcopy-gen=package on its package", "type", name)
+	}
+	return nil
+}
+
+// findMissingDeepcopyAliases returns slice and map alias types in pkgs which
+// are used as struct fields but neither opted in deepcopy-gen nor have
+// DeepCopy or DeepCopyInto methods.
+func findMissingDeepcopyAliases(b *parser.Builder, pkgs []string) ([]string, error) {
+	u, err := b.FindTypes()
+	if err != nil {
+		return nil, err
+	}
+
+	// alias types used as struct fields
+	used := map[*types.Type]bool{}
+	for _, pkg := range pkgs {
+		p := u.Package(pkg)
+		for _, t := range p.Types {
+			if t.Kind != types.Struct {
+				continue
+			}
+			for _, m := range t.Members {
+				mt := m.Type
+				if mt.Kind == types.Pointer {
+					mt = mt.Elem
+				}
+				used[mt] = true
+			}
+		}
+	}
+
+	missing := []string{}
+	for _, pkg := range pkgs {
+		p := u.Package(pkg)
+		pkgEnabled := deepcopyTag(p.Comments) == "package"
+		for _, t := range p.Types {
+			if t.Kind != types.Alias || !used[t] {
+				continue
+			}
+			if t.Underlying.Kind != types.Slice && t.Underlying.Kind != types.Map {
+				continue
+			}
+			typeTag := deepcopyTag(append(append([]string{}, t.SecondClosestCommentLines...), t.CommentLines...))
+			if typeTag == "false" || typeTag == "true" || (pkgEnabled && typeTag == "") {
+				continue
+			}
+			if _, ok := t.Methods["DeepCopy"]; ok {
+				continue
+			}
+			if _, ok := t.Methods["DeepCopyInto"]; ok {
+				continue
+			}
+			missing = append(missing, t.Name.String())
+		}
+	}
+	sort.Strings(missing)
+	return missing, nil
+}
+
+// deepcopyTag returns the value of +k8s:deepcopy-gen tag in comments.
+func deepcopyTag(comments []string) string {
+	values := types.ExtractCommentTags("+", comments)[deepcopyTagName]
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
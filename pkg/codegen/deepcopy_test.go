@@ -0,0 +1,145 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/gengo/parser"
+
+	"github.com/zoumo/kube-codegen/pkg/logging"
+)
+
+func Test_findMissingDeepcopyAliases(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		src  string
+		want []string
+	}{
+		{
+			name: "missing",
+			src: `package v1
+
+type Foo struct {
+	Bars    BarList
+	Labels  *Labels
+	Unused  string
+}
+
+type Bar struct{}
+
+type BarList []Bar
+
+type Labels map[string]string
+
+type NotUsed []Bar
+`,
+			want: []string{"example.com/apis/v1.BarList", "example.com/apis/v1.Labels"},
+		},
+		{
+			name: "type opt-in or has method",
+			src: `package v1
+
+type Foo struct {
+	Bars   BarList
+	Labels Labels
+}
+
+type Bar struct{}
+
+// +k8s:deepcopy-gen=true
+type BarList []Bar
+
+type Labels map[string]string
+
+func (in Labels) DeepCopy() Labels { return in }
+`,
+			want: []string{},
+		},
+		{
+			name: "package opt-in",
+			doc: `// +k8s:deepcopy-gen=package
+package v1
+`,
+			src: `package v1
+
+type Foo struct {
+	Bars BarList
+}
+
+type Bar struct{}
+
+type BarList []Bar
+`,
+			want: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := parser.New()
+			if len(tt.doc) > 0 {
+				assert.NoError(t, b.AddFileForTest("example.com/apis/v1", "example.com/apis/v1/doc.go", []byte(tt.doc)))
+			}
+			assert.NoError(t, b.AddFileForTest("example.com/apis/v1", "example.com/apis/v1/types.go", []byte(tt.src)))
+			got, err := findMissingDeepcopyAliases(b, []string{"example.com/apis/v1"})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_checkDeepcopyDependency(t *testing.T) {
+	c := newTestCodeGenerator()
+	c.workspace = t.TempDir()
+	dir := filepath.Join(c.workspace, "pkg/apis/apps/v1")
+	assert.NoError(t, os.MkdirAll(dir, 0755))
+
+	assert.NoError(t, c.checkDeepcopyDependency([]string{"defaulter", "register"}))
+	assert.NoError(t, c.checkDeepcopyDependency([]string{"deepcopy", "conversion", "protobuf"}))
+
+	// warned by default
+	logs := &bytes.Buffer{}
+	c.logger = logging.NewJSON(logs, 0)
+	assert.NoError(t, c.checkDeepcopyDependency([]string{"conversion", "protobuf"}))
+	assert.Contains(t, logs.String(), "generated deepcopy file is not found")
+
+	c.WithStrict(true)
+	err := c.checkDeepcopyDependency([]string{"conversion", "protobuf"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "please add deepcopy to --generators")
+
+	// generated by previous run
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "zz_generated.deepcopy.go"), []byte("package v1\n"), 0644))
+	assert.NoError(t, c.checkDeepcopyDependency([]string{"conversion"}))
+}
+
+func Test_checkDeepcopyAliases(t *testing.T) {
+	c := newTestWorkspaceGenerator(t, map[string]string{
+		"pkg/apis/apps/v1/types.go": "package v1\n\ntype Foo struct {\n\tLabels Labels\n}\n\ntype Labels map[string]string\n",
+	})
+	c.inputInternalPackages = nil
+	logs := &bytes.Buffer{}
+	c.logger = logging.NewJSON(logs, 0)
+
+	// types are parsed in workspace rather than the module the test runs in
+	assert.NoError(t, c.checkDeepcopyAliases())
+	assert.Contains(t, logs.String(), "github.com/example/project/pkg/apis/apps/v1.Labels")
+}
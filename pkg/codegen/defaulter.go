@@ -0,0 +1,186 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/zoumo/goset"
+)
+
+const (
+	defaulterFileBase     = "zz_generated.defaults"
+	setDefaultsFuncPrefix = "SetDefaults_"
+)
+
+// checkDefaulterFuncs checks that every SetDefaults_ function called by
+// defaulters generated in pkgs is declared in the package it is referenced
+// from, so that defaults are not silently dropped, e.g. the function is
+// renamed or lives in a shared package which is not importable. SetDefaults_
+// functions of pkgs not called by generated defaulters are logged.
+func (c *CodeGenerator) checkDefaulterFuncs(pkgs []string) error {
+	missing := []string{}
+	for _, pkg := range pkgs {
+		content, err := ioutil.ReadFile(path.Join(c.outputBase, pkg, defaulterFileBase+".go"))
+		if os.IsNotExist(err) {
+			// no defaulters generated for the package
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		refs, err := defaulterFuncRefs(content)
+		if err != nil {
+			return fmt.Errorf("failed to parse defaulters of %v: %v", pkg, err)
+		}
+		for key, called := range refs {
+			names := called.ToStrings()
+			sort.Strings(names)
+			refPkg := key
+			if len(refPkg) == 0 {
+				refPkg = pkg
+			}
+			dir, err := c.packageDir(refPkg)
+			if err != nil {
+				return err
+			}
+			declared, err := defaulterFuncDecls(dir)
+			if err != nil {
+				return err
+			}
+			for _, name := range names {
+				if !declared[name] {
+					missing = append(missing, refPkg+"."+name)
+				}
+			}
+			if len(key) > 0 {
+				continue
+			}
+			uncalled := []string{}
+			for name := range declared {
+				if !called.Contains(name) {
+					uncalled = append(uncalled, name)
+				}
+			}
+			if len(uncalled) > 0 {
+				sort.Strings(uncalled)
+				c.logger.Info("defaulter functions are not called by generated defaulters, make sure their types are reachable from types with +k8s:defaulter-gen",
+					"package", pkg, "functions", strings.Join(uncalled, ","))
+			}
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("defaulter functions called by generated defaulters are not found: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// packageDir returns the dir of pkg, pkg in workspace module is resolved
+// without go list.
+func (c *CodeGenerator) packageDir(pkg string) (string, error) {
+	if dir, ok := localPackageDir(c.workspace, c.workspaceModule, pkg); ok {
+		return dir, nil
+	}
+	out, err := c.goCmd.RunOutput("list", "-f", "{{ .Dir }}", pkg)
+	if err != nil {
+		return "", fmt.Errorf("failed to find dir of package %v: %v", pkg, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// defaulterFuncRefs returns SetDefaults_ functions called by generated
+// defaulters content, grouped by import path of their packages, functions of
+// the package itself are grouped by "".
+func defaulterFuncRefs(content []byte) (map[string]goset.Set, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", content, 0)
+	if err != nil {
+		return nil, err
+	}
+	imports := map[string]string{}
+	for _, spec := range file.Imports {
+		p, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			return nil, err
+		}
+		name := path.Base(p)
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		imports[name] = p
+	}
+
+	refs := map[string]goset.Set{}
+	add := func(pkg, name string) {
+		if !strings.HasPrefix(name, setDefaultsFuncPrefix) {
+			return
+		}
+		if refs[pkg] == nil {
+			refs[pkg] = goset.NewSet()
+		}
+		refs[pkg].Add(name) //nolint
+	}
+	ast.Inspect(file, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		switch fn := call.Fun.(type) {
+		case *ast.Ident:
+			add("", fn.Name)
+		case *ast.SelectorExpr:
+			if x, ok := fn.X.(*ast.Ident); ok {
+				if p, ok := imports[x.Name]; ok {
+					add(p, fn.Sel.Name)
+				}
+			}
+		}
+		return true
+	})
+	return refs, nil
+}
+
+// defaulterFuncDecls returns SetDefaults_ functions declared in go files of
+// dir except generated defaulters and tests.
+func defaulterFuncDecls(dir string) (map[string]bool, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(info os.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go") && info.Name() != defaulterFileBase+".go"
+	}, 0)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	declared := map[string]bool{}
+	for _, p := range pkgs {
+		for _, f := range p.Files {
+			for _, decl := range f.Decls {
+				if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil && strings.HasPrefix(fn.Name.Name, setDefaultsFuncPrefix) {
+					declared[fn.Name.Name] = true
+				}
+			}
+		}
+	}
+	return declared, nil
+}
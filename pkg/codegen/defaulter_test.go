@@ -0,0 +1,78 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testDefaultsGenerated = `// Code generated by defaulter-gen. DO NOT EDIT.
+
+package v1
+
+import (
+	common "github.com/example/project/pkg/apis/common"
+	runtime "k8s.io/apimachinery/pkg/runtime"
+)
+
+func RegisterDefaults(scheme *runtime.Scheme) error {
+	scheme.AddTypeDefaultingFunc(&Foo{}, func(obj interface{}) { SetObjectDefaults_Foo(obj.(*Foo)) })
+	return nil
+}
+
+func SetObjectDefaults_Foo(in *Foo) {
+	SetDefaults_Foo(in)
+	SetDefaults_Bar(&in.Bar)
+	common.SetDefaults_Spec(&in.Spec)
+}
+`
+
+func Test_checkDefaulterFuncs(t *testing.T) {
+	c := newTestCodeGenerator()
+	c.workspace = t.TempDir()
+	c.outputBase = filepath.Join(c.workspace, "__output", "generated")
+	writeTestFiles(t, c.workspace, map[string]string{
+		"pkg/apis/common/defaults.go": "package common\n\nfunc SetDefaults_Spec(in *Spec) {}\n",
+		"pkg/apis/apps/v1/defaults.go": "package v1\n\nfunc SetDefaults_Foo(in *Foo) {}\n\n" +
+			"// not reachable from Foo\nfunc SetDefaults_Baz(in *Baz) {}\n",
+		// generated by previous runs
+		"pkg/apis/apps/v1/zz_generated.defaults.go": "package v1\n\nfunc SetDefaults_Bar(in *Bar) {}\n",
+	})
+	writeTestFiles(t, c.outputBase, map[string]string{
+		"github.com/example/project/pkg/apis/apps/v1/zz_generated.defaults.go": testDefaultsGenerated,
+	})
+
+	err := c.checkDefaulterFuncs([]string{"github.com/example/project/pkg/apis/apps/v1", "github.com/example/project/pkg/apis/batch/v1"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "defaulter functions called by generated defaulters are not found: github.com/example/project/pkg/apis/apps/v1.SetDefaults_Bar")
+	assert.NotContains(t, err.Error(), "SetDefaults_Foo")
+	assert.NotContains(t, err.Error(), "SetDefaults_Spec")
+
+	writeTestFiles(t, c.workspace, map[string]string{
+		"pkg/apis/apps/v1/bar.go": "package v1\n\nfunc SetDefaults_Bar(in *Bar) {}\n",
+	})
+	assert.NoError(t, c.checkDefaulterFuncs([]string{"github.com/example/project/pkg/apis/apps/v1"}))
+}
+
+func Test_defaulterFuncRefs(t *testing.T) {
+	refs, err := defaulterFuncRefs([]byte(testDefaultsGenerated))
+	assert.NoError(t, err)
+	assert.Len(t, refs, 2)
+	assert.ElementsMatch(t, []string{"SetDefaults_Foo", "SetDefaults_Bar"}, refs[""].ToStrings())
+	assert.ElementsMatch(t, []string{"SetDefaults_Spec"}, refs["github.com/example/project/pkg/apis/common"].ToStrings())
+}
@@ -0,0 +1,94 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/zoumo/goset"
+)
+
+// externalInputPackages returns input packages not in workspace module, e.g.
+// k8s.io/api/core/v1 when generating clients for built-in types.
+func (c *CodeGenerator) externalInputPackages() []string {
+	pkgs := []string{}
+	for _, pkg := range c.inputPackages {
+		if _, ok := localPackageDir(c.workspace, c.workspaceModule, pkg); !ok {
+			pkgs = append(pkgs, pkg)
+		}
+	}
+	return pkgs
+}
+
+// checkExternalImports checks go files generated in root import external
+// input packages by their import paths, see checkImports.
+func (c *CodeGenerator) checkExternalImports(root string) error {
+	pkgs := c.externalInputPackages()
+	if len(pkgs) == 0 {
+		return nil
+	}
+	c.logger.V(1).Info("checking imports of external input packages", "dir", root, "packages", pkgs)
+	return checkImports(root, pkgs)
+}
+
+// checkImports returns error if go files in root import any package in vendor
+// tree, or none of them imports one of pkgs. Generators resolving pkgs in a
+// vendored repo or GOPATH may reference them by paths which do not compile in
+// module mode, e.g. github.com/example/project/vendor/k8s.io/api/core/v1.
+func checkImports(root string, pkgs []string) error {
+	imported := goset.NewSet()
+	err := filepath.WalkDir(root, func(file string, d fs.DirEntry, err error) error {
+		if os.IsNotExist(err) && file == root {
+			return fs.SkipDir
+		}
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(file) != ".go" {
+			return nil
+		}
+		f, err := parser.ParseFile(token.NewFileSet(), file, nil, parser.ImportsOnly)
+		if err != nil {
+			return err
+		}
+		for _, spec := range f.Imports {
+			importPath, err := strconv.Unquote(spec.Path.Value)
+			if err != nil {
+				return err
+			}
+			if strings.HasPrefix(importPath, "vendor/") || strings.Contains(importPath, "/vendor/") {
+				return fmt.Errorf("generated file %v imports %v in vendor tree", file, importPath)
+			}
+			imported.Add(importPath) //nolint
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, pkg := range pkgs {
+		if !imported.Contains(pkg) {
+			return fmt.Errorf("no generated file in %v imports %v, check it is resolved from go.mod", root, pkg)
+		}
+	}
+	return nil
+}
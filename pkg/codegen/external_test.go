@@ -0,0 +1,53 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_externalInputPackages(t *testing.T) {
+	c := newTestCodeGenerator()
+	assert.Empty(t, c.externalInputPackages())
+
+	c.inputPackages = []string{"github.com/example/project/pkg/apis/apps/v1", "k8s.io/api/core/v1"}
+	assert.Equal(t, []string{"k8s.io/api/core/v1"}, c.externalInputPackages())
+}
+
+func Test_checkImports(t *testing.T) {
+	root := t.TempDir()
+	writeTestFiles(t, root, map[string]string{
+		"listers/core/v1/pod.go": "package v1\n\nimport (\n\tv1 \"k8s.io/api/core/v1\"\n\t\"k8s.io/client-go/tools/cache\"\n)\n\nvar _ *v1.Pod\nvar _ cache.Indexer\n",
+		"listers/core/v1/doc.go": "package v1\n",
+	})
+	assert.NoError(t, checkImports(filepath.Join(root, "listers"), []string{"k8s.io/api/core/v1"}))
+	assert.NoError(t, checkImports(filepath.Join(root, "missing"), nil))
+
+	err := checkImports(filepath.Join(root, "listers"), []string{"k8s.io/api/core/v1", "k8s.io/api/apps/v1"})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "imports k8s.io/api/apps/v1")
+	}
+
+	writeTestFiles(t, root, map[string]string{
+		"listers/core/v1/node.go": "package v1\n\nimport v1 \"github.com/example/project/vendor/k8s.io/api/core/v1\"\n\nvar _ *v1.Node\n",
+	})
+	err = checkImports(filepath.Join(root, "listers"), []string{"k8s.io/api/core/v1"})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "imports github.com/example/project/vendor/k8s.io/api/core/v1 in vendor tree")
+	}
+}
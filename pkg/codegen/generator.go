@@ -17,13 +17,18 @@ package codegen
 import (
 	"errors"
 	"fmt"
+	"go/token"
 	"io/fs"
 	"io/ioutil"
 	"os"
+	"os/exec"
 	"path"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/otiai10/copy"
@@ -31,11 +36,20 @@ import (
 	"github.com/zoumo/goset"
 	"github.com/zoumo/make-rules/pkg/golang"
 	"github.com/zoumo/make-rules/pkg/runner"
+	"golang.org/x/mod/semver"
 	"k8s.io/gengo/generator"
 	"k8s.io/gengo/namer"
 	"k8s.io/gengo/parser"
 
 	"github.com/zoumo/kube-codegen/cmd/crd-gen/app"
+	"github.com/zoumo/kube-codegen/pkg/generator/crd"
+)
+
+const (
+	// genericListersMinVersion is the first code-generator version whose
+	// lister-gen generates listers on the generic listers.ResourceIndexer of
+	// k8s.io/client-go/listers instead of per-type indexer wrappers.
+	genericListersMinVersion = "v0.31.0"
 )
 
 var (
@@ -53,23 +67,76 @@ var (
 		"crd",
 		"openapi",
 		"protobuf",
+		"applyconfiguration",
 		"client",
 		"lister",
 		"informer",
 	}
 	validGenerators = goset.NewSetFromStrings(sortedValidGenerators)
+
+	registeredGenerators = map[string]GeneratorFunc{}
 )
 
+// SkippedGenerator records a generator which is requested but not run.
+type SkippedGenerator struct {
+	Name   string
+	Reason string
+}
+
+// GeneratorFunc runs a generator registered by RegisterGenerator, logger is
+// the logger of c with the generator name.
+type GeneratorFunc func(c *CodeGenerator, logger logr.Logger, run *runner.Runner) error
+
+// RegisterGenerator registers a custom generator which runs right after the
+// generator named after, empty after means the end of the pipeline. A nil fn
+// reserves a no-op slot in the pipeline.
+//
+// It is not safe for concurrent use, generators should be registered in init.
+func RegisterGenerator(name string, fn GeneratorFunc, after string) error {
+	if len(name) == 0 {
+		return fmt.Errorf("generator name must not be empty")
+	}
+	if validGenerators.Contains(name) {
+		return fmt.Errorf("generator %q is already registered", name)
+	}
+	pos := len(sortedValidGenerators)
+	if len(after) > 0 {
+		pos = -1
+		for i, g := range sortedValidGenerators {
+			if g == after {
+				pos = i + 1
+				break
+			}
+		}
+		if pos < 0 {
+			return fmt.Errorf("generator %q to register %q after is not found", after, name)
+		}
+	}
+
+	sorted := make([]string, 0, len(sortedValidGenerators)+1)
+	sorted = append(sorted, sortedValidGenerators[:pos]...)
+	sorted = append(sorted, name)
+	sorted = append(sorted, sortedValidGenerators[pos:]...)
+	sortedValidGenerators = sorted
+	validGenerators.Add(name) //nolint
+	registeredGenerators[name] = fn
+	return nil
+}
+
 type CodeGenerator struct {
 	workspace       string
 	workspaceModule string
 	logger          logr.Logger
 
+	goBin                string
+	usePathGenerators    bool
+	pathGenerators       map[string]string
 	goCmd                *runner.Runner
 	gomodHelper          *golang.GomodHelper
 	enabledGenerators    []string
 	disabledGenerators   []string
 	codeGeneratorVersion string
+	generatorVersions    map[string]string
 
 	inputPackages         []string
 	inputInternalPackages []string
@@ -81,8 +148,83 @@ type CodeGenerator struct {
 	listerDirName    string
 	informerDirName  string
 
-	outputBase string
-	verbose    int
+	outputBase  string
+	inPlace     bool
+	verbose     int
+	genDocs     bool
+	verifyBuild bool
+	strict      bool
+	verify      bool
+	verboseDiff bool
+
+	crdVersionAnnotation string
+	crdVersion           string
+	crdYAML              bool
+	crdOnlyYAML          bool
+	crdSingleFile        string
+	crdAggregateOnly     bool
+	crdConversionNone    bool
+	crdPreserveOrder     bool
+	crdServed            map[string]bool
+	crdStorage           map[string]bool
+	crdMaxDepth          int
+	crdMaxDescLen        int
+
+	codeGeneratedTemplate string
+	sourceDateEpoch       int64
+	headerVars            map[string]string
+	headerFile            string
+	trimPathPrefix        string
+
+	conversionSkipUnsafe bool
+	conversionBuildTag   string
+	conversionTaggedOnly bool
+	conversionSubdir     string
+	genConversionScheme  bool
+	genConversionBench   bool
+	scaffoldConversions  bool
+	genEvents            bool
+	genAPIDocs           bool
+	genPriority          bool
+	genRoundTripTests    bool
+	genRefs              bool
+	genDynamic           bool
+	genInformerErrors    bool
+	genAdapter           bool
+	genSerializer        bool
+	copyParallelism      int
+	excludeGenerated     []string
+	cleanOutputDirs      bool
+	commit               bool
+	commitMessage        string
+	generatedFiles       []string
+	noDepCheck           bool
+	clientContentType    string
+	clientUserAgent      string
+	genRateLimit         bool
+	genericListers       bool
+	installSchemeOnly    bool
+	installReturnError   bool
+	schemeAddMetav1      bool
+	installPackageName   string
+	skipGroupProtection  bool
+	keepStaleProtobuf    bool
+	protoTempDir         string
+
+	informerDefaultResync time.Duration
+
+	applyConfigurationPackage string
+	noApplyMethods            bool
+	applyExternalTypes        []string
+	openapiExtraInputs        []string
+	openapiOnlyTypes          []string
+	openapiReportFormat       string
+	clientOnlyKinds           []string
+	nonNamespacedKinds        []string
+	listerKeyFields           []string
+	clientInputBase           string
+
+	skipped []SkippedGenerator
 }
 
 func NewCodeGenerator(
@@ -100,7 +242,11 @@ func NewCodeGenerator(
 		workspace:             workspace,
 		workspaceModule:       workspaceModule,
 		logger:                logger,
-		goCmd:                 runner.NewRunner("go"),
+		goBin:                 "go",
+		goCmd:                 runner.NewRunner("go").WithDir(workspace),
+		pathGenerators:        map[string]string{},
+		crdMaxDescLen:         -1,
+		sourceDateEpoch:       -1,
 		gomodHelper:           golang.NewGomodHelper(path.Join(workspace, "go.mod"), logger),
 		enabledGenerators:     make([]string, 0),
 		disabledGenerators:    make([]string, 0),
@@ -134,10 +280,526 @@ func NewCodeGenerator(
 	return c
 }
 
+// WithGoBin sets the go binary used to install and run generators.
+func (c *CodeGenerator) WithGoBin(goBin string) *CodeGenerator {
+	if len(goBin) == 0 {
+		return c
+	}
+	c.goBin = goBin
+	c.goCmd = runner.NewRunner(goBin).WithDir(c.workspace)
+	return c
+}
+
+// WithUsePathGenerators makes generator binaries found on PATH used instead of
+// installing them into <workspace>/bin, if they are built from the
+// k8s.io/code-generator version of the generators.
+func (c *CodeGenerator) WithUsePathGenerators(usePath bool) *CodeGenerator {
+	c.usePathGenerators = usePath
+	return c
+}
+
+// WithGeneratorVersions pins k8s.io/code-generator versions of generators by
+// name, e.g. deepcopy. Generators not pinned use the code-generator version.
+func (c *CodeGenerator) WithGeneratorVersions(versions map[string]string) *CodeGenerator {
+	c.generatorVersions = versions
+	return c
+}
+
+// generatorVersion returns the k8s.io/code-generator version of generator.
+func (c *CodeGenerator) generatorVersion(generator string) string {
+	if version, ok := c.generatorVersions[generator]; ok {
+		return version
+	}
+	return c.codeGeneratorVersion
+}
+
+// WithGenDocs enables generating doc.go for clientset, listers and informers.
+func (c *CodeGenerator) WithGenDocs(genDocs bool) *CodeGenerator {
+	c.genDocs = genDocs
+	return c
+}
+
+// WithVerifyBuild makes generator build generated apis and clients packages
+// after generation, and the clientset and listers before informer-gen.
+func (c *CodeGenerator) WithVerifyBuild(verify bool) *CodeGenerator {
+	c.verifyBuild = verify
+	return c
+}
+
+// WithCRDVersion stamps version on every generated CRD with the annotation key.
+func (c *CodeGenerator) WithCRDVersion(annotation, version string) *CodeGenerator {
+	c.crdVersionAnnotation = annotation
+	c.crdVersion = version
+	return c
+}
+
+// WithConversionSkipUnsafe makes conversion-gen generate safe conversions only.
+func (c *CodeGenerator) WithConversionSkipUnsafe(skipUnsafe bool) *CodeGenerator {
+	c.conversionSkipUnsafe = skipUnsafe
+	return c
+}
+
+// WithConversionBuildTag makes conversion-gen parse files gated by the build
+// tag, and gates generated conversions by it. gengo --build-tag of
+// conversion-gen takes a single tag, so does it.
+func (c *CodeGenerator) WithConversionBuildTag(tag string) *CodeGenerator {
+	c.conversionBuildTag = tag
+	return c
+}
+
+// WithConversionTaggedOnly makes conversion generator keep generated
+// conversions of types tagged with +k8s:conversion-gen=true only, and of types
+// they depend on.
+func (c *CodeGenerator) WithConversionTaggedOnly(taggedOnly bool) *CodeGenerator {
+	c.conversionTaggedOnly = taggedOnly
+	return c
+}
+
+// WithConversionSubdir makes conversion generator move zz_generated.conversion.go
+// of each package into its subpackage in subdir, e.g. conversions. Install
+// packages add the subpackages to scheme instead of the version packages.
+func (c *CodeGenerator) WithConversionSubdir(subdir string) *CodeGenerator {
+	c.conversionSubdir = subdir
+	return c
+}
+
+// WithGenConversionScheme makes conversion generator generate
+// zz_generated.conversion_scheme.go along with zz_generated.conversion.go,
+// which registers the generated conversions with a scheme explicitly.
+func (c *CodeGenerator) WithGenConversionScheme(genConversionScheme bool) *CodeGenerator {
+	c.genConversionScheme = genConversionScheme
+	return c
+}
+
+// WithGenConversionBenchmarks makes conversion generator generate
+// conversion_bench_test.go along with zz_generated.conversion.go, which
+// benchmarks each generated conversion on a fuzzed object.
+func (c *CodeGenerator) WithGenConversionBenchmarks(genBench bool) *CodeGenerator {
+	c.genConversionBench = genBench
+	return c
+}
+
+// WithScaffoldManualConversions makes conversion generator scaffold stubs of
+// conversion functions which conversion-gen requires to be written by hand.
+func (c *CodeGenerator) WithScaffoldManualConversions(scaffold bool) *CodeGenerator {
+	c.scaffoldConversions = scaffold
+	return c
+}
+
+// WithGenAPIDocs makes crd generator generate types.md of each group
+// documenting kinds and their fields.
+func (c *CodeGenerator) WithGenAPIDocs(genAPIDocs bool) *CodeGenerator {
+	c.genAPIDocs = genAPIDocs
+	return c
+}
+
+// WithOpenapiExtraInputs makes openapi-gen take the packages as additional
+// input dirs, e.g. k8s.io/api/core/v1 referenced by types of input packages.
+func (c *CodeGenerator) WithOpenapiExtraInputs(pkgs []string) *CodeGenerator {
+	c.openapiExtraInputs = pkgs
+	return c
+}
+
+// WithOpenapiOnlyTypes makes openapi generator retain only definitions of
+// types and the types they reference transitively, e.g.
+// github.com/example/project/pkg/apis/apps/v1.Foo. Empty means all definitions.
+func (c *CodeGenerator) WithOpenapiOnlyTypes(types []string) *CodeGenerator {
+	c.openapiOnlyTypes = types
+	return c
+}
+
+// WithOpenapiReportFormat sets the format of violations.report written by
+// openapi generator, one of text|json. Empty means text.
+func (c *CodeGenerator) WithOpenapiReportFormat(format string) *CodeGenerator {
+	c.openapiReportFormat = format
+	return c
+}
+
+// WithGenEvents makes install generator generate event recorder helper for each group.
+func (c *CodeGenerator) WithGenEvents(genEvents bool) *CodeGenerator {
+	c.genEvents = genEvents
+	return c
+}
+
+// WithKeepStaleProtobuf disables removing existing generated protobuf files
+// before running go-to-protobuf.
+func (c *CodeGenerator) WithKeepStaleProtobuf(keep bool) *CodeGenerator {
+	c.keepStaleProtobuf = keep
+	return c
+}
+
+// WithApplyConfigurationPackage makes applyconfiguration-gen generate apply
+// configurations into the package, and client-gen generate typed Apply() methods
+// referencing them. Empty package disables both.
+func (c *CodeGenerator) WithApplyConfigurationPackage(pkg string) *CodeGenerator {
+	c.applyConfigurationPackage = pkg
+	return c
+}
+
+// WithApplyMethods enables or disables typed Apply() methods generated by
+// client-gen, apply configurations are generated regardless. It is enabled by default.
+func (c *CodeGenerator) WithApplyMethods(enabled bool) *CodeGenerator {
+	c.noApplyMethods = !enabled
+	return c
+}
+
+// WithApplyExternalTypes sets mappings of third-party types to their apply
+// configuration packages forwarded to applyconfiguration-gen, mappings are in
+// <type-package>/<Kind>=<applyconfiguration-package> form.
+func (c *CodeGenerator) WithApplyExternalTypes(mappings []string) *CodeGenerator {
+	c.applyExternalTypes = mappings
+	return c
+}
+
+// WithClientOnlyKinds makes lister-gen and informer-gen only generate listers
+// and informers for the kinds. Empty means all kinds.
+func (c *CodeGenerator) WithClientOnlyKinds(kinds []string) *CodeGenerator {
+	c.clientOnlyKinds = kinds
+	return c
+}
+
+// WithNonNamespacedKinds makes client-gen, lister-gen and informer-gen generate
+// cluster-scoped clients, listers and informers for the kinds, as if they have
+// +genclient:nonNamespaced.
+func (c *CodeGenerator) WithNonNamespacedKinds(kinds []string) *CodeGenerator {
+	c.nonNamespacedKinds = kinds
+	return c
+}
+
+// WithListerKeyFields makes lister-gen generate GetByCompositeKey in listers
+// and informer-gen register its indexer on shared informers for the kinds in
+// <group>/<version>/<Kind>=<field1>,<field2> form.
+func (c *CodeGenerator) WithListerKeyFields(options []string) *CodeGenerator {
+	c.listerKeyFields = options
+	return c
+}
+
+// parseListerKeyFields parses kinds of WithListerKeyFields.
+func (c *CodeGenerator) parseListerKeyFields() ([]ListerKeyFields, error) {
+	kinds := make([]ListerKeyFields, 0, len(c.listerKeyFields))
+	for _, option := range c.listerKeyFields {
+		k, err := ParseListerKeyFields(option)
+		if err != nil {
+			return nil, err
+		}
+		kinds = append(kinds, k)
+	}
+	return kinds, nil
+}
+
+// WithClientInputBase makes client-gen resolve input packages relative to
+// the base package. Empty means input packages are fully qualified.
+func (c *CodeGenerator) WithClientInputBase(base string) *CodeGenerator {
+	c.clientInputBase = base
+	return c
+}
+
+// WithGenPriority makes install generator generate PrioritizedVersionsAllGroups.
+func (c *CodeGenerator) WithGenPriority(genPriority bool) *CodeGenerator {
+	c.genPriority = genPriority
+	return c
+}
+
+// WithGenRoundTripTests makes install generator generate round trip tests for
+// each group.
+func (c *CodeGenerator) WithGenRoundTripTests(genRoundTripTests bool) *CodeGenerator {
+	c.genRoundTripTests = genRoundTripTests
+	return c
+}
+
+// WithGenRefs makes install generator generate RefTo<Kind> and
+// ObjectRefTo<Kind> for each kind in version packages of each group.
+func (c *CodeGenerator) WithGenRefs(genRefs bool) *CodeGenerator {
+	c.genRefs = genRefs
+	return c
+}
+
+// WithInformerDefaultResync makes informer generator generate resync.go in
+// informers dir with NewDefaultSharedInformerFactory resyncing every resync.
+// 0 means no resync.go is generated.
+func (c *CodeGenerator) WithInformerDefaultResync(resync time.Duration) *CodeGenerator {
+	c.informerDefaultResync = resync
+	return c
+}
+
+// WithCRDSkipGroupProtection makes crd generator skip annotating CRDs of
+// kubernetes community owned API groups with api-approved.kubernetes.io.
+func (c *CodeGenerator) WithCRDSkipGroupProtection(skip bool) *CodeGenerator {
+	c.skipGroupProtection = skip
+	return c
+}
+
+// WithSchemeAddMetav1 makes install generator add metav1 types to each group
+// version by metav1.AddToGroupVersion in install packages.
+func (c *CodeGenerator) WithSchemeAddMetav1(addMetav1 bool) *CodeGenerator {
+	c.schemeAddMetav1 = addMetav1
+	return c
+}
+
+// WithInstallSchemeOnly makes install generator only generate the top-level
+// install package, and skip install packages of each group.
+func (c *CodeGenerator) WithInstallSchemeOnly(schemeOnly bool) *CodeGenerator {
+	c.installSchemeOnly = schemeOnly
+	return c
+}
+
+// WithInstallReturnError makes install generator additionally generate
+// InstallOrError in install packages, which returns errors instead of panicking.
+func (c *CodeGenerator) WithInstallReturnError(returnError bool) *CodeGenerator {
+	c.installReturnError = returnError
+	return c
+}
+
+// WithInstallPackageName sets the go package name and directory name of
+// install packages generated by install generator, empty means install.
+func (c *CodeGenerator) WithInstallPackageName(name string) *CodeGenerator {
+	c.installPackageName = name
+	return c
+}
+
+// WithClientContentType makes client generator generate config.go in clientset
+// dir with helpers creating clientset which negotiates contentType, it must be
+// json or protobuf. Empty means no config.go is generated.
+func (c *CodeGenerator) WithClientContentType(contentType string) *CodeGenerator {
+	c.clientContentType = contentType
+	return c
+}
+
+// WithClientUserAgent makes client generator generate useragent.go in
+// clientset dir with helpers creating clientset whose user agent defaults to
+// userAgent. Empty means no useragent.go is generated.
+func (c *CodeGenerator) WithClientUserAgent(userAgent string) *CodeGenerator {
+	c.clientUserAgent = userAgent
+	return c
+}
+
+// WithGenericListers requires lister generator to generate listers on the
+// generic lister API of client-go, it requires code-generator >=
+// genericListersMinVersion.
+func (c *CodeGenerator) WithGenericListers(generic bool) *CodeGenerator {
+	c.genericListers = generic
+	return c
+}
+
+// WithGenRateLimit makes client generator generate ratelimit.go in clientset
+// dir with helpers creating clientset whose requests are throttled by a rate
+// limiter, e.g. NewForConfigWithRateLimit.
+func (c *CodeGenerator) WithGenRateLimit(genRateLimit bool) *CodeGenerator {
+	c.genRateLimit = genRateLimit
+	return c
+}
+
+// WithNoDepCheck disables checking dependencies between generators before
+// generation, e.g. conversion requires deepcopy.
+func (c *CodeGenerator) WithNoDepCheck(noDepCheck bool) *CodeGenerator {
+	c.noDepCheck = noDepCheck
+	return c
+}
+
+// WithVerify makes Run compare generated files with files in workspace
+// instead of copying them, and fail if any of them is out of date. If
+// verboseDiff is true, the error contains unified diff of each file.
+func (c *CodeGenerator) WithVerify(verify, verboseDiff bool) *CodeGenerator {
+	c.verify = verify
+	c.verboseDiff = verboseDiff
+	return c
+}
+
+// WithStrict makes generators fail if they emit known warnings in output,
+// which usually means the generated code is subtly wrong.
+func (c *CodeGenerator) WithStrict(strict bool) *CodeGenerator {
+	c.strict = strict
+	return c
+}
+
+// WithInPlace makes gengo based generators write into workspace in place
+// through a symlinked GOPATH-style layout, instead of generating into the
+// intermediate output base and copying back.
+func (c *CodeGenerator) WithInPlace(inPlace bool) *CodeGenerator {
+	c.inPlace = inPlace
+	return c
+}
+
+// WithCleanOutputDirs makes generated go files in workspace removed from each
+// dir receiving new output before copying, so that orphans of previous runs
+// are removed. It takes no effect with WithInPlace or WithVerify.
+func (c *CodeGenerator) WithCleanOutputDirs(clean bool) *CodeGenerator {
+	c.cleanOutputDirs = clean
+	return c
+}
+
+// WithCopyParallelism sets the number of workers copying generated files into
+// workspace, 1 or less means copying serially.
+func (c *CodeGenerator) WithCopyParallelism(parallelism int) *CodeGenerator {
+	c.copyParallelism = parallelism
+	return c
+}
+
+// WithExcludeGeneratedFiles makes Run discard generated files matching any of
+// glob patterns instead of copying them to workspace. A pattern is matched
+// against the path relative to the module and the base name of the file.
+func (c *CodeGenerator) WithExcludeGeneratedFiles(patterns []string) *CodeGenerator {
+	c.excludeGenerated = patterns
+	return c
+}
+
+// WithCommit makes Run stage generated files and create a git commit with
+// message if any of them changed. An empty message means a default one. It
+// takes no effect with WithInPlace or WithVerify.
+func (c *CodeGenerator) WithCommit(commit bool, message string) *CodeGenerator {
+	c.commit = commit
+	c.commitMessage = message
+	return c
+}
+
+// WithGenDynamic makes informer generator generate dynamic.go with dynamic
+// informer helpers for each kind in informers package.
+func (c *CodeGenerator) WithGenDynamic(genDynamic bool) *CodeGenerator {
+	c.genDynamic = genDynamic
+	return c
+}
+
+// WithGenInformerErrors makes informer generator generate run.go with
+// RunWithErrorHandler wiring a WatchErrorHandler into informers of the factory
+// in informers package.
+func (c *CodeGenerator) WithGenInformerErrors(genInformerErrors bool) *CodeGenerator {
+	c.genInformerErrors = genInformerErrors
+	return c
+}
+
+// WithGenSerializer makes client generator generate serializer.go in clientset
+// package with helpers building negotiated serializer from the scheme of
+// clientset, CBOR is supported if the code-generator version supports it.
+func (c *CodeGenerator) WithGenSerializer(genSerializer bool) *CodeGenerator {
+	c.genSerializer = genSerializer
+	return c
+}
+
+// WithGenUnstructuredAdapter makes client generator generate adapter.go with
+// helpers converting each kind from and to unstructured in clientset package.
+func (c *CodeGenerator) WithGenUnstructuredAdapter(genAdapter bool) *CodeGenerator {
+	c.genAdapter = genAdapter
+	return c
+}
+
+// WithCRDYAML makes crd generator generate CRD YAML manifests, if onlyYAML is
+// true, the go constructors will not be regenerated.
+func (c *CodeGenerator) WithCRDYAML(genYAML, onlyYAML bool) *CodeGenerator {
+	c.crdYAML = genYAML
+	c.crdOnlyYAML = onlyYAML
+	return c
+}
+
+// WithCRDSingleFile makes crd generator write CRD YAML manifests of all groups
+// into file relative to workspace, instead of a file per CRD in each group. It
+// only takes effect with WithCRDYAML.
+func (c *CodeGenerator) WithCRDSingleFile(file string) *CodeGenerator {
+	c.crdSingleFile = file
+	return c
+}
+
+// WithCRDAggregateOnly makes crd generator only generate NewCustomResourceDefinitions
+// without the exported New<Kind>CRD constructors.
+func (c *CodeGenerator) WithCRDAggregateOnly(aggregateOnly bool) *CodeGenerator {
+	c.crdAggregateOnly = aggregateOnly
+	return c
+}
+
+// WithCRDForceConversionNone makes crd generator set conversion strategy of
+// all CRDs to None.
+func (c *CodeGenerator) WithCRDForceConversionNone(force bool) *CodeGenerator {
+	c.crdConversionNone = force
+	return c
+}
+
+// WithCRDVersionOverrides makes crd generator override served and storage of
+// CRD versions set by markers, keyed by group/version.
+func (c *CodeGenerator) WithCRDVersionOverrides(served, storage map[string]bool) *CodeGenerator {
+	c.crdServed = served
+	c.crdStorage = storage
+	return c
+}
+
+// WithCRDPreserveVersionOrder makes crd generator keep versions of CRDs in the
+// order of input packages.
+func (c *CodeGenerator) WithCRDPreserveVersionOrder(preserve bool) *CodeGenerator {
+	c.crdPreserveOrder = preserve
+	return c
+}
+
+// WithCRDMaxDepth makes crd generator prune schemas of CRDs deeper than maxDepth,
+// 0 means no pruning.
+func (c *CodeGenerator) WithCRDMaxDepth(maxDepth int) *CodeGenerator {
+	c.crdMaxDepth = maxDepth
+	return c
+}
+
+// WithCRDMaxDescLen makes crd generator truncate descriptions of fields in
+// schemas of CRDs to maxDescLen, 0 drops descriptions and negative means no
+// truncation.
+func (c *CodeGenerator) WithCRDMaxDescLen(maxDescLen int) *CodeGenerator {
+	c.crdMaxDescLen = maxDescLen
+	return c
+}
+
+// WithTrimPathPrefix makes the prefix trimmed from files generated by
+// deepcopy-gen, defaulter-gen and conversion-gen, e.g. GOPATH or workspace,
+// so that they are reproducible across machines.
+func (c *CodeGenerator) WithTrimPathPrefix(prefix string) *CodeGenerator {
+	c.trimPathPrefix = prefix
+	return c
+}
+
+// WithCodeGeneratedTemplate sets the go template of "Code generated" comment
+// in files generated by crd and install generators, empty means the default.
+func (c *CodeGenerator) WithCodeGeneratedTemplate(tmpl string) *CodeGenerator {
+	c.codeGeneratedTemplate = tmpl
+	return c
+}
+
+// WithSourceDateEpoch fixes the generation date to the unix timestamp, negative means now.
+func (c *CodeGenerator) WithSourceDateEpoch(epoch int64) *CodeGenerator {
+	c.sourceDateEpoch = epoch
+	return c
+}
+
+// WithHeaderVars makes generator substitute {{.<key>}} in go header file with
+// the value of key in vars, in files generated by all generators.
+func (c *CodeGenerator) WithHeaderVars(vars map[string]string) *CodeGenerator {
+	c.headerVars = vars
+	return c
+}
+
+// WithProtoTempDir sets the dir in which protobuf generator creates the temp dir
+// to link all modules, empty means the system default temp dir.
+func (c *CodeGenerator) WithProtoTempDir(dir string) *CodeGenerator {
+	c.protoTempDir = dir
+	return c
+}
+
 func (c *CodeGenerator) Run(generators []string) error {
 	// clean up generated dir
 	os.RemoveAll(c.outputBase)
 
+	if c.inPlace {
+		if err := linkWorkspace(c.outputBase, c.workspaceModule, c.workspace); err != nil {
+			return err
+		}
+		// do not leave the link pointing to workspace in output base if
+		// generation fails, postRun removes output base on success
+		defer func() {
+			if err := unlinkWorkspace(c.outputBase, c.workspaceModule); err != nil {
+				c.logger.Error(err, "failed to remove workspace link", "outputBase", c.outputBase)
+			}
+		}()
+	}
+
+	if c.commit {
+		if err := c.checkGitRepo(); err != nil {
+			return err
+		}
+	}
+
 	// detect code-generator version
 	if c.codeGeneratorVersion == "" {
 		bytes, err := c.goCmd.RunOutput("list", "-mod", "readonly", "-f", "{{if .Replace}}{{.Replace.Version}}{{else}}{{.Version}}{{end}}", "-m", "k8s.io/code-generator")
@@ -147,19 +809,94 @@ func (c *CodeGenerator) Run(generators []string) error {
 		c.codeGeneratorVersion = strings.TrimSpace(string(bytes))
 	}
 
+	// gengo generators read the header file verbatim
+	cleanHeader, err := c.renderHeaderFile()
+	if err != nil {
+		return err
+	}
+	defer cleanHeader()
+
 	// do generation
 	if err := c.doGenerate(generators); err != nil {
 		return err
 	}
 
 	// copy and clean
-	if err := c.postRun(); err != nil {
+	if err := c.postRun(generators); err != nil {
 		return err
 	}
+
+	// verify generated packages compile
+	if c.verifyBuild {
+		if err := c.doVerifyBuild(); err != nil {
+			return err
+		}
+	}
+
+	// commit changed generated files
+	if c.commit && !c.verify && !c.inPlace {
+		if err := c.commitGenerated(); err != nil {
+			return fmt.Errorf("failed to commit generated files: %v", err)
+		}
+	}
+
+	// report skipped generators
+	for _, s := range c.skipped {
+		c.logger.Info("generator skipped", "generator", s.Name, "reason", s.Reason)
+	}
 	return nil
 }
 
-func (c *CodeGenerator) postRun() error {
+func (c *CodeGenerator) doVerifyBuild() error {
+	args := c.verifyBuildArgs()
+	if len(args) == 1 {
+		return nil
+	}
+	c.logger.Info("verifying build", "args", strings.Join(args, " "))
+	if _, err := c.goCmd.RunCombinedOutput(args...); err != nil {
+		return fmt.Errorf("generated code does not compile: %v", err)
+	}
+	return nil
+}
+
+// verifyBuildArgs returns go build args for generated apis and clients packages.
+func (c *CodeGenerator) verifyBuildArgs() []string {
+	args := []string{"build"}
+	for _, p := range []string{c.apisPath, c.clientPath} {
+		if len(p) == 0 {
+			continue
+		}
+		args = append(args, "./"+path.Join(p, "..."))
+	}
+	return args
+}
+
+// Skipped returns generators which are requested but skipped in last Run.
+func (c *CodeGenerator) Skipped() []SkippedGenerator {
+	return c.skipped
+}
+
+func (c *CodeGenerator) postRun(generators []string) error {
+	if !c.inPlace {
+		if err := excludeGeneratedFiles(c.logger, path.Join(c.outputBase, c.workspaceModule), c.excludeGenerated); err != nil {
+			return err
+		}
+	}
+	if c.verify {
+		return c.postVerify()
+	}
+
+	// record what produced the generated code
+	sorted := EnabledGenerators(c.enabledGenerators, c.disabledGenerators, generators)
+	if err := c.writeManifest(sorted); err != nil {
+		return err
+	}
+
+	if c.inPlace {
+		// generated into workspace already, only remove the links
+		return os.RemoveAll(c.outputBase)
+	}
+
 	// copy generated files
 	_, err := os.Stat(c.outputBase)
 	if err != nil && !os.IsNotExist(err) {
@@ -173,8 +910,22 @@ func (c *CodeGenerator) postRun() error {
 	// generated
 	src := path.Join(c.outputBase, c.workspaceModule)
 	dst := c.workspace
-	c.logger.Info("copying", "src", src, "dst", dst)
-	if err := copy.Copy(src, dst); err != nil {
+	if c.commit {
+		// including files of in-process generators, e.g. CRDs and install
+		files, err := generatedFileList(src)
+		if err != nil {
+			return err
+		}
+		c.generatedFiles = files
+	}
+	if c.cleanOutputDirs {
+		c.logger.Info("cleaning output dirs", "src", src, "dst", dst)
+		if err := cleanOutputDirs(c.logger, src, dst); err != nil {
+			return err
+		}
+	}
+	c.logger.Info("copying", "src", src, "dst", dst, "parallelism", c.copyParallelism)
+	if err := copyTree(src, dst, c.copyParallelism); err != nil {
 		return err
 	}
 
@@ -183,6 +934,18 @@ func (c *CodeGenerator) postRun() error {
 	return nil
 }
 
+// postVerify compares generated files with workspace and cleans them up.
+func (c *CodeGenerator) postVerify() error {
+	defer os.RemoveAll(c.outputBase)
+	src := path.Join(c.outputBase, c.workspaceModule)
+	if _, err := os.Stat(src); os.IsNotExist(err) {
+		// not generated
+		return nil
+	}
+	c.logger.Info("verifying", "src", src, "dst", c.workspace)
+	return verifyGenerated(src, c.workspace, c.verboseDiff)
+}
+
 func (c *CodeGenerator) doGenerate(generators []string) error {
 	sorted := EnabledGenerators(c.enabledGenerators, c.disabledGenerators, generators)
 
@@ -191,9 +954,47 @@ func (c *CodeGenerator) doGenerate(generators []string) error {
 		"inputPackages", c.inputPackages,
 		"inputInternalPackages", c.inputInternalPackages,
 		"codeGeneratorVersion", c.codeGeneratorVersion,
+		"generatorVersions", c.generatorVersions,
 	)
 
+	c.skipped = nil
+	for _, opt := range generators {
+		name := strings.TrimLeft(opt, "+-")
+		if len(name) > 0 && !validGenerators.Contains(name) {
+			c.skipped = append(c.skipped, SkippedGenerator{Name: name, Reason: "unknown generator"})
+		}
+	}
+
+	runnable := []string{}
 	for _, g := range sorted {
+		if reason := c.skipReason(g); len(reason) > 0 {
+			c.skipped = append(c.skipped, SkippedGenerator{Name: g, Reason: reason})
+			continue
+		}
+		runnable = append(runnable, g)
+	}
+
+	if !c.noDepCheck {
+		if err := c.checkDeepcopyDependency(runnable); err != nil {
+			return err
+		}
+	}
+
+	if err := c.checkGroupCycles(runnable); err != nil {
+		return err
+	}
+
+	if c.genericListers && goset.NewSetFromStrings(runnable).Contains("lister") {
+		if err := checkGenericListersSupported(c.generatorVersion("lister")); err != nil {
+			return err
+		}
+	}
+
+	if err := c.installGenerators(runnable); err != nil {
+		return err
+	}
+
+	for _, g := range runnable {
 		if err := c.doGen(g); err != nil {
 			return err
 		}
@@ -201,22 +1002,108 @@ func (c *CodeGenerator) doGenerate(generators []string) error {
 	return nil
 }
 
-func (c *CodeGenerator) installCodeGenerator(name string) error {
-	_, err := c.goCmd.WithEnvs("GOBIN", path.Join(c.workspace, "bin")).RunCombinedOutput("install", "-v", fmt.Sprintf("k8s.io/code-generator/cmd/%s@%s", name, c.codeGeneratorVersion))
-	if err != nil {
-		return err
+// skipReason returns why the generator can not run, empty means it can run.
+func (c *CodeGenerator) skipReason(generator string) string {
+	switch generator {
+	case "client", "lister", "informer":
+		if len(c.clientPath) == 0 {
+			return "--client-path is not specified"
+		}
+	case "applyconfiguration":
+		if len(c.applyConfigurationPackage) == 0 {
+			return "--apply-configuration-package is not specified"
+		}
+	case "crd", "install":
+		if len(c.getLocalInputPackagePaths()) == 0 {
+			return fmt.Sprintf("no input packages in local module %v", c.workspaceModule)
+		}
+	}
+	return ""
+}
+
+// installGenerators installs binaries of all generators once in parallel, it
+// fails fast before any generation starts if any binary can not be installed.
+func (c *CodeGenerator) installGenerators(generators []string) error {
+	pkgs, versions := []string{}, []string{}
+	seen := goset.NewSet()
+	for _, g := range generators {
+		for _, pkg := range generatorPackages(g) {
+			if seen.Contains(pkg) {
+				continue
+			}
+			seen.Add(pkg) //nolint
+			version := c.generatorVersion(g)
+			if c.usePathGenerators {
+				if binPath, ok := c.lookPathGenerator(pkg, version); ok {
+					c.logger.Info("using generator on PATH", "path", binPath, "version", version)
+					c.pathGenerators[path.Base(pkg)] = binPath
+					continue
+				}
+			}
+			pkgs = append(pkgs, pkg)
+			versions = append(versions, version)
+		}
+	}
+
+	errs := make([]error, len(pkgs))
+	wg := sync.WaitGroup{}
+	for i, pkg := range pkgs {
+		wg.Add(1)
+		go func(i int, pkg string) {
+			defer wg.Done()
+			c.logger.Info("installing generator", "package", pkg, "version", versions[i])
+			if err := c.installCodeGenerator(pkg, versions[i]); err != nil {
+				errs[i] = fmt.Errorf("failed to install k8s.io/code-generator/cmd/%s@%s: %v", pkg, versions[i], err)
+			}
+		}(i, pkg)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
-func (c *CodeGenerator) installProtocGenGoGo() error {
-	_, err := c.goCmd.WithEnvs("GOBIN", path.Join(c.workspace, "bin")).RunCombinedOutput("install", "-v", fmt.Sprintf("k8s.io/code-generator/cmd/go-to-protobuf/protoc-gen-gogo@%s", c.codeGeneratorVersion))
+func (c *CodeGenerator) installCodeGenerator(pkg, version string) error {
+	_, err := c.goCmd.WithEnvs("GOBIN", path.Join(c.workspace, "bin")).RunCombinedOutput("install", "-v", fmt.Sprintf("k8s.io/code-generator/cmd/%s@%s", pkg, version))
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// generatorBinary returns binary name of generator, empty means generator
+// runs in process.
+func generatorBinary(generator string) string {
+	if _, ok := registeredGenerators[generator]; ok {
+		// registered generators prepare what they need by themselves
+		return ""
+	}
+	switch generator {
+	case "crd", "install":
+		return ""
+	case "protobuf":
+		return "go-to-protobuf"
+	}
+	return generator + "-gen"
+}
+
+// generatorPackages returns packages under k8s.io/code-generator/cmd to install
+// for generator.
+func generatorPackages(generator string) []string {
+	binary := generatorBinary(generator)
+	switch binary {
+	case "":
+		return nil
+	case "go-to-protobuf":
+		return []string{binary, "go-to-protobuf/protoc-gen-gogo"}
+	}
+	return []string{binary}
+}
+
 func (c *CodeGenerator) doGen(generator string) error {
 	if !validGenerators.Contains(generator) {
 		return nil
@@ -225,146 +1112,254 @@ func (c *CodeGenerator) doGen(generator string) error {
 	if err != nil {
 		return err
 	}
+	return c.runGenerator(generator, c.logger.WithValues("generator", generator), runner)
+}
+
+// runGenerator runs generator with runner of its binary, logger is passed to
+// the generator to log with its name.
+func (c *CodeGenerator) runGenerator(generator string, logger logr.Logger, runner *runner.Runner) error {
 	switch generator {
 	case "deepcopy":
-		return c.genDeepcopy(runner)
+		return c.genDeepcopy(logger, runner)
 	case "defaulter":
-		return c.genDefaulter(runner)
+		return c.genDefaulter(logger, runner)
 	case "conversion":
-		return c.genConversion(runner)
+		return c.genConversion(logger, runner)
 	case "register":
-		return c.genRegister(runner)
+		return c.genRegister(logger, runner)
 	case "openapi":
-		return c.genOpenapi(runner)
+		return c.genOpenapi(logger, runner)
 	case "crd":
-		return c.genCRD(runner)
+		return c.genCRD(logger, runner)
 	case "install":
-		return c.genInstall(runner)
+		return c.genInstall(logger, runner)
 	case "protobuf":
-		return c.genProtobuf(runner)
+		return c.genProtobuf(logger, runner)
+	case "applyconfiguration":
+		return c.genApplyConfiguration(logger, runner)
 	case "lister":
-		return c.genLister(runner)
+		return c.genLister(logger, runner)
 	case "client":
-		return c.genClient(runner)
+		return c.genClient(logger, runner)
 	case "informer":
-		return c.genInformer(runner)
+		return c.genInformer(logger, runner)
+	}
+	if fn := registeredGenerators[generator]; fn != nil {
+		return fn(c, logger, runner)
 	}
 	return nil
 }
 
+// prepareRunner returns runner of generator binary installed or found on PATH
+// by installGenerators.
 func (c *CodeGenerator) prepareRunner(generator string) (*runner.Runner, error) {
-	switch generator {
-	case "crd", "install":
+	generator = generatorBinary(generator)
+	if len(generator) == 0 {
 		return nil, nil
-	case "protobuf":
-		generator = "go-to-protobuf"
-		if err := c.installProtocGenGoGo(); err != nil {
-			return nil, err
-		}
-	default:
-		generator += "-gen"
 	}
 
-	if err := c.installCodeGenerator(generator); err != nil {
-		return nil, err
-	}
 	newPath := fmt.Sprintf("%s:%s", path.Join(c.workspace, "bin"), os.Getenv("PATH"))
-	run := runner.NewRunner(path.Join(c.workspace, "bin", generator)).WithEnvs("PATH", newPath)
+	if goBinPath, err := exec.LookPath(c.goBin); err == nil {
+		// generators may run go command, make sure they use the same go binary
+		goBinDir, _ := filepath.Abs(filepath.Dir(goBinPath))
+		newPath = fmt.Sprintf("%s:%s", goBinDir, newPath)
+	}
+	binPath, ok := c.pathGenerators[generator]
+	if !ok {
+		binPath = path.Join(c.workspace, "bin", generator)
+	}
+	run := runner.NewRunner(binPath).WithEnvs("PATH", newPath).WithDir(c.workspace)
 	return run, nil
 }
 
-func (c *CodeGenerator) genDeepcopy(run *runner.Runner) error {
+func (c *CodeGenerator) genDeepcopy(logger logr.Logger, run *runner.Runner) error {
 	generatorName := "deepcopy-gen"
+
+	// preflight, it only warns so that generation is not blocked
+	if err := c.checkDeepcopyAliases(); err != nil {
+		logger.Error(err, "failed to check alias types for deepcopy")
+	}
+
 	inputPackages := append(c.inputPackages, c.inputInternalPackages...)
 	inputDirs := strings.Join(inputPackages, ",")
 	outputPackage := path.Join(c.workspaceModule, c.apisPath)
 
+	// packages of modules replaced by dirs in workspace
+	replaced, err := c.replacedPackageDirs(inputPackages)
+	if err != nil {
+		return err
+	}
+	boundingDirs := []string{path.Join(c.workspaceModule, c.apisPath)}
+	for _, pkg := range inputPackages {
+		if _, ok := replaced[pkg]; ok {
+			boundingDirs = append(boundingDirs, pkg)
+		}
+	}
+
 	args := []string{
-		"--go-header-file", c.boilerplatePath,
+		"--go-header-file", c.goHeaderFile(),
 		"--input-dirs", inputDirs,
 		"--output-base", c.outputBase,
 		"--output-package", outputPackage,
-		"--output-file-base", "zz_generated.deepcopy",
-		"--bounding-dirs", path.Join(c.workspaceModule, c.apisPath),
+		"--output-file-base", deepcopyFileBase,
+		"--bounding-dirs", strings.Join(boundingDirs, ","),
 	}
 	args = c.appendArgs(args)
-	c.logger.Info(generatorName, "args", strings.Join(args, " "))
-	_, err := run.RunCombinedOutput(args...)
+	logger.Info(generatorName, "args", strings.Join(args, " "))
+	out, err := run.RunCombinedOutput(args...)
 	if err != nil {
-		c.logger.Error(err, "failed to run generator", "generator", generatorName)
+		logger.Error(err, "failed to run generator", "generator", generatorName)
 		return err
 	}
-	return nil
+	if err := c.trimGeneratedPaths(deepcopyFileBase, inputPackages); err != nil {
+		return err
+	}
+	if err := c.moveReplacedOutputs(deepcopyFileBase, replaced); err != nil {
+		return err
+	}
+	return c.checkWarnings(generatorName, out)
 }
 
-func (c *CodeGenerator) genDefaulter(run *runner.Runner) error {
+func (c *CodeGenerator) genDefaulter(logger logr.Logger, run *runner.Runner) error {
 	generatorName := "defaulter-gen"
 
 	inputDirs := strings.Join(c.inputPackages, ",")
 	outputPackage := path.Join(c.workspaceModule, c.apisPath)
 	args := []string{
-		"--go-header-file", c.boilerplatePath,
+		"--go-header-file", c.goHeaderFile(),
 		"--input-dirs", inputDirs,
 		"--output-base", c.outputBase,
 		"--output-package", outputPackage,
-		"--output-file-base", "zz_generated.defaults",
+		"--output-file-base", defaulterFileBase,
 	}
 	args = c.appendArgs(args)
-	c.logger.Info(generatorName, "args", strings.Join(args, " "))
-	_, err := run.RunCombinedOutput(args...)
+	logger.Info(generatorName, "args", strings.Join(args, " "))
+	out, err := run.RunCombinedOutput(args...)
 	if err != nil {
-		c.logger.Error(err, "failed to run generator", "generator", generatorName)
+		logger.Error(err, "failed to run generator", "generator", generatorName)
 		return err
 	}
-	return nil
+	if err := c.trimGeneratedPaths(defaulterFileBase, c.inputPackages); err != nil {
+		return err
+	}
+	if err := c.checkWarnings(generatorName, out); err != nil {
+		return err
+	}
+	return c.checkDefaulterFuncs(c.inputPackages)
 }
 
-func (c *CodeGenerator) genConversion(run *runner.Runner) error {
+func (c *CodeGenerator) genConversion(logger logr.Logger, run *runner.Runner) error {
 	generatorName := "conversion-gen"
 	inputPackages := append(c.inputPackages, c.inputInternalPackages...)
-	inputDirs := strings.Join(inputPackages, ",")
-	outputPackage := path.Join(c.workspaceModule, c.apisPath)
 
-	args := []string{
-		"--go-header-file", c.boilerplatePath,
-		"--input-dirs", inputDirs,
-		"--output-base", c.outputBase,
-		"--output-package", outputPackage,
-		"--output-file-base", "zz_generated.conversion",
+	var tagged map[string]map[string]bool
+	if c.conversionTaggedOnly {
+		b := parser.New()
+		err := c.inWorkspace(func() error {
+			for _, pkg := range inputPackages {
+				if err := b.AddDir(pkg); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		tagged, err = conversionTaggedTypes(b, inputPackages)
+		if err != nil {
+			return err
+		}
+	}
+
+	args := c.conversionArgs()
+	logger.Info(generatorName, "args", strings.Join(args, " "))
+	out, err := run.RunCombinedOutput(args...)
+	if c.scaffoldConversions && !c.verify {
+		output := string(out)
+		if err != nil {
+			// output is in the error if generator fails
+			output = err.Error()
+		}
+		if serr := c.scaffoldManualConversions(output); serr != nil {
+			return serr
+		}
 	}
-	args = c.appendArgs(args)
-	c.logger.Info(generatorName, "args", strings.Join(args, " "))
-	_, err := run.RunCombinedOutput(args...)
 	if err != nil {
-		c.logger.Error(err, "failed to run generator", "generator", generatorName)
+		logger.Error(err, "failed to run generator", "generator", generatorName)
 		return err
 	}
-	return nil
+	if err := c.trimGeneratedPaths(conversionFileBase, inputPackages); err != nil {
+		return err
+	}
+	if err := c.gateGeneratedFiles(conversionFileBase, c.conversionBuildTag, inputPackages); err != nil {
+		return err
+	}
+	if err := c.checkWarnings(generatorName, out); err != nil {
+		return err
+	}
+	if c.conversionTaggedOnly {
+		if err := c.pruneUntaggedConversions(inputPackages, tagged); err != nil {
+			return err
+		}
+	}
+	if err := c.moveConversionsToSubdir(inputPackages); err != nil {
+		return err
+	}
+	if err := c.genConversionSchemeFile(inputPackages); err != nil {
+		return err
+	}
+	return c.genConversionBenchmarks(inputPackages)
 }
-
-func (c *CodeGenerator) genRegister(run *runner.Runner) error {
-	generatorName := "register-gen"
-	inputDirs := strings.Join(c.inputPackages, ",")
+
+func (c *CodeGenerator) conversionArgs() []string {
+	inputPackages := append(c.inputPackages, c.inputInternalPackages...)
+	inputDirs := strings.Join(inputPackages, ",")
 	outputPackage := path.Join(c.workspaceModule, c.apisPath)
 
 	args := []string{
-		"--go-header-file", c.boilerplatePath,
+		"--go-header-file", c.goHeaderFile(),
 		"--input-dirs", inputDirs,
 		"--output-base", c.outputBase,
 		"--output-package", outputPackage,
+		"--output-file-base", "zz_generated.conversion",
 	}
-	args = c.appendArgs(args)
-	c.logger.Info(generatorName, "args", strings.Join(args, " "))
-	_, err := run.RunCombinedOutput(args...)
+	if c.conversionSkipUnsafe {
+		args = append(args, "--skip-unsafe")
+	}
+	if len(c.conversionBuildTag) > 0 {
+		args = append(args, "--build-tag", c.conversionBuildTag)
+	}
+	return c.appendArgs(args)
+}
+
+func (c *CodeGenerator) genRegister(logger logr.Logger, run *runner.Runner) error {
+	generatorName := "register-gen"
+	args := c.appendArgs(c.registerArgs())
+	logger.Info(generatorName, "args", strings.Join(args, " "))
+	out, err := run.RunCombinedOutput(args...)
 	if err != nil {
-		c.logger.Error(err, "failed to run generator", "generator", generatorName)
+		logger.Error(err, "failed to run generator", "generator", generatorName)
 		return err
 	}
-	return nil
+	return c.checkWarnings(generatorName, out)
 }
 
-func (c *CodeGenerator) genOpenapi(run *runner.Runner) error {
-	generatorName := "openapi-gen"
+// registerArgs returns args of register-gen without the common args.
+func (c *CodeGenerator) registerArgs() []string {
+	// register-gen writes into each input package regardless of it
+	outputPackage := path.Join(c.workspaceModule, c.apisPath)
+	return []string{
+		"--go-header-file", c.goHeaderFile(),
+		"--input-dirs", strings.Join(c.inputPackages, ","),
+		"--output-base", c.outputBase,
+		"--output-package", outputPackage,
+	}
+}
+
+// openapiInputDirs returns input dirs of openapi-gen, which are the seed
+// apimachinery packages, the extra inputs and the input packages.
+func (c *CodeGenerator) openapiInputDirs() string {
 	inputs := []string{
 		"k8s.io/apimachinery/pkg/apis/meta/v1",
 		"k8s.io/apimachinery/pkg/api/resource",
@@ -372,27 +1367,60 @@ func (c *CodeGenerator) genOpenapi(run *runner.Runner) error {
 		"k8s.io/apimachinery/pkg/runtime",
 		"k8s.io/apimachinery/pkg/util/intstr",
 	}
-	inputDirs := strings.Join(append(inputs, c.inputPackages...), ",")
+	seen := goset.NewSetFromStrings(inputs)
+	for _, pkg := range c.openapiExtraInputs {
+		if !seen.Contains(pkg) {
+			seen.Add(pkg) //nolint
+			inputs = append(inputs, pkg)
+		}
+	}
+	return strings.Join(append(inputs, c.inputPackages...), ",")
+}
+
+func (c *CodeGenerator) genOpenapi(logger logr.Logger, run *runner.Runner) error {
+	generatorName := "openapi-gen"
+	inputDirs := c.openapiInputDirs()
 	outputPackage := path.Join(c.workspaceModule, c.apisPath, "generated/openapi")
-	violations := path.Join(c.workspace, c.apisPath, "generated/openapi/violations.report")
+	violations := path.Join(c.generatedDir(c.apisPath), "generated/openapi/violations.report")
 	if err := os.MkdirAll(path.Dir(violations), 0755); err != nil {
 		return err
 	}
 
 	args := []string{
-		"--go-header-file", c.boilerplatePath,
+		"--go-header-file", c.goHeaderFile(),
 		"--input-dirs", inputDirs,
 		"--output-base", c.outputBase,
 		"--output-package", outputPackage,
 		"--report-filename", violations,
+		"--output-file-base", openapiFileBase,
 	}
 	args = c.appendArgs(args)
-	c.logger.Info(generatorName, "args", strings.Join(args, " "))
-	_, err := run.RunCombinedOutput(args...)
+	logger.Info(generatorName, "args", strings.Join(args, " "))
+	out, err := run.RunCombinedOutput(args...)
 	if err != nil {
-		c.logger.Error(err, "failed to run generator", "generator", generatorName)
+		logger.Error(err, "failed to run generator", "generator", generatorName)
+		return err
+	}
+	if err := c.checkWarnings(generatorName, out); err != nil {
+		return err
+	}
+	if err := c.convertOpenapiReport(violations); err != nil {
 		return err
 	}
+	return c.filterOpenapi(path.Join(c.outputBase, outputPackage, openapiFileBase+".go"))
+}
+
+// checkGenericListersSupported returns error with guidance if lister-gen of the
+// code-generator version can not generate generic listers. lister-gen has no
+// option to switch between the outputs, all versions since
+// genericListersMinVersion generate generic listers.
+func checkGenericListersSupported(codeGeneratorVersion string) error {
+	if !semver.IsValid(codeGeneratorVersion) {
+		return fmt.Errorf("unable to detect whether k8s.io/code-generator %q supports generic listers, please set a valid --code-generator-version", codeGeneratorVersion)
+	}
+	if semver.Compare(codeGeneratorVersion, genericListersMinVersion) < 0 {
+		return fmt.Errorf("k8s.io/code-generator %v does not support generic listers, please upgrade it to %v or later, or remove --generic-listers", codeGeneratorVersion, genericListersMinVersion)
+	}
 	return nil
 }
 
@@ -401,37 +1429,182 @@ func (c *CodeGenerator) genOpenapi(run *runner.Runner) error {
 func (c *CodeGenerator) getLocalInputPackagePaths() []string {
 	inputPaths := []string{}
 	for _, inputPackage := range c.inputPackages {
-		if strings.HasPrefix(inputPackage, c.workspaceModule) {
-			relative := strings.TrimPrefix(inputPackage, c.workspaceModule)
-			inputPaths = append(inputPaths, path.Join(c.workspace, relative))
+		if dir, ok := localPackageDir(c.workspace, c.workspaceModule, inputPackage); ok {
+			inputPaths = append(inputPaths, dir)
 		}
 	}
 	return inputPaths
 }
 
-func (c *CodeGenerator) genCRD(_ *runner.Runner) error {
+// inWorkspace runs fn with workspace as the current dir, so that packages
+// loaded in process by go list, e.g. by controller-tools loader and gengo
+// parser, are resolved in the module of workspace rather than the one kube-codegen
+// runs in. Generators run one by one, changing the dir of the process is safe.
+func (c *CodeGenerator) inWorkspace(fn func() error) error {
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	if err := os.Chdir(c.workspace); err != nil {
+		return err
+	}
+	defer os.Chdir(wd) //nolint
+	return fn()
+}
+
+// localPackageDir maps pkg in module to its dir in workspace, it returns false
+// if pkg does not belong to module.
+//
+// The major version suffix of module path (e.g. github.com/foo/bar/v2) is not
+// a dir on disk, the whole module path is mapped to workspace, so that
+// github.com/foo/bar/v2/pkg/apis is in <workspace>/pkg/apis.
+func localPackageDir(workspace, module, pkg string) (string, bool) {
+	module = strings.TrimSuffix(module, "/")
+	if pkg == module {
+		return workspace, true
+	}
+	if !strings.HasPrefix(pkg, module+"/") {
+		return "", false
+	}
+	return path.Join(workspace, strings.TrimPrefix(pkg, module+"/")), true
+}
+
+// crdHeaderOpts returns crd generator options of generated file headers.
+func (c *CodeGenerator) crdHeaderOpts() string {
+	opts := fmt.Sprintf(",year=%q", strconv.Itoa(crd.GenerationTime(c.sourceDateEpoch).Year()))
+	if c.codeGeneratedTemplate != "" {
+		opts += fmt.Sprintf(",codeGeneratedTemplate=%q", c.codeGeneratedTemplate)
+	}
+	if c.sourceDateEpoch >= 0 {
+		opts += fmt.Sprintf(",sourceDateEpoch=%d", c.sourceDateEpoch)
+	}
+	if len(c.headerVars) > 0 {
+		keys := make([]string, 0, len(c.headerVars))
+		for key := range c.headerVars {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		vars := make([]string, 0, len(keys))
+		for _, key := range keys {
+			vars = append(vars, fmt.Sprintf("%q:%q", key, c.headerVars[key]))
+		}
+		opts += ",headerVars={" + strings.Join(vars, ",") + "}"
+	}
+	return opts
+}
+
+func (c *CodeGenerator) genCRD(logger logr.Logger, _ *runner.Runner) error {
 	generatorName := "crd-gen"
 	cmd := app.NewRootCommand()
+	args := c.crdArgs()
+	logger.Info(generatorName, "args", strings.Join(args, " "))
+	cmd.SetArgs(args)
+	return c.inWorkspace(cmd.Execute)
+}
+
+// crdArgs returns args of crd generator generating CRDs.
+func (c *CodeGenerator) crdArgs() []string {
+	crdOpts := "crd:headerFile=" + c.boilerplatePath + ",genCRD=true,genInstall=false" + c.crdHeaderOpts()
+	if c.crdVersionAnnotation != "" {
+		crdOpts += fmt.Sprintf(",versionAnnotation=%q,version=%q", c.crdVersionAnnotation, c.crdVersion)
+	}
+	if c.crdYAML {
+		crdOpts += ",genYAML=true"
+	}
+	if c.crdOnlyYAML {
+		crdOpts += ",onlyYAML=true"
+	}
+	if c.crdSingleFile != "" {
+		// relative to the output dir of CRDs, both are relative to workspace
+		rel, _ := filepath.Rel(c.apisPath, c.crdSingleFile)
+		crdOpts += fmt.Sprintf(",singleYAMLFile=%q", filepath.ToSlash(rel))
+	}
+	if c.crdAggregateOnly {
+		crdOpts += ",aggregateOnly=true"
+	}
+	if c.crdConversionNone {
+		crdOpts += ",forceConversionNone=true"
+	}
+	if c.crdPreserveOrder {
+		crdOpts += ",preserveVersionOrder=true"
+	}
+	if len(c.crdServed) > 0 {
+		crdOpts += ",servedVersions=" + markerBoolMap(c.crdServed)
+	}
+	if len(c.crdStorage) > 0 {
+		crdOpts += ",storageVersions=" + markerBoolMap(c.crdStorage)
+	}
+	if c.crdMaxDepth > 0 {
+		crdOpts += fmt.Sprintf(",maxDepth=%d", c.crdMaxDepth)
+	}
+	if c.crdMaxDescLen >= 0 {
+		crdOpts += fmt.Sprintf(",maxDescLen=%d", c.crdMaxDescLen)
+	}
+	if c.skipGroupProtection {
+		crdOpts += ",skipGroupProtection=true"
+	}
+	if c.genAPIDocs {
+		crdOpts += ",genAPIDocs=true"
+	}
 	args := []string{
-		"crd:headerFile=" + c.boilerplatePath + ",genCRD=true,genInstall=false",
-		"output:crd:dir=" + path.Join(c.workspace, c.apisPath),
+		crdOpts,
+		"output:crd:dir=" + c.generatedDir(c.apisPath),
 		// "paths=" + path.Join(c.workspace, c.apisPath, "..."),
 	}
 	inputPaths := c.getLocalInputPackagePaths()
 	for _, inputPath := range inputPaths {
 		args = append(args, fmt.Sprintf("paths=%s", inputPath))
 	}
-	c.logger.Info(generatorName, "args", strings.Join(args, " "))
-	cmd.SetArgs(args)
-	return cmd.Execute()
+	return args
 }
 
-func (c *CodeGenerator) genInstall(_ *runner.Runner) error {
+func (c *CodeGenerator) genInstall(logger logr.Logger, _ *runner.Runner) error {
 	generatorName := "install-gen"
 	cmd := app.NewRootCommand()
+	crdOpts := "crd:headerFile=" + c.boilerplatePath + ",genCRD=false,genInstall=true" + c.crdHeaderOpts()
+	if c.installSchemeOnly {
+		crdOpts += ",schemeOnly=true"
+	}
+	if c.installReturnError {
+		crdOpts += ",installReturnError=true"
+	}
+	if c.schemeAddMetav1 {
+		crdOpts += ",schemeAddMetav1=true"
+	}
+	if c.installPackageName != "" {
+		crdOpts += ",installPackageName=" + c.installPackageName
+	}
+	if c.genEvents {
+		crdOpts += ",genEvents=true"
+	}
+	if c.genPriority {
+		crdOpts += ",genPriority=true"
+	}
+	if c.genRoundTripTests {
+		crdOpts += ",genRoundTripTests=true"
+	}
+	if c.genRefs {
+		crdOpts += ",genRefs=true"
+	}
+	conversions, err := c.conversionPackages()
+	if err != nil {
+		return err
+	}
+	if len(conversions) > 0 {
+		pkgs := make([]string, 0, len(conversions))
+		for pkg := range conversions {
+			pkgs = append(pkgs, pkg)
+		}
+		sort.Strings(pkgs)
+		pairs := make([]string, 0, len(pkgs))
+		for _, pkg := range pkgs {
+			pairs = append(pairs, fmt.Sprintf("%q:%q", pkg, conversions[pkg]))
+		}
+		crdOpts += ",conversionPackages={" + strings.Join(pairs, ",") + "}"
+	}
 	args := []string{
-		"crd:headerFile=" + c.boilerplatePath + ",genCRD=false,genInstall=true",
-		"output:crd:dir=" + path.Join(c.workspace, c.apisPath),
+		crdOpts,
+		"output:crd:dir=" + c.generatedDir(c.apisPath),
 		// "paths=" + path.Join(c.workspace, c.apisPath, "..."),
 	}
 	inputPaths := c.getLocalInputPackagePaths()
@@ -439,21 +1612,24 @@ func (c *CodeGenerator) genInstall(_ *runner.Runner) error {
 		args = append(args, fmt.Sprintf("paths=%s", inputPath))
 	}
 	args = c.appendArgs(args)
-	c.logger.Info(generatorName, "args", strings.Join(args, " "))
+	logger.Info(generatorName, "args", strings.Join(args, " "))
 	cmd.SetArgs(args)
-	return cmd.Execute()
+	return c.inWorkspace(cmd.Execute)
 }
 
 // create all modules symlinks in temp dir for protobuf generator
 func (c *CodeGenerator) linkAllModulesInTempDir() (string, error) {
-	tempDir, _ := ioutil.TempDir("", "proto-gen.*")
+	tempDir, err := ioutil.TempDir(c.protoTempDir, "proto-gen.*")
+	if err != nil {
+		return "", err
+	}
 
-	_, err := c.goCmd.RunCombinedOutput("mod", "download")
+	_, err = c.goCmd.RunCombinedOutput("mod", "download")
 	if err != nil {
 		return "", err
 	}
 
-	mods, err := c.gomodHelper.ParseListMod()
+	mods, err := c.listModules()
 	if err != nil {
 		return "", err
 	}
@@ -485,7 +1661,7 @@ func (c *CodeGenerator) linkAllModulesInTempDir() (string, error) {
 	return tempDir, nil
 }
 
-func (c *CodeGenerator) genProtobuf(run *runner.Runner) error {
+func (c *CodeGenerator) genProtobuf(logger logr.Logger, run *runner.Runner) error {
 	generatorName := "go-to-protobuf"
 
 	inputDirs := strings.Join(c.inputPackages, ",")
@@ -498,8 +1674,20 @@ func (c *CodeGenerator) genProtobuf(run *runner.Runner) error {
 
 	// copy types to output path, let generator to overwrite protobuf struct tag
 	for _, pkg := range c.inputPackages {
-		rel, _ := filepath.Rel(c.workspaceModule, pkg)
-		localPath := path.Join(c.workspace, rel)
+		localPath, ok := localPackageDir(c.workspace, c.workspaceModule, pkg)
+		if !ok {
+			return fmt.Errorf("input package %v is not in module %v", pkg, c.workspaceModule)
+		}
+		if !c.keepStaleProtobuf && !c.verify {
+			// remove files left by previous failed run to avoid mixing old and new messages
+			if err := removeStaleProtobuf(logger, localPath); err != nil {
+				return err
+			}
+		}
+		if c.inPlace {
+			// output path is the local path
+			continue
+		}
 		if err := copy.Copy(localPath, path.Join(c.outputBase, pkg)); err != nil {
 			return err
 		}
@@ -508,10 +1696,16 @@ func (c *CodeGenerator) genProtobuf(run *runner.Runner) error {
 	// detect apimachinery packages
 	b := parser.New()
 	b.AddBuildTags("proto")
-	for _, pkg := range c.inputPackages {
-		if err := b.AddDir(pkg); err != nil {
-			return err
+	err = c.inWorkspace(func() error {
+		for _, pkg := range c.inputPackages {
+			if err := b.AddDir(pkg); err != nil {
+				return err
+			}
 		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 	ctx, err := generator.NewContext(
 		b,
@@ -547,7 +1741,7 @@ func (c *CodeGenerator) genProtobuf(run *runner.Runner) error {
 	}
 
 	args := []string{
-		"--go-header-file", c.boilerplatePath,
+		"--go-header-file", c.goHeaderFile(),
 		"--proto-import", tempDir,
 		"--proto-import", path.Join(tempDir, "github.com/gogo/protobuf/protobuf"),
 		"--packages", inputDirs,
@@ -555,47 +1749,89 @@ func (c *CodeGenerator) genProtobuf(run *runner.Runner) error {
 		"--apimachinery-packages", strings.Join(apimachineries, ","),
 	}
 	args = c.appendArgs(args)
-	c.logger.Info(generatorName, "args", strings.Join(args, " "))
-	_, err = run.RunCombinedOutput(args...)
+	logger.Info(generatorName, "args", strings.Join(args, " "))
+	out, err := run.RunCombinedOutput(args...)
 	if err != nil {
-		c.logger.Error(err, "failed to run generator", "generator", generatorName)
+		logger.Error(err, "failed to run generator", "generator", generatorName)
 		return err
 	}
-	return nil
+	return c.checkWarnings(generatorName, out)
 }
 
-func (c *CodeGenerator) genClient(run *runner.Runner) error {
+func (c *CodeGenerator) genClient(logger logr.Logger, run *runner.Runner) error {
 	generatorName := "client-gen"
 
-	input := strings.Join(c.inputPackages, ",")
+	inputPackages, err := relativeInputPackages(c.clientInputBase, c.inputPackages)
+	if err != nil {
+		return err
+	}
+	input := strings.Join(inputPackages, ",")
 	outputPackage := path.Join(c.workspaceModule, c.clientPath, c.clientsetDirName)
 	outputPackage, dirName := path.Split(outputPackage)
 
 	localClientsetPath := path.Join(c.workspace, c.clientPath, c.clientsetDirName)
 	outputClientsetPath := path.Join(c.outputBase, outputPackage, c.clientsetDirName)
-	err := copyExpansions(c.logger, localClientsetPath, outputClientsetPath)
-	if err != nil {
-		return err
+	if !c.inPlace {
+		if err := copyExpansions(logger, localClientsetPath, outputClientsetPath); err != nil {
+			return err
+		}
 	}
 	args := []string{
-		"--go-header-file", c.boilerplatePath,
-		"--input-base", "",
+		"--go-header-file", c.goHeaderFile(),
+		"--input-base", c.clientInputBase,
 		"--input", input,
 		"--clientset-name", dirName,
 		"--output-base", c.outputBase,
 		"--output-package", outputPackage,
 	}
+	if c.applyConfigurationPackage != "" && !c.noApplyMethods {
+		args = append(args, "--apply-configuration-package", c.applyConfigurationPackage)
+	}
 	args = c.appendArgs(args)
-	c.logger.Info(generatorName, "args", strings.Join(args, " "))
-	_, err = run.RunCombinedOutput(args...)
+	if len(c.nonNamespacedKinds) > 0 {
+		retagged, cleanup, err := c.retagInputs(run, nonNamespacedTags(c.nonNamespacedKinds))
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		run = retagged
+	}
+	logger.Info(generatorName, "args", strings.Join(args, " "))
+	out, err := run.RunCombinedOutput(args...)
 	if err != nil {
-		c.logger.Error(err, "failed to run generator", "generator", generatorName)
+		logger.Error(err, "failed to run generator", "generator", generatorName)
 		return err
 	}
-	return nil
+	if err := c.checkWarnings(generatorName, out); err != nil {
+		return err
+	}
+	if err := c.checkExternalImports(outputClientsetPath); err != nil {
+		return err
+	}
+	if err := c.genClientConfig(outputClientsetPath); err != nil {
+		return err
+	}
+	if err := c.genClientUserAgent(outputClientsetPath); err != nil {
+		return err
+	}
+	if err := c.genClientRateLimit(outputClientsetPath); err != nil {
+		return err
+	}
+	schemePackage := path.Join(c.workspaceModule, c.clientPath, c.clientsetDirName, "scheme")
+	if c.genAdapter {
+		if err := c.genUnstructuredAdapter(outputClientsetPath, schemePackage); err != nil {
+			return err
+		}
+	}
+	if c.genSerializer {
+		if err := c.genClientSerializer(outputClientsetPath, schemePackage); err != nil {
+			return err
+		}
+	}
+	return c.genDoc(outputClientsetPath, "has the automatically generated clientset.")
 }
 
-func (c *CodeGenerator) genLister(run *runner.Runner) error {
+func (c *CodeGenerator) genLister(logger logr.Logger, run *runner.Runner) error {
 	generatorName := "lister-gen"
 
 	inputDirs := strings.Join(c.inputPackages, ",")
@@ -603,35 +1839,62 @@ func (c *CodeGenerator) genLister(run *runner.Runner) error {
 
 	localListersPath := path.Join(c.workspace, c.clientPath, c.listerDirName)
 	outputListersPath := path.Join(c.outputBase, outputPackage)
-	err := copyExpansions(c.logger, localListersPath, outputListersPath)
-	if err != nil {
-		return err
+	if !c.inPlace {
+		if err := copyExpansions(logger, localListersPath, outputListersPath); err != nil {
+			return err
+		}
+	}
+	if len(c.listerKeyFields) > 0 {
+		kinds, err := c.compositeKeyKinds()
+		if err != nil {
+			return err
+		}
+		if err := c.genCompositeKeyExpansions(outputListersPath, kinds); err != nil {
+			return err
+		}
 	}
 	args := []string{
-		"--go-header-file", c.boilerplatePath,
+		"--go-header-file", c.goHeaderFile(),
 		"--input-dirs", inputDirs,
 		"--output-base", c.outputBase,
 		"--output-package", outputPackage,
 	}
 	args = c.appendArgs(args)
-	c.logger.Info(generatorName, "args", strings.Join(args, " "))
-	_, err = run.RunCombinedOutput(args...)
+	if edit := c.listerTags(); edit != nil {
+		retagged, cleanup, err := c.retagInputs(run, edit)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		run = retagged
+	}
+	logger.Info(generatorName, "args", strings.Join(args, " "))
+	out, err := run.RunCombinedOutput(args...)
 	if err != nil {
-		c.logger.Error(err, "failed to run generator", "generator", generatorName)
+		logger.Error(err, "failed to run generator", "generator", generatorName)
 		return err
 	}
-	return nil
+	if err := c.checkWarnings(generatorName, out); err != nil {
+		return err
+	}
+	if err := c.checkExternalImports(outputListersPath); err != nil {
+		return err
+	}
+	return c.genDoc(outputListersPath, "contains the automatically generated listers.")
 }
 
-func (c *CodeGenerator) genInformer(run *runner.Runner) error {
+func (c *CodeGenerator) genInformer(logger logr.Logger, run *runner.Runner) error {
 	generatorName := "informer-gen"
 	inputDirs := strings.Join(c.inputPackages, ",")
 	outputPackage := path.Join(c.workspaceModule, c.clientPath, c.informerDirName)
 
 	versionedClientsetPackage := path.Join(c.workspaceModule, c.clientPath, c.clientsetDirName)
 	listersPacakge := path.Join(c.workspaceModule, c.clientPath, c.listerDirName)
+	if err := c.preflightInformer(); err != nil {
+		return err
+	}
 	args := []string{
-		"--go-header-file", c.boilerplatePath,
+		"--go-header-file", c.goHeaderFile(),
 		"--input-dirs", inputDirs,
 		"--output-base", c.outputBase,
 		"--output-package", outputPackage,
@@ -640,13 +1903,218 @@ func (c *CodeGenerator) genInformer(run *runner.Runner) error {
 		"--listers-package", listersPacakge,
 	}
 	args = c.appendArgs(args)
-	c.logger.Info(generatorName, "args", strings.Join(args, " "))
-	_, err := run.RunCombinedOutput(args...)
+	if edit := c.listerTags(); edit != nil {
+		retagged, cleanup, err := c.retagInputs(run, edit)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		run = retagged
+	}
+	logger.Info(generatorName, "args", strings.Join(args, " "))
+	out, err := run.RunCombinedOutput(args...)
 	if err != nil {
-		c.logger.Error(err, "failed to run generator", "generator", generatorName)
+		logger.Error(err, "failed to run generator", "generator", generatorName)
 		return err
 	}
-	return nil
+	if err := c.checkWarnings(generatorName, out); err != nil {
+		return err
+	}
+	outputInformersPath := path.Join(c.outputBase, outputPackage)
+	if err := c.checkExternalImports(outputInformersPath); err != nil {
+		return err
+	}
+	if len(c.listerKeyFields) > 0 {
+		kinds, err := c.compositeKeyKinds()
+		if err != nil {
+			return err
+		}
+		if err := c.registerCompositeKeyIndexers(outputInformersPath, kinds); err != nil {
+			return err
+		}
+	}
+	if err := c.genInformerResync(outputInformersPath); err != nil {
+		return err
+	}
+	if err := c.genInformerErrorHandler(outputInformersPath); err != nil {
+		return err
+	}
+	if c.genDynamic {
+		if err := c.genDynamicInformer(outputInformersPath); err != nil {
+			return err
+		}
+	}
+	return c.genDoc(outputInformersPath, "contains the automatically generated shared informers.")
+}
+
+// genDynamicInformer generates dynamic.go in informers output dir by crd
+// generator, it requires GenericInformer generated by informer-gen.
+func (c *CodeGenerator) genDynamicInformer(outputInformersPath string) error {
+	generatorName := "dynamic-informer-gen"
+	inputPaths := c.getLocalInputPackagePaths()
+	if len(inputPaths) == 0 {
+		c.logger.Info("no local input packages, skip generating dynamic informers", "generator", generatorName)
+		return nil
+	}
+	pkgName := goPackageName(outputInformersPath)
+	cmd := app.NewRootCommand()
+	crdOpts := "crd:headerFile=" + c.boilerplatePath + ",genCRD=false,genInstall=false,genDynamic=true,dynamicPackage=" + pkgName + c.crdHeaderOpts()
+	args := []string{
+		crdOpts,
+		"output:crd:dir=" + outputInformersPath,
+	}
+	for _, inputPath := range inputPaths {
+		args = append(args, fmt.Sprintf("paths=%s", inputPath))
+	}
+	c.logger.Info(generatorName, "args", strings.Join(args, " "))
+	cmd.SetArgs(args)
+	return c.inWorkspace(cmd.Execute)
+}
+
+// genUnstructuredAdapter generates adapter.go in clientset output dir by crd
+// generator, it requires the scheme package generated by client-gen.
+func (c *CodeGenerator) genUnstructuredAdapter(outputClientsetPath, schemePackage string) error {
+	generatorName := "unstructured-adapter-gen"
+	inputPaths := c.getLocalInputPackagePaths()
+	if len(inputPaths) == 0 {
+		c.logger.Info("no local input packages, skip generating unstructured adapter", "generator", generatorName)
+		return nil
+	}
+	pkgName := goPackageName(outputClientsetPath)
+	cmd := app.NewRootCommand()
+	crdOpts := "crd:headerFile=" + c.boilerplatePath + ",genCRD=false,genInstall=false,genUnstructuredAdapter=true,adapterPackage=" + pkgName + ",schemePackage=" + schemePackage + c.crdHeaderOpts()
+	args := []string{
+		crdOpts,
+		"output:crd:dir=" + outputClientsetPath,
+	}
+	for _, inputPath := range inputPaths {
+		args = append(args, fmt.Sprintf("paths=%s", inputPath))
+	}
+	c.logger.Info(generatorName, "args", strings.Join(args, " "))
+	cmd.SetArgs(args)
+	return c.inWorkspace(cmd.Execute)
+}
+
+// boilerplate returns the go header with YEAR replaced by the generation year,
+// and {{.<key>}} replaced by header vars.
+func (c *CodeGenerator) boilerplate() (string, error) {
+	header, err := ioutil.ReadFile(c.boilerplatePath)
+	if err != nil {
+		return "", err
+	}
+	pairs := []string{" YEAR", " " + strconv.Itoa(crd.GenerationTime(c.sourceDateEpoch).Year())}
+	for key, value := range c.headerVars {
+		pairs = append(pairs, "{{."+key+"}}", value)
+	}
+	return strings.NewReplacer(pairs...).Replace(string(header)), nil
+}
+
+// renderHeaderFile writes the boilerplate rendered by boilerplate into a
+// temporary file passed to gengo generators by goHeaderFile, and returns a
+// func removing it.
+func (c *CodeGenerator) renderHeaderFile() (func(), error) {
+	header, err := c.boilerplate()
+	if err != nil {
+		return nil, err
+	}
+	f, err := ioutil.TempFile("", "boilerplate-*.go.txt")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err := f.WriteString(header); err != nil {
+		os.Remove(f.Name())
+		return nil, err
+	}
+	c.headerFile = f.Name()
+	return func() {
+		os.Remove(c.headerFile)
+		c.headerFile = ""
+	}, nil
+}
+
+// goHeaderFile returns the --go-header-file of gengo generators, which is the
+// rendered boilerplate during Run.
+func (c *CodeGenerator) goHeaderFile() string {
+	if len(c.headerFile) > 0 {
+		return c.headerFile
+	}
+	return c.boilerplatePath
+}
+
+// ParseHeaderVars parses options in key=value form into header vars, keys
+// must be go identifiers, e.g. Company=Example.
+func ParseHeaderVars(options []string) (map[string]string, error) {
+	vars := map[string]string{}
+	for _, option := range options {
+		parts := strings.SplitN(option, "=", 2)
+		if len(parts) != 2 || !token.IsIdentifier(parts[0]) {
+			return nil, fmt.Errorf("invalid header var %q, it must be in key=value form and key must be a go identifier", option)
+		}
+		vars[parts[0]] = parts[1]
+	}
+	return vars, nil
+}
+
+// ParseCRDVersionOverrides parses options in group/version=bool form into
+// overrides of served or storage of CRD versions, e.g. apps.example.com/v1=false.
+func ParseCRDVersionOverrides(options []string) (map[string]bool, error) {
+	overrides := map[string]bool{}
+	for _, option := range options {
+		parts := strings.SplitN(option, "=", 2)
+		if len(parts) != 2 || strings.Count(parts[0], "/") != 1 || strings.HasPrefix(parts[0], "/") || strings.HasSuffix(parts[0], "/") {
+			return nil, fmt.Errorf("invalid crd version override %q, it must be in group/version=bool form", option)
+		}
+		value, err := strconv.ParseBool(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid crd version override %q, err: %v", option, err)
+		}
+		overrides[parts[0]] = value
+	}
+	return overrides, nil
+}
+
+// markerBoolMap returns m in marker map syntax with sorted keys, e.g.
+// {"apps.example.com/v1":true}.
+func markerBoolMap(m map[string]bool) string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, fmt.Sprintf("%q:%t", key, m[key]))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// ParseGeneratorVersions parses options in name=version form into pinned
+// k8s.io/code-generator versions of generators, e.g. deepcopy=v0.20.2. The
+// generator must be installed from k8s.io/code-generator and the version
+// must be a valid semantic version.
+func ParseGeneratorVersions(options []string) (map[string]string, error) {
+	versions := map[string]string{}
+	for _, option := range options {
+		parts := strings.SplitN(option, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid generator version %q, it must be in name=version form", option)
+		}
+		name, version := parts[0], parts[1]
+		if !validGenerators.Contains(name) || len(generatorPackages(name)) == 0 {
+			return nil, fmt.Errorf("invalid generator version %q, %v is not a generator installed from k8s.io/code-generator", option, name)
+		}
+		if !semver.IsValid(version) {
+			return nil, fmt.Errorf("invalid generator version %q, %v is not a valid semantic version, e.g. v0.20.2", option, version)
+		}
+		versions[name] = version
+	}
+	return versions, nil
+}
+
+// goPackageName returns the go package name of dir generated by generators.
+func goPackageName(dir string) string {
+	return strings.NewReplacer("-", "", ".", "").Replace(path.Base(dir))
 }
 
 func (c *CodeGenerator) appendArgs(args []string) []string {
@@ -743,6 +2211,39 @@ func findFiles(fsys fs.FS, root string, filter func(d fs.DirEntry) (bool, error)
 	return target, err
 }
 
+// relativeInputPackages makes input packages relative to base, it returns
+// input packages as is if base is empty.
+func relativeInputPackages(base string, inputPackages []string) ([]string, error) {
+	if len(base) == 0 {
+		return inputPackages, nil
+	}
+	base = strings.TrimSuffix(base, "/")
+	ret := make([]string, 0, len(inputPackages))
+	for _, pkg := range inputPackages {
+		if !strings.HasPrefix(pkg, base+"/") {
+			return nil, fmt.Errorf("input package %v is not in input base %v", pkg, base)
+		}
+		ret = append(ret, strings.TrimPrefix(pkg, base+"/"))
+	}
+	return ret, nil
+}
+
+// removeStaleProtobuf removes generated protobuf files in dir.
+func removeStaleProtobuf(logger logr.Logger, dir string) error {
+	for _, name := range []string{"generated.pb.go", "generated.proto"} {
+		file := path.Join(dir, name)
+		err := os.Remove(file)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		logger.Info("removed stale protobuf file", "file", file)
+	}
+	return nil
+}
+
 func protoSafeOutermostPackage(name string) string {
 	pkg := strings.Replace(name, "/", ".", -1)
 	pkg = strings.Replace(pkg, "-", "_", -1)
@@ -0,0 +1,505 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/zoumo/goset"
+	"github.com/zoumo/make-rules/pkg/runner"
+
+	"github.com/zoumo/kube-codegen/pkg/logging"
+)
+
+func newTestCodeGenerator() *CodeGenerator {
+	return NewCodeGenerator(
+		"/workspace",
+		"github.com/example/project",
+		logr.Discard(),
+		"v0.20.2",
+		nil,
+		nil,
+		"hack/boilerplate.go.txt",
+		"pkg/apis",
+		"pkg/clients",
+		[]string{"github.com/example/project/pkg/apis/apps/v1"},
+		[]string{"github.com/example/project/pkg/apis/apps"},
+		"kubernetes",
+		"informers",
+		"listers",
+		0,
+	)
+}
+
+// newTestWorkspaceGenerator returns a test generator of a temporary workspace
+// containing files, whose go.mod resolves dependencies as this module does.
+func newTestWorkspaceGenerator(t *testing.T, files map[string]string) *CodeGenerator {
+	c := newTestCodeGenerator()
+	c.workspace = t.TempDir()
+	c.outputBase = filepath.Join(c.workspace, "__output", "generated")
+	gomod, err := ioutil.ReadFile("../../go.mod")
+	assert.NoError(t, err)
+	gosum, err := ioutil.ReadFile("../../go.sum")
+	assert.NoError(t, err)
+	writeTestFiles(t, c.workspace, map[string]string{
+		"go.mod":                  strings.Replace(string(gomod), "module github.com/zoumo/kube-codegen", "module github.com/example/project", 1),
+		"go.sum":                  string(gosum),
+		"hack/boilerplate.go.txt": "// Copyright 2022 The Authors.\n",
+	})
+	writeTestFiles(t, c.workspace, files)
+	return c
+}
+
+// e2e is set by e2e_test.go when tests are built with tag e2e.
+var e2e bool
+
+// skipUnlessE2E skips end-to-end tests unless tag e2e is set, they build
+// generators and programs in temporary modules with -mod=mod, which resolves
+// modules over the network.
+func skipUnlessE2E(t *testing.T) {
+	if !e2e {
+		t.Skip("end-to-end test, run with -tags e2e")
+	}
+}
+
+// exitStderr returns stderr of the command failed with err, which is captured
+// by exec.Cmd.Output.
+func exitStderr(err error) string {
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return string(exitErr.Stderr)
+	}
+	return ""
+}
+
+// testGeneratorRunner builds the binary of generator from k8s.io/code-generator
+// pinned by this module into the workspace of c, and returns its runner.
+func testGeneratorRunner(t *testing.T, c *CodeGenerator, generator string) *runner.Runner {
+	skipUnlessE2E(t)
+	binary := generatorBinary(generator)
+	cmd := exec.Command("go", "build", "-o", filepath.Join("bin", binary), "k8s.io/code-generator/cmd/"+binary)
+	cmd.Dir = c.workspace
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod")
+	out, err := cmd.CombinedOutput()
+	if !assert.NoError(t, err, string(out)) {
+		t.FailNow()
+	}
+	run, err := c.prepareRunner(generator)
+	assert.NoError(t, err)
+	return run
+}
+
+// goBuild builds pkgs in the workspace of c.
+func goBuild(t *testing.T, c *CodeGenerator, args ...string) {
+	skipUnlessE2E(t)
+	cmd := exec.Command("go", append([]string{"build"}, args...)...)
+	cmd.Dir = c.workspace
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod")
+	out, err := cmd.CombinedOutput()
+	assert.NoError(t, err, string(out))
+}
+
+// goTest runs go test with args in the workspace of c and returns its output.
+func goTest(t *testing.T, c *CodeGenerator, args ...string) string {
+	skipUnlessE2E(t)
+	cmd := exec.Command("go", append([]string{"test"}, args...)...)
+	cmd.Dir = c.workspace
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod")
+	out, err := cmd.CombinedOutput()
+	assert.NoError(t, err, string(out))
+	return string(out)
+}
+
+func Test_conversionArgs(t *testing.T) {
+	c := newTestCodeGenerator()
+	assert.NotContains(t, c.conversionArgs(), "--skip-unsafe")
+
+	c.WithConversionSkipUnsafe(true)
+	assert.Contains(t, c.conversionArgs(), "--skip-unsafe")
+
+	assert.NotContains(t, c.conversionArgs(), "--build-tag")
+	c.WithConversionBuildTag("conversion")
+	args := c.conversionArgs()
+	assert.Contains(t, args, "--build-tag")
+	assert.Contains(t, args, "conversion")
+}
+
+func Test_crdArgs_maxDescLen(t *testing.T) {
+	c := newTestCodeGenerator()
+	assert.NotContains(t, c.crdArgs()[0], "maxDescLen")
+
+	c.WithCRDMaxDescLen(0)
+	assert.Contains(t, c.crdArgs()[0], ",maxDescLen=0")
+
+	c.WithCRDMaxDescLen(80)
+	assert.Contains(t, c.crdArgs()[0], ",maxDescLen=80")
+}
+
+func Test_crdArgs_singleFile(t *testing.T) {
+	c := newTestCodeGenerator()
+	assert.NotContains(t, c.crdArgs()[0], "singleYAMLFile")
+
+	c.WithCRDYAML(true, false).WithCRDSingleFile("charts/example/crds/crds.yaml")
+	assert.Contains(t, c.crdArgs()[0], `,singleYAMLFile="../../charts/example/crds/crds.yaml"`)
+}
+
+func Test_registerArgs(t *testing.T) {
+	c := newTestCodeGenerator()
+	args := c.registerArgs()
+	assert.Equal(t, []string{"--output-package", "github.com/example/project/pkg/apis"}, args[len(args)-2:])
+}
+
+func Test_openapiInputDirs(t *testing.T) {
+	c := newTestCodeGenerator()
+	c.inputPackages = []string{"github.com/example/project/pkg/apis/apps/v1"}
+	inputs := strings.Split(c.openapiInputDirs(), ",")
+	assert.Equal(t, "k8s.io/apimachinery/pkg/apis/meta/v1", inputs[0])
+	assert.Equal(t, "github.com/example/project/pkg/apis/apps/v1", inputs[len(inputs)-1])
+	assert.NotContains(t, inputs, "k8s.io/api/core/v1")
+
+	c.WithOpenapiExtraInputs([]string{"k8s.io/api/core/v1", "k8s.io/apimachinery/pkg/runtime"})
+	extra := strings.Split(c.openapiInputDirs(), ",")
+	assert.Len(t, extra, len(inputs)+1)
+	assert.Equal(t, "k8s.io/api/core/v1", extra[len(extra)-2])
+}
+
+func Test_removeStaleProtobuf(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"generated.pb.go", "generated.proto", "types.go"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("stale"), 0644))
+	}
+
+	assert.NoError(t, removeStaleProtobuf(logr.Discard(), dir))
+	assert.NoFileExists(t, filepath.Join(dir, "generated.pb.go"))
+	assert.NoFileExists(t, filepath.Join(dir, "generated.proto"))
+	assert.FileExists(t, filepath.Join(dir, "types.go"))
+
+	// no error if there is nothing to remove
+	assert.NoError(t, removeStaleProtobuf(logr.Discard(), dir))
+}
+
+func Test_writeManifest(t *testing.T) {
+	dir := t.TempDir()
+	c := newTestCodeGenerator()
+	c.workspace = dir
+	c.boilerplatePath = filepath.Join(dir, "boilerplate.go.txt")
+	assert.NoError(t, os.WriteFile(c.boilerplatePath, []byte("// header\n"), 0644))
+
+	c.WithGeneratorVersions(map[string]string{"deepcopy": "v0.19.0"})
+	assert.NoError(t, c.writeManifest([]string{"deepcopy", "conversion"}))
+
+	data, err := os.ReadFile(filepath.Join(dir, manifestFileName))
+	assert.NoError(t, err)
+	m := Manifest{}
+	assert.NoError(t, json.Unmarshal(data, &m))
+	assert.Equal(t, "v0.20.2", m.CodeGeneratorVersion)
+	assert.Equal(t, map[string]string{"deepcopy": "v0.19.0"}, m.GeneratorVersions)
+	assert.Equal(t, []string{"deepcopy", "conversion"}, m.Generators)
+	assert.Equal(t, []string{"github.com/example/project/pkg/apis/apps/v1"}, m.InputPackages)
+	assert.Equal(t, []string{"github.com/example/project/pkg/apis/apps"}, m.InputInternalPackages)
+	assert.Len(t, m.BoilerplateSHA256, 64)
+	// omitted without source date epoch
+	assert.Empty(t, m.GeneratedAt)
+	assert.NotContains(t, string(data), "generatedAt")
+
+	// reproducible with source date epoch
+	c.WithSourceDateEpoch(1640995200)
+	m1, err := c.newManifest(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "2022-01-01T00:00:00Z", m1.GeneratedAt)
+	c.WithSourceDateEpoch(0)
+	m1, err = c.newManifest(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "1970-01-01T00:00:00Z", m1.GeneratedAt)
+}
+
+func Test_RegisterGenerator(t *testing.T) {
+	origSorted := sortedValidGenerators
+	defer func() {
+		sortedValidGenerators = origSorted
+		validGenerators = goset.NewSetFromStrings(origSorted)
+		registeredGenerators = map[string]GeneratorFunc{}
+	}()
+
+	called := false
+	logs := &bytes.Buffer{}
+	assert.NoError(t, RegisterGenerator("fake", func(c *CodeGenerator, logger logr.Logger, run *runner.Runner) error {
+		called = true
+		logger.Info("generating")
+		// logs are streamed with the generator name
+		assert.Contains(t, logs.String(), `"msg":"generating","generator":"fake"`)
+		return nil
+	}, "register"))
+	assert.NoError(t, RegisterGenerator("reserved", nil, ""))
+
+	assert.Error(t, RegisterGenerator("fake", nil, ""))
+	assert.Error(t, RegisterGenerator("deepcopy", nil, ""))
+	assert.Error(t, RegisterGenerator("other", nil, "not-exist"))
+
+	assert.Equal(t,
+		[]string{"deepcopy", "conversion", "register", "fake", "install", "reserved"},
+		EnabledGenerators([]string{"deepcopy", "conversion", "register", "install"}, nil, []string{"+fake", "+reserved"}),
+	)
+
+	c := newTestCodeGenerator()
+	c.logger = logging.NewJSON(logs, 0)
+	assert.NoError(t, c.doGen("fake"))
+	assert.True(t, called)
+	assert.Contains(t, logs.String(), `"msg":"generating","generator":"fake"`)
+	assert.NoError(t, c.doGen("reserved"))
+}
+
+func Test_installGenerators_versions(t *testing.T) {
+	dir := t.TempDir()
+	// fake go binary recording install commands
+	goBin := filepath.Join(dir, "go")
+	assert.NoError(t, os.WriteFile(goBin, []byte("#!/bin/sh\necho \"$@\" >> "+filepath.Join(dir, "installs")+"\n"), 0755))
+	c := newTestCodeGenerator()
+	c.workspace = dir
+	c.WithGoBin(goBin).WithGeneratorVersions(map[string]string{"deepcopy": "v0.19.0", "protobuf": "v0.21.0"})
+
+	assert.NoError(t, c.installGenerators([]string{"deepcopy", "client", "protobuf", "crd"}))
+	data, err := os.ReadFile(filepath.Join(dir, "installs"))
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		"install -v k8s.io/code-generator/cmd/deepcopy-gen@v0.19.0",
+		"install -v k8s.io/code-generator/cmd/client-gen@v0.20.2",
+		"install -v k8s.io/code-generator/cmd/go-to-protobuf@v0.21.0",
+		"install -v k8s.io/code-generator/cmd/go-to-protobuf/protoc-gen-gogo@v0.21.0",
+	}, strings.Split(strings.TrimSpace(string(data)), "\n"))
+}
+
+func Test_ParseGeneratorVersions(t *testing.T) {
+	got, err := ParseGeneratorVersions([]string{"deepcopy=v0.19.0", "client=v0.21.0-alpha.1"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"deepcopy": "v0.19.0", "client": "v0.21.0-alpha.1"}, got)
+
+	for _, option := range []string{"deepcopy", "crd=v0.20.2", "unknown=v0.20.2", "deepcopy=0.20.2", "deepcopy=latest"} {
+		_, err := ParseGeneratorVersions([]string{option})
+		assert.Error(t, err, option)
+	}
+}
+
+func Test_parseWorkspaceModules(t *testing.T) {
+	out := []byte(`{"Path": "github.com/example/project", "Main": true, "Dir": "/workspace/project"}
+{"Path": "github.com/example/api", "Main": true, "Dir": "/workspace/api"}
+{"Path": "k8s.io/apimachinery", "Version": "v0.20.2", "Dir": "/go/pkg/mod/k8s.io/apimachinery@v0.20.2"}
+`)
+	mods, err := parseWorkspaceModules(out, "/workspace/project/")
+	assert.NoError(t, err)
+	paths := []string{}
+	for _, m := range mods {
+		paths = append(paths, m.Path)
+	}
+	assert.Equal(t, []string{"github.com/example/api", "k8s.io/apimachinery"}, paths)
+
+	_, err = parseWorkspaceModules([]byte("{"), "/workspace/project")
+	assert.Error(t, err)
+}
+
+func Test_doGenerate_skipped(t *testing.T) {
+	c := newTestCodeGenerator()
+	c.clientPath = ""
+	c.workspaceModule = "github.com/example/other"
+
+	assert.NoError(t, c.doGenerate([]string{"client", "lister", "crd", "unknown"}))
+	assert.Equal(t, []SkippedGenerator{
+		{Name: "unknown", Reason: "unknown generator"},
+		{Name: "crd", Reason: "no input packages in local module github.com/example/other"},
+		{Name: "client", Reason: "--client-path is not specified"},
+		{Name: "lister", Reason: "--client-path is not specified"},
+	}, c.Skipped())
+}
+
+func Test_relativeInputPackages(t *testing.T) {
+	pkgs := []string{
+		"github.com/example/project/pkg/apis/apps/v1",
+		"github.com/example/project/pkg/apis/batch/v1",
+	}
+
+	got, err := relativeInputPackages("", pkgs)
+	assert.NoError(t, err)
+	assert.Equal(t, pkgs, got)
+
+	got, err = relativeInputPackages("github.com/example/project/pkg/apis/", pkgs)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"apps/v1", "batch/v1"}, got)
+
+	_, err = relativeInputPackages("github.com/example/project/pkg/api", pkgs)
+	assert.Error(t, err)
+}
+
+func Test_verifyBuildArgs(t *testing.T) {
+	c := newTestCodeGenerator()
+	assert.Equal(t, []string{"build", "./pkg/apis/...", "./pkg/clients/..."}, c.verifyBuildArgs())
+
+	c.apisPath = ""
+	assert.Equal(t, []string{"build", "./pkg/clients/..."}, c.verifyBuildArgs())
+}
+
+func Test_crdHeaderOpts(t *testing.T) {
+	c := newTestCodeGenerator()
+	assert.Regexp(t, `^,year="\d{4}"$`, c.crdHeaderOpts())
+
+	// 0 is a valid source date epoch
+	c.WithSourceDateEpoch(0)
+	assert.Equal(t, `,year="1970",sourceDateEpoch=0`, c.crdHeaderOpts())
+
+	c.WithCodeGeneratedTemplate("// Code generated by {{.Generator}}. DO NOT EDIT.").WithSourceDateEpoch(1640995200)
+	assert.Equal(t, `,year="2022",codeGeneratedTemplate="// Code generated by {{.Generator}}. DO NOT EDIT.",sourceDateEpoch=1640995200`, c.crdHeaderOpts())
+
+	c.WithHeaderVars(map[string]string{"Project": "kube-codegen", "Company": "Example, Inc."})
+	assert.Contains(t, c.crdHeaderOpts(), `,headerVars={"Company":"Example, Inc.","Project":"kube-codegen"}`)
+}
+
+func Test_boilerplate(t *testing.T) {
+	c := newTestCodeGenerator()
+	c.boilerplatePath = filepath.Join(t.TempDir(), "boilerplate.go.txt")
+	assert.NoError(t, os.WriteFile(c.boilerplatePath, []byte("// Copyright YEAR {{.Company}}\n// Project {{.Project}}\n"), 0644))
+	c.WithSourceDateEpoch(1640995200)
+
+	got, err := c.boilerplate()
+	assert.NoError(t, err)
+	assert.Equal(t, "// Copyright 2022 {{.Company}}\n// Project {{.Project}}\n", got)
+
+	vars, err := ParseHeaderVars([]string{"Company=Example, Inc.", "Project=a=b"})
+	assert.NoError(t, err)
+	c.WithHeaderVars(vars)
+	got, err = c.boilerplate()
+	assert.NoError(t, err)
+	assert.Equal(t, "// Copyright 2022 Example, Inc.\n// Project a=b\n", got)
+
+	_, err = ParseHeaderVars([]string{"Company"})
+	assert.Error(t, err)
+	_, err = ParseHeaderVars([]string{"my-company=Example"})
+	assert.Error(t, err)
+}
+
+func Test_renderHeaderFile(t *testing.T) {
+	c := newTestWorkspaceGenerator(t, map[string]string{
+		"hack/boilerplate.go.txt":   "// Copyright YEAR {{.Company}}.\n",
+		"pkg/apis/apps/types.go":    "package apps\n\ntype Foo struct {\n\tName string\n}\n",
+		"pkg/apis/apps/v1/doc.go":   "// +k8s:deepcopy-gen=package\npackage v1\n",
+		"pkg/apis/apps/v1/types.go": "package v1\n\ntype Foo struct {\n\tName string\n}\n",
+	})
+	c.boilerplatePath = filepath.Join(c.workspace, "hack/boilerplate.go.txt")
+	c.WithSourceDateEpoch(1640995200)
+	c.WithHeaderVars(map[string]string{"Company": "Example, Inc"})
+
+	cleanup, err := c.renderHeaderFile()
+	assert.NoError(t, err)
+	headerFile := c.goHeaderFile()
+	assert.NotEqual(t, c.boilerplatePath, headerFile)
+
+	run := testGeneratorRunner(t, c, "deepcopy")
+	assert.NoError(t, c.genDeepcopy(c.logger, run))
+	content, err := ioutil.ReadFile(filepath.Join(c.outputBase, "github.com/example/project/pkg/apis/apps/v1", deepcopyFileBase+".go"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "// Copyright 2022 Example, Inc.\n")
+	assert.NotContains(t, string(content), "{{.Company}}")
+
+	cleanup()
+	_, err = os.Stat(headerFile)
+	assert.True(t, os.IsNotExist(err))
+	assert.Equal(t, c.boilerplatePath, c.goHeaderFile())
+}
+
+func Test_ParseCRDVersionOverrides(t *testing.T) {
+	got, err := ParseCRDVersionOverrides([]string{"apps.example.com/v1=false", "apps.example.com/v2=true"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{"apps.example.com/v1": false, "apps.example.com/v2": true}, got)
+	assert.Equal(t, `{"apps.example.com/v1":false,"apps.example.com/v2":true}`, markerBoolMap(got))
+
+	for _, option := range []string{"apps.example.com/v1", "apps.example.com=true", "apps.example.com/v1/x=true", "/v1=true", "apps.example.com/v1=yes"} {
+		_, err := ParseCRDVersionOverrides([]string{option})
+		assert.Error(t, err, option)
+	}
+}
+
+func Test_generatorPackages(t *testing.T) {
+	assert.Equal(t, []string{"deepcopy-gen"}, generatorPackages("deepcopy"))
+	assert.Equal(t, []string{"go-to-protobuf", "go-to-protobuf/protoc-gen-gogo"}, generatorPackages("protobuf"))
+	assert.Nil(t, generatorPackages("crd"))
+	assert.Nil(t, generatorPackages("install"))
+
+	// nothing to install
+	c := newTestCodeGenerator()
+	assert.NoError(t, c.installGenerators([]string{"crd", "install"}))
+}
+
+func Test_getLocalInputPackagePaths(t *testing.T) {
+	c := newTestCodeGenerator()
+	c.workspaceModule = "github.com/example/project/v2"
+	c.inputPackages = []string{
+		"github.com/example/project/v2/pkg/apis/apps/v1",
+		"github.com/example/project/pkg/apis/apps/v1",
+		"github.com/example/project/v20/pkg/apis/apps/v1",
+	}
+	assert.Equal(t, []string{"/workspace/pkg/apis/apps/v1"}, c.getLocalInputPackagePaths())
+
+	// module path is matched by path segments
+	c.workspaceModule = "github.com/example/proj"
+	assert.Empty(t, c.getLocalInputPackagePaths())
+}
+
+func Test_checkGenericListersSupported(t *testing.T) {
+	assert.NoError(t, checkGenericListersSupported("v0.31.0"))
+	assert.NoError(t, checkGenericListersSupported("v0.32.1"))
+	assert.Error(t, checkGenericListersSupported("v0.30.3"))
+	assert.Error(t, checkGenericListersSupported(""))
+}
+
+func TestCodeGenerator_doGenerate_genericListers(t *testing.T) {
+	c := newTestCodeGenerator().WithGenericListers(true)
+	// fails before any generator is installed or run
+	err := c.doGenerate([]string{"client", "lister", "informer"})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "--generic-listers")
+	}
+
+	// the lister generator version takes precedence
+	c.WithGeneratorVersions(map[string]string{"lister": "v0.31.0"})
+	assert.NoError(t, checkGenericListersSupported(c.generatorVersion("lister")))
+}
+
+func Test_inWorkspace(t *testing.T) {
+	c := newTestCodeGenerator()
+	c.workspace = t.TempDir()
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+
+	assert.NoError(t, c.inWorkspace(func() error {
+		got, err := os.Getwd()
+		assert.NoError(t, err)
+		want, err := filepath.EvalSymlinks(c.workspace)
+		assert.NoError(t, err)
+		assert.Equal(t, want, got)
+		return nil
+	}))
+	assert.Error(t, c.inWorkspace(func() error { return fmt.Errorf("failed") }))
+	// the current dir is restored
+	after, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.Equal(t, wd, after)
+}
@@ -0,0 +1,75 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/zoumo/make-rules/pkg/golang"
+)
+
+// goWork returns the go.work file used by workspace, empty means workspace
+// is not in a go.work multi-module workspace.
+func (c *CodeGenerator) goWork() (string, error) {
+	out, err := c.goCmd.RunOutput("env", "GOWORK")
+	if err != nil {
+		return "", err
+	}
+	gowork := strings.TrimSpace(string(out))
+	if gowork == "off" {
+		return "", nil
+	}
+	return gowork, nil
+}
+
+// listModules returns all modules used by workspace except itself. If workspace
+// is in a go.work, modules are resolved honoring the go.work, so that other
+// workspace modules are included.
+func (c *CodeGenerator) listModules() ([]golang.ListModule, error) {
+	gowork, err := c.goWork()
+	if err != nil {
+		return nil, err
+	}
+	if len(gowork) == 0 {
+		return c.gomodHelper.ParseListMod()
+	}
+
+	c.logger.Info("listing modules in go workspace", "gowork", gowork)
+	out, err := c.goCmd.RunOutput("list", "-m", "-json", "all")
+	if err != nil {
+		return nil, err
+	}
+	return parseWorkspaceModules(out, c.workspace)
+}
+
+// parseWorkspaceModules parses output of `go list -m -json all` in go.work
+// mode, where every workspace module is a main module. Only the main module
+// in workspace dir is skipped.
+func parseWorkspaceModules(out []byte, workspace string) ([]golang.ListModule, error) {
+	modules, err := parseListModules(out)
+	if err != nil {
+		return nil, err
+	}
+	ret := []golang.ListModule{}
+	for _, m := range modules {
+		if m.Main && filepath.Clean(m.Dir) == filepath.Clean(workspace) {
+			// skip workspace module
+			continue
+		}
+		ret = append(ret, m)
+	}
+	return ret, nil
+}
@@ -0,0 +1,48 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"text/template"
+)
+
+// writeHelperFile renders tmpl with data into go file name in dir, which holds
+// helpers generated by kube-codegen along with the generators output. Header
+// of data is the boilerplate, and Package is the go package name of dir unless
+// data sets it.
+func (c *CodeGenerator) writeHelperFile(dir, name string, tmpl *template.Template, data map[string]interface{}) error {
+	header, err := c.boilerplate()
+	if err != nil {
+		return err
+	}
+	values := map[string]interface{}{
+		"Header":  header,
+		"Package": goPackageName(dir),
+	}
+	for key, value := range data {
+		values[key] = value
+	}
+	buf := bytes.Buffer{}
+	if err := tmpl.Execute(&buf, values); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	return writeGoFile(path.Join(dir, name), buf.Bytes())
+}
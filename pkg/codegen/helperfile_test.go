@@ -0,0 +1,344 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"go/ast"
+	"go/format"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testClientsetPackage = "github.com/example/project/pkg/clients/kubernetes"
+	testInformersPackage = "github.com/example/project/pkg/clients/informers"
+	testSchemePackage    = testClientsetPackage + "/scheme"
+)
+
+// testHelperPackages stubs the parts of packages used by helper files, which
+// are k8s.io/client-go and k8s.io/apimachinery v0.20 and the packages
+// generated by client-gen and informer-gen.
+var testHelperPackages = map[string]string{
+	"k8s.io/apimachinery/pkg/runtime": `package runtime
+
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/vnd.kubernetes.protobuf"
+)
+
+type ObjectCreater interface{}
+
+type ObjectTyper interface{}
+
+type SerializerInfo struct {
+	MediaType string
+}
+
+type NegotiatedSerializer interface {
+	SupportedMediaTypes() []SerializerInfo
+}
+
+type Scheme struct{}
+
+func NewScheme() *Scheme { return &Scheme{} }
+`,
+	"k8s.io/apimachinery/pkg/runtime/serializer": `package serializer
+
+import runtime "k8s.io/apimachinery/pkg/runtime"
+
+type CodecFactory struct{}
+
+type CodecFactoryOptions struct{}
+
+type CodecFactoryOptionsMutator func(*CodecFactoryOptions)
+
+func NewCodecFactory(scheme *runtime.Scheme, mutators ...CodecFactoryOptionsMutator) CodecFactory {
+	return CodecFactory{}
+}
+
+func (f CodecFactory) WithoutConversion() runtime.NegotiatedSerializer { return nil }
+
+func WithSerializer(newSerializer func(runtime.ObjectCreater, runtime.ObjectTyper) runtime.SerializerInfo) CodecFactoryOptionsMutator {
+	return nil
+}
+`,
+	"k8s.io/apimachinery/pkg/runtime/serializer/cbor": `package cbor
+
+import runtime "k8s.io/apimachinery/pkg/runtime"
+
+func NewSerializerInfo(creater runtime.ObjectCreater, typer runtime.ObjectTyper) runtime.SerializerInfo {
+	return runtime.SerializerInfo{}
+}
+`,
+	"k8s.io/client-go/util/flowcontrol": `package flowcontrol
+
+type RateLimiter interface {
+	TryAccept() bool
+	Accept()
+	Stop()
+	QPS() float32
+}
+
+func NewTokenBucketRateLimiter(qps float32, burst int) RateLimiter { return nil }
+`,
+	"k8s.io/client-go/rest": `package rest
+
+import (
+	runtime "k8s.io/apimachinery/pkg/runtime"
+	flowcontrol "k8s.io/client-go/util/flowcontrol"
+)
+
+type ContentConfig struct {
+	AcceptContentTypes   string
+	ContentType          string
+	NegotiatedSerializer runtime.NegotiatedSerializer
+}
+
+type Config struct {
+	ContentConfig
+	UserAgent   string
+	QPS         float32
+	Burst       int
+	RateLimiter flowcontrol.RateLimiter
+}
+
+func CopyConfig(config *Config) *Config { return config }
+
+func DefaultKubernetesUserAgent() string { return "" }
+`,
+	testClientsetPackage: `package kubernetes
+
+import rest "k8s.io/client-go/rest"
+
+type Interface interface{}
+
+type Clientset struct{}
+
+func NewForConfig(c *rest.Config) (*Clientset, error) { return &Clientset{}, nil }
+`,
+	testSchemePackage: `package scheme
+
+import runtime "k8s.io/apimachinery/pkg/runtime"
+
+var Scheme = runtime.NewScheme()
+`,
+	testInformersPackage: `package informers
+
+import (
+	time "time"
+
+	versioned "github.com/example/project/pkg/clients/kubernetes"
+)
+
+type SharedInformerFactory interface{}
+
+type sharedInformerFactory struct{}
+
+type SharedInformerOption func(*sharedInformerFactory) *sharedInformerFactory
+
+func NewSharedInformerFactoryWithOptions(client versioned.Interface, defaultResync time.Duration, options ...SharedInformerOption) SharedInformerFactory {
+	return &sharedInformerFactory{}
+}
+`,
+}
+
+type importerFunc func(path string) (*types.Package, error)
+
+func (f importerFunc) Import(path string) (*types.Package, error) {
+	return f(path)
+}
+
+// checkHelperFile type checks helper file src along with the stub of package
+// pkgPath, against the stubs of packages it imports.
+func checkHelperFile(t *testing.T, pkgPath, src string) {
+	fset := token.NewFileSet()
+	imported := map[string]*types.Package{}
+	var check func(path string, srcs ...string) (*types.Package, error)
+	conf := types.Config{Importer: importerFunc(func(path string) (*types.Package, error) {
+		if pkg, ok := imported[path]; ok {
+			return pkg, nil
+		}
+		if stub, ok := testHelperPackages[path]; ok {
+			return check(path, stub)
+		}
+		return importer.Default().Import(path)
+	})}
+	check = func(path string, srcs ...string) (*types.Package, error) {
+		files := []*ast.File{}
+		for _, src := range srcs {
+			f, err := parser.ParseFile(fset, "", src, 0)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, f)
+		}
+		pkg, err := conf.Check(path, fset, files, nil)
+		if err != nil {
+			return nil, err
+		}
+		imported[path] = pkg
+		return pkg, nil
+	}
+	_, err := check(pkgPath, testHelperPackages[pkgPath], src)
+	assert.NoError(t, err)
+}
+
+func Test_writeHelperFile(t *testing.T) {
+	tests := []struct {
+		name string
+		pkg  string
+		file string
+		// version is the code-generator version, the default one is used if empty
+		version string
+		// enable is required for gen to write file if it is set
+		enable  func(c *CodeGenerator)
+		gen     func(c *CodeGenerator, dir string) error
+		want    []string
+		notWant []string
+		// invalid makes gen fail if it is set
+		invalid func(c *CodeGenerator)
+	}{
+		{
+			name:    "config",
+			pkg:     testClientsetPackage,
+			file:    "config.go",
+			enable:  func(c *CodeGenerator) { c.WithClientContentType(ClientContentTypeProtobuf) },
+			gen:     (*CodeGenerator).genClientConfig,
+			want:    []string{"const ContentType = runtime.ContentTypeProtobuf"},
+			invalid: func(c *CodeGenerator) { c.WithClientContentType("yaml") },
+		},
+		{
+			name:   "useragent",
+			pkg:    testClientsetPackage,
+			file:   "useragent.go",
+			enable: func(c *CodeGenerator) { c.WithClientUserAgent(`example-operator/v1.0.0 "beta"`) },
+			gen:    (*CodeGenerator).genClientUserAgent,
+			want:   []string{`var DefaultUserAgent = "example-operator/v1.0.0 \"beta\""`},
+		},
+		{
+			name:   "ratelimit",
+			pkg:    testClientsetPackage,
+			file:   "ratelimit.go",
+			enable: func(c *CodeGenerator) { c.WithGenRateLimit(true) },
+			gen:    (*CodeGenerator).genClientRateLimit,
+			want:   []string{"func NewForConfigWithRateLimit(c *rest.Config, qps float32, burst int) (*Clientset, error)"},
+		},
+		{
+			name:    "serializer",
+			pkg:     testClientsetPackage,
+			file:    "serializer.go",
+			version: "v0.20.2",
+			gen: func(c *CodeGenerator, dir string) error {
+				return c.genClientSerializer(dir, testSchemePackage)
+			},
+			want: []string{
+				`"` + testSchemePackage + `"`,
+				"return serializer.NewCodecFactory(scheme.Scheme, mutators...)",
+				"func NewNegotiatedSerializer(mutators ...serializer.CodecFactoryOptionsMutator) runtime.NegotiatedSerializer {",
+			},
+			notWant: []string{"cbor"},
+		},
+		{
+			name:    "serializer of unknown version",
+			pkg:     testClientsetPackage,
+			file:    "serializer.go",
+			version: "unknown",
+			gen: func(c *CodeGenerator, dir string) error {
+				return c.genClientSerializer(dir, testSchemePackage)
+			},
+			notWant: []string{"cbor"},
+		},
+		{
+			name:    "serializer with cbor",
+			pkg:     testClientsetPackage,
+			file:    "serializer.go",
+			version: "v0.32.0",
+			gen: func(c *CodeGenerator, dir string) error {
+				return c.genClientSerializer(dir, testSchemePackage)
+			},
+			want: []string{
+				`"k8s.io/apimachinery/pkg/runtime/serializer/cbor"`,
+				"serializer.WithSerializer(cbor.NewSerializerInfo)",
+			},
+		},
+		{
+			name:   "resync",
+			pkg:    testInformersPackage,
+			file:   "resync.go",
+			enable: func(c *CodeGenerator) { c.WithInformerDefaultResync(10 * time.Hour) },
+			gen:    (*CodeGenerator).genInformerResync,
+			want: []string{
+				`versioned "` + testClientsetPackage + `"`,
+				"const DefaultResync = 10 * time.Hour",
+				"return NewSharedInformerFactoryWithOptions(client, DefaultResync, options...)",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp := t.TempDir()
+			c := newTestCodeGenerator()
+			c.boilerplatePath = filepath.Join(tmp, "boilerplate.go.txt")
+			assert.NoError(t, ioutil.WriteFile(c.boilerplatePath, []byte("// Copyright YEAR The Authors.\n"), 0644))
+			c.WithSourceDateEpoch(1640995200)
+			if len(tt.version) > 0 {
+				c.codeGeneratorVersion = tt.version
+			}
+			dir := filepath.Join(tmp, strings.TrimPrefix(tt.pkg, c.workspaceModule+"/"))
+
+			if tt.enable != nil {
+				// not generated by default
+				assert.NoError(t, tt.gen(c, dir))
+				assert.NoFileExists(t, filepath.Join(dir, tt.file))
+				tt.enable(c)
+			}
+			assert.NoError(t, tt.gen(c, dir))
+			got, err := ioutil.ReadFile(filepath.Join(dir, tt.file))
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.True(t, strings.HasPrefix(string(got), "// Copyright 2022 The Authors.\n"), string(got))
+			assert.Contains(t, string(got), "package "+path.Base(tt.pkg)+"\n")
+			for _, want := range tt.want {
+				assert.Contains(t, string(got), want)
+			}
+			for _, notWant := range tt.notWant {
+				assert.NotContains(t, string(got), notWant)
+			}
+
+			formatted, err := format.Source(got)
+			assert.NoError(t, err)
+			assert.Equal(t, string(formatted), string(got))
+
+			// type check against the stubs of the package generated in dir and its imports
+			checkHelperFile(t, tt.pkg, string(got))
+
+			if tt.invalid != nil {
+				tt.invalid(c)
+				assert.Error(t, tt.gen(c, dir))
+			}
+		})
+	}
+}
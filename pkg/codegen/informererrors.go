@@ -0,0 +1,97 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"fmt"
+	"path"
+	"text/template"
+
+	"golang.org/x/mod/semver"
+)
+
+// informerErrorsMinVersion is the first client-go version whose informers
+// accept a WatchErrorHandler.
+const informerErrorsMinVersion = "v0.19.0"
+
+var informerErrorsTemplate = template.Must(template.New("run").Parse(`{{ .Header }}
+// Code generated by kube-codegen. DO NOT EDIT.
+
+package {{ .Package }}
+
+import (
+	context "context"
+	fmt "fmt"
+	reflect "reflect"
+
+	cache "k8s.io/client-go/tools/cache"
+)
+
+// WatchErrorHandler is called with the type of object an informer watches
+// whenever its ListAndWatch drops with err.
+type WatchErrorHandler func(informerType reflect.Type, err error)
+
+// RunWithErrorHandler wires handler as the WatchErrorHandler of informers
+// requested from factory and not started yet, then starts them and blocks
+// until ctx is done. Errors are still logged by cache.DefaultWatchErrorHandler.
+// Informers must be requested from factory before calling it.
+func RunWithErrorHandler(ctx context.Context, factory SharedInformerFactory, handler WatchErrorHandler) error {
+	f, ok := factory.(*sharedInformerFactory)
+	if !ok {
+		return fmt.Errorf("unsupported SharedInformerFactory %T", factory)
+	}
+	if err := f.setWatchErrorHandler(handler); err != nil {
+		return err
+	}
+	f.Start(ctx.Done())
+	<-ctx.Done()
+	return nil
+}
+
+func (f *sharedInformerFactory) setWatchErrorHandler(handler WatchErrorHandler) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for informerType, informer := range f.informers {
+		if f.startedInformers[informerType] {
+			continue
+		}
+		informerType := informerType
+		err := informer.SetWatchErrorHandler(func(r *cache.Reflector, err error) {
+			cache.DefaultWatchErrorHandler(r, err)
+			handler(informerType, err)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to set watch error handler of informer for %v: %v", informerType, err)
+		}
+	}
+	return nil
+}
+`))
+
+// genInformerErrorHandler generates run.go in informers dir with RunWithErrorHandler,
+// it requires the factory generated by informer-gen in the same dir.
+func (c *CodeGenerator) genInformerErrorHandler(dir string) error {
+	if !c.genInformerErrors {
+		return nil
+	}
+	version := c.generatorVersion("informer")
+	if semver.IsValid(version) && semver.Compare(version, informerErrorsMinVersion) < 0 {
+		return fmt.Errorf("informers of k8s.io/client-go %v do not accept WatchErrorHandler, please upgrade k8s.io/code-generator to %v or later, or remove --gen-informer-errors", version, informerErrorsMinVersion)
+	}
+	runFile := path.Join(dir, "run.go")
+	c.logger.Info("generating informer error handler", "file", runFile)
+	return c.writeHelperFile(dir, "run.go", informerErrorsTemplate, nil)
+}
@@ -0,0 +1,75 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"go/format"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/otiai10/copy"
+	"github.com/stretchr/testify/assert"
+	"github.com/zoumo/make-rules/pkg/runner"
+)
+
+func Test_genInformerErrorHandler(t *testing.T) {
+	tmp := t.TempDir()
+	c := newTestCodeGenerator()
+	c.boilerplatePath = filepath.Join(tmp, "boilerplate.go.txt")
+	assert.NoError(t, ioutil.WriteFile(c.boilerplatePath, []byte("// Copyright YEAR The Authors.\n"), 0644))
+
+	// not generated by default
+	dir := filepath.Join(tmp, "informers")
+	assert.NoError(t, c.genInformerErrorHandler(dir))
+	assert.NoFileExists(t, filepath.Join(dir, "run.go"))
+
+	c.WithGenInformerErrors(true)
+	assert.NoError(t, c.genInformerErrorHandler(dir))
+	got, err := ioutil.ReadFile(filepath.Join(dir, "run.go"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(got), "package informers")
+	assert.Contains(t, string(got), "func RunWithErrorHandler(ctx context.Context, factory SharedInformerFactory, handler WatchErrorHandler) error")
+
+	formatted, err := format.Source(got)
+	assert.NoError(t, err)
+	assert.Equal(t, string(formatted), string(got))
+
+	// WatchErrorHandler is not supported
+	c.WithGeneratorVersions(map[string]string{"informer": "v0.18.6"})
+	assert.Error(t, c.genInformerErrorHandler(dir))
+}
+
+func Test_genInformers_errorHandler(t *testing.T) {
+	c := newTestWorkspaceGenerator(t, map[string]string{
+		"pkg/apis/infra/v1/doc.go":   "// +groupName=infra.example.com\npackage v1\n",
+		"pkg/apis/infra/v1/types.go": testClusterTypes,
+	})
+	c.boilerplatePath = filepath.Join(c.workspace, "hack/boilerplate.go.txt")
+	c.goCmd = runner.NewRunner("go").WithDir(c.workspace).WithEnvs("GOFLAGS", "-mod=mod")
+	c.inputPackages = []string{"github.com/example/project/pkg/apis/infra/v1"}
+	c.WithGenInformerErrors(true)
+
+	assert.NoError(t, c.genClient(c.logger, testGeneratorRunner(t, c, "client")))
+	assert.NoError(t, c.genLister(c.logger, testGeneratorRunner(t, c, "lister")))
+	assert.NoError(t, c.genInformer(c.logger, testGeneratorRunner(t, c, "informer")))
+
+	output := filepath.Join(c.outputBase, "github.com/example/project/pkg/clients")
+	assert.FileExists(t, filepath.Join(output, "informers/run.go"))
+
+	// run.go compiles with the factory generated by informer-gen and k8s.io/client-go pinned by go.mod
+	assert.NoError(t, copy.Copy(output, filepath.Join(c.workspace, "pkg/clients")))
+	goBuild(t, c, "./...")
+}
@@ -0,0 +1,48 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"os"
+	"path"
+)
+
+// linkWorkspace creates a GOPATH-style layout in outputBase whose module path
+// is a symlink to workspace, so that gengo based generators writing into
+// <outputBase>/<module> write into workspace in place.
+func linkWorkspace(outputBase, module, workspace string) error {
+	link := path.Join(outputBase, module)
+	if err := os.MkdirAll(path.Dir(link), 0755); err != nil {
+		return err
+	}
+	return os.Symlink(workspace, link)
+}
+
+// unlinkWorkspace removes the symlink created by linkWorkspace if it exists,
+// files in workspace are kept.
+func unlinkWorkspace(outputBase, module string) error {
+	link := path.Join(outputBase, module)
+	info, err := os.Lstat(link)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		return nil
+	}
+	return os.Remove(link)
+}
@@ -0,0 +1,73 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_postRun_inPlace(t *testing.T) {
+	dir := t.TempDir()
+	c := newTestCodeGenerator().WithInPlace(true)
+	c.workspace = dir
+	c.outputBase = filepath.Join(dir, "__output", "generated")
+	c.boilerplatePath = filepath.Join(dir, "boilerplate.go.txt")
+	assert.NoError(t, os.WriteFile(c.boilerplatePath, []byte("// header\n"), 0644))
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "pkg", "apis", "apps", "v1"), 0755))
+
+	assert.NoError(t, linkWorkspace(c.outputBase, c.workspaceModule, c.workspace))
+
+	// generators write into output base through the link
+	generated := filepath.Join(c.outputBase, c.workspaceModule, "pkg", "apis", "apps", "v1", "zz_generated.deepcopy.go")
+	assert.NoError(t, os.WriteFile(generated, []byte("package v1\n"), 0644))
+	data, err := os.ReadFile(filepath.Join(dir, "pkg", "apis", "apps", "v1", "zz_generated.deepcopy.go"))
+	assert.NoError(t, err)
+	assert.Equal(t, "package v1\n", string(data))
+
+	// postRun removes links only and keeps generated files in workspace
+	assert.NoError(t, c.postRun([]string{"deepcopy"}))
+	_, err = os.Stat(c.outputBase)
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(dir, "pkg", "apis", "apps", "v1", "zz_generated.deepcopy.go"))
+	assert.NoError(t, err)
+}
+
+func Test_unlinkWorkspace(t *testing.T) {
+	dir := t.TempDir()
+	workspace := filepath.Join(dir, "workspace")
+	outputBase := filepath.Join(dir, "__output", "generated")
+	module := "github.com/example/project"
+	assert.NoError(t, os.MkdirAll(workspace, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(workspace, "go.mod"), []byte("module "+module+"\n"), 0644))
+
+	// nothing linked
+	assert.NoError(t, unlinkWorkspace(outputBase, module))
+
+	assert.NoError(t, linkWorkspace(outputBase, module, workspace))
+	assert.NoError(t, unlinkWorkspace(outputBase, module))
+	_, err := os.Lstat(filepath.Join(outputBase, module))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(workspace, "go.mod"))
+	assert.NoError(t, err)
+
+	// dirs generated by copy mode are not removed
+	assert.NoError(t, os.MkdirAll(filepath.Join(outputBase, module), 0755))
+	assert.NoError(t, unlinkWorkspace(outputBase, module))
+	assert.DirExists(t, filepath.Join(outputBase, module))
+}
@@ -0,0 +1,107 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"bytes"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/zoumo/goset"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// allowedKindsTags removes +genclient tags of kinds not in kinds, so that
+// generators skip them as if they are not marked.
+func allowedKindsTags(kinds []string) tagEditor {
+	set := goset.NewSetFromStrings(kinds)
+	return func(kind string, lines []string) []string {
+		if set.Contains(kind) {
+			return lines
+		}
+		ret := []string{}
+		for _, line := range lines {
+			tag := commentTag(line)
+			if tag == "genclient" || strings.HasPrefix(tag, "genclient:") {
+				continue
+			}
+			ret = append(ret, line)
+		}
+		return ret
+	}
+}
+
+// walkGeneratedFiles walks into root, and calls fn with the content of each
+// file named filename, the returned content is written back.
+func walkGeneratedFiles(root, filename string, fn func(dir string, content []byte) ([]byte, error)) error {
+	if _, err := os.Stat(root); os.IsNotExist(err) {
+		return nil
+	}
+	return filepath.WalkDir(root, func(fpath string, d fs.DirEntry, ierr error) error {
+		if ierr != nil {
+			return ierr
+		}
+		if d.IsDir() || d.Name() != filename {
+			return nil
+		}
+		content, err := ioutil.ReadFile(fpath)
+		if err != nil {
+			return err
+		}
+		content, err = fn(filepath.Dir(fpath), content)
+		if err != nil {
+			return err
+		}
+		return writeGoFile(fpath, content)
+	})
+}
+
+// deleteUnusedImports deletes imports of f which are not used.
+func deleteUnusedImports(fset *token.FileSet, f *ast.File) {
+	imports := append([]*ast.ImportSpec{}, f.Imports...)
+	for _, imp := range imports {
+		importPath, _ := strconv.Unquote(imp.Path.Value)
+		name := ""
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+		if !astutil.UsesImport(f, importPath) {
+			astutil.DeleteNamedImport(fset, f, name, importPath)
+		}
+	}
+}
+
+// writeGoFile removes unused imports, formats and writes go source to file.
+func writeGoFile(filename string, content []byte) error {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, content, parser.ParseComments)
+	if err != nil {
+		return err
+	}
+	deleteUnusedImports(fset, f)
+	buf := &bytes.Buffer{}
+	if err := format.Node(buf, fset, f); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, buf.Bytes(), 0644)
+}
@@ -0,0 +1,125 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/otiai10/copy"
+	"github.com/stretchr/testify/assert"
+	"github.com/zoumo/make-rules/pkg/runner"
+)
+
+func Test_allowedKindsTags(t *testing.T) {
+	src := `package v1
+
+// +genclient
+// +genclient:nonNamespaced
+// Foo is allowed.
+type Foo struct{}
+
+// +genclient
+// +genclient:onlyVerbs=get,list
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// Bar is not allowed.
+type Bar struct{}
+`
+	got, err := retagFile("types.go", []byte(src), allowedKindsTags([]string{"Foo"}))
+	assert.NoError(t, err)
+	assert.Equal(t, `package v1
+
+// +genclient
+// +genclient:nonNamespaced
+// Foo is allowed.
+type Foo struct{}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// Bar is not allowed.
+type Bar struct{}
+`, string(got))
+}
+
+func writeTestFiles(t *testing.T, root string, files map[string]string) {
+	for name, content := range files {
+		file := filepath.Join(root, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(file), 0755))
+		assert.NoError(t, os.WriteFile(file, []byte(content), 0644))
+	}
+}
+
+func Test_genListers_clientOnlyKinds(t *testing.T) {
+	c := newTestWorkspaceGenerator(t, map[string]string{
+		"pkg/apis/infra/v1/doc.go":   "// +groupName=infra.example.com\npackage v1\n",
+		"pkg/apis/infra/v1/types.go": testClusterTypes,
+		"pkg/apis/infra/v1/node.go": `package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	runtime "k8s.io/apimachinery/pkg/runtime"
+)
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+type Node struct {
+	metav1.TypeMeta   ` + "`json:\",inline\"`" + `
+	metav1.ObjectMeta ` + "`json:\"metadata,omitempty\"`" + `
+}
+
+func (in *Node) DeepCopyObject() runtime.Object {
+	out := *in
+	return &out
+}
+
+type NodeList struct {
+	metav1.TypeMeta ` + "`json:\",inline\"`" + `
+	metav1.ListMeta ` + "`json:\"metadata,omitempty\"`" + `
+	Items           []Node ` + "`json:\"items\"`" + `
+}
+
+func (in *NodeList) DeepCopyObject() runtime.Object {
+	out := *in
+	return &out
+}
+`,
+	})
+	c.boilerplatePath = filepath.Join(c.workspace, "hack/boilerplate.go.txt")
+	c.goCmd = runner.NewRunner("go").WithDir(c.workspace).WithEnvs("GOFLAGS", "-mod=mod")
+	c.inputPackages = []string{"github.com/example/project/pkg/apis/infra/v1"}
+	c.WithClientOnlyKinds([]string{"Cluster"})
+
+	assert.NoError(t, c.genClient(c.logger, testGeneratorRunner(t, c, "client")))
+	assert.NoError(t, c.genLister(c.logger, testGeneratorRunner(t, c, "lister")))
+	assert.NoError(t, c.genInformer(c.logger, testGeneratorRunner(t, c, "informer")))
+
+	output := filepath.Join(c.outputBase, "github.com/example/project/pkg/clients")
+	// clients are generated for all kinds
+	assert.FileExists(t, filepath.Join(output, "kubernetes/typed/infra/v1/node.go"))
+	assert.FileExists(t, filepath.Join(output, "listers/infra/v1/cluster.go"))
+	assert.NoFileExists(t, filepath.Join(output, "listers/infra/v1/node.go"))
+	assert.FileExists(t, filepath.Join(output, "informers/infra/v1/cluster.go"))
+	assert.NoFileExists(t, filepath.Join(output, "informers/infra/v1/node.go"))
+	content, err := os.ReadFile(filepath.Join(output, "informers/generic.go"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), `WithResource("clusters")`)
+	assert.NotContains(t, string(content), `WithResource("nodes")`)
+
+	assert.NoError(t, copy.Copy(output, filepath.Join(c.workspace, "pkg/clients")))
+	goBuild(t, c, "./...")
+}
@@ -0,0 +1,88 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path"
+	"strings"
+)
+
+const codeGeneratorModule = "k8s.io/code-generator"
+
+// lookPathGenerator returns path of binary of package pkg found on PATH if it
+// is built from k8s.io/code-generator of version.
+func (c *CodeGenerator) lookPathGenerator(pkg, version string) (string, bool) {
+	binary := path.Base(pkg)
+	binPath, err := exec.LookPath(binary)
+	if err != nil {
+		c.logger.V(1).Info("generator not found on PATH", "binary", binary)
+		return "", false
+	}
+	out, err := c.goCmd.RunOutput("version", "-m", binPath)
+	if err != nil {
+		c.logger.Info("unable to detect version of generator on PATH", "path", binPath, "err", err.Error())
+		return "", false
+	}
+	got, err := parseCodeGeneratorVersion(out)
+	if err != nil {
+		c.logger.Info("unable to detect version of generator on PATH", "path", binPath, "err", err.Error())
+		return "", false
+	}
+	if got != version {
+		c.logger.Info("version of generator on PATH mismatches", "path", binPath, "version", got, "want", version)
+		return "", false
+	}
+	return binPath, true
+}
+
+// parseCodeGeneratorVersion returns version of k8s.io/code-generator in build
+// info printed by `go version -m`, the replacement version takes precedence.
+func parseCodeGeneratorVersion(out []byte) (string, error) {
+	version, found := "", false
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		if fields[0] == "=>" {
+			if !found {
+				// replacement of other modules
+				continue
+			}
+			if len(fields) < 3 || !strings.HasPrefix(fields[2], "v") {
+				return "", fmt.Errorf("%v is replaced by %v without version", codeGeneratorModule, fields[1])
+			}
+			version = fields[2]
+			continue
+		}
+		found = (fields[0] == "mod" || fields[0] == "dep") && fields[1] == codeGeneratorModule && len(fields) >= 3
+		if found {
+			version = fields[2]
+			continue
+		}
+		if len(version) > 0 {
+			break
+		}
+	}
+	if len(version) == 0 {
+		return "", fmt.Errorf("%v is not found in build info", codeGeneratorModule)
+	}
+	return version, nil
+}
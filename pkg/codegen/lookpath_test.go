@@ -0,0 +1,94 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_parseCodeGeneratorVersion(t *testing.T) {
+	got, err := parseCodeGeneratorVersion([]byte(`/go/bin/deepcopy-gen: go1.20.1
+	path	k8s.io/code-generator/cmd/deepcopy-gen
+	mod	k8s.io/code-generator	v0.20.2	h1:SQaysped4EtUDTYCe9+sQw9ijuDPUe2uDzvgrEcpmq4=
+	dep	k8s.io/gengo	v0.0.0-20201113003025-83324d819ded	h1:JApXBKYyB7l9xx+DK7/+mFjC7A9Bt5A93FPvFD0HIFE=
+	=>	example.com/gengo	v0.0.1
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, "v0.20.2", got)
+
+	got, err = parseCodeGeneratorVersion([]byte(`/go/bin/client-gen: go1.20.1
+	path	k8s.io/code-generator/cmd/client-gen
+	mod	k8s.io/code-generator	v0.20.2
+	=>	example.com/code-generator	v0.20.3-fork	h1:abc=
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, "v0.20.3-fork", got)
+
+	_, err = parseCodeGeneratorVersion([]byte(`/go/bin/client-gen: go1.20.1
+	path	k8s.io/code-generator/cmd/client-gen
+	mod	k8s.io/code-generator	(devel)
+	=>	../code-generator
+`))
+	assert.Error(t, err)
+
+	_, err = parseCodeGeneratorVersion([]byte("/go/bin/client-gen: not a go binary\n"))
+	assert.Error(t, err)
+}
+
+func Test_installGenerators_usePathGenerators(t *testing.T) {
+	dir := t.TempDir()
+	pathDir := filepath.Join(dir, "path")
+	assert.NoError(t, os.MkdirAll(pathDir, 0755))
+	// deepcopy-gen on PATH matches the version, client-gen does not
+	for name, version := range map[string]string{"deepcopy-gen": "v0.20.2", "client-gen": "v0.19.0"} {
+		script := "#!/bin/sh\n# " + version + "\necho " + name + " on PATH\n"
+		assert.NoError(t, os.WriteFile(filepath.Join(pathDir, name), []byte(script), 0755))
+	}
+	t.Setenv("PATH", pathDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	// fake go binary printing build info by the version in generator scripts
+	// and recording install commands
+	goBin := filepath.Join(dir, "go")
+	assert.NoError(t, os.WriteFile(goBin, []byte(`#!/bin/sh
+if [ "$1" = version ]; then
+	printf '%s: go1.20.1\n\tmod\tk8s.io/code-generator\t%s\n' "$3" "$(sed -n 's/^# //p' "$3")"
+	exit 0
+fi
+echo "$@" >> `+filepath.Join(dir, "installs")+"\n"), 0755))
+
+	c := newTestCodeGenerator()
+	c.workspace = dir
+	c.WithGoBin(goBin).WithUsePathGenerators(true)
+	assert.NoError(t, c.installGenerators([]string{"deepcopy", "client", "lister"}))
+	data, err := os.ReadFile(filepath.Join(dir, "installs"))
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		"install -v k8s.io/code-generator/cmd/client-gen@v0.20.2",
+		"install -v k8s.io/code-generator/cmd/lister-gen@v0.20.2",
+	}, strings.Split(strings.TrimSpace(string(data)), "\n"))
+
+	// deepcopy runs the generator on PATH
+	run, err := c.prepareRunner("deepcopy")
+	assert.NoError(t, err)
+	out, err := run.RunOutput()
+	assert.NoError(t, err)
+	assert.Equal(t, "deepcopy-gen on PATH", strings.TrimSpace(string(out)))
+	assert.Equal(t, map[string]string{"deepcopy-gen": filepath.Join(pathDir, "deepcopy-gen")}, c.pathGenerators)
+}
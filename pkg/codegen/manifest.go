@@ -0,0 +1,84 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"path"
+	"time"
+
+	"github.com/zoumo/make-rules/version"
+
+	"github.com/zoumo/kube-codegen/pkg/generator/crd"
+)
+
+const (
+	manifestFileName = ".codegen-manifest.json"
+)
+
+// Manifest records what produced the generated code. It is written to the
+// workspace root after generation so that regenerations are auditable.
+// GeneratedAt is the source date epoch, it is omitted if the epoch is not set
+// to keep the manifest reproducible.
+type Manifest struct {
+	KubeCodegenVersion    string            `json:"kubeCodegenVersion"`
+	CodeGeneratorVersion  string            `json:"codeGeneratorVersion"`
+	GeneratorVersions     map[string]string `json:"generatorVersions,omitempty"`
+	Generators            []string          `json:"generators"`
+	InputPackages         []string          `json:"inputPackages"`
+	InputInternalPackages []string          `json:"inputInternalPackages,omitempty"`
+	BoilerplateSHA256     string            `json:"boilerplateSHA256"`
+	GeneratedAt           string            `json:"generatedAt,omitempty"`
+}
+
+func (c *CodeGenerator) newManifest(generators []string) (*Manifest, error) {
+	header, err := ioutil.ReadFile(c.boilerplatePath)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(header)
+	generatedAt := ""
+	if c.sourceDateEpoch >= 0 {
+		generatedAt = crd.GenerationTime(c.sourceDateEpoch).Format(time.RFC3339)
+	}
+	return &Manifest{
+		KubeCodegenVersion:    version.Get().String(),
+		CodeGeneratorVersion:  c.codeGeneratorVersion,
+		GeneratorVersions:     c.generatorVersions,
+		Generators:            generators,
+		InputPackages:         c.inputPackages,
+		InputInternalPackages: c.inputInternalPackages,
+		BoilerplateSHA256:     hex.EncodeToString(sum[:]),
+		GeneratedAt:           generatedAt,
+	}, nil
+}
+
+// writeManifest writes manifest of enabled generators to workspace root.
+func (c *CodeGenerator) writeManifest(generators []string) error {
+	m, err := c.newManifest(generators)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	manifestFile := path.Join(c.workspace, manifestFileName)
+	c.logger.Info("writing manifest", "file", manifestFile)
+	return ioutil.WriteFile(manifestFile, append(data, '\n'), 0644)
+}
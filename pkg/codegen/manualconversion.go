@@ -0,0 +1,261 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"bytes"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+const (
+	manualConversionFile = "conversion.go"
+
+	conversionPackage = "k8s.io/apimachinery/pkg/conversion"
+)
+
+// missingConversionRegexp matches the error of conversion-gen when a type has
+// fields which can not be converted automatically, e.g.
+// Warning: could not find nor generate a final Conversion function for example.com/apis/apps/v1.Foo -> example.com/apis/apps.Foo
+var missingConversionRegexp = regexp.MustCompile(`could not find nor generate a final Conversion function for (\S+) -> (\S+)`)
+
+// conversionType is a type in conversion-gen output.
+type conversionType struct {
+	pkg  string
+	name string
+}
+
+func parseConversionType(s string) conversionType {
+	i := strings.LastIndex(s, ".")
+	return conversionType{pkg: s[:i], name: s[i+1:]}
+}
+
+// conversionName returns the type name used in conversion function names,
+// which is prefixed by the last part of package path, e.g. v1_Foo.
+func (t conversionType) conversionName() string {
+	return path.Base(t.pkg) + "_" + t.name
+}
+
+// manualConversion is a conversion function which conversion-gen expects to be
+// written by hand.
+type manualConversion struct {
+	in     conversionType
+	out    conversionType
+	fields []string
+}
+
+func (m manualConversion) funcName() string {
+	return "Convert_" + m.in.conversionName() + "_To_" + m.out.conversionName()
+}
+
+// parseManualConversions returns manual conversions required by conversion-gen
+// in its output.
+func parseManualConversions(output string) []manualConversion {
+	ret := []manualConversion{}
+	var current *manualConversion
+	for _, line := range strings.Split(output, "\n") {
+		if m := klogHeaderRegexp.FindString(line); m != "" {
+			line = line[len(m):]
+		}
+		if m := missingConversionRegexp.FindStringSubmatch(line); m != nil {
+			ret = append(ret, manualConversion{in: parseConversionType(m[1]), out: parseConversionType(m[2])})
+			current = &ret[len(ret)-1]
+			continue
+		}
+		if current == nil {
+			continue
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "- "):
+			current.fields = append(current.fields, strings.TrimPrefix(line, "- "))
+		case strings.HasPrefix(line, "the following fields need manual conversion"):
+		default:
+			current = nil
+		}
+	}
+	return ret
+}
+
+var manualConversionTemplate = template.Must(template.New("conversion").Parse(`
+{{- if .Header }}{{ .Header }}
+package {{ .Package }}
+{{ end }}
+{{- range .Funcs }}
+// {{ .Name }} is scaffolded by kube-codegen, conversion-gen can not generate it.
+func {{ .Name }}(in *{{ .In }}, out *{{ .Out }}, s {{ .Scope }}) error {
+	// TODO: convert fields requiring manual conversion: {{ .Fields }}
+	return auto{{ .Name }}(in, out, s)
+}
+{{ end }}`))
+
+type manualConversionFunc struct {
+	Name   string
+	In     string
+	Out    string
+	Scope  string
+	Fields string
+}
+
+// scaffoldManualConversions writes stubs of manual conversions required by
+// conversion-gen in output into conversion.go of the package which the
+// generated conversions belong to. Existing functions are kept, and stubs
+// are appended to existing conversion.go with imports merged into it.
+func (c *CodeGenerator) scaffoldManualConversions(output string) error {
+	external := map[string]bool{}
+	for _, pkg := range c.inputPackages {
+		external[pkg] = true
+	}
+	byPkg := map[string][]manualConversion{}
+	for _, m := range parseManualConversions(output) {
+		// conversions are generated in external version packages
+		pkg := m.in.pkg
+		if !external[pkg] && external[m.out.pkg] {
+			pkg = m.out.pkg
+		}
+		byPkg[pkg] = append(byPkg[pkg], m)
+	}
+
+	pkgs := make([]string, 0, len(byPkg))
+	for pkg := range byPkg {
+		pkgs = append(pkgs, pkg)
+	}
+	sort.Strings(pkgs)
+	for _, pkg := range pkgs {
+		dir, ok := localPackageDir(c.workspace, c.workspaceModule, pkg)
+		if !ok {
+			c.logger.Info("skip scaffolding manual conversions of package not in local module", "package", pkg)
+			continue
+		}
+		if err := c.writeManualConversions(dir, pkg, byPkg[pkg]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *CodeGenerator) writeManualConversions(dir, pkg string, conversions []manualConversion) error {
+	file := path.Join(dir, manualConversionFile)
+	existing, err := ioutil.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// imports of existing conversion.go are reused by their names
+	imports, used := map[string]string{}, map[string]bool{}
+	if len(existing) > 0 {
+		f, err := parser.ParseFile(token.NewFileSet(), file, existing, parser.ImportsOnly)
+		if err != nil {
+			return err
+		}
+		for _, spec := range f.Imports {
+			importPath, err := strconv.Unquote(spec.Path.Value)
+			if err != nil {
+				return err
+			}
+			name := path.Base(importPath)
+			if spec.Name != nil {
+				name = spec.Name.Name
+			}
+			imports[importPath], used[name] = name, true
+		}
+	}
+	added := map[string]string{}
+	qualify := func(t conversionType) string {
+		if t.pkg == pkg {
+			return t.name
+		}
+		name, ok := imports[t.pkg]
+		if !ok {
+			name = path.Base(t.pkg)
+			for i := 1; used[name]; i++ {
+				name = path.Base(t.pkg) + strconv.Itoa(i)
+			}
+			imports[t.pkg], used[name], added[t.pkg] = name, true, name
+		}
+		return name + "." + t.name
+	}
+	funcs := []manualConversionFunc{}
+	for _, m := range conversions {
+		if bytes.Contains(existing, []byte("func "+m.funcName()+"(")) {
+			continue
+		}
+		funcs = append(funcs, manualConversionFunc{
+			Name:   m.funcName(),
+			In:     qualify(m.in),
+			Out:    qualify(m.out),
+			Scope:  qualify(conversionType{pkg: conversionPackage, name: "Scope"}),
+			Fields: strings.Join(m.fields, ", "),
+		})
+	}
+	if len(funcs) == 0 {
+		return nil
+	}
+
+	data := map[string]interface{}{
+		"Package": goPackageName(dir),
+		"Funcs":   funcs,
+	}
+	if len(existing) == 0 {
+		header, err := c.boilerplate()
+		if err != nil {
+			return err
+		}
+		data["Header"] = header
+	}
+	buf := bytes.Buffer{}
+	if err := manualConversionTemplate.Execute(&buf, data); err != nil {
+		return err
+	}
+	content, err := addImports(append(existing, buf.Bytes()...), added)
+	if err != nil {
+		return err
+	}
+	c.logger.Info("scaffolding manual conversions", "file", file, "count", len(funcs))
+	return ioutil.WriteFile(file, content, 0644)
+}
+
+// addImports adds imports of path to name into go source src.
+func addImports(src []byte, imports map[string]string) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, 0, len(imports))
+	for importPath := range imports {
+		paths = append(paths, importPath)
+	}
+	sort.Strings(paths)
+	for _, importPath := range paths {
+		astutil.AddNamedImport(fset, f, imports[importPath], importPath)
+	}
+	buf := bytes.Buffer{}
+	if err := format.Node(&buf, fset, f); err != nil {
+		return nil, err
+	}
+	return format.Source(buf.Bytes())
+}
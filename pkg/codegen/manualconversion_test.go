@@ -0,0 +1,120 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// conversionGenOutput is the output of conversion-gen for Foo whose Selector
+// field changes from string in v1 to *metav1.LabelSelector in apps.
+const conversionGenOutput = `W0102 15:04:05.000000   12345 conversion.go:755] could not find nor generate a final Conversion function for github.com/example/project/pkg/apis/apps/v1.FooSpec -> github.com/example/project/pkg/apis/apps.FooSpec
+W0102 15:04:05.000000   12345 conversion.go:756]   the following fields need manual conversion:
+W0102 15:04:05.000000   12345 conversion.go:758]       - Selector
+W0102 15:04:05.000000   12345 conversion.go:755] could not find nor generate a final Conversion function for github.com/example/project/pkg/apis/apps.FooSpec -> github.com/example/project/pkg/apis/apps/v1.FooSpec
+W0102 15:04:05.000000   12345 conversion.go:756]   the following fields need manual conversion:
+W0102 15:04:05.000000   12345 conversion.go:758]       - Selector
+I0102 15:04:06.000000   12345 main.go:104] Completed successfully.
+`
+
+func Test_parseManualConversions(t *testing.T) {
+	got := parseManualConversions(conversionGenOutput)
+	assert.Len(t, got, 2)
+	assert.Equal(t, "Convert_v1_FooSpec_To_apps_FooSpec", got[0].funcName())
+	assert.Equal(t, []string{"Selector"}, got[0].fields)
+	assert.Equal(t, "Convert_apps_FooSpec_To_v1_FooSpec", got[1].funcName())
+	assert.Equal(t, []string{"Selector"}, got[1].fields)
+
+	assert.Empty(t, parseManualConversions("I0102 15:04:06.000000   12345 main.go:104] Completed successfully.\n"))
+
+	// conversion-gen v0.20.2 logs them by klog.Errorf with a Warning prefix
+	got = parseManualConversions("E0102 15:04:05.000000   12345 conversion.go:755] Warning: could not find nor generate a final Conversion function for github.com/example/project/pkg/apis/apps/v1.FooSpec -> github.com/example/project/pkg/apis/apps.FooSpec\n" +
+		"E0102 15:04:05.000000   12345 conversion.go:756]   the following fields need manual conversion:\n" +
+		"E0102 15:04:05.000000   12345 conversion.go:758]       - Selector\n")
+	assert.Len(t, got, 1)
+	assert.Equal(t, []string{"Selector"}, got[0].fields)
+}
+
+func Test_scaffoldManualConversions(t *testing.T) {
+	dir := t.TempDir()
+	c := newTestCodeGenerator()
+	c.workspace = dir
+	c.boilerplatePath = filepath.Join(dir, "boilerplate.go.txt")
+	writeTestFiles(t, dir, map[string]string{
+		"boilerplate.go.txt":           "// Copyright YEAR The Authors.\n",
+		"pkg/apis/apps/v1/types.go":    "package v1\n",
+		"pkg/apis/apps/types.go":       "package apps\n",
+		"pkg/apis/batch/v1/convert.go": "package v1\n",
+	})
+
+	assert.NoError(t, c.scaffoldManualConversions(conversionGenOutput))
+	data, err := os.ReadFile(filepath.Join(dir, "pkg/apis/apps/v1/conversion.go"))
+	assert.NoError(t, err)
+	got := string(data)
+	assert.Contains(t, got, "package v1\n")
+	assert.Contains(t, got, `apps "github.com/example/project/pkg/apis/apps"`)
+	assert.Contains(t, got, "func Convert_v1_FooSpec_To_apps_FooSpec(in *FooSpec, out *apps.FooSpec, s conversion.Scope) error {\n\t// TODO: convert fields requiring manual conversion: Selector\n\treturn autoConvert_v1_FooSpec_To_apps_FooSpec(in, out, s)\n}")
+	assert.Contains(t, got, "func Convert_apps_FooSpec_To_v1_FooSpec(in *apps.FooSpec, out *FooSpec, s conversion.Scope) error {")
+	// internal package is not touched
+	_, err = os.Stat(filepath.Join(dir, "pkg/apis/apps/conversion.go"))
+	assert.True(t, os.IsNotExist(err))
+
+	// existing functions are kept
+	assert.NoError(t, c.scaffoldManualConversions(conversionGenOutput))
+	data, err = os.ReadFile(filepath.Join(dir, "pkg/apis/apps/v1/conversion.go"))
+	assert.NoError(t, err)
+	assert.Equal(t, got, string(data))
+	assert.Equal(t, 1, strings.Count(string(data), "func Convert_v1_FooSpec_To_apps_FooSpec("))
+}
+
+func Test_scaffoldManualConversions_mergeImports(t *testing.T) {
+	dir := t.TempDir()
+	c := newTestCodeGenerator()
+	c.workspace = dir
+	c.boilerplatePath = filepath.Join(dir, "boilerplate.go.txt")
+	existing := `package v1
+
+import (
+	"fmt"
+
+	internal "github.com/example/project/pkg/apis/apps"
+)
+
+func describe(in *internal.FooSpec) string { return fmt.Sprint(in) }
+`
+	writeTestFiles(t, dir, map[string]string{
+		"boilerplate.go.txt":             "// Copyright YEAR The Authors.\n",
+		"pkg/apis/apps/v1/conversion.go": existing,
+	})
+
+	assert.NoError(t, c.scaffoldManualConversions(conversionGenOutput))
+	data, err := os.ReadFile(filepath.Join(dir, "pkg/apis/apps/v1/conversion.go"))
+	assert.NoError(t, err)
+	got := string(data)
+	_, err = parser.ParseFile(token.NewFileSet(), "", data, 0)
+	assert.NoError(t, err)
+	// existing import name is reused, and missing imports are added
+	assert.Contains(t, got, "import (\n\t\"fmt\"\n\n\tinternal \"github.com/example/project/pkg/apis/apps\"\n\tconversion \"k8s.io/apimachinery/pkg/conversion\"\n)\n")
+	assert.NotContains(t, got, `apps "github.com/example/project/pkg/apis/apps"`)
+	assert.Contains(t, got, "func Convert_v1_FooSpec_To_apps_FooSpec(in *FooSpec, out *internal.FooSpec, s conversion.Scope) error {")
+	assert.Contains(t, got, "func describe(in *internal.FooSpec) string { return fmt.Sprint(in) }")
+}
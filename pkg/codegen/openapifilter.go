@@ -0,0 +1,244 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// openapiFileBase is the default output file base of openapi-gen.
+const openapiFileBase = "openapi_generated"
+
+// filterOpenapi retains definitions of openapiOnlyTypes and the types they
+// reference transitively in GetOpenAPIDefinitions generated in file.
+func (c *CodeGenerator) filterOpenapi(file string) error {
+	if len(c.openapiOnlyTypes) == 0 {
+		return nil
+	}
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	filtered, retained, err := filterOpenapiDefinitions(content, c.openapiOnlyTypes)
+	if err != nil {
+		return fmt.Errorf("failed to filter openapi definitions in %v: %v", file, err)
+	}
+	c.logger.Info("filtering openapi definitions", "file", file, "types", strings.Join(c.openapiOnlyTypes, ","), "retained", retained)
+	return writeGoFile(file, filtered)
+}
+
+// filterOpenapiDefinitions rewrites content of openapi-gen output to retain
+// only definitions of types and the types they reference transitively, e.g.
+// github.com/example/project/pkg/apis/apps/v1.Foo. Schema functions of
+// dropped definitions are removed. It returns the number of retained
+// definitions, and error if any of types is not defined in content. Imports
+// only used by the removed functions are removed as well.
+func filterOpenapiDefinitions(content []byte, types []string) ([]byte, int, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", content, parser.ParseComments)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defs, err := openapiDefinitionsLit(file)
+	if err != nil {
+		return nil, 0, err
+	}
+	// definition name -> schema function name
+	schemaFuncs := map[string]string{}
+	for _, elt := range defs.Elts {
+		name, fn, ok := openapiDefinitionEntry(elt)
+		if ok {
+			schemaFuncs[name] = fn
+		}
+	}
+	funcDecls := map[string]*ast.FuncDecl{}
+	for _, decl := range file.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil {
+			funcDecls[fn.Name.Name] = fn
+		}
+	}
+
+	retained := map[string]bool{}
+	queue := []string{}
+	for _, t := range types {
+		if _, ok := schemaFuncs[t]; !ok {
+			return nil, 0, fmt.Errorf("type %v is not found in openapi definitions", t)
+		}
+		queue = append(queue, t)
+	}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		if retained[name] {
+			continue
+		}
+		retained[name] = true
+		if fn := funcDecls[schemaFuncs[name]]; fn != nil {
+			for _, dep := range openapiReferences(fn) {
+				// types out of input dirs are not defined
+				if _, ok := schemaFuncs[dep]; ok {
+					queue = append(queue, dep)
+				}
+			}
+		}
+	}
+
+	elts := []ast.Expr{}
+	dropped := map[string]bool{}
+	for _, elt := range defs.Elts {
+		name, fn, ok := openapiDefinitionEntry(elt)
+		if ok && !retained[name] {
+			dropped[fn] = true
+			continue
+		}
+		elts = append(elts, elt)
+	}
+	defs.Elts = elts
+
+	decls := []ast.Decl{}
+	removed := []ast.Node{}
+	for _, decl := range file.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil && dropped[fn.Name.Name] {
+			removed = append(removed, fn)
+			continue
+		}
+		decls = append(decls, decl)
+	}
+	file.Decls = decls
+	file.Comments = commentsOutside(file.Comments, removed)
+	// packages are imported for OpenAPISchemaType of their types in schema
+	// functions, e.g. resource.Quantity
+	deleteUnusedImports(fset, file)
+
+	buf := &bytes.Buffer{}
+	if err := format.Node(buf, fset, file); err != nil {
+		return nil, 0, err
+	}
+	return buf.Bytes(), len(retained), nil
+}
+
+// openapiDefinitionsLit returns the map literal returned by GetOpenAPIDefinitions.
+func openapiDefinitionsLit(file *ast.File) (*ast.CompositeLit, error) {
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Recv != nil || fn.Name.Name != "GetOpenAPIDefinitions" || fn.Body == nil {
+			continue
+		}
+		for _, stmt := range fn.Body.List {
+			ret, ok := stmt.(*ast.ReturnStmt)
+			if !ok || len(ret.Results) != 1 {
+				continue
+			}
+			if lit, ok := ret.Results[0].(*ast.CompositeLit); ok {
+				return lit, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("GetOpenAPIDefinitions returning a map literal is not found")
+}
+
+// openapiDefinitionEntry returns the definition name and schema function name
+// of entry "<name>": <fn>(ref) in the map of GetOpenAPIDefinitions.
+func openapiDefinitionEntry(elt ast.Expr) (string, string, bool) {
+	kv, ok := elt.(*ast.KeyValueExpr)
+	if !ok {
+		return "", "", false
+	}
+	key, ok := kv.Key.(*ast.BasicLit)
+	if !ok || key.Kind != token.STRING {
+		return "", "", false
+	}
+	name, err := strconv.Unquote(key.Value)
+	if err != nil {
+		return "", "", false
+	}
+	call, ok := kv.Value.(*ast.CallExpr)
+	if !ok {
+		return "", "", false
+	}
+	fn, ok := call.Fun.(*ast.Ident)
+	if !ok {
+		return "", "", false
+	}
+	return name, fn.Name, true
+}
+
+// openapiReferences returns sorted definition names referenced by schema
+// function fn, by ref("<name>") calls and Dependencies.
+func openapiReferences(fn *ast.FuncDecl) []string {
+	refs := map[string]bool{}
+	addStrings := func(exprs []ast.Expr) {
+		for _, expr := range exprs {
+			if lit, ok := expr.(*ast.BasicLit); ok && lit.Kind == token.STRING {
+				if s, err := strconv.Unquote(lit.Value); err == nil {
+					refs[s] = true
+				}
+			}
+		}
+	}
+	ast.Inspect(fn, func(n ast.Node) bool {
+		switch x := n.(type) {
+		case *ast.CallExpr:
+			if ident, ok := x.Fun.(*ast.Ident); ok && ident.Name == "ref" {
+				addStrings(x.Args)
+			}
+		case *ast.KeyValueExpr:
+			if ident, ok := x.Key.(*ast.Ident); ok && ident.Name == "Dependencies" {
+				if lit, ok := x.Value.(*ast.CompositeLit); ok {
+					addStrings(lit.Elts)
+				}
+			}
+		}
+		return true
+	})
+	names := make([]string, 0, len(refs))
+	for name := range refs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// commentsOutside returns comments not within any of nodes.
+func commentsOutside(comments []*ast.CommentGroup, nodes []ast.Node) []*ast.CommentGroup {
+	kept := []*ast.CommentGroup{}
+	for _, cg := range comments {
+		inside := false
+		for _, n := range nodes {
+			start := n.Pos()
+			if fn, ok := n.(*ast.FuncDecl); ok && fn.Doc != nil {
+				start = fn.Doc.Pos()
+			}
+			if cg.Pos() >= start && cg.End() <= n.End() {
+				inside = true
+				break
+			}
+		}
+		if !inside {
+			kept = append(kept, cg)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,240 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testOpenapiGenerated = `// Code generated by openapi-gen. DO NOT EDIT.
+
+package openapi
+
+import (
+	spec "github.com/go-openapi/spec"
+	common "k8s.io/kube-openapi/pkg/common"
+)
+
+func GetOpenAPIDefinitions(ref common.ReferenceCallback) map[string]common.OpenAPIDefinition {
+	return map[string]common.OpenAPIDefinition{
+		"github.com/example/project/pkg/apis/apps/v1.Bar":     schema_pkg_apis_apps_v1_Bar(ref),
+		"github.com/example/project/pkg/apis/apps/v1.Foo":     schema_pkg_apis_apps_v1_Foo(ref),
+		"github.com/example/project/pkg/apis/apps/v1.FooSpec": schema_pkg_apis_apps_v1_FooSpec(ref),
+		"k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta":     schema_pkg_apis_meta_v1_ObjectMeta(ref),
+		"k8s.io/apimachinery/pkg/apis/meta/v1.Time":           schema_pkg_apis_meta_v1_Time(ref),
+	}
+}
+
+// schema_pkg_apis_apps_v1_Bar is unrelated to Foo.
+func schema_pkg_apis_apps_v1_Bar(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Properties: map[string]spec.Schema{
+					"created": {
+						SchemaProps: spec.SchemaProps{
+							Ref: ref("k8s.io/apimachinery/pkg/apis/meta/v1.Time"),
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{
+			"k8s.io/apimachinery/pkg/apis/meta/v1.Time"},
+	}
+}
+
+func schema_pkg_apis_apps_v1_Foo(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Properties: map[string]spec.Schema{
+					"metadata": {
+						SchemaProps: spec.SchemaProps{
+							Ref: ref("k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"),
+						},
+					},
+					"spec": {
+						SchemaProps: spec.SchemaProps{
+							Ref: ref("github.com/example/project/pkg/apis/apps/v1.FooSpec"),
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{
+			"github.com/example/project/pkg/apis/apps/v1.FooSpec", "k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"},
+	}
+}
+
+func schema_pkg_apis_apps_v1_FooSpec(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Properties: map[string]spec.Schema{
+					"replicas": {
+						SchemaProps: spec.SchemaProps{
+							Type: []string{"integer"},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func schema_pkg_apis_meta_v1_ObjectMeta(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Properties: map[string]spec.Schema{
+					"name": {
+						SchemaProps: spec.SchemaProps{
+							Type: []string{"string"},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func schema_pkg_apis_meta_v1_Time(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Type:   []string{"string"},
+				Format: "date-time",
+			},
+		},
+	}
+}
+`
+
+func Test_filterOpenapiDefinitions(t *testing.T) {
+	tests := []struct {
+		name     string
+		types    []string
+		wantDefs []string
+		wantErr  bool
+	}{
+		{
+			name:  "transitive references",
+			types: []string{"github.com/example/project/pkg/apis/apps/v1.Foo"},
+			wantDefs: []string{
+				"github.com/example/project/pkg/apis/apps/v1.Foo",
+				"github.com/example/project/pkg/apis/apps/v1.FooSpec",
+				"k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta",
+			},
+		},
+		{
+			name: "multiple types",
+			types: []string{
+				"github.com/example/project/pkg/apis/apps/v1.FooSpec",
+				"github.com/example/project/pkg/apis/apps/v1.Bar",
+			},
+			wantDefs: []string{
+				"github.com/example/project/pkg/apis/apps/v1.Bar",
+				"github.com/example/project/pkg/apis/apps/v1.FooSpec",
+				"k8s.io/apimachinery/pkg/apis/meta/v1.Time",
+			},
+		},
+		{
+			name:    "unknown type",
+			types:   []string{"github.com/example/project/pkg/apis/apps/v1.Baz"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, retained, err := filterOpenapiDefinitions([]byte(testOpenapiGenerated), tt.types)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, len(tt.wantDefs), retained)
+
+			file, err := parser.ParseFile(token.NewFileSet(), "", got, parser.ParseComments)
+			if !assert.NoError(t, err) {
+				return
+			}
+			defs, err := openapiDefinitionsLit(file)
+			if !assert.NoError(t, err) {
+				return
+			}
+			keys := map[string]string{}
+			for _, elt := range defs.Elts {
+				name, fn, ok := openapiDefinitionEntry(elt)
+				if assert.True(t, ok) {
+					keys[name] = fn
+				}
+			}
+			gotDefs := []string{}
+			for name := range keys {
+				gotDefs = append(gotDefs, name)
+			}
+			assert.ElementsMatch(t, tt.wantDefs, gotDefs)
+
+			funcs := map[string]*ast.FuncDecl{}
+			for _, decl := range file.Decls {
+				if fn, ok := decl.(*ast.FuncDecl); ok && fn.Name.Name != "GetOpenAPIDefinitions" {
+					funcs[fn.Name.Name] = fn
+				}
+			}
+			assert.Len(t, funcs, len(tt.wantDefs))
+			for name, fn := range keys {
+				decl, ok := funcs[fn]
+				if !assert.True(t, ok, "schema function of %v is removed", name) {
+					continue
+				}
+				// all references of retained definitions must resolve
+				for _, ref := range openapiReferences(decl) {
+					assert.Contains(t, keys, ref)
+				}
+			}
+			if _, ok := funcs["schema_pkg_apis_apps_v1_Bar"]; !ok {
+				for _, cg := range file.Comments {
+					assert.NotContains(t, cg.Text(), "unrelated", "comments of removed functions must be dropped")
+				}
+			}
+		})
+	}
+}
+
+func Test_filterOpenapiDefinitions_imports(t *testing.T) {
+	// generated by openapi-gen of k8s.io/kube-openapi pinned by this module
+	content, err := ioutil.ReadFile("testdata/openapi/openapi_generated.go")
+	assert.NoError(t, err)
+	got, retained, err := filterOpenapiDefinitions(content, []string{"github.com/example/project/pkg/apis/web/v1.Foo"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, retained)
+	// only used by schema functions of Quantity and IntOrString
+	assert.NotContains(t, string(got), `"k8s.io/apimachinery/pkg/api/resource"`)
+	assert.NotContains(t, string(got), `"k8s.io/apimachinery/pkg/util/intstr"`)
+
+	c := newTestWorkspaceGenerator(t, map[string]string{
+		"pkg/apis/generated/openapi/openapi_generated.go": string(got),
+	})
+	goBuild(t, c, "./pkg/apis/generated/openapi/")
+}
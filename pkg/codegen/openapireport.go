@@ -0,0 +1,86 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+)
+
+const (
+	OpenapiReportFormatText = "text"
+	OpenapiReportFormatJSON = "json"
+
+	// openapiViolationPrefix is the prefix of each line in violations report,
+	// e.g. API rule violation: names_match,<package>,<Type>,<Field>
+	openapiViolationPrefix = "API rule violation: "
+)
+
+// OpenapiViolation is an API rule violation reported by openapi-gen.
+type OpenapiViolation struct {
+	// Type is the go type violating the rule in <package>.<Type> form.
+	Type string `json:"type"`
+	// Rule is the name of the API rule, e.g. names_match.
+	Rule string `json:"rule"`
+	// Message is the violation line in the report.
+	Message string `json:"message"`
+}
+
+// convertOpenapiReport rewrites the plain-text violations report written by
+// openapi-gen in the report format.
+func (c *CodeGenerator) convertOpenapiReport(report string) error {
+	if c.openapiReportFormat != OpenapiReportFormatJSON {
+		return nil
+	}
+	content, err := ioutil.ReadFile(report)
+	if err != nil {
+		return err
+	}
+	converted, err := openapiReportJSON(content)
+	if err != nil {
+		return err
+	}
+	c.logger.Info("converting openapi violations report", "file", report, "format", c.openapiReportFormat)
+	return ioutil.WriteFile(report, converted, 0644)
+}
+
+// openapiReportJSON converts the line-oriented violations report content to
+// a JSON array of OpenapiViolation. Lines not in the API rule violation form
+// are kept as messages without type and rule.
+func openapiReportJSON(content []byte) ([]byte, error) {
+	violations := []OpenapiViolation{}
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		v := OpenapiViolation{Message: line}
+		if strings.HasPrefix(line, openapiViolationPrefix) {
+			// <rule>,<package>,<Type>,<Field>
+			fields := strings.SplitN(strings.TrimPrefix(line, openapiViolationPrefix), ",", 4)
+			if len(fields) >= 3 {
+				v.Rule = fields[0]
+				v.Type = fields[1] + "." + fields[2]
+			}
+		}
+		violations = append(violations, v)
+	}
+	out, err := json.MarshalIndent(violations, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
@@ -0,0 +1,75 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testOpenapiReport = `API rule violation: list_type_missing,github.com/example/project/pkg/apis/apps/v1,FooSpec,Ports
+API rule violation: names_match,github.com/example/project/pkg/apis/apps/v1,FooSpec,URL
+unexpected line
+`
+
+func Test_openapiReportJSON(t *testing.T) {
+	got, err := openapiReportJSON([]byte(testOpenapiReport))
+	assert.NoError(t, err)
+	violations := []OpenapiViolation{}
+	assert.NoError(t, json.Unmarshal(got, &violations))
+	assert.Equal(t, []OpenapiViolation{
+		{
+			Type:    "github.com/example/project/pkg/apis/apps/v1.FooSpec",
+			Rule:    "list_type_missing",
+			Message: "API rule violation: list_type_missing,github.com/example/project/pkg/apis/apps/v1,FooSpec,Ports",
+		},
+		{
+			Type:    "github.com/example/project/pkg/apis/apps/v1.FooSpec",
+			Rule:    "names_match",
+			Message: "API rule violation: names_match,github.com/example/project/pkg/apis/apps/v1,FooSpec,URL",
+		},
+		{
+			Message: "unexpected line",
+		},
+	}, violations)
+
+	// empty report
+	got, err = openapiReportJSON(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "[]\n", string(got))
+}
+
+func Test_convertOpenapiReport(t *testing.T) {
+	report := filepath.Join(t.TempDir(), "violations.report")
+	assert.NoError(t, ioutil.WriteFile(report, []byte(testOpenapiReport), 0644))
+
+	// text is kept by default
+	c := newTestCodeGenerator()
+	assert.NoError(t, c.convertOpenapiReport(report))
+	got, err := ioutil.ReadFile(report)
+	assert.NoError(t, err)
+	assert.Equal(t, testOpenapiReport, string(got))
+
+	c.WithOpenapiReportFormat(OpenapiReportFormatJSON)
+	assert.NoError(t, c.convertOpenapiReport(report))
+	got, err = ioutil.ReadFile(report)
+	assert.NoError(t, err)
+	assert.Contains(t, string(got), `"rule": "names_match"`)
+	assert.Contains(t, string(got), `"type": "github.com/example/project/pkg/apis/apps/v1.FooSpec"`)
+}
@@ -0,0 +1,76 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path"
+	"text/template"
+)
+
+var docTemplate = template.Must(template.New("doc").Parse(`{{ .Header }}
+// Code generated by kube-codegen. DO NOT EDIT.
+
+// Package {{ .Package }} {{ .Summary }}
+package {{ .Package }}
+`))
+
+// genDoc generates doc.go with package documentation in output dir if
+// genDocs is enabled. client-gen writes doc.go of clientset already, only its
+// package comment is rewritten so that its header is kept.
+func (c *CodeGenerator) genDoc(dir, summary string) error {
+	if !c.genDocs {
+		return nil
+	}
+	docFile := path.Join(dir, "doc.go")
+	content, err := ioutil.ReadFile(docFile)
+	if os.IsNotExist(err) {
+		c.logger.Info("generating doc", "file", docFile)
+		return c.writeHelperFile(dir, "doc.go", docTemplate, map[string]interface{}{
+			"Summary": summary,
+		})
+	}
+	if err != nil {
+		return err
+	}
+	rewritten, err := rewritePackageComment(content, "// Package "+goPackageName(dir)+" "+summary)
+	if err != nil {
+		return err
+	}
+	c.logger.Info("rewriting package comment of doc", "file", docFile)
+	return ioutil.WriteFile(docFile, rewritten, 0644)
+}
+
+// rewritePackageComment replaces the doc comment of package clause in go file
+// content with comment, or inserts it if there is none.
+func rewritePackageComment(content []byte, comment string) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", content, parser.PackageClauseOnly|parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	file := fset.File(f.Package)
+	start, end := file.Offset(f.Package), file.Offset(f.Package)
+	if f.Doc != nil {
+		start, end = file.Offset(f.Doc.Pos()), file.Offset(f.Doc.End())+1
+	}
+	ret := make([]byte, 0, len(content)+len(comment))
+	ret = append(ret, content[:start]...)
+	ret = append(ret, comment+"\n"...)
+	return append(ret, content[end:]...), nil
+}
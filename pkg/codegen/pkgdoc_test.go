@@ -0,0 +1,83 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"go/format"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testClientsetDoc is doc.go written by client-gen in clientset dir.
+const testClientsetDoc = `// Copyright 2022 The Authors.
+
+// Code generated by client-gen. DO NOT EDIT.
+
+// This package has the automatically generated clientset.
+package kubernetes
+`
+
+func Test_genDoc(t *testing.T) {
+	tmp := t.TempDir()
+	c := newTestCodeGenerator()
+	c.boilerplatePath = filepath.Join(tmp, "boilerplate.go.txt")
+	c.WithSourceDateEpoch(1640995200)
+	assert.NoError(t, ioutil.WriteFile(c.boilerplatePath, []byte("// Copyright YEAR The Authors.\n"), 0644))
+	clientset := filepath.Join(tmp, "pkg/clients/kubernetes")
+	writeTestFiles(t, clientset, map[string]string{"doc.go": testClientsetDoc})
+
+	// not generated by default
+	listers := filepath.Join(tmp, "pkg/clients/listers")
+	assert.NoError(t, c.genDoc(listers, "contains the automatically generated listers."))
+	assert.NoFileExists(t, filepath.Join(listers, "doc.go"))
+
+	c.WithGenDocs(true)
+	tests := []struct {
+		dir     string
+		summary string
+		want    string
+	}{
+		{
+			// header of client-gen is kept
+			dir:     clientset,
+			summary: "has the automatically generated clientset.",
+			want:    "// Copyright 2022 The Authors.\n\n// Code generated by client-gen. DO NOT EDIT.\n\n// Package kubernetes has the automatically generated clientset.\npackage kubernetes\n",
+		},
+		{
+			dir:     listers,
+			summary: "contains the automatically generated listers.",
+			want:    "// Copyright 2022 The Authors.\n\n// Code generated by kube-codegen. DO NOT EDIT.\n\n// Package listers contains the automatically generated listers.\npackage listers\n",
+		},
+		{
+			dir:     filepath.Join(tmp, "pkg/clients/informers"),
+			summary: "contains the automatically generated shared informers.",
+			want:    "// Copyright 2022 The Authors.\n\n// Code generated by kube-codegen. DO NOT EDIT.\n\n// Package informers contains the automatically generated shared informers.\npackage informers\n",
+		},
+	}
+	for _, tt := range tests {
+		assert.NoError(t, c.genDoc(tt.dir, tt.summary))
+		// generating again does not change it
+		assert.NoError(t, c.genDoc(tt.dir, tt.summary))
+		got, err := ioutil.ReadFile(filepath.Join(tt.dir, "doc.go"))
+		assert.NoError(t, err)
+		assert.Equal(t, tt.want, string(got))
+		formatted, err := format.Source(got)
+		assert.NoError(t, err)
+		assert.Equal(t, string(formatted), string(got))
+	}
+}
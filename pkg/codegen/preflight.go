@@ -0,0 +1,113 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// preflightInformer builds the clientset and listers packages informer-gen
+// generates informers against, so that informers are not generated for
+// clientset or listers that do not compile, e.g. in vendored repos whose
+// vendor tree misses their dependencies.
+//
+// Files just generated in outputBase are built in place of the ones in
+// workspace via go build -overlay.
+func (c *CodeGenerator) preflightInformer() error {
+	if !c.verifyBuild {
+		return nil
+	}
+	args := []string{"build"}
+	if !c.inPlace {
+		overlay, err := c.informerPreflightOverlay()
+		if err != nil {
+			return err
+		}
+		if len(overlay) > 0 {
+			file, err := writeOverlayFile(overlay)
+			if err != nil {
+				return err
+			}
+			defer os.Remove(file)
+			args = append(args, "-overlay", file)
+		}
+	}
+	for _, dir := range []string{c.clientsetDirName, c.listerDirName} {
+		args = append(args, "./"+path.Join(c.clientPath, dir, "..."))
+	}
+	c.logger.Info("verifying informer-gen dependencies build", "args", strings.Join(args, " "))
+	out, err := c.goCmd.RunCombinedOutput(args...)
+	if err != nil {
+		return fmt.Errorf("clientset or listers for informer-gen do not compile, "+
+			"make sure client and lister are generated and their dependencies are vendored (go mod vendor): %v\n%s", err, out)
+	}
+	return nil
+}
+
+// informerPreflightOverlay returns the go build overlay replacing go files in
+// workspace with all the ones generated in outputBase, e.g. clientset and
+// listers along with deepcopy and register of apis they depend on.
+func (c *CodeGenerator) informerPreflightOverlay() (map[string]string, error) {
+	overlay := map[string]string{}
+	generated := path.Join(c.outputBase, c.workspaceModule)
+	err := filepath.WalkDir(generated, func(file string, d fs.DirEntry, err error) error {
+		if os.IsNotExist(err) && file == generated {
+			// not generated in this run
+			return fs.SkipDir
+		}
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(file) != ".go" {
+			return nil
+		}
+		rel, err := filepath.Rel(generated, file)
+		if err != nil {
+			return err
+		}
+		overlay[filepath.Join(c.workspace, rel)] = file
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return overlay, nil
+}
+
+// writeOverlayFile writes overlay to a temporary file in go build -overlay
+// format and returns its path.
+func writeOverlayFile(overlay map[string]string) (string, error) {
+	data, err := json.Marshal(map[string]interface{}{"Replace": overlay})
+	if err != nil {
+		return "", err
+	}
+	f, err := ioutil.TempFile("", "kube-codegen-overlay-*.json")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := f.Write(data); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
@@ -0,0 +1,74 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zoumo/make-rules/pkg/runner"
+)
+
+func Test_informerPreflightOverlay(t *testing.T) {
+	c := newTestCodeGenerator()
+	c.workspace = t.TempDir()
+	c.outputBase = filepath.Join(c.workspace, "__output", "generated")
+	generated := filepath.Join(c.outputBase, "github.com/example/project/pkg/clients")
+	writeTestFiles(t, c.outputBase, map[string]string{
+		// clientset and listers depend on generated apis
+		"github.com/example/project/pkg/apis/apps/v1/zz_generated.deepcopy.go": "package v1\n",
+		"github.com/example/project/pkg/apis/apps/v1/zz_generated.register.go": "package v1\n",
+	})
+	writeTestFiles(t, generated, map[string]string{
+		"kubernetes/clientset.go":           "package kubernetes\n",
+		"kubernetes/typed/apps/v1/foo.go":   "package v1\n",
+		"listers/apps/v1/foo.go":            "package v1\n",
+		"listers/apps/v1/README.md":         "listers\n",
+		"informers/externalversions/doc.go": "package externalversions\n",
+	})
+
+	overlay, err := c.informerPreflightOverlay()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		filepath.Join(c.workspace, "pkg/apis/apps/v1/zz_generated.deepcopy.go"):     filepath.Join(c.outputBase, "github.com/example/project/pkg/apis/apps/v1/zz_generated.deepcopy.go"),
+		filepath.Join(c.workspace, "pkg/apis/apps/v1/zz_generated.register.go"):     filepath.Join(c.outputBase, "github.com/example/project/pkg/apis/apps/v1/zz_generated.register.go"),
+		filepath.Join(c.workspace, "pkg/clients/kubernetes/clientset.go"):           filepath.Join(generated, "kubernetes/clientset.go"),
+		filepath.Join(c.workspace, "pkg/clients/kubernetes/typed/apps/v1/foo.go"):   filepath.Join(generated, "kubernetes/typed/apps/v1/foo.go"),
+		filepath.Join(c.workspace, "pkg/clients/listers/apps/v1/foo.go"):            filepath.Join(generated, "listers/apps/v1/foo.go"),
+		filepath.Join(c.workspace, "pkg/clients/informers/externalversions/doc.go"): filepath.Join(generated, "informers/externalversions/doc.go"),
+	}, overlay)
+
+	// nothing generated in this run
+	c.outputBase = filepath.Join(c.workspace, "__output", "missing")
+	overlay, err = c.informerPreflightOverlay()
+	assert.NoError(t, err)
+	assert.Empty(t, overlay)
+}
+
+func Test_preflightInformer_generatedApis(t *testing.T) {
+	c := newTestWorkspaceGenerator(t, map[string]string{
+		"pkg/apis/apps/v1/types.go": "package v1\n\nimport metav1 \"k8s.io/apimachinery/pkg/apis/meta/v1\"\n\ntype Foo struct {\n\tmetav1.TypeMeta\n}\n",
+	})
+	c.goCmd = runner.NewRunner("go").WithDir(c.workspace).WithEnvs("GOFLAGS", "-mod=mod")
+	c.WithVerifyBuild(true)
+	writeTestFiles(t, filepath.Join(c.outputBase, c.workspaceModule), map[string]string{
+		// deepcopy of apis is only generated in this run
+		"pkg/apis/apps/v1/zz_generated.deepcopy.go": "package v1\n\nimport \"k8s.io/apimachinery/pkg/runtime\"\n\nfunc (in *Foo) DeepCopyObject() runtime.Object {\n\tout := *in\n\treturn &out\n}\n",
+		"pkg/clients/kubernetes/clientset.go":       "package kubernetes\n",
+		"pkg/clients/listers/apps/v1/foo.go":        "package v1\n\nimport (\n\tv1 \"github.com/example/project/pkg/apis/apps/v1\"\n\t\"k8s.io/apimachinery/pkg/runtime\"\n)\n\nvar _ runtime.Object = &v1.Foo{}\n",
+	})
+	assert.NoError(t, c.preflightInformer())
+}
@@ -0,0 +1,69 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"path"
+	"text/template"
+)
+
+var clientRateLimitTemplate = template.Must(template.New("ratelimit").Parse(`{{ .Header }}
+// Code generated by kube-codegen. DO NOT EDIT.
+
+package {{ .Package }}
+
+import (
+	rest "k8s.io/client-go/rest"
+	flowcontrol "k8s.io/client-go/util/flowcontrol"
+)
+
+// ConfigWithRateLimiter returns a copy of c whose requests are throttled by rateLimiter.
+func ConfigWithRateLimiter(c *rest.Config, rateLimiter flowcontrol.RateLimiter) *rest.Config {
+	config := rest.CopyConfig(c)
+	config.RateLimiter = rateLimiter
+	return config
+}
+
+// ConfigWithRateLimit returns a copy of c whose requests are throttled by a
+// token bucket rate limiter with qps and burst.
+func ConfigWithRateLimit(c *rest.Config, qps float32, burst int) *rest.Config {
+	config := ConfigWithRateLimiter(c, flowcontrol.NewTokenBucketRateLimiter(qps, burst))
+	config.QPS = qps
+	config.Burst = burst
+	return config
+}
+
+// NewForConfigWithRateLimiter creates a new Clientset for the given config whose requests are throttled by rateLimiter.
+func NewForConfigWithRateLimiter(c *rest.Config, rateLimiter flowcontrol.RateLimiter) (*Clientset, error) {
+	return NewForConfig(ConfigWithRateLimiter(c, rateLimiter))
+}
+
+// NewForConfigWithRateLimit creates a new Clientset for the given config whose requests are throttled
+// by a token bucket rate limiter with qps and burst.
+func NewForConfigWithRateLimit(c *rest.Config, qps float32, burst int) (*Clientset, error) {
+	return NewForConfig(ConfigWithRateLimit(c, qps, burst))
+}
+`))
+
+// genClientRateLimit generates ratelimit.go in clientset dir with helpers
+// building clientset with a rate limiter.
+func (c *CodeGenerator) genClientRateLimit(dir string) error {
+	if !c.genRateLimit {
+		return nil
+	}
+	rateLimitFile := path.Join(dir, "ratelimit.go")
+	c.logger.Info("generating client rate limit", "file", rateLimitFile)
+	return c.writeHelperFile(dir, "ratelimit.go", clientRateLimitTemplate, nil)
+}
@@ -0,0 +1,133 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_genRegister_localSchemeBuilder(t *testing.T) {
+	c := newTestWorkspaceGenerator(t, map[string]string{
+		"pkg/apis/apps/v1/doc.go": "// +groupName=apps.example.com\npackage v1\n",
+		"pkg/apis/apps/v1/types.go": `package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	runtime "k8s.io/apimachinery/pkg/runtime"
+)
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+type Foo struct {
+	metav1.TypeMeta ` + "`json:\",inline\"`" + `
+	Replicas        int ` + "`json:\"replicas\"`" + `
+}
+
+func (in *Foo) DeepCopyObject() runtime.Object {
+	out := *in
+	return &out
+}
+`,
+		// batch/v1 only uses the generated SchemeBuilder
+		"pkg/apis/batch/v1/doc.go": "// +groupName=batch.example.com\npackage v1\n",
+		"pkg/apis/batch/v1/types.go": `package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	runtime "k8s.io/apimachinery/pkg/runtime"
+)
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+type Bar struct {
+	metav1.TypeMeta ` + "`json:\",inline\"`" + `
+}
+
+func (in *Bar) DeepCopyObject() runtime.Object {
+	out := *in
+	return &out
+}
+`,
+		// hand-written defaults of apps/v1 register into localSchemeBuilder
+		"pkg/apis/apps/v1/defaults.go": `package v1
+
+import runtime "k8s.io/apimachinery/pkg/runtime"
+
+func init() {
+	localSchemeBuilder.Register(func(scheme *runtime.Scheme) error {
+		scheme.AddTypeDefaultingFunc(&Foo{}, func(obj interface{}) { obj.(*Foo).Replicas = 1 })
+		return nil
+	})
+}
+`,
+		"cmd/check/main.go": `package main
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	appsv1 "github.com/example/project/pkg/apis/apps/v1"
+	batchv1 "github.com/example/project/pkg/apis/batch/v1"
+)
+
+func main() {
+	scheme := runtime.NewScheme()
+	if err := appsv1.AddToScheme(scheme); err != nil {
+		panic(err)
+	}
+	if err := batchv1.AddToScheme(scheme); err != nil {
+		panic(err)
+	}
+	foo := &appsv1.Foo{}
+	scheme.Default(foo)
+	fmt.Println(scheme.Recognizes(appsv1.SchemeGroupVersion.WithKind("Foo")), foo.Replicas)
+	fmt.Println(scheme.Recognizes(batchv1.SchemeGroupVersion.WithKind("Bar")))
+}
+`,
+	})
+	c.inputPackages = []string{
+		"github.com/example/project/pkg/apis/apps/v1",
+		"github.com/example/project/pkg/apis/batch/v1",
+	}
+	run := testGeneratorRunner(t, c, "register")
+	assert.NoError(t, c.genRegister(c.logger, run))
+
+	// register-gen declares localSchemeBuilder pointing to SchemeBuilder in
+	// every package, whether hand-written files use it or not
+	for _, pkg := range []string{"pkg/apis/apps/v1", "pkg/apis/batch/v1"} {
+		content, err := ioutil.ReadFile(filepath.Join(c.outputBase, "github.com/example/project", pkg, "zz_generated.register.go"))
+		assert.NoError(t, err)
+		got := string(content)
+		assert.Regexp(t, `SchemeBuilder\s+runtime.SchemeBuilder\n`, got)
+		assert.Regexp(t, `localSchemeBuilder\s+= &SchemeBuilder\n`, got)
+		assert.Regexp(t, `AddToScheme\s+= localSchemeBuilder.AddToScheme\n`, got)
+		writeTestFiles(t, c.workspace, map[string]string{filepath.Join(pkg, "zz_generated.register.go"): got})
+	}
+
+	// both forms compile and register their types and defaulters
+	cmd := exec.Command("go", "run", "./cmd/check")
+	cmd.Dir = c.workspace
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod")
+	out, err := cmd.Output()
+	assert.NoError(t, err, exitStderr(err))
+	assert.Equal(t, "true 1\ntrue\n", string(out))
+}
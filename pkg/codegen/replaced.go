@@ -0,0 +1,142 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/zoumo/make-rules/pkg/golang"
+)
+
+// replacedPackageDirs maps pkgs not in workspace module to their dirs relative
+// to workspace, e.g. k8s.io/api/apps/v1 to vendored/api/apps/v1 if go.mod has
+// replace k8s.io/api => ./vendored/api. Modules of pkgs are resolved by
+// go list -m -json honoring replace directives, pkgs whose dirs are not in
+// workspace are not mapped.
+func (c *CodeGenerator) replacedPackageDirs(pkgs []string) (map[string]string, error) {
+	external := []string{}
+	for _, pkg := range pkgs {
+		if _, ok := localPackageDir(c.workspace, c.workspaceModule, pkg); !ok {
+			external = append(external, pkg)
+		}
+	}
+	if len(external) == 0 {
+		return nil, nil
+	}
+	out, err := c.goCmd.RunOutput("list", "-m", "-json", "all")
+	if err != nil {
+		return nil, err
+	}
+	modules, err := parseListModules(out)
+	if err != nil {
+		return nil, err
+	}
+	dirs := map[string]string{}
+	for _, pkg := range external {
+		dir, ok := packageDirInModules(modules, pkg)
+		if !ok {
+			continue
+		}
+		rel, err := filepath.Rel(c.workspace, dir)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			// not in workspace
+			continue
+		}
+		dirs[pkg] = filepath.ToSlash(rel)
+	}
+	return dirs, nil
+}
+
+// parseListModules parses output of go list -m -json.
+func parseListModules(out []byte) ([]golang.ListModule, error) {
+	decoder := json.NewDecoder(bytes.NewReader(out))
+	ret := []golang.ListModule{}
+	for {
+		var m golang.ListModule
+		if err := decoder.Decode(&m); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		ret = append(ret, m)
+	}
+	return ret, nil
+}
+
+// packageDirInModules returns the dir of pkg in the module with the longest
+// path containing it, the dir of replacement is used if the module is replaced.
+func packageDirInModules(modules []golang.ListModule, pkg string) (string, bool) {
+	m, dir, ok := moduleOfPackage(modules, pkg)
+	if !ok {
+		return "", false
+	}
+	return filepath.Join(dir, filepath.FromSlash(strings.TrimPrefix(pkg, m.Path))), true
+}
+
+// moduleOfPackage returns the module with the longest path containing pkg and
+// its dir, the dir of replacement is used if the module is replaced.
+func moduleOfPackage(modules []golang.ListModule, pkg string) (*golang.ListModule, string, bool) {
+	var found *golang.ListModule
+	for i := range modules {
+		m := &modules[i]
+		if pkg != m.Path && !strings.HasPrefix(pkg, m.Path+"/") {
+			continue
+		}
+		if found == nil || len(m.Path) > len(found.Path) {
+			found = m
+		}
+	}
+	if found == nil {
+		return nil, "", false
+	}
+	dir := found.Dir
+	if found.Replace != nil && len(found.Replace.Dir) > 0 {
+		dir = found.Replace.Dir
+	}
+	if len(dir) == 0 {
+		return nil, "", false
+	}
+	return found, dir, true
+}
+
+// moveReplacedOutputs moves <fileBase>.go generated by import path for each
+// package in dirs into the dir of the package in workspace module output, so
+// that it is copied to where the package is on disk.
+func (c *CodeGenerator) moveReplacedOutputs(fileBase string, dirs map[string]string) error {
+	for pkg, dir := range dirs {
+		src := path.Join(c.outputBase, pkg, fileBase+".go")
+		if _, err := os.Stat(src); os.IsNotExist(err) {
+			// nothing generated for the package
+			continue
+		} else if err != nil {
+			return err
+		}
+		dst := path.Join(c.outputBase, c.workspaceModule, dir, fileBase+".go")
+		c.logger.Info("moving generated file of replaced module", "package", pkg, "file", dst)
+		if err := os.MkdirAll(path.Dir(dst), 0755); err != nil {
+			return err
+		}
+		if err := os.Rename(src, dst); err != nil {
+			return err
+		}
+	}
+	return nil
+}
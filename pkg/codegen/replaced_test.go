@@ -0,0 +1,105 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zoumo/make-rules/pkg/golang"
+)
+
+func TestCodeGenerator_moveReplacedOutputs(t *testing.T) {
+	root := t.TempDir()
+	c := newTestCodeGenerator()
+	c.workspace = filepath.Join(root, "project")
+	c.outputBase = filepath.Join(c.workspace, "__output", "generated")
+	c.goCmd = c.goCmd.WithDir(c.workspace)
+	writeTestFiles(t, root, map[string]string{
+		"project/go.mod": `module github.com/example/project
+
+go 1.15
+
+require (
+	example.com/outside v0.0.0
+	k8s.io/api v0.0.0
+)
+
+replace (
+	example.com/outside => ../outside
+	k8s.io/api => ./vendored/api
+)
+`,
+		"project/vendored/api/go.mod": "module k8s.io/api\n",
+		"outside/go.mod":              "module example.com/outside\n",
+	})
+	pkgs := []string{
+		"github.com/example/project/pkg/apis/apps/v1",
+		"k8s.io/api/apps/v1",
+		"k8s.io/api/core/v1",
+		"example.com/outside/apis/v1",
+	}
+
+	dirs, err := c.replacedPackageDirs(pkgs)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"k8s.io/api/apps/v1": "vendored/api/apps/v1",
+		"k8s.io/api/core/v1": "vendored/api/core/v1",
+	}, dirs)
+
+	// generated by import path
+	writeTestFiles(t, c.outputBase, map[string]string{
+		"github.com/example/project/pkg/apis/apps/v1/zz_generated.deepcopy.go": "package v1\n",
+		"k8s.io/api/apps/v1/zz_generated.deepcopy.go":                          "package v1\n",
+	})
+	assert.NoError(t, c.moveReplacedOutputs(deepcopyFileBase, dirs))
+	assert.NoFileExists(t, filepath.Join(c.outputBase, "k8s.io/api/apps/v1/zz_generated.deepcopy.go"))
+	assert.FileExists(t, filepath.Join(c.outputBase, "github.com/example/project/vendored/api/apps/v1/zz_generated.deepcopy.go"))
+	assert.FileExists(t, filepath.Join(c.outputBase, "github.com/example/project/pkg/apis/apps/v1/zz_generated.deepcopy.go"))
+	_, err = os.Stat(filepath.Join(c.outputBase, "github.com/example/project/vendored/api/core/v1"))
+	assert.True(t, os.IsNotExist(err))
+
+	// local packages only
+	dirs, err = c.replacedPackageDirs(pkgs[:1])
+	assert.NoError(t, err)
+	assert.Empty(t, dirs)
+}
+
+func Test_packageDirInModules(t *testing.T) {
+	modules := []golang.ListModule{
+		{Path: "k8s.io/api", Dir: "/go/pkg/mod/k8s.io/api@v0.20.2"},
+		{Path: "example.com/api", Dir: "/go/pkg/mod/example.com/api@v1.0.0", Replace: &golang.ListModule{Path: "./api", Dir: "/workspace/api"}},
+		{Path: "example.com/api/nested", Dir: "/workspace/nested"},
+		{Path: "example.com/nodir"},
+	}
+	tests := []struct {
+		pkg    string
+		want   string
+		wantOK bool
+	}{
+		{pkg: "k8s.io/api/apps/v1", want: "/go/pkg/mod/k8s.io/api@v0.20.2/apps/v1", wantOK: true},
+		{pkg: "example.com/api/apps/v1", want: "/workspace/api/apps/v1", wantOK: true},
+		{pkg: "example.com/api/nested/v1", want: "/workspace/nested/v1", wantOK: true},
+		{pkg: "example.com/apis/v1"},
+		{pkg: "example.com/nodir/v1"},
+	}
+	for _, tt := range tests {
+		got, ok := packageDirInModules(modules, tt.pkg)
+		assert.Equal(t, tt.wantOK, ok, tt.pkg)
+		assert.Equal(t, filepath.FromSlash(tt.want), got, tt.pkg)
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"fmt"
+	"path"
+	"text/template"
+	"time"
+)
+
+var resyncTemplate = template.Must(template.New("resync").Parse(`{{ .Header }}
+// Code generated by kube-codegen. DO NOT EDIT.
+
+package {{ .Package }}
+
+import (
+	time "time"
+
+	versioned "{{ .ClientsetPackage }}"
+)
+
+// DefaultResync is the default resync period of informers created by NewDefaultSharedInformerFactory.
+const DefaultResync = {{ .Resync }}
+
+// NewDefaultSharedInformerFactory constructs a new instance of sharedInformerFactory for all namespaces
+// which resyncs informers every DefaultResync.
+func NewDefaultSharedInformerFactory(client versioned.Interface, options ...SharedInformerOption) SharedInformerFactory {
+	return NewSharedInformerFactoryWithOptions(client, DefaultResync, options...)
+}
+`))
+
+// durationLiteral returns go expression of d in the largest unit it is a
+// multiple of, e.g. 10 * time.Hour.
+func durationLiteral(d time.Duration) string {
+	units := []struct {
+		unit time.Duration
+		name string
+	}{
+		{time.Hour, "time.Hour"},
+		{time.Minute, "time.Minute"},
+		{time.Second, "time.Second"},
+		{time.Millisecond, "time.Millisecond"},
+	}
+	for _, u := range units {
+		if d%u.unit == 0 {
+			return fmt.Sprintf("%d * %s", d/u.unit, u.name)
+		}
+	}
+	return fmt.Sprintf("time.Duration(%d)", int64(d))
+}
+
+// genInformerResync generates resync.go in informers dir with DefaultResync
+// and NewDefaultSharedInformerFactory, it requires the factory generated by
+// informer-gen in the same dir.
+func (c *CodeGenerator) genInformerResync(dir string) error {
+	if c.informerDefaultResync <= 0 {
+		return nil
+	}
+	resyncFile := path.Join(dir, "resync.go")
+	c.logger.Info("generating informer default resync", "file", resyncFile, "resync", c.informerDefaultResync)
+	return c.writeHelperFile(dir, "resync.go", resyncTemplate, map[string]interface{}{
+		"ClientsetPackage": path.Join(c.workspaceModule, c.clientPath, c.clientsetDirName),
+		"Resync":           durationLiteral(c.informerDefaultResync),
+	})
+}
@@ -0,0 +1,30 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_durationLiteral(t *testing.T) {
+	assert.Equal(t, "10 * time.Hour", durationLiteral(10*time.Hour))
+	assert.Equal(t, "90 * time.Minute", durationLiteral(90*time.Minute))
+	assert.Equal(t, "30 * time.Second", durationLiteral(30*time.Second))
+	assert.Equal(t, "1500 * time.Millisecond", durationLiteral(1500*time.Millisecond))
+	assert.Equal(t, "time.Duration(10)", durationLiteral(10))
+}
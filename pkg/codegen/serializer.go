@@ -0,0 +1,75 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"path"
+	"text/template"
+
+	"golang.org/x/mod/semver"
+)
+
+// cborMinVersion is the first code-generator version whose apimachinery
+// provides the CBOR serializer.
+const cborMinVersion = "v0.32.0"
+
+var serializerTemplate = template.Must(template.New("serializer").Parse(`{{ .Header }}
+// Code generated by kube-codegen. DO NOT EDIT.
+
+package {{ .Package }}
+
+import (
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+{{- if .CBOR }}
+	"k8s.io/apimachinery/pkg/runtime/serializer/cbor"
+{{- end }}
+
+	"{{ .SchemePackage }}"
+)
+
+// NewCodecFactory returns a CodecFactory of the types registered in scheme.Scheme,
+// it supports {{ if .CBOR }}CBOR in addition to {{ end }}the serializers of serializer.NewCodecFactory.
+func NewCodecFactory(mutators ...serializer.CodecFactoryOptionsMutator) serializer.CodecFactory {
+{{- if .CBOR }}
+	mutators = append([]serializer.CodecFactoryOptionsMutator{serializer.WithSerializer(cbor.NewSerializerInfo)}, mutators...)
+{{- end }}
+	return serializer.NewCodecFactory(scheme.Scheme, mutators...)
+}
+
+// NewNegotiatedSerializer returns a NegotiatedSerializer of the types registered in scheme.Scheme
+// without conversion, which can be set as NegotiatedSerializer of rest.Config.
+func NewNegotiatedSerializer(mutators ...serializer.CodecFactoryOptionsMutator) runtime.NegotiatedSerializer {
+	return NewCodecFactory(mutators...).WithoutConversion()
+}
+`))
+
+// cborSupported returns true if apimachinery of the code-generator version
+// provides the CBOR serializer.
+func cborSupported(codeGeneratorVersion string) bool {
+	return semver.IsValid(codeGeneratorVersion) && semver.Compare(codeGeneratorVersion, cborMinVersion) >= 0
+}
+
+// genClientSerializer generates serializer.go in clientset dir with helpers
+// building negotiated serializer from the scheme of clientset.
+func (c *CodeGenerator) genClientSerializer(dir, schemePackage string) error {
+	cbor := cborSupported(c.generatorVersion("client"))
+	serializerFile := path.Join(dir, "serializer.go")
+	c.logger.Info("generating serializer", "file", serializerFile, "cbor", cbor)
+	return c.writeHelperFile(dir, "serializer.go", serializerTemplate, map[string]interface{}{
+		"SchemePackage": schemePackage,
+		"CBOR":          cbor,
+	})
+}
@@ -0,0 +1,104 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	// klogHeaderRegexp matches the header of klog lines, e.g.
+	// W0102 15:04:05.000000   12345 file.go:10] message
+	klogHeaderRegexp = regexp.MustCompile(`^([IWEF])\d{4} \d{2}:\d{2}:\d{2}\.\d+\s+\d+ [^\]]+\] `)
+
+	// commonWarningPrefixes are warnings emitted by all gengo based generators.
+	commonWarningPrefixes = []string{
+		"namer: duplicate name",
+	}
+
+	// generatorWarningPrefixes are warnings emitted by each generator which exits
+	// 0 but produces wrong output.
+	generatorWarningPrefixes = map[string][]string{
+		"deepcopy-gen": {
+			"Warning:",
+		},
+		"defaulter-gen": {
+			"Warning:",
+		},
+		"conversion-gen": {
+			// e.g. Warning: could not find nor generate a final Conversion function
+			"Warning:",
+		},
+		"openapi-gen": {
+			"API rule violation:",
+		},
+		"go-to-protobuf": {
+			"warning:",
+		},
+		"client-gen": {
+			"Warning:",
+		},
+		"lister-gen": {
+			"Warning:",
+		},
+		"informer-gen": {
+			"Warning:",
+		},
+	}
+)
+
+// findWarnings returns lines of output which are warnings of generator, klog
+// lines of warning severity are always warnings.
+func findWarnings(generatorName string, output []byte) []string {
+	prefixes := append(append([]string{}, commonWarningPrefixes...), generatorWarningPrefixes[generatorName]...)
+
+	warnings := []string{}
+	for _, line := range strings.Split(string(output), "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		msg := line
+		if m := klogHeaderRegexp.FindStringSubmatch(line); m != nil {
+			if m[1] == "W" {
+				warnings = append(warnings, line)
+				continue
+			}
+			msg = line[len(m[0]):]
+		}
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(msg, prefix) {
+				warnings = append(warnings, line)
+				break
+			}
+		}
+	}
+	return warnings
+}
+
+// checkWarnings returns an error with the offending lines if strict is enabled
+// and generator emits warnings in output.
+func (c *CodeGenerator) checkWarnings(generatorName string, output []byte) error {
+	if !c.strict {
+		return nil
+	}
+	warnings := findWarnings(generatorName, output)
+	if len(warnings) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s emitted %d warnings in strict mode:\n%s", generatorName, len(warnings), strings.Join(warnings, "\n"))
+}
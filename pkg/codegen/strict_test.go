@@ -0,0 +1,55 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_findWarnings(t *testing.T) {
+	output := []byte(`I0102 15:04:05.000000   12345 main.go:10] Completed successfully.
+E0102 15:04:05.000000   12345 namer.go:20] namer: duplicate name Foo
+W0102 15:04:05.000000   12345 conversion.go:30] skipping field
+Warning: could not find nor generate a final Conversion function for v1.Foo -> apps.Foo
+`)
+	assert.Equal(t, []string{
+		"E0102 15:04:05.000000   12345 namer.go:20] namer: duplicate name Foo",
+		"W0102 15:04:05.000000   12345 conversion.go:30] skipping field",
+		"Warning: could not find nor generate a final Conversion function for v1.Foo -> apps.Foo",
+	}, findWarnings("conversion-gen", output))
+
+	// Warning: is not recognized for openapi-gen
+	assert.Equal(t, []string{
+		"E0102 15:04:05.000000   12345 namer.go:20] namer: duplicate name Foo",
+		"W0102 15:04:05.000000   12345 conversion.go:30] skipping field",
+	}, findWarnings("openapi-gen", output))
+
+	assert.Empty(t, findWarnings("deepcopy-gen", []byte("I0102 15:04:05.000000   12345 main.go:10] Completed successfully.\n")))
+}
+
+func Test_checkWarnings(t *testing.T) {
+	output := []byte("namer: duplicate name Foo\n")
+	c := newTestCodeGenerator()
+	assert.NoError(t, c.checkWarnings("client-gen", output))
+
+	c.WithStrict(true)
+	err := c.checkWarnings("client-gen", output)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "client-gen emitted 1 warnings in strict mode")
+	assert.Contains(t, err.Error(), "namer: duplicate name Foo")
+	assert.NoError(t, c.checkWarnings("client-gen", []byte("done\n")))
+}
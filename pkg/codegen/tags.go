@@ -0,0 +1,455 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/zoumo/goset"
+	"github.com/zoumo/make-rules/pkg/golang"
+	"github.com/zoumo/make-rules/pkg/runner"
+)
+
+// tagEditor edits comment lines preceding the declaration of type kind, and
+// returns the edited lines.
+type tagEditor func(kind string, lines []string) []string
+
+// nonNamespacedTags tags kinds with +genclient:nonNamespaced.
+func nonNamespacedTags(kinds []string) tagEditor {
+	set := goset.NewSetFromStrings(kinds)
+	return func(kind string, lines []string) []string {
+		if !set.Contains(kind) {
+			return lines
+		}
+		for _, line := range lines {
+			if commentTag(line) == "genclient:nonNamespaced" {
+				return lines
+			}
+		}
+		return append(lines, "// +genclient:nonNamespaced")
+	}
+}
+
+// chainTags runs editors in order.
+func chainTags(editors ...tagEditor) tagEditor {
+	return func(kind string, lines []string) []string {
+		for _, edit := range editors {
+			lines = edit(kind, lines)
+		}
+		return lines
+	}
+}
+
+// listerTags returns editor of tags seen by lister-gen and informer-gen, nil
+// means tags are not edited.
+func (c *CodeGenerator) listerTags() tagEditor {
+	editors := []tagEditor{}
+	if len(c.clientOnlyKinds) > 0 {
+		editors = append(editors, allowedKindsTags(c.clientOnlyKinds))
+	}
+	if len(c.nonNamespacedKinds) > 0 {
+		editors = append(editors, nonNamespacedTags(c.nonNamespacedKinds))
+	}
+	if len(editors) == 0 {
+		return nil
+	}
+	return chainTags(editors...)
+}
+
+// commentTag returns name of the tag in comment line, e.g. genclient:nonNamespaced
+// for "// +genclient:nonNamespaced" and genclient:onlyVerbs for
+// "// +genclient:onlyVerbs=get", empty means line is not a tag.
+func commentTag(line string) string {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "//") {
+		return ""
+	}
+	line = strings.TrimSpace(strings.TrimPrefix(line, "//"))
+	if !strings.HasPrefix(line, "+") {
+		return ""
+	}
+	return strings.SplitN(line[1:], "=", 2)[0]
+}
+
+// retagFile edits comments preceding each type declaration in src by edit,
+// it returns nil if nothing is edited.
+func retagFile(filename string, src []byte, edit tagEditor) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	file := fset.File(f.Pos())
+	lineStart := func(pos token.Pos) int {
+		return int(file.LineStart(file.Line(pos))) - file.Base()
+	}
+	nextLine := func(pos token.Pos) int {
+		offset := file.Offset(pos)
+		if i := bytes.IndexByte(src[offset:], '\n'); i >= 0 {
+			return offset + i + 1
+		}
+		return len(src)
+	}
+
+	type comments struct {
+		start, end int
+		kind       string
+	}
+	found := []comments{}
+	prev := f.Name.End()
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			prev = decl.End()
+			continue
+		}
+		if !gen.Lparen.IsValid() {
+			spec := gen.Specs[0].(*ast.TypeSpec)
+			found = append(found, comments{nextLine(prev), lineStart(gen.Pos()), spec.Name.Name})
+			prev = gen.End()
+			continue
+		}
+		prev = gen.Lparen
+		for _, spec := range gen.Specs {
+			spec := spec.(*ast.TypeSpec)
+			found = append(found, comments{nextLine(prev), lineStart(spec.Pos()), spec.Name.Name})
+			prev = spec.End()
+		}
+		prev = gen.End()
+	}
+
+	edited := false
+	buf := bytes.Buffer{}
+	last := 0
+	for _, c := range found {
+		if c.start > c.end {
+			// declaration follows the previous one in the same line
+			continue
+		}
+		lines := strings.SplitAfter(string(src[c.start:c.end]), "\n")
+		lines = lines[:len(lines)-1]
+		for i := range lines {
+			lines[i] = strings.TrimSuffix(lines[i], "\n")
+		}
+		newLines := edit(c.kind, append([]string{}, lines...))
+		if strings.Join(newLines, "\n") == strings.Join(lines, "\n") {
+			continue
+		}
+		edited = true
+		buf.Write(src[last:c.start])
+		for _, line := range newLines {
+			buf.WriteString(line + "\n")
+		}
+		last = c.end
+	}
+	if !edited {
+		return nil, nil
+	}
+	buf.Write(src[last:])
+	return buf.Bytes(), nil
+}
+
+// retagPackage edits comments of types in go files in dir, and returns the
+// edited files by path.
+func retagPackage(dir string, edit tagEditor) (map[string][]byte, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	ret := map[string][]byte{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || filepath.Ext(name) != ".go" || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		filename := filepath.Join(dir, name)
+		src, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		content, err := retagFile(filename, src, edit)
+		if err != nil {
+			return nil, err
+		}
+		if content != nil {
+			ret[filename] = content
+		}
+	}
+	return ret, nil
+}
+
+// retagInputs edits comments of types in input packages by edit, and returns
+// run in a dir mirroring workspace with the edited files, so that generators
+// parsing input packages see the edited tags.
+//
+// Everything else in the mirror is symlinked to workspace, and modules of
+// input packages out of workspace are mirrored and replaced in go.mod, so
+// neither workspace nor modules are modified. run is returned as is if
+// nothing is edited. cleanup removes the mirror.
+func (c *CodeGenerator) retagInputs(run *runner.Runner, edit tagEditor) (*runner.Runner, func(), error) {
+	noop := func() {}
+	out, err := c.goCmd.RunOutput("list", "-m", "-json", "all")
+	if err != nil {
+		return nil, noop, err
+	}
+	modules, err := parseListModules(out)
+	if err != nil {
+		return nil, noop, err
+	}
+
+	workspace := filepath.Clean(c.workspace)
+	// edited files and modules of input packages by module dir
+	edited := map[string]map[string][]byte{}
+	inputModules := map[string]golang.ListModule{}
+	for _, pkg := range c.inputPackages {
+		m, dir, ok := moduleOfPackage(modules, pkg)
+		if !ok {
+			return nil, noop, fmt.Errorf("module of input package %v is not found", pkg)
+		}
+		files, err := retagPackage(filepath.Join(dir, filepath.FromSlash(strings.TrimPrefix(pkg, m.Path))), edit)
+		if err != nil {
+			return nil, noop, err
+		}
+		if len(files) == 0 {
+			continue
+		}
+		dir = filepath.Clean(dir)
+		if edited[dir] == nil {
+			edited[dir] = map[string][]byte{}
+		}
+		for filename, content := range files {
+			c.logger.Info("retagging types", "file", filename)
+			edited[dir][filename] = content
+		}
+		inputModules[dir] = *m
+	}
+	if len(edited) == 0 {
+		return run, noop, nil
+	}
+
+	tempDir, err := ioutil.TempDir("", "kube-codegen-tags.*")
+	if err != nil {
+		return nil, noop, err
+	}
+	cleanup := func() {
+		os.RemoveAll(tempDir) //nolint
+	}
+	mirror := filepath.Join(tempDir, "workspace")
+	mirrors := map[string]string{workspace: mirror}
+	for dir, m := range inputModules {
+		if dir != workspace {
+			mirrors[dir] = filepath.Join(tempDir, "modules", filepath.FromSlash(m.Path))
+		}
+	}
+	gomod, err := ioutil.ReadFile(filepath.Join(workspace, "go.mod"))
+	if err != nil {
+		cleanup()
+		return nil, noop, err
+	}
+	if edited[workspace] == nil {
+		edited[workspace] = map[string][]byte{}
+	}
+	// go.mod is copied to be edited below
+	edited[workspace][filepath.Join(workspace, "go.mod")] = gomod
+	for dir, dst := range mirrors {
+		if err := mirrorTree(dir, dst, edited[dir]); err != nil {
+			cleanup()
+			return nil, noop, err
+		}
+	}
+
+	run, err = c.replaceMirrors(run.WithDir(mirror), tempDir, mirrors, inputModules)
+	if err != nil {
+		cleanup()
+		return nil, noop, err
+	}
+	return run, cleanup, nil
+}
+
+// goModReplace is replace directive in output of go mod edit -json or
+// go work edit -json.
+type goModReplace struct {
+	Old struct {
+		Path    string
+		Version string
+	}
+	New struct {
+		Path    string
+		Version string
+	}
+}
+
+// replaceMirrors makes modules in mirrors resolved to their mirror dirs by run
+// in mirror of workspace.
+//
+// Relative replacements in go.mod of the mirror are resolved against
+// workspace, and modules out of workspace are replaced by their mirrors. If
+// workspace is in a go.work, a go.work using mirrors instead of the modules
+// is written in tempDir.
+func (c *CodeGenerator) replaceMirrors(run *runner.Runner, tempDir string, mirrors map[string]string, modules map[string]golang.ListModule) (*runner.Runner, error) {
+	workspace := filepath.Clean(c.workspace)
+	mirror := mirrors[workspace]
+	goCmd := c.goCmd.WithDir(mirror)
+
+	var gomod struct {
+		Replace []goModReplace
+	}
+	out, err := goCmd.RunOutput("mod", "edit", "-json")
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(out, &gomod); err != nil {
+		return nil, err
+	}
+	args := []string{"mod", "edit"}
+	for _, r := range gomod.Replace {
+		if r.New.Version != "" || filepath.IsAbs(r.New.Path) {
+			continue
+		}
+		args = append(args, "-replace", replaceArg(r.Old.Path, r.Old.Version, filepath.Join(workspace, r.New.Path)))
+	}
+
+	gowork, err := c.goWork()
+	if err != nil {
+		return nil, err
+	}
+	for dir, m := range modules {
+		if dir == workspace || (m.Main && len(gowork) > 0) {
+			// main modules are used by go.work
+			continue
+		}
+		for _, r := range gomod.Replace {
+			if r.Old.Path == m.Path && r.Old.Version != "" {
+				args = append(args, "-dropreplace", r.Old.Path+"@"+r.Old.Version)
+			}
+		}
+		args = append(args, "-replace", replaceArg(m.Path, "", mirrors[dir]))
+	}
+	if len(args) > 2 {
+		if _, err := goCmd.RunCombinedOutput(args...); err != nil {
+			return nil, err
+		}
+	}
+	if len(gowork) == 0 {
+		return run, nil
+	}
+
+	var work struct {
+		Go  string
+		Use []struct {
+			DiskPath string
+		}
+		Replace []goModReplace
+	}
+	out, err = c.goCmd.RunOutput("work", "edit", "-json")
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(out, &work); err != nil {
+		return nil, err
+	}
+	workDir := filepath.Dir(gowork)
+	newWork := filepath.Join(tempDir, "go.work")
+	if err := ioutil.WriteFile(newWork, []byte("go "+work.Go+"\n"), 0644); err != nil {
+		return nil, err
+	}
+	args = []string{"work", "edit"}
+	for _, use := range work.Use {
+		dir := use.DiskPath
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(workDir, dir)
+		}
+		if m, ok := mirrors[filepath.Clean(dir)]; ok {
+			dir = m
+		}
+		args = append(args, "-use", dir)
+	}
+	for _, r := range work.Replace {
+		newPath := r.New.Path
+		if r.New.Version == "" && !filepath.IsAbs(newPath) {
+			newPath = filepath.Join(workDir, newPath)
+		}
+		arg := replaceArg(r.Old.Path, r.Old.Version, newPath)
+		if r.New.Version != "" {
+			arg += "@" + r.New.Version
+		}
+		args = append(args, "-replace", arg)
+	}
+	args = append(args, newWork)
+	if _, err := c.goCmd.WithDir(tempDir).RunCombinedOutput(args...); err != nil {
+		return nil, err
+	}
+	return run.WithEnvs("GOWORK", newWork), nil
+}
+
+// replaceArg returns argument of -replace of go mod edit replacing module
+// path at version by dir.
+func replaceArg(path, version, dir string) string {
+	if version != "" {
+		path += "@" + version
+	}
+	return path + "=" + dir
+}
+
+// mirrorTree mirrors src in dst, files are written with the given content, and
+// everything else is symlinked to src.
+func mirrorTree(src, dst string, files map[string][]byte) error {
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		srcPath := filepath.Join(src, entry.Name())
+		dstPath := filepath.Join(dst, entry.Name())
+		if content, ok := files[srcPath]; ok {
+			if err := ioutil.WriteFile(dstPath, content, 0644); err != nil {
+				return err
+			}
+			continue
+		}
+		if entry.IsDir() && containsFiles(srcPath, files) {
+			if err := mirrorTree(srcPath, dstPath, files); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := os.Symlink(srcPath, dstPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// containsFiles returns true if any of files is in dir.
+func containsFiles(dir string, files map[string][]byte) bool {
+	for filename := range files {
+		if strings.HasPrefix(filename, dir+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
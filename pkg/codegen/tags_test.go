@@ -0,0 +1,173 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/otiai10/copy"
+	"github.com/stretchr/testify/assert"
+	"github.com/zoumo/make-rules/pkg/runner"
+)
+
+func Test_retagFile(t *testing.T) {
+	src := `package v1
+
+import "fmt"
+
+// +genclient
+// Cluster is cluster-scoped.
+type Cluster struct{}
+
+type Node struct{}
+
+// +genclient
+// +genclient:nonNamespaced
+type Region struct{}
+
+type (
+	// +genclient
+	Zone struct{}
+	Host struct{}
+)
+
+var _ = fmt.Sprint
+`
+	got, err := retagFile("types.go", []byte(src), nonNamespacedTags([]string{"Cluster", "Node", "Region", "Zone"}))
+	assert.NoError(t, err)
+	assert.Equal(t, `package v1
+
+import "fmt"
+
+// +genclient
+// Cluster is cluster-scoped.
+// +genclient:nonNamespaced
+type Cluster struct{}
+
+// +genclient:nonNamespaced
+type Node struct{}
+
+// +genclient
+// +genclient:nonNamespaced
+type Region struct{}
+
+type (
+	// +genclient
+// +genclient:nonNamespaced
+	Zone struct{}
+	Host struct{}
+)
+
+var _ = fmt.Sprint
+`, string(got))
+
+	got, err = retagFile("types.go", []byte(src), nonNamespacedTags([]string{"Region", "Foo"}))
+	assert.NoError(t, err)
+	assert.Nil(t, got)
+}
+
+func Test_commentTag(t *testing.T) {
+	assert.Equal(t, "genclient", commentTag("// +genclient"))
+	assert.Equal(t, "genclient:nonNamespaced", commentTag("\t//+genclient:nonNamespaced"))
+	assert.Equal(t, "genclient:onlyVerbs", commentTag("// +genclient:onlyVerbs=get,list"))
+	assert.Equal(t, "", commentTag("// Cluster +genclient"))
+	assert.Equal(t, "", commentTag(""))
+}
+
+const testClusterTypes = `package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	runtime "k8s.io/apimachinery/pkg/runtime"
+	schema "k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var SchemeGroupVersion = schema.GroupVersion{Group: "infra.example.com", Version: "v1"}
+
+var (
+	SchemeBuilder = runtime.NewSchemeBuilder(func(scheme *runtime.Scheme) error {
+		scheme.AddKnownTypes(SchemeGroupVersion, &Cluster{}, &ClusterList{})
+		metav1.AddToGroupVersion(scheme, SchemeGroupVersion)
+		return nil
+	})
+	AddToScheme = SchemeBuilder.AddToScheme
+)
+
+func Resource(resource string) schema.GroupResource {
+	return SchemeGroupVersion.WithResource(resource).GroupResource()
+}
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// Cluster is a cluster-scoped kind not marked with +genclient:nonNamespaced.
+type Cluster struct {
+	metav1.TypeMeta   ` + "`json:\",inline\"`" + `
+	metav1.ObjectMeta ` + "`json:\"metadata,omitempty\"`" + `
+}
+
+func (in *Cluster) DeepCopyObject() runtime.Object {
+	out := *in
+	return &out
+}
+
+type ClusterList struct {
+	metav1.TypeMeta ` + "`json:\",inline\"`" + `
+	metav1.ListMeta ` + "`json:\"metadata,omitempty\"`" + `
+	Items           []Cluster ` + "`json:\"items\"`" + `
+}
+
+func (in *ClusterList) DeepCopyObject() runtime.Object {
+	out := *in
+	return &out
+}
+`
+
+func Test_genClients_nonNamespacedKinds(t *testing.T) {
+	c := newTestWorkspaceGenerator(t, map[string]string{
+		"pkg/apis/infra/v1/doc.go":   "// +groupName=infra.example.com\npackage v1\n",
+		"pkg/apis/infra/v1/types.go": testClusterTypes,
+	})
+	c.boilerplatePath = filepath.Join(c.workspace, "hack/boilerplate.go.txt")
+	c.goCmd = runner.NewRunner("go").WithDir(c.workspace).WithEnvs("GOFLAGS", "-mod=mod")
+	c.inputPackages = []string{"github.com/example/project/pkg/apis/infra/v1"}
+	c.WithNonNamespacedKinds([]string{"Cluster"})
+
+	assert.NoError(t, c.genClient(c.logger, testGeneratorRunner(t, c, "client")))
+	assert.NoError(t, c.genLister(c.logger, testGeneratorRunner(t, c, "lister")))
+	assert.NoError(t, c.genInformer(c.logger, testGeneratorRunner(t, c, "informer")))
+
+	// all generators see the kind cluster-scoped
+	output := filepath.Join(c.outputBase, "github.com/example/project/pkg/clients")
+	content, err := ioutil.ReadFile(filepath.Join(output, "kubernetes/typed/infra/v1/cluster.go"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "func newClusters(c *InfraV1Client) *clusters {")
+	content, err = ioutil.ReadFile(filepath.Join(output, "listers/infra/v1/cluster.go"))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(content), "ClusterNamespaceLister")
+	content, err = ioutil.ReadFile(filepath.Join(output, "informers/infra/v1/cluster.go"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "func NewClusterInformer(client kubernetes.Interface, resyncPeriod time.Duration, indexers cache.Indexers) cache.SharedIndexInformer {")
+
+	// types in workspace are not modified
+	content, err = ioutil.ReadFile(filepath.Join(c.workspace, "pkg/apis/infra/v1/types.go"))
+	assert.NoError(t, err)
+	assert.Equal(t, testClusterTypes, string(content))
+
+	assert.NoError(t, copy.Copy(output, filepath.Join(c.workspace, "pkg/clients")))
+	goBuild(t, c, "./...")
+}
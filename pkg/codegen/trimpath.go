@@ -0,0 +1,84 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"bytes"
+	"go/scanner"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+)
+
+// trimGeneratedPaths removes trimPathPrefix from <fileBase>.go generated for
+// pkgs, so that absolute paths of the machine running generators, e.g. GOPATH
+// or workspace, embedded in comments do not make generated files differ
+// across machines. Code, e.g. string literals, is kept as it is.
+func (c *CodeGenerator) trimGeneratedPaths(fileBase string, pkgs []string) error {
+	if len(c.trimPathPrefix) == 0 {
+		return nil
+	}
+	prefix := []byte(strings.TrimSuffix(c.trimPathPrefix, "/") + "/")
+	for _, pkg := range pkgs {
+		file := path.Join(c.outputBase, pkg, fileBase+".go")
+		content, err := ioutil.ReadFile(file)
+		if os.IsNotExist(err) {
+			// nothing generated for the package
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		trimmed := trimCommentPaths(content, prefix)
+		if bytes.Equal(trimmed, content) {
+			continue
+		}
+		c.logger.V(1).Info("trimming path prefix", "file", file, "prefix", c.trimPathPrefix)
+		if err := ioutil.WriteFile(file, trimmed, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// trimCommentPaths removes prefix from comments of go source src.
+func trimCommentPaths(src, prefix []byte) []byte {
+	if !bytes.Contains(src, prefix) {
+		return src
+	}
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(src))
+	s := scanner.Scanner{}
+	s.Init(file, src, nil, scanner.ScanComments)
+	out := bytes.Buffer{}
+	last := 0
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok != token.COMMENT {
+			continue
+		}
+		offset := file.Offset(pos)
+		out.Write(src[last:offset])
+		out.Write(bytes.ReplaceAll([]byte(lit), prefix, nil))
+		last = offset + len(lit)
+	}
+	out.Write(src[last:])
+	return out.Bytes()
+}
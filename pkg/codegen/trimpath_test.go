@@ -0,0 +1,52 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_trimGeneratedPaths(t *testing.T) {
+	pkg := "github.com/example/project/pkg/apis/apps/v1"
+	// generate as if generators run from different roots
+	generate := func(root string) string {
+		c := newTestCodeGenerator()
+		c.outputBase = filepath.Join(root, "__output")
+		c.WithTrimPathPrefix(root)
+		writeTestFiles(t, c.outputBase, map[string]string{
+			pkg + "/zz_generated.conversion.go": fmt.Sprintf("package v1\n\n// generated from %s/go/src/%s/types.go\n", root, pkg),
+			pkg + "/zz_generated.defaults.go":   fmt.Sprintf("package v1\n\n/* generated from %s/types.go */\nconst dir = %q\n", root, root+"/go"),
+		})
+		assert.NoError(t, c.trimGeneratedPaths("zz_generated.conversion", []string{pkg, "github.com/example/project/pkg/apis/batch/v1"}))
+		content, err := ioutil.ReadFile(filepath.Join(c.outputBase, pkg, "zz_generated.conversion.go"))
+		assert.NoError(t, err)
+
+		// paths in code are not comments
+		assert.NoError(t, c.trimGeneratedPaths("zz_generated.defaults", []string{pkg}))
+		defaults, err := ioutil.ReadFile(filepath.Join(c.outputBase, pkg, "zz_generated.defaults.go"))
+		assert.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("package v1\n\n/* generated from types.go */\nconst dir = %q\n", root+"/go"), string(defaults))
+		return string(content)
+	}
+
+	first, second := generate(t.TempDir()), generate(t.TempDir())
+	assert.Equal(t, first, second)
+	assert.Equal(t, "package v1\n\n// generated from go/src/"+pkg+"/types.go\n", first)
+}
@@ -0,0 +1,71 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"path"
+	"strconv"
+	"text/template"
+)
+
+var clientUserAgentTemplate = template.Must(template.New("useragent").Parse(`{{ .Header }}
+// Code generated by kube-codegen. DO NOT EDIT.
+
+package {{ .Package }}
+
+import (
+	rest "k8s.io/client-go/rest"
+)
+
+// DefaultUserAgent is the user agent of clientsets created by NewForConfigWithUserAgent.
+// If it is empty, rest.DefaultKubernetesUserAgent() is used.
+var DefaultUserAgent = {{ .UserAgent }}
+
+// UserAgent returns DefaultUserAgent, or rest.DefaultKubernetesUserAgent() if it is empty.
+func UserAgent() string {
+	if len(DefaultUserAgent) == 0 {
+		return rest.DefaultKubernetesUserAgent()
+	}
+	return DefaultUserAgent
+}
+
+// ConfigWithUserAgent returns a copy of c whose UserAgent defaults to UserAgent().
+// UserAgent already set in c is kept.
+func ConfigWithUserAgent(c *rest.Config) *rest.Config {
+	config := rest.CopyConfig(c)
+	if len(config.UserAgent) == 0 {
+		config.UserAgent = UserAgent()
+	}
+	return config
+}
+
+// NewForConfigWithUserAgent creates a new Clientset for the given config whose UserAgent defaults to UserAgent().
+func NewForConfigWithUserAgent(c *rest.Config) (*Clientset, error) {
+	return NewForConfig(ConfigWithUserAgent(c))
+}
+`))
+
+// genClientUserAgent generates useragent.go in clientset dir with helpers
+// building clientset whose user agent defaults to clientUserAgent.
+func (c *CodeGenerator) genClientUserAgent(dir string) error {
+	if len(c.clientUserAgent) == 0 {
+		return nil
+	}
+	userAgentFile := path.Join(dir, "useragent.go")
+	c.logger.Info("generating client user agent", "file", userAgentFile, "userAgent", c.clientUserAgent)
+	return c.writeHelperFile(dir, "useragent.go", clientUserAgentTemplate, map[string]interface{}{
+		"UserAgent": strconv.Quote(c.clientUserAgent),
+	})
+}
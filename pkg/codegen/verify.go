@@ -0,0 +1,111 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+const (
+	// maxDiffLines is the maximum lines of unified diff shown for each file.
+	maxDiffLines = 100
+)
+
+// generatedDir returns the dir of rel in output base which in-process
+// generators write into. Like output of gengo generators, it is copied to
+// workspace after all generators run, so that cleaning output dirs does not
+// remove it, and workspace is untouched in verify mode.
+func (c *CodeGenerator) generatedDir(rel string) string {
+	return path.Join(c.outputBase, c.workspaceModule, rel)
+}
+
+// verifyGenerated compares generated files in src with files in dst, and
+// returns error listing out of date files, with unified diffs of them if
+// verboseDiff is true.
+func verifyGenerated(src, dst string, verboseDiff bool) error {
+	changed := []string{}
+	diffs := map[string]string{}
+	err := filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		want, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		got, err := os.ReadFile(filepath.Join(dst, rel))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err == nil && bytes.Equal(want, got) {
+			return nil
+		}
+		changed = append(changed, rel)
+		if verboseDiff {
+			diffs[rel] = unifiedDiff(rel, string(got), string(want), maxDiffLines)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	sort.Strings(changed)
+	msg := fmt.Sprintf("generated files are out of date, please run generation again:\n  %s", strings.Join(changed, "\n  "))
+	for _, rel := range changed {
+		if diff := diffs[rel]; len(diff) > 0 {
+			msg += "\n\n" + diff
+		}
+	}
+	return fmt.Errorf("%s", msg)
+}
+
+// unifiedDiff returns unified diff from committed to generated content of
+// file, at most maxLines lines are kept.
+func unifiedDiff(name, committed, generated string, maxLines int) string {
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(committed),
+		B:        difflib.SplitLines(generated),
+		FromFile: "a/" + name,
+		ToFile:   "b/" + name,
+		Context:  3,
+	})
+	if err != nil {
+		return fmt.Sprintf("failed to diff %s: %v", name, err)
+	}
+	lines := strings.SplitAfter(strings.TrimSuffix(diff, "\n"), "\n")
+	if len(lines) <= maxLines {
+		return strings.Join(lines, "")
+	}
+	return strings.Join(lines[:maxLines], "") + fmt.Sprintf("... (%d more lines)", len(lines)-maxLines)
+}
@@ -0,0 +1,70 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_verifyGenerated(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	writeTestFiles(t, src, map[string]string{
+		"pkg/apis/apps/v1/zz_generated.deepcopy.go": "package v1\n\nfunc A() {}\n",
+		"pkg/apis/apps/v1/zz_generated.defaults.go": "package v1\n",
+		"pkg/clients/listers/apps/v1/foo.go":        "package v1\n",
+	})
+	writeTestFiles(t, dst, map[string]string{
+		"pkg/apis/apps/v1/zz_generated.deepcopy.go": "package v1\n\nfunc B() {}\n",
+		"pkg/apis/apps/v1/zz_generated.defaults.go": "package v1\n",
+		"pkg/apis/apps/v1/types.go":                 "package v1\n",
+	})
+
+	err := verifyGenerated(src, dst, false)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), filepath.Join("pkg", "apis", "apps", "v1", "zz_generated.deepcopy.go"))
+	assert.Contains(t, err.Error(), filepath.Join("pkg", "clients", "listers", "apps", "v1", "foo.go"))
+	assert.NotContains(t, err.Error(), "zz_generated.defaults.go")
+	assert.NotContains(t, err.Error(), "@@")
+
+	err = verifyGenerated(src, dst, true)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "--- a/pkg/apis/apps/v1/zz_generated.deepcopy.go\n+++ b/pkg/apis/apps/v1/zz_generated.deepcopy.go\n")
+	assert.Contains(t, err.Error(), "-func B() {}\n+func A() {}")
+
+	assert.NoError(t, verifyGenerated(src, src, true))
+}
+
+func Test_unifiedDiff(t *testing.T) {
+	committed, generated := []string{}, []string{}
+	for i := 0; i < 200; i++ {
+		committed = append(committed, fmt.Sprintf("line %d", i))
+		generated = append(generated, fmt.Sprintf("line %d changed", i))
+	}
+	diff := unifiedDiff("foo.go", strings.Join(committed, "\n")+"\n", strings.Join(generated, "\n")+"\n", 10)
+	lines := strings.Split(diff, "\n")
+	assert.Len(t, lines, 11)
+	assert.Equal(t, "--- a/foo.go", lines[0])
+	assert.Regexp(t, `^\.\.\. \(\d+ more lines\)$`, lines[10])
+}
+
+func Test_generatedDir(t *testing.T) {
+	c := newTestCodeGenerator()
+	assert.Equal(t, "/workspace/__output/generated/github.com/example/project/pkg/apis", c.generatedDir("pkg/apis"))
+}
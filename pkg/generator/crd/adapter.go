@@ -0,0 +1,152 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dave/jennifer/jen"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	defaultAdapterPackage = "versioned"
+)
+
+// adapterKind is a kind with the go package of its type.
+type adapterKind struct {
+	// name is the prefix of generated identifiers, e.g. AppsV1Foo
+	name    string
+	gvk     schema.GroupVersionKind
+	pkgPath string
+}
+
+// adapterKinds returns all kinds in every served version whose go type is in
+// input packages, sorted by group, kind and then version order in CRD.
+func (cw *codeWriter) adapterKinds(groupPackageNames map[string]string) []adapterKind {
+	gvPkgs := map[schema.GroupVersion]string{}
+	for pkg, gv := range cw.parser.GroupVersions {
+		if p, ok := gvPkgs[gv]; !ok || pkg.PkgPath < p {
+			gvPkgs[gv] = pkg.PkgPath
+		}
+	}
+
+	ret := []adapterKind{}
+	for _, gk := range sortedGroupKinds(cw.parser.CustomResourceDefinitions) {
+		crd := cw.parser.CustomResourceDefinitions[gk]
+		pkgName, ok := groupPackageNames[gk.Group]
+		if !ok {
+			pkgName = strings.Split(gk.Group, ".")[0]
+		}
+		for _, v := range crd.Spec.Versions {
+			if !v.Served {
+				continue
+			}
+			gvk := gk.WithVersion(v.Name)
+			pkgPath, ok := gvPkgs[gvk.GroupVersion()]
+			if !ok {
+				continue
+			}
+			ret = append(ret, adapterKind{
+				name:    Capitalize(pkgName) + Capitalize(v.Name) + Capitalize(gk.Kind),
+				gvk:     gvk,
+				pkgPath: pkgPath,
+			})
+		}
+	}
+	return ret
+}
+
+// GenerateUnstructuredAdapter generates adapter.go in the clientset package,
+// which converts typed objects of each kind from and to unstructured objects
+// by runtime.DefaultUnstructuredConverter. It relies on the scheme package
+// generated by client-gen.
+func (cw *codeWriter) GenerateUnstructuredAdapter(packageName, schemePackage string, groupPackageNames map[string]string) error {
+	if packageName == "" {
+		packageName = defaultAdapterPackage
+	}
+	if schemePackage == "" {
+		return fmt.Errorf("scheme package is required to generate unstructured adapter")
+	}
+	adapterfile := jen.NewFile(packageName)
+	cw.setFileDefault(adapterfile)
+
+	const (
+		runtimePkg      = "k8s.io/apimachinery/pkg/runtime"
+		unstructuredPkg = "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	)
+	unstructuredType := jen.Op("*").Qual(unstructuredPkg, "Unstructured")
+
+	adapterfile.Line()
+	adapterfile.Comment("FromUnstructured converts u to a typed object registered in the scheme by its GroupVersionKind.")
+	adapterfile.Func().Id("FromUnstructured").Params(jen.Id("u").Add(unstructuredType.Clone())).Parens(jen.List(jen.Qual(runtimePkg, "Object"), jen.Error())).Block(
+		jen.List(jen.Id("obj"), jen.Err()).Op(":=").Qual(schemePackage, "Scheme").Dot("New").Call(jen.Id("u").Dot("GroupVersionKind").Call()),
+		jen.If(jen.Err().Op("!=").Nil()).Block(jen.Return(jen.Nil(), jen.Err())),
+		jen.If(
+			jen.Err().Op(":=").Qual(runtimePkg, "DefaultUnstructuredConverter").Dot("FromUnstructured").Call(jen.Id("u").Dot("UnstructuredContent").Call(), jen.Id("obj")),
+			jen.Err().Op("!=").Nil(),
+		).Block(jen.Return(jen.Nil(), jen.Err())),
+		jen.Return(jen.Id("obj"), jen.Nil()),
+	)
+
+	adapterfile.Line()
+	adapterfile.Comment("ToUnstructured converts obj to an unstructured object, apiVersion and kind are set by")
+	adapterfile.Comment("the scheme if obj does not have them.")
+	adapterfile.Func().Id("ToUnstructured").Params(jen.Id("obj").Qual(runtimePkg, "Object")).Parens(jen.List(unstructuredType.Clone(), jen.Error())).Block(
+		jen.List(jen.Id("content"), jen.Err()).Op(":=").Qual(runtimePkg, "DefaultUnstructuredConverter").Dot("ToUnstructured").Call(jen.Id("obj")),
+		jen.If(jen.Err().Op("!=").Nil()).Block(jen.Return(jen.Nil(), jen.Err())),
+		jen.Id("u").Op(":=").Op("&").Qual(unstructuredPkg, "Unstructured").Values(jen.Dict{jen.Id("Object"): jen.Id("content")}),
+		jen.If(jen.Id("u").Dot("GetKind").Call().Op("==").Lit("")).Block(
+			jen.List(jen.Id("gvks"), jen.Id("_"), jen.Err()).Op(":=").Qual(schemePackage, "Scheme").Dot("ObjectKinds").Call(jen.Id("obj")),
+			jen.If(jen.Err().Op("!=").Nil()).Block(jen.Return(jen.Nil(), jen.Err())),
+			jen.Id("u").Dot("SetGroupVersionKind").Call(jen.Id("gvks").Index(jen.Lit(0))),
+		),
+		jen.Return(jen.Id("u"), jen.Nil()),
+	)
+
+	for _, k := range cw.adapterKinds(groupPackageNames) {
+		typ := jen.Op("*").Qual(k.pkgPath, k.gvk.Kind)
+
+		adapterfile.Line()
+		adapterfile.Comment(k.name + "FromUnstructured converts u to " + k.gvk.Kind + " in " + k.gvk.GroupVersion().String() + ".")
+		adapterfile.Func().Id(k.name+"FromUnstructured").Params(jen.Id("u").Add(unstructuredType.Clone())).Parens(jen.List(typ.Clone(), jen.Error())).Block(
+			jen.Id("obj").Op(":=").Op("&").Qual(k.pkgPath, k.gvk.Kind).Values(),
+			jen.If(
+				jen.Err().Op(":=").Qual(runtimePkg, "DefaultUnstructuredConverter").Dot("FromUnstructured").Call(jen.Id("u").Dot("UnstructuredContent").Call(), jen.Id("obj")),
+				jen.Err().Op("!=").Nil(),
+			).Block(jen.Return(jen.Nil(), jen.Err())),
+			jen.Return(jen.Id("obj"), jen.Nil()),
+		)
+
+		adapterfile.Line()
+		adapterfile.Comment(k.name + "ToUnstructured converts " + k.gvk.Kind + " in " + k.gvk.GroupVersion().String() + " to an unstructured object.")
+		adapterfile.Func().Id(k.name+"ToUnstructured").Params(jen.Id("obj").Add(typ.Clone())).Parens(jen.List(unstructuredType.Clone(), jen.Error())).Block(
+			jen.List(jen.Id("content"), jen.Err()).Op(":=").Qual(runtimePkg, "DefaultUnstructuredConverter").Dot("ToUnstructured").Call(jen.Id("obj")),
+			jen.If(jen.Err().Op("!=").Nil()).Block(jen.Return(jen.Nil(), jen.Err())),
+			jen.Id("u").Op(":=").Op("&").Qual(unstructuredPkg, "Unstructured").Values(jen.Dict{jen.Id("Object"): jen.Id("content")}),
+			jen.Id("u").Dot("SetAPIVersion").Call(jen.Lit(k.gvk.GroupVersion().String())),
+			jen.Id("u").Dot("SetKind").Call(jen.Lit(k.gvk.Kind)),
+			jen.Return(jen.Id("u"), jen.Nil()),
+		)
+	}
+
+	w, err := cw.ctx.Open(nil, "adapter.go")
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	return adapterfile.Render(w)
+}
@@ -0,0 +1,71 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crd
+
+import (
+	"go/format"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/tools/go/packages"
+	apiext "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-tools/pkg/crd"
+	"sigs.k8s.io/controller-tools/pkg/genall"
+	"sigs.k8s.io/controller-tools/pkg/loader"
+)
+
+func Test_codeWriter_GenerateUnstructuredAdapter(t *testing.T) {
+	appsv1Pkg := &loader.Package{Package: &packages.Package{PkgPath: "github.com/example/project/pkg/apis/apps/v1"}}
+	output := OutputToMemory{}
+	cw := &codeWriter{
+		headerText: "// Copyright 2022 The Authors.\n",
+		parser: &crd.Parser{
+			GroupVersions: map[*loader.Package]schema.GroupVersion{
+				appsv1Pkg: {Group: "apps.example.com", Version: "v1"},
+			},
+			CustomResourceDefinitions: map[schema.GroupKind]apiext.CustomResourceDefinition{
+				{Group: "apps.example.com", Kind: "Foo"}: {
+					Spec: apiext.CustomResourceDefinitionSpec{
+						Group: "apps.example.com",
+						Names: apiext.CustomResourceDefinitionNames{Kind: "Foo", Plural: "foos"},
+						Versions: []apiext.CustomResourceDefinitionVersion{
+							{Name: "v1", Served: true},
+							{Name: "v1beta1", Served: true},
+						},
+					},
+				},
+			},
+		},
+		ctx: &genall.GenerationContext{OutputRule: output},
+	}
+	assert.Error(t, cw.GenerateUnstructuredAdapter("", "", nil))
+	assert.NoError(t, cw.GenerateUnstructuredAdapter("", "github.com/example/project/pkg/clients/versioned/scheme", map[string]string{"apps.example.com": "apps"}))
+
+	got := output["adapter.go"].Bytes()
+	assert.Contains(t, string(got), "package versioned")
+	assert.Contains(t, string(got), `"github.com/example/project/pkg/clients/versioned/scheme"`)
+	assert.Contains(t, string(got), "func FromUnstructured(u *unstructured.Unstructured) (runtime.Object, error) {")
+	assert.Contains(t, string(got), "func ToUnstructured(obj runtime.Object) (*unstructured.Unstructured, error) {")
+	assert.Contains(t, string(got), "func AppsV1FooFromUnstructured(u *unstructured.Unstructured) (*v1.Foo, error) {")
+	assert.Contains(t, string(got), "func AppsV1FooToUnstructured(obj *v1.Foo) (*unstructured.Unstructured, error) {")
+	assert.Contains(t, string(got), `u.SetAPIVersion("apps.example.com/v1")`)
+	// v1beta1 has no go package in input
+	assert.NotContains(t, string(got), "V1beta1")
+
+	formatted, err := format.Source(got)
+	assert.NoError(t, err)
+	assert.Equal(t, string(formatted), string(got))
+}
@@ -0,0 +1,276 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crd
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/types"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/controller-tools/pkg/crd"
+	"sigs.k8s.io/controller-tools/pkg/loader"
+	"sigs.k8s.io/controller-tools/pkg/markers"
+)
+
+const validationMarkerPrefix = "kubebuilder:validation:"
+
+// apiDocsField is a row of the fields table in types.md.
+type apiDocsField struct {
+	Name       string
+	Type       string
+	JSON       string
+	Validation string
+	Doc        string
+}
+
+// GenerateGroupAPIDocs generates types.md of group listing each kind and the
+// struct types it references in each version, with their fields, json tags
+// and validation derived from markers.
+//
+// Versions and kinds are sorted by name, referenced types follow the kind in
+// the order of fields, fields of inlined embedded structs are flattened into
+// the embedding struct.
+func (cw *codeWriter) GenerateGroupAPIDocs(group string, dirName string) error {
+	pkgs := []*loader.Package{}
+	for pkg, gv := range cw.parser.GroupVersions {
+		if gv.Group == group {
+			pkgs = append(pkgs, pkg)
+		}
+	}
+	sort.Slice(pkgs, func(i, j int) bool {
+		vi, vj := cw.parser.GroupVersions[pkgs[i]].Version, cw.parser.GroupVersions[pkgs[j]].Version
+		if vi != vj {
+			return vi < vj
+		}
+		return pkgs[i].PkgPath < pkgs[j].PkgPath
+	})
+
+	codeGenerated := cw.codeGenerated
+	if len(codeGenerated) == 0 {
+		codeGenerated = "// Code generated by " + generatorName + ". DO NOT EDIT."
+	}
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "<!-- %s -->\n\n# %s\n", strings.TrimSpace(strings.TrimPrefix(codeGenerated, "//")), group)
+
+	for _, pkg := range pkgs {
+		fmt.Fprintf(buf, "\n## %s\n", cw.parser.GroupVersions[pkg].Version)
+		for _, gk := range sortedGroupKinds(cw.parser.CustomResourceDefinitions) {
+			if gk.Group != group {
+				continue
+			}
+			info := cw.parser.Types[crd.TypeIdent{Package: pkg, Name: gk.Kind}]
+			if info == nil {
+				// kind is not served in this version
+				continue
+			}
+			fmt.Fprintf(buf, "\n### %s\n", gk.Kind)
+			visited := map[string]bool{gk.Kind: true}
+			queue := []*markers.TypeInfo{info}
+			for len(queue) > 0 {
+				info, queue = queue[0], queue[1:]
+				if info.Name != gk.Kind {
+					fmt.Fprintf(buf, "\n#### %s\n", info.Name)
+				}
+				fields, refs := cw.apiDocsFields(pkg, info, map[string]bool{info.Name: true})
+				writeAPIDocsTable(buf, info.Doc, fields)
+				for _, ref := range refs {
+					if !visited[ref.Name] {
+						visited[ref.Name] = true
+						queue = append(queue, ref)
+					}
+				}
+			}
+		}
+	}
+
+	w, err := cw.ctx.Open(nil, path.Join(dirName, "types.md"))
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// apiDocsFields returns fields of struct info in pkg and the struct types in
+// pkg referenced by them. inlining holds the types being flattened to break
+// embedding cycles.
+func (cw *codeWriter) apiDocsFields(pkg *loader.Package, info *markers.TypeInfo, inlining map[string]bool) ([]apiDocsField, []*markers.TypeInfo) {
+	fields := []apiDocsField{}
+	refs := []*markers.TypeInfo{}
+	for _, field := range info.Fields {
+		jsonTag := field.Tag.Get("json")
+		jsonName := strings.Split(jsonTag, ",")[0]
+		if jsonName == "-" {
+			continue
+		}
+		name := field.Name
+		if name == "" {
+			name = embeddedTypeName(field.RawField.Type)
+			if jsonName == "" {
+				if embedded := cw.localStruct(pkg, field.RawField.Type); embedded != nil && !inlining[embedded.Name] {
+					inlining[embedded.Name] = true
+					embeddedFields, embeddedRefs := cw.apiDocsFields(pkg, embedded, inlining)
+					delete(inlining, embedded.Name)
+					fields = append(fields, embeddedFields...)
+					refs = append(refs, embeddedRefs...)
+					continue
+				}
+				jsonName = "(inline)"
+			}
+		} else if jsonName == "" {
+			jsonName = name
+		}
+		fields = append(fields, apiDocsField{
+			Name:       name,
+			Type:       types.ExprString(field.RawField.Type),
+			JSON:       jsonName,
+			Validation: validationOf(field.Markers),
+			Doc:        field.Doc,
+		})
+		for _, ref := range typeRefs(field.RawField.Type) {
+			if refInfo := cw.parser.Types[crd.TypeIdent{Package: pkg, Name: ref}]; refInfo != nil && refInfo.Fields != nil {
+				refs = append(refs, refInfo)
+			}
+		}
+	}
+	return fields, refs
+}
+
+// localStruct returns the struct type in pkg of embedded field type expr.
+func (cw *codeWriter) localStruct(pkg *loader.Package, expr ast.Expr) *markers.TypeInfo {
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	ident, ok := expr.(*ast.Ident)
+	if !ok {
+		return nil
+	}
+	info := cw.parser.Types[crd.TypeIdent{Package: pkg, Name: ident.Name}]
+	if info == nil || info.Fields == nil {
+		return nil
+	}
+	return info
+}
+
+// embeddedTypeName returns the field name of embedded field type expr.
+func embeddedTypeName(expr ast.Expr) string {
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	if sel, ok := expr.(*ast.SelectorExpr); ok {
+		return sel.Sel.Name
+	}
+	return types.ExprString(expr)
+}
+
+// typeRefs returns names of types in the package of expr referenced by expr.
+func typeRefs(expr ast.Expr) []string {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		return []string{t.Name}
+	case *ast.StarExpr:
+		return typeRefs(t.X)
+	case *ast.ArrayType:
+		return typeRefs(t.Elt)
+	case *ast.MapType:
+		return append(typeRefs(t.Key), typeRefs(t.Value)...)
+	default:
+		return nil
+	}
+}
+
+// validationOf renders validation markers of a field, sorted by marker name,
+// e.g. Minimum=1, Enum=a;b, optional.
+func validationOf(values markers.MarkerValues) string {
+	names := []string{}
+	for name := range values {
+		if strings.HasPrefix(name, validationMarkerPrefix) || name == "optional" || name == "kubebuilder:default" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	rules := []string{}
+	for _, name := range names {
+		display := strings.TrimPrefix(name, validationMarkerPrefix)
+		display = strings.TrimPrefix(display, "kubebuilder:")
+		for _, value := range values[name] {
+			if v := markerValueString(reflect.ValueOf(value)); v != "" {
+				rules = append(rules, display+"="+v)
+			} else {
+				rules = append(rules, display)
+			}
+		}
+	}
+	return strings.Join(rules, ", ")
+}
+
+// markerValueString renders the argument of a marker value, empty for markers
+// without argument.
+func markerValueString(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.Invalid:
+		return ""
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			return ""
+		}
+		return markerValueString(v.Elem())
+	case reflect.Bool:
+		if v.Bool() {
+			return ""
+		}
+		return "false"
+	case reflect.Slice:
+		items := make([]string, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			items = append(items, markerValueString(v.Index(i)))
+		}
+		return strings.Join(items, ";")
+	case reflect.Struct:
+		switch v.NumField() {
+		case 0:
+			return ""
+		case 1:
+			return markerValueString(v.Field(0))
+		}
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// writeAPIDocsTable writes doc and the fields table of a type.
+func writeAPIDocsTable(buf *bytes.Buffer, doc string, fields []apiDocsField) {
+	if doc != "" {
+		fmt.Fprintf(buf, "\n%s\n", doc)
+	}
+	if len(fields) == 0 {
+		return
+	}
+	buf.WriteString("\n| Field | Type | JSON | Validation | Description |\n| --- | --- | --- | --- | --- |\n")
+	for _, f := range fields {
+		fmt.Fprintf(buf, "| %s | `%s` | `%s` | %s | %s |\n", f.Name, f.Type, f.JSON, markdownCell(f.Validation), markdownCell(f.Doc))
+	}
+}
+
+// markdownCell escapes s to be put in a markdown table cell.
+func markdownCell(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.ReplaceAll(s, "\n", "<br>")
+}
@@ -0,0 +1,126 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crd
+
+import (
+	"go/ast"
+	"go/parser"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/tools/go/packages"
+	apiext "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-tools/pkg/crd"
+	crdmarkers "sigs.k8s.io/controller-tools/pkg/crd/markers"
+	"sigs.k8s.io/controller-tools/pkg/genall"
+	"sigs.k8s.io/controller-tools/pkg/loader"
+	"sigs.k8s.io/controller-tools/pkg/markers"
+)
+
+func testField(t *testing.T, name, typ, tag string, values markers.MarkerValues) markers.FieldInfo {
+	expr, err := parser.ParseExpr(typ)
+	assert.NoError(t, err)
+	return markers.FieldInfo{Name: name, Tag: reflect.StructTag(tag), Markers: values, RawField: &ast.Field{Type: expr}}
+}
+
+func Test_codeWriter_GenerateGroupAPIDocs(t *testing.T) {
+	v1Pkg := &loader.Package{Package: &packages.Package{PkgPath: "github.com/example/project/pkg/apis/apps/v1"}}
+	v1beta1Pkg := &loader.Package{Package: &packages.Package{PkgPath: "github.com/example/project/pkg/apis/apps/v1beta1"}}
+	types := map[crd.TypeIdent]*markers.TypeInfo{
+		{Package: v1Pkg, Name: "Foo"}: {
+			Name: "Foo",
+			Doc:  "Foo is a test kind.",
+			Fields: []markers.FieldInfo{
+				testField(t, "", "metav1.TypeMeta", `json:",inline"`, nil),
+				testField(t, "Spec", "FooSpec", `json:"spec,omitempty"`, nil),
+				testField(t, "Internal", "string", `json:"-"`, nil),
+			},
+		},
+		{Package: v1Pkg, Name: "FooSpec"}: {
+			Name: "FooSpec",
+			Fields: []markers.FieldInfo{
+				testField(t, "", "CommonSpec", `json:",inline"`, nil),
+				testField(t, "Replicas", "*int32", `json:"replicas,omitempty"`, markers.MarkerValues{
+					"kubebuilder:validation:Minimum": {crdmarkers.Minimum(1)},
+					"optional":                       {struct{}{}},
+				}),
+				testField(t, "Mode", "string", `json:"mode"`, markers.MarkerValues{
+					"kubebuilder:validation:Enum": {crdmarkers.Enum{"a", "b"}},
+				}),
+				testField(t, "Bars", "[]Bar", `json:"bars"`, nil),
+			},
+		},
+		{Package: v1Pkg, Name: "CommonSpec"}: {
+			Name: "CommonSpec",
+			Fields: []markers.FieldInfo{
+				testField(t, "Paused", "bool", `json:"paused"`, nil),
+			},
+		},
+		{Package: v1Pkg, Name: "Bar"}: {
+			Name:   "Bar",
+			Fields: []markers.FieldInfo{testField(t, "Name", "string", `json:"name"`, nil)},
+		},
+		{Package: v1beta1Pkg, Name: "Foo"}: {
+			Name:   "Foo",
+			Fields: []markers.FieldInfo{testField(t, "Size", "int", `json:"size"`, nil)},
+		},
+	}
+	output := OutputToMemory{}
+	cw := &codeWriter{
+		parser: &crd.Parser{
+			GroupVersions: map[*loader.Package]schema.GroupVersion{
+				v1Pkg:      {Group: "apps.example.com", Version: "v1"},
+				v1beta1Pkg: {Group: "apps.example.com", Version: "v1beta1"},
+			},
+			CustomResourceDefinitions: map[schema.GroupKind]apiext.CustomResourceDefinition{
+				{Group: "apps.example.com", Kind: "Foo"}: {},
+			},
+			Types: types,
+		},
+		ctx: &genall.GenerationContext{OutputRule: output},
+	}
+	assert.NoError(t, cw.GenerateGroupAPIDocs("apps.example.com", "apps"))
+
+	want := "<!-- Code generated by crd-gen. DO NOT EDIT. -->\n" +
+		"\n# apps.example.com\n" +
+		"\n## v1\n" +
+		"\n### Foo\n" +
+		"\nFoo is a test kind.\n" +
+		"\n| Field | Type | JSON | Validation | Description |\n| --- | --- | --- | --- | --- |\n" +
+		"| TypeMeta | `metav1.TypeMeta` | `(inline)` |  |  |\n" +
+		"| Spec | `FooSpec` | `spec` |  |  |\n" +
+		"\n#### FooSpec\n" +
+		"\n| Field | Type | JSON | Validation | Description |\n| --- | --- | --- | --- | --- |\n" +
+		"| Paused | `bool` | `paused` |  |  |\n" +
+		"| Replicas | `*int32` | `replicas` | Minimum=1, optional |  |\n" +
+		"| Mode | `string` | `mode` | Enum=a;b |  |\n" +
+		"| Bars | `[]Bar` | `bars` |  |  |\n" +
+		"\n#### Bar\n" +
+		"\n| Field | Type | JSON | Validation | Description |\n| --- | --- | --- | --- | --- |\n" +
+		"| Name | `string` | `name` |  |  |\n" +
+		"\n## v1beta1\n" +
+		"\n### Foo\n" +
+		"\n| Field | Type | JSON | Validation | Description |\n| --- | --- | --- | --- | --- |\n" +
+		"| Size | `int` | `size` |  |  |\n"
+	assert.Equal(t, want, output["apps/types.md"].String())
+
+	// generation is deterministic
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, cw.GenerateGroupAPIDocs("apps.example.com", "apps"))
+		assert.Equal(t, want, output["apps/types.md"].String())
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crd
+
+import (
+	"strings"
+
+	"github.com/dave/jennifer/jen"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	defaultDynamicPackage = "informers"
+)
+
+// dynamicResource is the GroupVersionResource of a kind served by CRD.
+type dynamicResource struct {
+	// name is the prefix of generated identifiers, e.g. AppsV1Foo
+	name string
+	gvk  schema.GroupVersionKind
+	gvr  schema.GroupVersionResource
+}
+
+// dynamicResources returns GroupVersionResources of all kinds in every served
+// version, sorted by group, kind and then version order in CRD. groupPackageNames
+// maps group to its go package name which prefixes generated identifiers.
+func (cw *codeWriter) dynamicResources(groupPackageNames map[string]string) []dynamicResource {
+	ret := []dynamicResource{}
+	for _, gk := range sortedGroupKinds(cw.parser.CustomResourceDefinitions) {
+		crd := cw.parser.CustomResourceDefinitions[gk]
+		pkgName, ok := groupPackageNames[gk.Group]
+		if !ok {
+			pkgName = strings.Split(gk.Group, ".")[0]
+		}
+		for _, v := range crd.Spec.Versions {
+			if !v.Served {
+				continue
+			}
+			ret = append(ret, dynamicResource{
+				name: Capitalize(pkgName) + Capitalize(v.Name) + Capitalize(gk.Kind),
+				gvk:  gk.WithVersion(v.Name),
+				gvr:  schema.GroupVersionResource{Group: gk.Group, Version: v.Name, Resource: crd.Spec.Names.Plural},
+			})
+		}
+	}
+	return ret
+}
+
+// GenerateDynamic generates dynamic.go in the informers package, which exposes
+// the GroupVersionResource of each kind and constructs dynamicinformer backed
+// GenericInformers for them. It relies on GenericInformer generated by
+// informer-gen in the same package.
+func (cw *codeWriter) GenerateDynamic(packageName string, groupPackageNames map[string]string) error {
+	if packageName == "" {
+		packageName = defaultDynamicPackage
+	}
+	dynamicfile := jen.NewFile(packageName)
+	cw.setFileDefault(dynamicfile)
+
+	const (
+		schemaPkg          = "k8s.io/apimachinery/pkg/runtime/schema"
+		dynamicinformerPkg = "k8s.io/client-go/dynamic/dynamicinformer"
+	)
+	resources := cw.dynamicResources(groupPackageNames)
+
+	dynamicfile.Line()
+	dynamicfile.Var().DefsFunc(func(g *jen.Group) {
+		for _, r := range resources {
+			g.Comment(r.name + "Resource is the GroupVersionResource of " + r.gvk.Kind + " in " + r.gvk.GroupVersion().String() + ".")
+			g.Id(r.name+"Resource").Op("=").Qual(schemaPkg, "GroupVersionResource").Values(jen.Dict{
+				jen.Id("Group"):    jen.Lit(r.gvr.Group),
+				jen.Id("Version"):  jen.Lit(r.gvr.Version),
+				jen.Id("Resource"): jen.Lit(r.gvr.Resource),
+			})
+		}
+	})
+
+	dynamicfile.Line()
+	dynamicfile.Comment("DynamicResources returns GroupVersionResources of all kinds keyed by their GroupVersionKind.")
+	dynamicfile.Func().Id("DynamicResources").Params().Map(jen.Qual(schemaPkg, "GroupVersionKind")).Qual(schemaPkg, "GroupVersionResource").Block(
+		jen.Return(jen.Map(jen.Qual(schemaPkg, "GroupVersionKind")).Qual(schemaPkg, "GroupVersionResource").Values(jen.DictFunc(func(d jen.Dict) {
+			for _, r := range resources {
+				d[jen.Values(jen.Dict{
+					jen.Id("Group"):   jen.Lit(r.gvk.Group),
+					jen.Id("Version"): jen.Lit(r.gvk.Version),
+					jen.Id("Kind"):    jen.Lit(r.gvk.Kind),
+				})] = jen.Id(r.name + "Resource")
+			}
+		}))),
+	)
+
+	dynamicfile.Line()
+	dynamicfile.Comment("ForDynamicKind returns a GenericInformer of gvk backed by the dynamic factory, it is")
+	dynamicfile.Comment("useful for kinds not registered in the scheme.")
+	dynamicfile.Func().Id("ForDynamicKind").Params(
+		jen.Id("factory").Qual(dynamicinformerPkg, "DynamicSharedInformerFactory"),
+		jen.Id("gvk").Qual(schemaPkg, "GroupVersionKind"),
+	).Parens(jen.List(jen.Id("GenericInformer"), jen.Error())).Block(
+		jen.List(jen.Id("gvr"), jen.Id("ok")).Op(":=").Id("DynamicResources").Call().Index(jen.Id("gvk")),
+		jen.If(jen.Op("!").Id("ok")).Block(
+			jen.Return(jen.Nil(), jen.Qual("fmt", "Errorf").Call(jen.Lit("no dynamic informer for kind %v"), jen.Id("gvk"))),
+		),
+		jen.Return(jen.Id("factory").Dot("ForResource").Call(jen.Id("gvr")), jen.Nil()),
+	)
+
+	for _, r := range resources {
+		dynamicfile.Line()
+		dynamicfile.Comment("New" + r.name + "DynamicInformer returns a GenericInformer of " + r.gvk.Kind + " in " + r.gvk.GroupVersion().String() + " backed by the dynamic factory.")
+		dynamicfile.Func().Id("New" + r.name + "DynamicInformer").Params(
+			jen.Id("factory").Qual(dynamicinformerPkg, "DynamicSharedInformerFactory"),
+		).Id("GenericInformer").Block(
+			jen.Return(jen.Id("factory").Dot("ForResource").Call(jen.Id(r.name + "Resource"))),
+		)
+	}
+
+	w, err := cw.ctx.Open(nil, "dynamic.go")
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	return dynamicfile.Render(w)
+}
@@ -0,0 +1,60 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crd
+
+import (
+	"go/format"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apiext "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-tools/pkg/crd"
+	"sigs.k8s.io/controller-tools/pkg/genall"
+)
+
+func Test_codeWriter_GenerateDynamic(t *testing.T) {
+	output := OutputToMemory{}
+	cw := &codeWriter{
+		headerText: "// Copyright 2022 The Authors.\n",
+		parser: &crd.Parser{
+			CustomResourceDefinitions: map[schema.GroupKind]apiext.CustomResourceDefinition{
+				{Group: "apps.example.com", Kind: "Foo"}: {
+					Spec: apiext.CustomResourceDefinitionSpec{
+						Group: "apps.example.com",
+						Names: apiext.CustomResourceDefinitionNames{Kind: "Foo", Plural: "foos"},
+						Versions: []apiext.CustomResourceDefinitionVersion{
+							{Name: "v1", Served: true},
+							{Name: "v1beta1", Served: false},
+						},
+					},
+				},
+			},
+		},
+		ctx: &genall.GenerationContext{OutputRule: output},
+	}
+	assert.NoError(t, cw.GenerateDynamic("", map[string]string{"apps.example.com": "apps"}))
+
+	got := output["dynamic.go"].Bytes()
+	assert.Contains(t, string(got), "package informers")
+	assert.Regexp(t, `AppsV1FooResource\s+= schema.GroupVersionResource{`, string(got))
+	assert.Contains(t, string(got), `Resource: "foos"`)
+	assert.Contains(t, string(got), "func NewAppsV1FooDynamicInformer(factory dynamicinformer.DynamicSharedInformerFactory) GenericInformer {")
+	assert.NotContains(t, string(got), "V1beta1")
+
+	formatted, err := format.Source(got)
+	assert.NoError(t, err)
+	assert.Equal(t, string(formatted), string(got))
+}
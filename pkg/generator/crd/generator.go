@@ -15,12 +15,15 @@
 package crd
 
 import (
+	"fmt"
 	"go/ast"
 	"path"
 	"sort"
 	"strings"
 
 	"github.com/dave/jennifer/jen"
+	apiext "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"sigs.k8s.io/controller-tools/pkg/crd"
 	crdmarkers "sigs.k8s.io/controller-tools/pkg/crd/markers"
 	"sigs.k8s.io/controller-tools/pkg/genall"
@@ -62,14 +65,166 @@ type Generator struct {
 	HeaderFile string `marker:",optional"`
 	// Year specifies the year to substitute for " YEAR" in the header file.
 	Year string `marker:",optional"`
+	// HeaderVars specifies the values to substitute for {{.<key>}} placeholders
+	// in the header file, e.g. {{.Company}}.
+	HeaderVars map[string]string `marker:",optional"`
+	// CodeGeneratedTemplate specifies the go template of the "Code generated" comment
+	// stamped on every generated go file. {{.Generator}}, {{.Date}} and {{.Version}}
+	// are available in the template.
+	//
+	// Left unspecified, the default is "// Code generated by {{.Generator}}. DO NOT EDIT."
+	CodeGeneratedTemplate string `marker:",optional"`
+	// SourceDateEpoch specifies the unix timestamp used as the generation date
+	// to make generated files reproducible.
+	//
+	// Left unspecified, the default is now.
+	SourceDateEpoch *int `marker:",optional"`
+	// SkipGroupProtection let this generator skip annotating CRDs of kubernetes
+	// community owned API groups (*.k8s.io and *.kubernetes.io) with
+	// api-approved.kubernetes.io, e.g. for internal groups in disconnected clusters.
+	SkipGroupProtection bool `marker:",optional"`
+	// VersionAnnotation specifies the annotation key used to stamp Version on every generated CRD.
+	VersionAnnotation string `marker:",optional"`
+	// Version specifies the version stamped on every generated CRD with VersionAnnotation.
+	Version string `marker:",optional"`
 	// genInstall let this generator generate install function.
 	GenInstall bool
 	// genCRD let this generator generate CustomResourceDefinition object.
 	GenCRD bool
+	// GenYAML let this generator generate CustomResourceDefinition YAML manifests
+	// along with the go constructors. It only takes effect when GenCRD is true.
+	GenYAML bool `marker:",optional"`
+	// OnlyYAML let this generator only generate CustomResourceDefinition YAML manifests
+	// and skip the go constructors. It only takes effect when GenCRD is true.
+	OnlyYAML bool `marker:",optional"`
+	// SingleYAMLFile let this generator write CustomResourceDefinition YAML manifests
+	// of all groups into the file relative to the output dir, sorted by group and
+	// kind, instead of a file per CRD. It only takes effect with GenYAML or OnlyYAML.
+	SingleYAMLFile string `marker:",optional"`
+	// AggregateOnly let this generator only generate NewCustomResourceDefinitions
+	// constructing each CustomResourceDefinition inline, and skip the exported
+	// New<Kind>CRD constructors. It only takes effect when GenCRD is true.
+	AggregateOnly bool `marker:",optional"`
+	// ForceConversionNone let this generator set the conversion strategy of every
+	// generated CustomResourceDefinition to None, instead of the strategy inferred
+	// by controller-tools, e.g. during initial bring-up of a multi-version API
+	// before the conversion webhook is deployed.
+	ForceConversionNone bool `marker:",optional"`
+	// ServedVersions overrides served of CustomResourceDefinition versions set by
+	// markers, keyed by group/version, e.g. {"apps.example.com/v1":false}.
+	ServedVersions map[string]bool `marker:",optional"`
+	// StorageVersions overrides storage of CustomResourceDefinition versions set by
+	// markers, keyed by group/version, e.g. {"apps.example.com/v2":true}. Every
+	// overridden CustomResourceDefinition must have exactly one storage version.
+	StorageVersions map[string]bool `marker:",optional"`
+	// MaxDepth specifies the maximum nesting depth of OpenAPI v3 schema of every
+	// generated CustomResourceDefinition. Deeper subtrees are pruned and replaced
+	// by x-kubernetes-preserve-unknown-fields.
+	//
+	// Left unspecified or 0, the schema is not pruned.
+	MaxDepth int `marker:",optional"`
+	// PreserveVersionOrder let this generator reorder versions of every generated
+	// CustomResourceDefinition to match the order of input packages, instead of the
+	// order sorted by controller-tools.
+	PreserveVersionOrder bool `marker:",optional"`
+	// SchemeOnly let this generator only generate the top-level install package
+	// installing all groups, and skip install packages of each group.
+	// It only takes effect when GenInstall is true.
+	SchemeOnly bool `marker:",optional"`
+	// InstallPackageName specifies the go package name and the directory name of
+	// install packages generated by GenInstall, e.g. scheme.
+	//
+	// Left unspecified, the default is install
+	InstallPackageName string `marker:",optional"`
+	// InstallReturnError let this generator additionally generate InstallOrError
+	// in install packages, which returns errors of AddToScheme instead of panicking.
+	// It only takes effect when GenInstall is true.
+	InstallReturnError bool `marker:",optional"`
+	// GenAPIDocs let this generator generate types.md for each group listing kinds
+	// and their fields, json tags and validation markers, for API documentation.
+	GenAPIDocs bool `marker:",optional"`
+	// SchemeAddMetav1 let this generator add metav1 types (e.g. ListOptions) to
+	// each group version by metav1.AddToGroupVersion in install packages, which
+	// is required by apiservers serving list and watch.
+	// It only takes effect when GenInstall is true.
+	SchemeAddMetav1 bool `marker:",optional"`
+	// ConversionPackages maps import paths of version packages to the packages
+	// their generated conversions are moved into. Install packages add these to
+	// scheme instead, whose AddToScheme adds both types and conversions.
+	// It only takes effect when GenInstall is true.
+	ConversionPackages map[string]string `marker:",optional"`
+	// GenEvents let this generator generate event recorder helper for each group.
+	// It only takes effect when GenInstall is true.
+	GenEvents bool `marker:",optional"`
+	// GenRoundTripTests let this generator generate round trip tests fuzzing
+	// serialization of each group against its Install function.
+	// It only takes effect when GenInstall is true.
+	GenRoundTripTests bool `marker:",optional"`
+	// GenRefs let this generator generate RefTo<Kind> and ObjectRefTo<Kind> for each
+	// kind in version packages of each group, which build OwnerReference and
+	// ObjectReference to objects by SchemeGroupVersion of the package.
+	// It only takes effect when GenInstall is true.
+	GenRefs bool `marker:",optional"`
+	// GenPriority let this generator generate PrioritizedVersionsAllGroups in install package.
+	// It only takes effect when GenInstall is true.
+	GenPriority bool `marker:",optional"`
+	// GenDynamic let this generator generate dynamic.go with dynamic informer helpers
+	// for the GroupVersionResource of each kind. It is generated into the informers
+	// package generated by informer-gen, and GenCRD and GenInstall should be false.
+	GenDynamic bool `marker:",optional"`
+	// DynamicPackage specifies the go package name of dynamic.go generated by GenDynamic.
+	//
+	// Left unspecified, the default is informers
+	DynamicPackage string `marker:",optional"`
+	// GenUnstructuredAdapter let this generator generate adapter.go with helpers
+	// converting each kind from and to unstructured objects. It is generated into
+	// the clientset package generated by client-gen, and GenCRD and GenInstall should be false.
+	GenUnstructuredAdapter bool `marker:",optional"`
+	// AdapterPackage specifies the go package name of adapter.go generated by GenUnstructuredAdapter.
+	//
+	// Left unspecified, the default is versioned
+	AdapterPackage string `marker:",optional"`
+	// SchemePackage specifies the import path of scheme package generated by client-gen,
+	// it is required by GenUnstructuredAdapter.
+	SchemePackage string `marker:",optional"`
+	// VersionPriority specifies the priority of version levels used by GenPriority.
+	//
+	// Left unspecified, the default is stable;beta;alpha
+	VersionPriority []string `marker:",optional"`
 }
 
+// ExtraMarkers holds additional marker definitions registered along with the
+// standard crd markers. Markers implementing crdmarkers.SchemaMarker can be used
+// to reflect custom metadata into x-kubernetes-* extensions of the schema.
+//
+// It is not a field of Generator because Generator itself is parsed as a marker,
+// set it before running the generator when embedding kube-codegen as a library.
+var ExtraMarkers []*markers.Definition
+
+// SchemaMutator mutates the generated CustomResourceDefinition of gk, e.g. to
+// inject validations which can not be expressed by markers.
+type SchemaMutator func(gk schema.GroupKind, crd *apiext.CustomResourceDefinition) error
+
+// Mutators holds SchemaMutators invoked on every generated CRD before it is
+// written as go constructors or YAML manifests. CRDs are visited in the order
+// of group and then kind, and mutators are invoked in the order of Mutators
+// on each CRD, after all CRD options of Generator (e.g. MaxDepth) are applied.
+// Generation fails on the first error returned by a mutator.
+//
+// Like ExtraMarkers, it is not a field of Generator, set it before running the
+// generator when embedding kube-codegen as a library.
+var Mutators []SchemaMutator
+
 func (Generator) RegisterMarkers(into *markers.Registry) error {
-	return crdmarkers.Register(into)
+	if err := crdmarkers.Register(into); err != nil {
+		return err
+	}
+	for _, def := range ExtraMarkers {
+		if err := into.Register(def); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (g Generator) Generate(ctx *genall.GenerationContext) error {
@@ -82,7 +237,22 @@ func (g Generator) Generate(ctx *genall.GenerationContext) error {
 		}
 		headerText = string(headerBytes)
 	}
-	headerText = strings.ReplaceAll(headerText, " YEAR", " "+g.Year)
+	headerText = renderHeader(headerText, g.Year, g.HeaderVars)
+
+	sourceDateEpoch := int64(-1)
+	if g.SourceDateEpoch != nil {
+		sourceDateEpoch = int64(*g.SourceDateEpoch)
+	}
+	codeGenerated, err := renderCodeGenerated(g.CodeGeneratedTemplate, GenerationTime(sourceDateEpoch))
+	if err != nil {
+		return err
+	}
+
+	if g.InstallPackageName != "" {
+		if err := validateInstallPackageName(g.InstallPackageName); err != nil {
+			return err
+		}
+	}
 
 	parser := &crd.Parser{
 		Collector: ctx.Collector,
@@ -109,72 +279,393 @@ func (g Generator) Generate(ctx *genall.GenerationContext) error {
 		return nil
 	}
 
-	groups := make([]string, 0)
-
+	groupSet := map[string]bool{}
 	for groupKind := range kubeKinds {
 		parser.NeedCRDFor(groupKind, g.MaxDescLen)
-		groups = append(groups, groupKind.Group)
+		groupSet[groupKind.Group] = true
 	}
+	// sort groups to make generation deterministic across runs
+	groups := make([]string, 0, len(groupSet))
+	for group := range groupSet {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
 
-	// protect kubernetes community owned API groups in CRDs
-	// see https://github.com/kubernetes/enhancements/pull/1111
-	for gk := range parser.CustomResourceDefinitions {
-		crd := parser.CustomResourceDefinitions[gk]
-		group := crd.Spec.Group
-		if strings.HasSuffix(group, ".k8s.io") || strings.HasSuffix(group, ".kubernetes.io") {
-			crd.Annotations = map[string]string{
-				KubeAPIApprovedAnnotation: "https://github.com/kubernetes/enhancements/pull/1111",
+	if err := checkVersionNames(parser, parser.CustomResourceDefinitions); err != nil {
+		return err
+	}
+
+	if !g.SkipGroupProtection {
+		protectCommunityGroups(parser.CustomResourceDefinitions)
+	}
+
+	if g.ForceConversionNone {
+		forceConversionNone(parser.CustomResourceDefinitions)
+	}
+
+	if len(g.ServedVersions) > 0 || len(g.StorageVersions) > 0 {
+		if err := overrideVersions(parser.CustomResourceDefinitions, g.ServedVersions, g.StorageVersions); err != nil {
+			return err
+		}
+	}
+
+	// stamp version on CRDs
+	if g.VersionAnnotation != "" {
+		for gk := range parser.CustomResourceDefinitions {
+			crd := parser.CustomResourceDefinitions[gk]
+			setAnnotation(&crd, g.VersionAnnotation, g.Version)
+			parser.CustomResourceDefinitions[gk] = crd
+		}
+	}
+
+	// prune schemas deeper than max depth
+	if g.MaxDepth > 0 {
+		for gk := range parser.CustomResourceDefinitions {
+			crd := parser.CustomResourceDefinitions[gk]
+			for i := range crd.Spec.Versions {
+				if v := crd.Spec.Versions[i].Schema; v != nil && v.OpenAPIV3Schema != nil {
+					pruneSchemaDepth(v.OpenAPIV3Schema, 0, g.MaxDepth)
+				}
 			}
 			parser.CustomResourceDefinitions[gk] = crd
 		}
 	}
 
+	// reorder versions as input packages declared
+	if g.PreserveVersionOrder {
+		order := versionOrder(parser, ctx.Roots)
+		for gk := range parser.CustomResourceDefinitions {
+			crd := parser.CustomResourceDefinitions[gk]
+			reorderVersions(&crd, order[gk.Group])
+			parser.CustomResourceDefinitions[gk] = crd
+		}
+	}
+
+	if err := applyMutators(parser.CustomResourceDefinitions, Mutators); err != nil {
+		return err
+	}
+
 	cw := &codeWriter{
-		headerText: headerText,
-		parser:     parser,
-		ctx:        ctx,
+		headerText:     headerText,
+		codeGenerated:  codeGenerated,
+		parser:         parser,
+		ctx:            ctx,
+		installPackage: g.InstallPackageName,
+		addMetav1:      g.SchemeAddMetav1,
+		aggregateOnly:  g.AggregateOnly,
+		returnError:    g.InstallReturnError,
+		conversions:    g.ConversionPackages,
 	}
+	groupPackageNames := map[string]string{}
 	for _, group := range groups {
 		goPackageName := ""
 		dirName := ""
+		pkgPath := ""
 		for pkg, gv := range parser.GroupVersions {
-			if gv.Group == group {
-				// use dir name as go package name
-				// k8s.io/api/apps/v1 -> apps
-				// k8s.io/api/a.b.c/v1 -> abc
-				dirName = path.Base(path.Dir(pkg.PkgPath))
-				goPackageName = strings.ReplaceAll(dirName, ".", "")
-				break
+			// pick the first package of group in order
+			if gv.Group == group && (pkgPath == "" || pkg.PkgPath < pkgPath) {
+				pkgPath = pkg.PkgPath
 			}
 		}
+		if pkgPath != "" {
+			// use dir name as go package name
+			// k8s.io/api/apps/v1 -> apps
+			// k8s.io/api/a.b.c/v1 -> abc
+			dirName = path.Base(path.Dir(pkgPath))
+			goPackageName = strings.ReplaceAll(dirName, ".", "")
+		}
 		if goPackageName == "" {
 			// use first part of group
 			goPackageName = strings.Split(group, ".")[0]
 			dirName = goPackageName
 		}
+		groupPackageNames[group] = goPackageName
 
 		if g.GenInstall {
-			if err := cw.GenerateGroupInstall(group, dirName); err != nil {
+			if err := g.generateGroupInstall(cw, group, dirName); err != nil {
+				return err
+			}
+		}
+
+		if g.GenInstall && g.GenRefs {
+			if err := cw.GenerateGroupRefs(group); err != nil {
 				return err
 			}
 		}
 
 		if g.GenCRD {
-			if err := cw.GenerateGroup(group, dirName, goPackageName); err != nil {
+			if !g.OnlyYAML {
+				if err := cw.GenerateGroup(group, dirName, goPackageName); err != nil {
+					return err
+				}
+			}
+			if (g.GenYAML || g.OnlyYAML) && g.SingleYAMLFile == "" {
+				if err := cw.GenerateGroupYAML(group, dirName); err != nil {
+					return err
+				}
+			}
+		}
+
+		if g.GenAPIDocs {
+			if err := cw.GenerateGroupAPIDocs(group, dirName); err != nil {
 				return err
 			}
 		}
 	}
 
+	if g.GenCRD && (g.GenYAML || g.OnlyYAML) && g.SingleYAMLFile != "" {
+		if err := cw.GenerateSingleYAMLFile(g.SingleYAMLFile); err != nil {
+			return err
+		}
+	}
+
+	if g.GenDynamic {
+		if err := cw.GenerateDynamic(g.DynamicPackage, groupPackageNames); err != nil {
+			return err
+		}
+	}
+
+	if g.GenUnstructuredAdapter {
+		if err := cw.GenerateUnstructuredAdapter(g.AdapterPackage, g.SchemePackage, groupPackageNames); err != nil {
+			return err
+		}
+	}
+
 	if g.GenInstall {
-		if err := cw.GenerateScheme(metav1Pkg); err != nil {
+		if err := g.generateSchemeInstall(cw, metav1Pkg); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// generateGroupInstall generates install package of the group with its
+// helpers, nothing is generated if SchemeOnly is true.
+func (g Generator) generateGroupInstall(cw *codeWriter, group, dirName string) error {
+	if g.SchemeOnly {
+		return nil
+	}
+	if err := checkInstallPackageCollision(cw.ctx.OutputRule, path.Join(dirName, cw.installPackageName())); err != nil {
+		return err
+	}
+	if err := cw.GenerateGroupInstall(group, dirName); err != nil {
+		return err
+	}
+	if g.GenEvents {
+		if err := cw.GenerateGroupEvents(group, dirName); err != nil {
+			return err
+		}
+	}
+	if g.GenRoundTripTests {
+		if err := cw.GenerateGroupRoundTripTest(group, dirName); err != nil {
 			return err
 		}
 	}
+	return nil
+}
+
+// generateSchemeInstall generates the top-level install package installing
+// all groups.
+func (g Generator) generateSchemeInstall(cw *codeWriter, metav1Pkg *loader.Package) error {
+	if err := checkInstallPackageCollision(cw.ctx.OutputRule, cw.installPackageName()); err != nil {
+		return err
+	}
+	if err := cw.GenerateScheme(metav1Pkg); err != nil {
+		return err
+	}
+	if g.GenPriority {
+		if err := cw.GenerateSchemePriority(metav1Pkg, g.VersionPriority); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyMutators invokes mutators on crds in the order of group and kind.
+func applyMutators(crds map[schema.GroupKind]apiext.CustomResourceDefinition, mutators []SchemaMutator) error {
+	if len(mutators) == 0 {
+		return nil
+	}
+	for _, gk := range sortedGroupKinds(crds) {
+		crd := crds[gk]
+		for _, mutate := range mutators {
+			if err := mutate(gk, &crd); err != nil {
+				return fmt.Errorf("failed to mutate CRD of %v: %w", gk, err)
+			}
+		}
+		crds[gk] = crd
+	}
+	return nil
+}
+
+// protectCommunityGroups annotates CRDs of kubernetes community owned API
+// groups, see https://github.com/kubernetes/enhancements/pull/1111
+func protectCommunityGroups(crds map[schema.GroupKind]apiext.CustomResourceDefinition) {
+	for gk := range crds {
+		crd := crds[gk]
+		group := crd.Spec.Group
+		if strings.HasSuffix(group, ".k8s.io") || strings.HasSuffix(group, ".kubernetes.io") {
+			setAnnotation(&crd, KubeAPIApprovedAnnotation, "https://github.com/kubernetes/enhancements/pull/1111")
+			crds[gk] = crd
+		}
+	}
+}
+
+// forceConversionNone sets conversion strategy of crds to None.
+func forceConversionNone(crds map[schema.GroupKind]apiext.CustomResourceDefinition) {
+	for gk := range crds {
+		crd := crds[gk]
+		crd.Spec.Conversion = &apiext.CustomResourceConversion{Strategy: apiext.NoneConverter}
+		crds[gk] = crd
+	}
+}
+
+// overrideVersions sets served and storage of versions of crds keyed by
+// group/version in served and storage. It returns error if any key matches no
+// version, or any overridden crd does not have exactly one storage version
+// afterwards.
+func overrideVersions(crds map[schema.GroupKind]apiext.CustomResourceDefinition, served, storage map[string]bool) error {
+	matched := map[string]bool{}
+	for _, gk := range sortedGroupKinds(crds) {
+		crd := crds[gk]
+		overridden := false
+		for i := range crd.Spec.Versions {
+			v := &crd.Spec.Versions[i]
+			key := gk.Group + "/" + v.Name
+			if value, ok := served[key]; ok {
+				v.Served = value
+				matched[key], overridden = true, true
+			}
+			if value, ok := storage[key]; ok {
+				v.Storage = value
+				matched[key], overridden = true, true
+			}
+		}
+		if !overridden {
+			continue
+		}
+		storageVersions := []string{}
+		for _, v := range crd.Spec.Versions {
+			if v.Storage {
+				storageVersions = append(storageVersions, v.Name)
+			}
+		}
+		if len(storageVersions) != 1 {
+			return fmt.Errorf("CustomResourceDefinition %v must have exactly one storage version, got %v", gk, storageVersions)
+		}
+		crds[gk] = crd
+	}
 
+	unmatched := []string{}
+	for _, overrides := range []map[string]bool{served, storage} {
+		for key := range overrides {
+			if !matched[key] {
+				unmatched = append(unmatched, key)
+				// report once
+				matched[key] = true
+			}
+		}
+	}
+	if len(unmatched) > 0 {
+		sort.Strings(unmatched)
+		return fmt.Errorf("served or storage overrides of %v match no CustomResourceDefinition version", unmatched)
+	}
 	return nil
 }
 
+// sortedGroupKinds returns GroupKinds of crds sorted by group and then kind.
+func sortedGroupKinds(crds map[schema.GroupKind]apiext.CustomResourceDefinition) []schema.GroupKind {
+	gks := make([]schema.GroupKind, 0, len(crds))
+	for gk := range crds {
+		gks = append(gks, gk)
+	}
+	sort.Slice(gks, func(i, j int) bool {
+		if gks[i].Group != gks[j].Group {
+			return gks[i].Group < gks[j].Group
+		}
+		return gks[i].Kind < gks[j].Kind
+	})
+	return gks
+}
+
+// setAnnotation sets annotation on crd without dropping existing annotations.
+func setAnnotation(crd *apiext.CustomResourceDefinition, key, value string) {
+	if crd.Annotations == nil {
+		crd.Annotations = map[string]string{}
+	}
+	crd.Annotations[key] = value
+}
+
+// versionOrder returns the index of each version within its group in the
+// order of roots.
+func versionOrder(parser *crd.Parser, roots []*loader.Package) map[string]map[string]int {
+	order := map[string]map[string]int{}
+	for _, root := range roots {
+		gv, ok := parser.GroupVersions[root]
+		if !ok {
+			continue
+		}
+		if order[gv.Group] == nil {
+			order[gv.Group] = map[string]int{}
+		}
+		if _, ok := order[gv.Group][gv.Version]; !ok {
+			order[gv.Group][gv.Version] = len(order[gv.Group])
+		}
+	}
+	return order
+}
+
+// reorderVersions sorts versions of crd by order, versions not in order are
+// moved to the end and keep their relative order.
+func reorderVersions(crd *apiext.CustomResourceDefinition, order map[string]int) {
+	index := func(version string) int {
+		if i, ok := order[version]; ok {
+			return i
+		}
+		return len(order)
+	}
+	sort.SliceStable(crd.Spec.Versions, func(i, j int) bool {
+		return index(crd.Spec.Versions[i].Name) < index(crd.Spec.Versions[j].Name)
+	})
+}
+
+// pruneSchemaDepth replaces subtrees of schema deeper than maxDepth with
+// x-kubernetes-preserve-unknown-fields, depth is the depth of schema itself.
+func pruneSchemaDepth(schema *apiext.JSONSchemaProps, depth, maxDepth int) {
+	if depth >= maxDepth {
+		if len(schema.Properties) == 0 && schema.Items == nil && schema.AdditionalProperties == nil {
+			return
+		}
+		preserve := true
+		pruned := apiext.JSONSchemaProps{
+			Description:            schema.Description,
+			XPreserveUnknownFields: &preserve,
+		}
+		if schema.Type == "object" {
+			pruned.Type = schema.Type
+		}
+		*schema = pruned
+		return
+	}
+
+	for name, prop := range schema.Properties {
+		pruneSchemaDepth(&prop, depth+1, maxDepth)
+		schema.Properties[name] = prop
+	}
+	if schema.Items != nil {
+		if schema.Items.Schema != nil {
+			pruneSchemaDepth(schema.Items.Schema, depth+1, maxDepth)
+		}
+		for i := range schema.Items.JSONSchemas {
+			pruneSchemaDepth(&schema.Items.JSONSchemas[i], depth+1, maxDepth)
+		}
+	}
+	if schema.AdditionalProperties != nil && schema.AdditionalProperties.Schema != nil {
+		pruneSchemaDepth(schema.AdditionalProperties.Schema, depth+1, maxDepth)
+	}
+}
+
 func (Generator) CheckFilter() loader.NodeFilter {
 	return filterTypesForCRDs
 }
@@ -200,47 +691,66 @@ func filterTypesForCRDs(node ast.Node) bool {
 
 type codeWriter struct {
 	headerText string
-	parser     *crd.Parser
-	ctx        *genall.GenerationContext
+	// codeGenerated is the rendered "Code generated" comment, empty means
+	// the default one.
+	codeGenerated string
+	parser        *crd.Parser
+	ctx           *genall.GenerationContext
+	// installPackage is the go package name and directory name of install
+	// packages, empty means defaultInstallPackage.
+	installPackage string
+	// addMetav1 adds metav1 types to group versions of install packages.
+	addMetav1 bool
+	// aggregateOnly skips New<Kind>CRD constructors.
+	aggregateOnly bool
+	// returnError generates InstallOrError along with Install.
+	returnError bool
+	// conversions maps version packages to their conversion packages added
+	// to scheme instead of them.
+	conversions map[string]string
+}
+
+// installPackageName returns the go package name and directory name of
+// install packages.
+func (cw *codeWriter) installPackageName() string {
+	if len(cw.installPackage) == 0 {
+		return defaultInstallPackage
+	}
+	return cw.installPackage
 }
 
 func (cw *codeWriter) setFileDefault(f *jen.File) {
-	f.HeaderComment("// +build !ignore_autogenerated\n")
+	// go:build for go1.17+ and +build for legacy toolchains
+	f.HeaderComment("//go:build !ignore_autogenerated\n// +build !ignore_autogenerated\n")
 	f.HeaderComment(cw.headerText + "\n")
-	f.HeaderComment("// Code generated by crd-gen. DO NOT EDIT.")
+	codeGenerated := cw.codeGenerated
+	if len(codeGenerated) == 0 {
+		codeGenerated = "// Code generated by " + generatorName + ". DO NOT EDIT."
+	}
+	f.HeaderComment(codeGenerated)
 
 	f.ImportAlias("k8s.io/apimachinery/pkg/apis/meta/v1", "metav1")
 	f.ImportAlias("k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1", "apiextensionsv1beta1")
 	f.ImportAlias("k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1", "apiextensionsv1")
 	f.ImportAlias("k8s.io/apimachinery/pkg/util/runtime", "utilruntime")
+	f.ImportAlias("k8s.io/apimachinery/pkg/util/errors", "utilerrors")
 }
 
 func (cw *codeWriter) GenerateScheme(metav1Pkg *loader.Package) error {
-	schemefile := jen.NewFile("install")
+	schemefile := jen.NewFile(cw.installPackageName())
 	cw.setFileDefault(schemefile)
 
-	schemefile.Line()
-	schemefile.Func().Id("Install").Params(jen.Id("scheme").Op("*").Qual("k8s.io/apimachinery/pkg/runtime", "Scheme")).BlockFunc(func(g *jen.Group) {
-		must := jen.Qual("k8s.io/apimachinery/pkg/util/runtime", "Must")
-		pkgs := []string{}
-		for pkg := range cw.parser.GroupVersions {
-			if pkg == metav1Pkg {
-				continue
-			}
-			pkgs = append(pkgs, loader.NonVendorPath(pkg.PkgPath))
-		}
-		sort.Strings(pkgs)
-		for _, pkg := range pkgs {
-			// add alias
-			alias := path.Base(path.Dir(pkg)) + path.Base(pkg)
-			alias = strings.ReplaceAll(alias, ".", "")
-			schemefile.ImportAlias(pkg, alias)
-
-			g.Add(must.Clone().Call(jen.Qual(pkg, "AddToScheme").Call(jen.Id("scheme"))))
+	pkgs := []string{}
+	for pkg := range cw.parser.GroupVersions {
+		if pkg == metav1Pkg {
+			continue
 		}
-	})
+		pkgs = append(pkgs, loader.NonVendorPath(pkg.PkgPath))
+	}
+	sort.Strings(pkgs)
+	cw.generateInstallFuncs(schemefile, pkgs)
 
-	w, err := cw.ctx.Open(nil, "install/zz.generated.scheme.go")
+	w, err := cw.ctx.Open(nil, path.Join(cw.installPackageName(), "zz.generated.scheme.go"))
 	if err != nil {
 		return err
 	}
@@ -252,32 +762,76 @@ func (cw *codeWriter) GenerateScheme(metav1Pkg *loader.Package) error {
 	return nil
 }
 
-func (cw *codeWriter) GenerateGroupInstall(group string, dirName string) error {
-	schemefile := jen.NewFile("install")
-	cw.setFileDefault(schemefile)
+// generateInstallFuncs generates Install adding types of pkgs to scheme in
+// the order of pkgs, which panics on errors. InstallOrError returning the
+// aggregated errors is generated as well if returnError is true.
+func (cw *codeWriter) generateInstallFuncs(f *jen.File, pkgs []string) {
+	for _, pkg := range pkgs {
+		// add alias
+		alias := path.Base(path.Dir(pkg)) + path.Base(pkg)
+		alias = strings.ReplaceAll(alias, ".", "")
+		f.ImportAlias(pkg, alias)
+		if conversions, ok := cw.conversions[pkg]; ok {
+			f.ImportAlias(conversions, alias+strings.ReplaceAll(path.Base(conversions), ".", ""))
+		}
+	}
+	// conversions moved out of version packages are added by their packages
+	addToScheme := func(pkg string) *jen.Statement {
+		if conversions, ok := cw.conversions[pkg]; ok {
+			return jen.Qual(conversions, "AddToScheme")
+		}
+		return jen.Qual(pkg, "AddToScheme")
+	}
+	addMetav1 := func(g *jen.Group, pkg string) {
+		if cw.addMetav1 {
+			g.Add(jen.Qual("k8s.io/apimachinery/pkg/apis/meta/v1", "AddToGroupVersion").Call(jen.Id("scheme"), jen.Qual(pkg, "SchemeGroupVersion")))
+		}
+	}
 
-	schemefile.Line()
-	schemefile.Func().Id("Install").Params(jen.Id("scheme").Op("*").Qual("k8s.io/apimachinery/pkg/runtime", "Scheme")).BlockFunc(func(g *jen.Group) {
+	f.Line()
+	f.Func().Id("Install").Params(jen.Id("scheme").Op("*").Qual("k8s.io/apimachinery/pkg/runtime", "Scheme")).BlockFunc(func(g *jen.Group) {
 		must := jen.Qual("k8s.io/apimachinery/pkg/util/runtime", "Must")
-		pkgs := []string{}
-		for pkg, gv := range cw.parser.GroupVersions {
-			if gv.Group != group {
-				continue
-			}
-			pkgs = append(pkgs, loader.NonVendorPath(pkg.PkgPath))
-		}
-		sort.Strings(pkgs)
 		for _, pkg := range pkgs {
-			// add alias
-			alias := path.Base(path.Dir(pkg)) + path.Base(pkg)
-			alias = strings.ReplaceAll(alias, ".", "")
-			schemefile.ImportAlias(pkg, alias)
+			g.Add(must.Clone().Call(addToScheme(pkg).Call(jen.Id("scheme"))))
+			addMetav1(g, pkg)
+		}
+	})
+	if !cw.returnError {
+		return
+	}
 
-			g.Add(must.Clone().Call(jen.Qual(pkg, "AddToScheme").Call(jen.Id("scheme"))))
+	f.Line()
+	f.Comment("InstallOrError is like Install, but returns the aggregated errors of AddToScheme instead of panicking.")
+	f.Func().Id("InstallOrError").Params(jen.Id("scheme").Op("*").Qual("k8s.io/apimachinery/pkg/runtime", "Scheme")).Error().BlockFunc(func(g *jen.Group) {
+		g.Id("errs").Op(":=").Index().Error().Values()
+		for _, pkg := range pkgs {
+			g.If(
+				jen.Err().Op(":=").Add(addToScheme(pkg)).Call(jen.Id("scheme")),
+				jen.Err().Op("!=").Nil(),
+			).Block(
+				jen.Id("errs").Op("=").Append(jen.Id("errs"), jen.Err()),
+			)
+			addMetav1(g, pkg)
 		}
+		g.Return(jen.Qual("k8s.io/apimachinery/pkg/util/errors", "NewAggregate").Call(jen.Id("errs")))
 	})
+}
+
+func (cw *codeWriter) GenerateGroupInstall(group string, dirName string) error {
+	schemefile := jen.NewFile(cw.installPackageName())
+	cw.setFileDefault(schemefile)
+
+	pkgs := []string{}
+	for pkg, gv := range cw.parser.GroupVersions {
+		if gv.Group != group {
+			continue
+		}
+		pkgs = append(pkgs, loader.NonVendorPath(pkg.PkgPath))
+	}
+	sort.Strings(pkgs)
+	cw.generateInstallFuncs(schemefile, pkgs)
 
-	filename := path.Join(dirName, "install", "zz.generated.install.go")
+	filename := path.Join(dirName, cw.installPackageName(), "zz.generated.install.go")
 	w, err := cw.ctx.Open(nil, filename)
 	if err != nil {
 		return err
@@ -290,17 +844,92 @@ func (cw *codeWriter) GenerateGroupInstall(group string, dirName string) error {
 	return nil
 }
 
+func (cw *codeWriter) GenerateGroupEvents(group string, dirName string) error {
+	eventsfile := jen.NewFile(cw.installPackageName())
+	cw.setFileDefault(eventsfile)
+	eventsfile.ImportAlias("k8s.io/api/core/v1", "corev1")
+
+	eventsfile.Line()
+	eventsfile.Comment("NewRecorder installs " + group + " types into scheme and returns an EventRecorder")
+	eventsfile.Comment("which records events with the given component as source.")
+	eventsfile.Func().Id("NewRecorder").Params(
+		jen.Id("broadcaster").Qual("k8s.io/client-go/tools/record", "EventBroadcaster"),
+		jen.Id("scheme").Op("*").Qual("k8s.io/apimachinery/pkg/runtime", "Scheme"),
+		jen.Id("component").String(),
+	).Qual("k8s.io/client-go/tools/record", "EventRecorder").Block(
+		jen.Id("Install").Call(jen.Id("scheme")),
+		jen.Return(jen.Id("broadcaster").Dot("NewRecorder").Call(
+			jen.Id("scheme"),
+			jen.Qual("k8s.io/api/core/v1", "EventSource").Values(jen.Dict{
+				jen.Id("Component"): jen.Id("component"),
+			}),
+		)),
+	)
+
+	filename := path.Join(dirName, cw.installPackageName(), "zz.generated.events.go")
+	w, err := cw.ctx.Open(nil, filename)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	return eventsfile.Render(w)
+}
+
+// GenerateGroupRoundTripTest generates a round trip test in install package of
+// the group, which fuzzes serialization of all external types installed by
+// Install. Protobuf is skipped since the types are not required to support it.
+func (cw *codeWriter) GenerateGroupRoundTripTest(group string, dirName string) error {
+	testfile := jen.NewFile(cw.installPackageName())
+	cw.setFileDefault(testfile)
+	testfile.ImportAlias("k8s.io/apimachinery/pkg/runtime/serializer", "runtimeserializer")
+	testfile.ImportAlias("k8s.io/apimachinery/pkg/apis/meta/fuzzer", "metafuzzer")
+
+	testfile.Line()
+	testfile.Comment("TestRoundTripTypes fuzzes serialization of all " + group + " types installed by Install.")
+	testfile.Func().Id("TestRoundTripTypes").Params(
+		jen.Id("t").Op("*").Qual("testing", "T"),
+	).Block(
+		jen.Id("scheme").Op(":=").Qual("k8s.io/apimachinery/pkg/runtime", "NewScheme").Call(),
+		jen.Id("Install").Call(jen.Id("scheme")),
+		jen.Id("codecs").Op(":=").Qual("k8s.io/apimachinery/pkg/runtime/serializer", "NewCodecFactory").Call(jen.Id("scheme")),
+		jen.Id("f").Op(":=").Qual("k8s.io/apimachinery/pkg/api/apitesting/fuzzer", "FuzzerFor").Call(
+			jen.Qual("k8s.io/apimachinery/pkg/apis/meta/fuzzer", "Funcs"),
+			jen.Qual("math/rand", "NewSource").Call(jen.Qual("math/rand", "Int63").Call()),
+			jen.Id("codecs"),
+		),
+		jen.Qual("k8s.io/apimachinery/pkg/api/apitesting/roundtrip", "RoundTripExternalTypesWithoutProtobuf").Call(
+			jen.Id("t"),
+			jen.Id("scheme"),
+			jen.Id("codecs"),
+			jen.Id("f"),
+			jen.Nil(),
+		),
+	)
+
+	filename := path.Join(dirName, cw.installPackageName(), "roundtrip_test.go")
+	w, err := cw.ctx.Open(nil, filename)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	return testfile.Render(w)
+}
+
 func (cw *codeWriter) GenerateGroup(group string, dirName, goPackageName string) error {
 	crdsfile := jen.NewFile(goPackageName)
 	cw.setFileDefault(crdsfile)
 
 	newCRDs := []jen.Code{}
-	for groupKind := range cw.parser.CustomResourceDefinitions {
+	for _, groupKind := range sortedGroupKinds(cw.parser.CustomResourceDefinitions) {
 		if groupKind.Group != group {
 			continue
 		}
 		crd := cw.parser.CustomResourceDefinitions[groupKind]
 		value := GenerateValue(&crd)
+		if cw.aggregateOnly {
+			newCRDs = append(newCRDs, value)
+			continue
+		}
 		crdid := jen.Op("*").Qual("k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1", "CustomResourceDefinition")
 		crdsfile.Comment("//nolint")
 		crdsfile.Func().Id("New" + Capitalize(groupKind.Kind) + "CRD").Params().Add(crdid.Clone()).Block(
@@ -327,3 +956,30 @@ func (cw *codeWriter) GenerateGroup(group string, dirName, goPackageName string)
 	defer writer.Close()
 	return crdsfile.Render(writer)
 }
+
+// GenerateSingleYAMLFile generates CustomResourceDefinition YAML manifests of
+// all groups into filename as a multi-document YAML, sorted by group and kind.
+func (cw *codeWriter) GenerateSingleYAMLFile(filename string) error {
+	gks := sortedGroupKinds(cw.parser.CustomResourceDefinitions)
+	crds := make([]interface{}, 0, len(gks))
+	for _, groupKind := range gks {
+		crds = append(crds, cw.parser.CustomResourceDefinitions[groupKind])
+	}
+	return cw.ctx.WriteYAML(filename, crds...)
+}
+
+// GenerateGroupYAML generates CustomResourceDefinition YAML manifests of the
+// group into <dirName>/crds/<group>_<plural>.yaml
+func (cw *codeWriter) GenerateGroupYAML(group string, dirName string) error {
+	for _, groupKind := range sortedGroupKinds(cw.parser.CustomResourceDefinitions) {
+		if groupKind.Group != group {
+			continue
+		}
+		crd := cw.parser.CustomResourceDefinitions[groupKind]
+		filename := path.Join(dirName, "crds", fmt.Sprintf("%s_%s.yaml", crd.Spec.Group, crd.Spec.Names.Plural))
+		if err := cw.ctx.WriteYAML(filename, crd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,614 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crd
+
+import (
+	"fmt"
+	"go/format"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/tools/go/packages"
+	apiext "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-tools/pkg/crd"
+	"sigs.k8s.io/controller-tools/pkg/genall"
+	"sigs.k8s.io/controller-tools/pkg/loader"
+	"sigs.k8s.io/controller-tools/pkg/markers"
+	"sigs.k8s.io/yaml"
+)
+
+// e2e is set by e2e_test.go when tests are built with tag e2e.
+var e2e bool
+
+// skipUnlessE2E skips end-to-end tests unless tag e2e is set, they run go
+// programs in temporary modules with -mod=mod, which resolves modules over the
+// network.
+func skipUnlessE2E(t *testing.T) {
+	if !e2e {
+		t.Skip("end-to-end test, run with -tags e2e")
+	}
+}
+
+// exitStderr returns stderr of the command failed with err, which is captured
+// by exec.Cmd.Output.
+func exitStderr(err error) string {
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return string(exitErr.Stderr)
+	}
+	return ""
+}
+
+func Test_setAnnotation(t *testing.T) {
+	crd := apiext.CustomResourceDefinition{}
+	setAnnotation(&crd, KubeAPIApprovedAnnotation, "https://github.com/kubernetes/enhancements/pull/1111")
+	setAnnotation(&crd, "example.com/version", "v1.2.3")
+
+	assert.Equal(t, map[string]string{
+		KubeAPIApprovedAnnotation: "https://github.com/kubernetes/enhancements/pull/1111",
+		"example.com/version":     "v1.2.3",
+	}, crd.Annotations)
+
+	// go output
+	code := fmt.Sprintf("%#v", GenerateValue(&crd))
+	assert.Regexp(t, `"example.com/version":\s+"v1.2.3"`, code)
+
+	// yaml output
+	out, err := yaml.Marshal(crd)
+	assert.NoError(t, err)
+	assert.Contains(t, string(out), "example.com/version: v1.2.3")
+}
+
+func Test_reorderVersions(t *testing.T) {
+	crd := apiext.CustomResourceDefinition{
+		Spec: apiext.CustomResourceDefinitionSpec{
+			Versions: []apiext.CustomResourceDefinitionVersion{
+				{Name: "v1"},
+				{Name: "v1alpha1"},
+				{Name: "v1beta1"},
+			},
+		},
+	}
+	reorderVersions(&crd, map[string]int{"v1beta1": 0, "v1": 1})
+
+	names := []string{}
+	for _, v := range crd.Spec.Versions {
+		names = append(names, v.Name)
+	}
+	assert.Equal(t, []string{"v1beta1", "v1", "v1alpha1"}, names)
+}
+
+// nodeSchema returns schema of a self-referential type Node{Value string; Children []Node}
+// unrolled to depth levels.
+func nodeSchema(depth int) apiext.JSONSchemaProps {
+	schema := apiext.JSONSchemaProps{
+		Type: "object",
+		Properties: map[string]apiext.JSONSchemaProps{
+			"value": {Type: "string"},
+		},
+	}
+	if depth > 0 {
+		child := nodeSchema(depth - 1)
+		schema.Properties["children"] = apiext.JSONSchemaProps{
+			Type:        "array",
+			Description: "children of node",
+			Items:       &apiext.JSONSchemaPropsOrArray{Schema: &child},
+		}
+	}
+	return schema
+}
+
+func Test_pruneSchemaDepth(t *testing.T) {
+	schema := nodeSchema(5)
+	pruneSchemaDepth(&schema, 0, 3)
+
+	// root(0) -> children(1) -> items(2) -> children(3)
+	children := schema.Properties["children"].Items.Schema.Properties["children"]
+	preserve := true
+	assert.Equal(t, apiext.JSONSchemaProps{
+		Description:            "children of node",
+		XPreserveUnknownFields: &preserve,
+	}, children)
+	assert.Equal(t, apiext.JSONSchemaProps{Type: "string"}, schema.Properties["children"].Items.Schema.Properties["value"])
+
+	// not deep enough to be pruned
+	shallow := nodeSchema(1)
+	pruneSchemaDepth(&shallow, 0, 3)
+	assert.Equal(t, nodeSchema(1), shallow)
+}
+
+type vendorMarker string
+
+func TestGenerator_RegisterMarkers(t *testing.T) {
+	defn := markers.Must(markers.MakeDefinition("example:vendor", markers.DescribesField, vendorMarker("")))
+	ExtraMarkers = []*markers.Definition{defn}
+	defer func() { ExtraMarkers = nil }()
+
+	reg := &markers.Registry{}
+	assert.NoError(t, Generator{}.RegisterMarkers(reg))
+	// standard markers
+	assert.NotNil(t, reg.Lookup("+kubebuilder:validation:Optional", markers.DescribesField))
+	// extra markers
+	assert.Equal(t, defn, reg.Lookup("+example:vendor", markers.DescribesField))
+}
+
+func Test_codeWriter_buildConstraints(t *testing.T) {
+	output := OutputToMemory{}
+	cw := &codeWriter{
+		headerText: "// Copyright 2022 The Authors.\n",
+		ctx:        &genall.GenerationContext{OutputRule: output},
+	}
+	assert.NoError(t, cw.GenerateGroupEvents("apps.example.com", "apps"))
+
+	got := output["apps/install/zz.generated.events.go"].Bytes()
+	assert.Contains(t, string(got), "//go:build !ignore_autogenerated\n// +build !ignore_autogenerated\n")
+
+	formatted, err := format.Source(got)
+	assert.NoError(t, err)
+	assert.Equal(t, string(formatted), string(got))
+}
+
+func Test_codeWriter_GenerateGroupRoundTripTest(t *testing.T) {
+	appsv1Pkg := &loader.Package{Package: &packages.Package{PkgPath: "github.com/example/project/pkg/apis/apps/v1"}}
+	output := OutputToMemory{}
+	cw := &codeWriter{
+		headerText: "// Copyright 2022 The Authors.\n",
+		parser: &crd.Parser{
+			GroupVersions: map[*loader.Package]schema.GroupVersion{
+				appsv1Pkg: {Group: "apps.example.com", Version: "v1"},
+			},
+		},
+		ctx: &genall.GenerationContext{OutputRule: output},
+	}
+	assert.NoError(t, cw.GenerateGroupInstall("apps.example.com", "apps"))
+	assert.NoError(t, cw.GenerateGroupRoundTripTest("apps.example.com", "apps"))
+
+	got := output["apps/install/roundtrip_test.go"].Bytes()
+	assert.Contains(t, string(got), "package install")
+	assert.Contains(t, string(got), "roundtrip.RoundTripExternalTypesWithoutProtobuf(t, scheme, codecs, f, nil)")
+
+	formatted, err := format.Source(got)
+	assert.NoError(t, err)
+	assert.Equal(t, string(formatted), string(got))
+
+	// the generated test round trips the external kinds installed by Install
+	root := t.TempDir()
+	gomod, err := ioutil.ReadFile("../../../go.mod")
+	assert.NoError(t, err)
+	gosum, err := ioutil.ReadFile("../../../go.sum")
+	assert.NoError(t, err)
+	files := map[string]string{
+		"go.mod":                           strings.Replace(string(gomod), "module github.com/zoumo/kube-codegen", "module github.com/example/project", 1),
+		"go.sum":                           string(gosum),
+		"pkg/apis/apps/install/install.go": output["apps/install/zz.generated.install.go"].String(),
+		"pkg/apis/apps/install/roundtrip_test.go": string(got),
+		"pkg/apis/apps/v1/types.go": `package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var SchemeGroupVersion = schema.GroupVersion{Group: "apps.example.com", Version: "v1"}
+
+func AddToScheme(scheme *runtime.Scheme) error {
+	scheme.AddKnownTypes(SchemeGroupVersion, &Foo{})
+	metav1.AddToGroupVersion(scheme, SchemeGroupVersion)
+	return nil
+}
+
+type Foo struct {
+	metav1.TypeMeta   ` + "`json:\",inline\"`" + `
+	metav1.ObjectMeta ` + "`json:\"metadata,omitempty\"`" + `
+	Replicas          int32 ` + "`json:\"replicas\"`" + `
+}
+
+func (in *Foo) DeepCopyObject() runtime.Object {
+	out := *in
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	return &out
+}
+`,
+	}
+	for name, content := range files {
+		file := filepath.Join(root, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(file), 0755))
+		assert.NoError(t, ioutil.WriteFile(file, []byte(content), 0644))
+	}
+	skipUnlessE2E(t)
+	cmd := exec.Command("go", "test", "-v", "./pkg/apis/apps/install/")
+	cmd.Dir = root
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod")
+	out, err := cmd.CombinedOutput()
+	assert.NoError(t, err, string(out))
+	assert.Contains(t, string(out), "--- PASS: TestRoundTripTypes/apps.example.com.v1.Foo")
+}
+
+func Test_codeWriter_GenerateGroup(t *testing.T) {
+	output := OutputToMemory{}
+	cw := &codeWriter{
+		headerText: "// Copyright 2022 The Authors.\n",
+		parser: &crd.Parser{
+			CustomResourceDefinitions: map[schema.GroupKind]apiext.CustomResourceDefinition{
+				{Group: "apps.example.com", Kind: "Foo"}: {
+					ObjectMeta: metav1.ObjectMeta{Name: "foos.apps.example.com"},
+					Spec: apiext.CustomResourceDefinitionSpec{
+						Group: "apps.example.com",
+						Names: apiext.CustomResourceDefinitionNames{Kind: "Foo", Plural: "foos"},
+					},
+				},
+				{Group: "batch.example.com", Kind: "Bar"}: {},
+			},
+		},
+		ctx: &genall.GenerationContext{OutputRule: output},
+	}
+	assert.NoError(t, cw.GenerateGroup("apps.example.com", "apps", "apps"))
+
+	assert.Len(t, output, 1)
+	got := output["apps/zz.generated.crd.go"].String()
+	assert.Contains(t, got, "package apps")
+	assert.Contains(t, got, "func NewFooCRD() *apiextensionsv1.CustomResourceDefinition {")
+	assert.Regexp(t, `Name:\s+"foos.apps.example.com"`, got)
+	assert.Contains(t, got, "return []*apiextensionsv1.CustomResourceDefinition{NewFooCRD()}")
+	assert.NotContains(t, got, "NewBarCRD")
+
+	// only the aggregator
+	cw.aggregateOnly = true
+	assert.NoError(t, cw.GenerateGroup("apps.example.com", "apps", "apps"))
+	got = output["apps/zz.generated.crd.go"].String()
+	assert.NotRegexp(t, `New\w+CRD`, got)
+	assert.Contains(t, got, "func NewCustomResourceDefinitions() []*apiextensionsv1.CustomResourceDefinition {")
+	assert.Regexp(t, `return \[\]\*apiextensionsv1.CustomResourceDefinition\{&apiextensionsv1.CustomResourceDefinition\{`, got)
+	assert.Regexp(t, `Name:\s+"foos.apps.example.com"`, got)
+	_, err := format.Source([]byte(got))
+	assert.NoError(t, err)
+}
+
+func TestGenerator_generateInstall(t *testing.T) {
+	metav1Pkg := &loader.Package{Package: &packages.Package{PkgPath: "k8s.io/apimachinery/pkg/apis/meta/v1"}}
+	appsv1Pkg := &loader.Package{Package: &packages.Package{PkgPath: "github.com/example/project/pkg/apis/apps/v1"}}
+	newCodeWriter := func(output OutputToMemory) *codeWriter {
+		return &codeWriter{
+			headerText: "// Copyright 2022 The Authors.\n",
+			parser: &crd.Parser{
+				GroupVersions: map[*loader.Package]schema.GroupVersion{
+					metav1Pkg: {Group: "meta.k8s.io", Version: "v1"},
+					appsv1Pkg: {Group: "apps.example.com", Version: "v1"},
+				},
+			},
+			ctx: &genall.GenerationContext{OutputRule: output},
+		}
+	}
+
+	tests := []struct {
+		name      string
+		generator Generator
+		want      []string
+	}{
+		{
+			name:      "install",
+			generator: Generator{GenInstall: true, GenEvents: true},
+			want:      []string{"apps/install/zz.generated.events.go", "apps/install/zz.generated.install.go", "install/zz.generated.scheme.go"},
+		},
+		{
+			name:      "scheme only",
+			generator: Generator{GenInstall: true, GenEvents: true, SchemeOnly: true},
+			want:      []string{"install/zz.generated.scheme.go"},
+		},
+		{
+			name:      "custom install package name",
+			generator: Generator{GenInstall: true, GenEvents: true, InstallPackageName: "scheme"},
+			want:      []string{"apps/scheme/zz.generated.events.go", "apps/scheme/zz.generated.install.go", "scheme/zz.generated.scheme.go"},
+		},
+		{
+			name:      "add metav1",
+			generator: Generator{GenInstall: true, SchemeAddMetav1: true},
+			want:      []string{"apps/install/zz.generated.install.go", "install/zz.generated.scheme.go"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := OutputToMemory{}
+			cw := newCodeWriter(output)
+			cw.installPackage = tt.generator.InstallPackageName
+			cw.addMetav1 = tt.generator.SchemeAddMetav1
+			assert.NoError(t, tt.generator.generateGroupInstall(cw, "apps.example.com", "apps"))
+			assert.NoError(t, tt.generator.generateSchemeInstall(cw, metav1Pkg))
+
+			got := []string{}
+			for name := range output {
+				got = append(got, name)
+			}
+			assert.ElementsMatch(t, tt.want, got)
+			schemefile := tt.want[len(tt.want)-1]
+			assert.Contains(t, output[schemefile].String(), "package "+cw.installPackageName()+"\n")
+			assert.Contains(t, output[schemefile].String(), "utilruntime.Must(appsv1.AddToScheme(scheme))")
+			for _, file := range tt.want {
+				if !strings.HasSuffix(file, "install.go") && !strings.HasSuffix(file, "scheme.go") {
+					continue
+				}
+				if tt.generator.SchemeAddMetav1 {
+					assert.Contains(t, output[file].String(), "metav1.AddToGroupVersion(scheme, appsv1.SchemeGroupVersion)")
+				} else {
+					assert.NotContains(t, output[file].String(), "AddToGroupVersion")
+				}
+			}
+		})
+	}
+}
+
+func Test_applyMutators(t *testing.T) {
+	crds := map[schema.GroupKind]apiext.CustomResourceDefinition{
+		{Group: "batch.example.com", Kind: "Bar"}: {},
+		{Group: "apps.example.com", Kind: "Foo"}:  {},
+	}
+	visited := []string{}
+	mutators := []SchemaMutator{
+		func(gk schema.GroupKind, crd *apiext.CustomResourceDefinition) error {
+			visited = append(visited, gk.String())
+			setAnnotation(crd, "example.com/owner", "platform")
+			return nil
+		},
+		func(gk schema.GroupKind, crd *apiext.CustomResourceDefinition) error {
+			// mutators are invoked in order
+			crd.Annotations["example.com/owner"] += "-team"
+			return nil
+		},
+	}
+	assert.NoError(t, applyMutators(crds, mutators))
+	assert.Equal(t, []string{"Foo.apps.example.com", "Bar.batch.example.com"}, visited)
+	for _, crd := range crds {
+		assert.Equal(t, "platform-team", crd.Annotations["example.com/owner"])
+	}
+
+	err := applyMutators(crds, []SchemaMutator{
+		func(gk schema.GroupKind, crd *apiext.CustomResourceDefinition) error {
+			return fmt.Errorf("invalid")
+		},
+	})
+	assert.EqualError(t, err, "failed to mutate CRD of Foo.apps.example.com: invalid")
+}
+
+func Test_protectCommunityGroups(t *testing.T) {
+	crds := map[schema.GroupKind]apiext.CustomResourceDefinition{
+		{Group: "infra.internal.k8s.io", Kind: "Foo"}: {Spec: apiext.CustomResourceDefinitionSpec{Group: "infra.internal.k8s.io"}},
+		{Group: "apps.example.com", Kind: "Bar"}:      {Spec: apiext.CustomResourceDefinitionSpec{Group: "apps.example.com"}},
+	}
+	protectCommunityGroups(crds)
+
+	assert.Equal(t, "https://github.com/kubernetes/enhancements/pull/1111", crds[schema.GroupKind{Group: "infra.internal.k8s.io", Kind: "Foo"}].Annotations[KubeAPIApprovedAnnotation])
+	assert.Nil(t, crds[schema.GroupKind{Group: "apps.example.com", Kind: "Bar"}].Annotations)
+}
+
+func Test_forceConversionNone(t *testing.T) {
+	crds := map[schema.GroupKind]apiext.CustomResourceDefinition{
+		{Group: "apps.example.com", Kind: "Foo"}: {
+			Spec: apiext.CustomResourceDefinitionSpec{
+				Group: "apps.example.com",
+				Names: apiext.CustomResourceDefinitionNames{Kind: "Foo", Plural: "foos"},
+				Conversion: &apiext.CustomResourceConversion{
+					Strategy: apiext.WebhookConverter,
+					Webhook:  &apiext.WebhookConversion{ConversionReviewVersions: []string{"v1"}},
+				},
+			},
+		},
+		{Group: "apps.example.com", Kind: "Bar"}: {
+			Spec: apiext.CustomResourceDefinitionSpec{
+				Group: "apps.example.com",
+				Names: apiext.CustomResourceDefinitionNames{Kind: "Bar", Plural: "bars"},
+			},
+		},
+	}
+	forceConversionNone(crds)
+
+	output := OutputToMemory{}
+	cw := &codeWriter{
+		parser: &crd.Parser{CustomResourceDefinitions: crds},
+		ctx:    &genall.GenerationContext{OutputRule: output},
+	}
+	assert.NoError(t, cw.GenerateGroup("apps.example.com", "apps", "apps"))
+	assert.NoError(t, cw.GenerateGroupYAML("apps.example.com", "apps"))
+
+	got := output["apps/zz.generated.crd.go"].String()
+	assert.Equal(t, 2, strings.Count(got, `Conversion: &apiextensionsv1.CustomResourceConversion{Strategy: apiextensionsv1.ConversionStrategyType("None")}`))
+	assert.NotContains(t, got, "Webhook")
+	for _, file := range []string{"apps/crds/apps.example.com_foos.yaml", "apps/crds/apps.example.com_bars.yaml"} {
+		assert.Contains(t, output[file].String(), "conversion:\n    strategy: None\n")
+		assert.NotContains(t, output[file].String(), "webhook")
+	}
+}
+
+func Test_codeWriter_GenerateSingleYAMLFile(t *testing.T) {
+	newCRD := func(group, kind, plural string) apiext.CustomResourceDefinition {
+		return apiext.CustomResourceDefinition{
+			ObjectMeta: metav1.ObjectMeta{Name: plural + "." + group},
+			Spec: apiext.CustomResourceDefinitionSpec{
+				Group: group,
+				Names: apiext.CustomResourceDefinitionNames{Kind: kind, Plural: plural},
+			},
+		}
+	}
+	crds := map[schema.GroupKind]apiext.CustomResourceDefinition{
+		{Group: "batch.example.com", Kind: "Job"}: newCRD("batch.example.com", "Job", "jobs"),
+		{Group: "apps.example.com", Kind: "Foo"}:  newCRD("apps.example.com", "Foo", "foos"),
+		{Group: "apps.example.com", Kind: "Bar"}:  newCRD("apps.example.com", "Bar", "bars"),
+	}
+
+	output := OutputToMemory{}
+	cw := &codeWriter{
+		parser: &crd.Parser{CustomResourceDefinitions: crds},
+		ctx:    &genall.GenerationContext{OutputRule: output},
+	}
+	assert.NoError(t, cw.GenerateSingleYAMLFile("../../charts/crds/crds.yaml"))
+	assert.Len(t, output, 1)
+	got := output["../../charts/crds/crds.yaml"].String()
+
+	docs := strings.Split(got, "\n---\n")
+	assert.Equal(t, "", docs[0])
+	names := []string{}
+	for _, doc := range docs[1:] {
+		out := apiext.CustomResourceDefinition{}
+		assert.NoError(t, yaml.Unmarshal([]byte(doc), &out))
+		names = append(names, out.Name)
+	}
+	// sorted by group and kind
+	assert.Equal(t, []string{"bars.apps.example.com", "foos.apps.example.com", "jobs.batch.example.com"}, names)
+}
+
+func TestGenerator_SingleYAMLFileMarker(t *testing.T) {
+	defn := markers.Must(markers.MakeDefinition("crd", markers.DescribesPackage, Generator{}))
+	got, err := defn.Parse(`+crd:headerFile=hack/boilerplate.go.txt,genCRD=true,genInstall=false,genYAML=true,singleYAMLFile="../../charts/crds/crds.yaml"`)
+	assert.NoError(t, err)
+	assert.Equal(t, "../../charts/crds/crds.yaml", got.(Generator).SingleYAMLFile)
+}
+
+func Test_overrideVersions(t *testing.T) {
+	newCRDs := func() map[schema.GroupKind]apiext.CustomResourceDefinition {
+		return map[schema.GroupKind]apiext.CustomResourceDefinition{
+			{Group: "apps.example.com", Kind: "Foo"}: {
+				Spec: apiext.CustomResourceDefinitionSpec{
+					Versions: []apiext.CustomResourceDefinitionVersion{
+						{Name: "v1", Served: true, Storage: true},
+						{Name: "v2", Served: false, Storage: false},
+					},
+				},
+			},
+			{Group: "batch.example.com", Kind: "Bar"}: {
+				Spec: apiext.CustomResourceDefinitionSpec{
+					Versions: []apiext.CustomResourceDefinitionVersion{
+						{Name: "v1", Served: true, Storage: true},
+					},
+				},
+			},
+		}
+	}
+
+	// migrate storage to v2
+	crds := newCRDs()
+	assert.NoError(t, overrideVersions(crds,
+		map[string]bool{"apps.example.com/v2": true},
+		map[string]bool{"apps.example.com/v1": false, "apps.example.com/v2": true},
+	))
+	assert.Equal(t, []apiext.CustomResourceDefinitionVersion{
+		{Name: "v1", Served: true, Storage: false},
+		{Name: "v2", Served: true, Storage: true},
+	}, crds[schema.GroupKind{Group: "apps.example.com", Kind: "Foo"}].Spec.Versions)
+	assert.Equal(t, newCRDs()[schema.GroupKind{Group: "batch.example.com", Kind: "Bar"}], crds[schema.GroupKind{Group: "batch.example.com", Kind: "Bar"}])
+
+	// two storage versions
+	err := overrideVersions(newCRDs(), nil, map[string]bool{"apps.example.com/v2": true})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Foo.apps.example.com must have exactly one storage version, got [v1 v2]")
+
+	// no storage version
+	err = overrideVersions(newCRDs(), nil, map[string]bool{"batch.example.com/v1": false})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Bar.batch.example.com must have exactly one storage version, got []")
+
+	// unknown version
+	err = overrideVersions(newCRDs(), map[string]bool{"apps.example.com/v3": true}, map[string]bool{"apps.example.com/v3": true})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "overrides of [apps.example.com/v3] match no CustomResourceDefinition version")
+}
+
+func TestGenerator_VersionOverridesMarker(t *testing.T) {
+	defn := markers.Must(markers.MakeDefinition("crd", markers.DescribesPackage, Generator{}))
+	got, err := defn.Parse(`+crd:headerFile=hack/boilerplate.go.txt,genCRD=true,genInstall=false,servedVersions={"apps.example.com/v2":true},storageVersions={"apps.example.com/v1":false,"apps.example.com/v2":true}`)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{"apps.example.com/v2": true}, got.(Generator).ServedVersions)
+	assert.Equal(t, map[string]bool{"apps.example.com/v1": false, "apps.example.com/v2": true}, got.(Generator).StorageVersions)
+}
+
+func TestGenerator_MaxDescLenMarker(t *testing.T) {
+	defn := markers.Must(markers.MakeDefinition("crd", markers.DescribesPackage, Generator{}))
+	got, err := defn.Parse(`+crd:headerFile=hack/boilerplate.go.txt,genCRD=true,genInstall=false,maxDescLen=0`)
+	assert.NoError(t, err)
+	if assert.NotNil(t, got.(Generator).MaxDescLen) {
+		assert.Equal(t, 0, *got.(Generator).MaxDescLen)
+	}
+
+	got, err = defn.Parse(`+crd:headerFile=hack/boilerplate.go.txt,genCRD=true,genInstall=false`)
+	assert.NoError(t, err)
+	assert.Nil(t, got.(Generator).MaxDescLen)
+}
+
+// orderedOutput records names of opened files in order.
+type orderedOutput struct {
+	OutputToMemory
+	names []string
+}
+
+func (o *orderedOutput) Open(pkg *loader.Package, itemPath string) (io.WriteCloser, error) {
+	o.names = append(o.names, itemPath)
+	return o.OutputToMemory.Open(pkg, itemPath)
+}
+
+func Test_codeWriter_GenerateGroup_deterministic(t *testing.T) {
+	newCRD := func(kind, plural string) apiext.CustomResourceDefinition {
+		return apiext.CustomResourceDefinition{
+			Spec: apiext.CustomResourceDefinitionSpec{
+				Group: "apps.example.com",
+				Names: apiext.CustomResourceDefinitionNames{Kind: kind, Plural: plural},
+			},
+		}
+	}
+	run := func() *orderedOutput {
+		output := &orderedOutput{OutputToMemory: OutputToMemory{}}
+		cw := &codeWriter{
+			parser: &crd.Parser{
+				CustomResourceDefinitions: map[schema.GroupKind]apiext.CustomResourceDefinition{
+					{Group: "apps.example.com", Kind: "Foo"}:   newCRD("Foo", "foos"),
+					{Group: "apps.example.com", Kind: "Bar"}:   newCRD("Bar", "bars"),
+					{Group: "apps.example.com", Kind: "Baz"}:   newCRD("Baz", "bazs"),
+					{Group: "batch.example.com", Kind: "Job"}:  newCRD("Job", "jobs"),
+					{Group: "apps.example.com", Kind: "Qux"}:   newCRD("Qux", "quxs"),
+					{Group: "apps.example.com", Kind: "Thud"}:  newCRD("Thud", "thuds"),
+					{Group: "apps.example.com", Kind: "Waldo"}: newCRD("Waldo", "waldos"),
+				},
+			},
+			ctx: &genall.GenerationContext{OutputRule: output},
+		}
+		assert.NoError(t, cw.GenerateGroup("apps.example.com", "apps", "apps"))
+		assert.NoError(t, cw.GenerateGroupYAML("apps.example.com", "apps"))
+		return output
+	}
+
+	first := run()
+	assert.Equal(t, []string{
+		"apps/zz.generated.crd.go",
+		"apps/crds/apps.example.com_bars.yaml",
+		"apps/crds/apps.example.com_bazs.yaml",
+		"apps/crds/apps.example.com_foos.yaml",
+		"apps/crds/apps.example.com_quxs.yaml",
+		"apps/crds/apps.example.com_thuds.yaml",
+		"apps/crds/apps.example.com_waldos.yaml",
+	}, first.names)
+	assert.Regexp(t, `NewBarCRD\(\),\s+NewBazCRD\(\),\s+NewFooCRD\(\),\s+NewQuxCRD\(\),\s+NewThudCRD\(\),\s+NewWaldoCRD\(\)`,
+		first.OutputToMemory["apps/zz.generated.crd.go"].String())
+
+	for i := 0; i < 5; i++ {
+		again := run()
+		assert.Equal(t, first.names, again.names)
+		assert.Equal(t, first.OutputToMemory["apps/zz.generated.crd.go"].String(), again.OutputToMemory["apps/zz.generated.crd.go"].String())
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/controller-tools/pkg/markers"
+)
+
+func Test_renderCodeGenerated(t *testing.T) {
+	now := GenerationTime(1640995200)
+	assert.Equal(t, time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC), now)
+	// 0 is a valid SOURCE_DATE_EPOCH
+	assert.Equal(t, time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC), GenerationTime(0))
+
+	got, err := renderCodeGenerated("", now)
+	assert.NoError(t, err)
+	assert.Equal(t, "// Code generated by crd-gen. DO NOT EDIT.", got)
+
+	got, err = renderCodeGenerated("// Code generated by {{.Generator}} on {{.Date}}. DO NOT EDIT.\nversion: {{.Version}}\n", now)
+	assert.NoError(t, err)
+	assert.Regexp(t, `^// Code generated by crd-gen on 2022-01-01. DO NOT EDIT.\n// version: .*$`, got)
+
+	_, err = renderCodeGenerated("{{.Generator", now)
+	assert.Error(t, err)
+	_, err = renderCodeGenerated("{{.Unknown}}", now)
+	assert.Error(t, err)
+}
+
+func Test_renderHeader(t *testing.T) {
+	header := "// Copyright YEAR {{.Company}}\n// This file is part of {{.Project}}, {{.Project}} is licensed under {{.License}}.\n"
+	got := renderHeader(header, "2022", map[string]string{
+		"Company": "Example, Inc.",
+		"Project": "kube-codegen",
+	})
+	assert.Equal(t, "// Copyright 2022 Example, Inc.\n// This file is part of kube-codegen, kube-codegen is licensed under {{.License}}.\n", got)
+
+	// YEAR only
+	assert.Equal(t, "// Copyright 2022 {{.Company}}.\n", renderHeader("// Copyright YEAR {{.Company}}.\n", "2022", nil))
+}
+
+func TestGenerator_HeaderVarsMarker(t *testing.T) {
+	defn := markers.Must(markers.MakeDefinition("crd", markers.DescribesPackage, Generator{}))
+	got, err := defn.Parse(`+crd:headerFile=hack/boilerplate.go.txt,genCRD=true,genInstall=false,year="2022",headerVars={"Company":"Example, Inc.","Project":"kube-codegen"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"Company": "Example, Inc.", "Project": "kube-codegen"}, got.(Generator).HeaderVars)
+}
+
+func TestGenerator_SourceDateEpochMarker(t *testing.T) {
+	defn := markers.Must(markers.MakeDefinition("crd", markers.DescribesPackage, Generator{}))
+	got, err := defn.Parse(`+crd:headerFile=hack/boilerplate.go.txt,genCRD=true,genInstall=false,sourceDateEpoch=0`)
+	assert.NoError(t, err)
+	if assert.NotNil(t, got.(Generator).SourceDateEpoch) {
+		assert.Equal(t, 0, *got.(Generator).SourceDateEpoch)
+	}
+	got, err = defn.Parse(`+crd:headerFile=hack/boilerplate.go.txt,genCRD=true,genInstall=false`)
+	assert.NoError(t, err)
+	assert.Nil(t, got.(Generator).SourceDateEpoch)
+}
@@ -0,0 +1,110 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crd
+
+import (
+	"bufio"
+	"fmt"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"sigs.k8s.io/controller-tools/pkg/genall"
+)
+
+const (
+	defaultInstallPackage = "install"
+)
+
+// codeGeneratedRegexp matches the standard comment of generated go files,
+// see https://golang.org/s/generatedcode
+var codeGeneratedRegexp = regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$`)
+
+// validateInstallPackageName returns error if name can not be used as go
+// package name of install packages.
+func validateInstallPackageName(name string) error {
+	if !token.IsIdentifier(name) || name == "main" {
+		return fmt.Errorf("invalid install package name %q, it must be a valid go package identifier", name)
+	}
+	return nil
+}
+
+// outputDir returns the directory of files opened without package by rule, it
+// is empty if rule does not write to disk.
+func outputDir(rule genall.OutputRule) string {
+	switch r := rule.(type) {
+	case genall.OutputToDirectory:
+		return string(r)
+	case genall.OutputArtifacts:
+		return string(r.Config)
+	case *genall.OutputArtifacts:
+		return string(r.Config)
+	}
+	return ""
+}
+
+// checkInstallPackageCollision returns error if dir under output dir of
+// rule contains go files which are not generated, generating install package
+// into it would mix with an existing package.
+func checkInstallPackageCollision(rule genall.OutputRule, dir string) error {
+	base := outputDir(rule)
+	if len(base) == 0 {
+		return nil
+	}
+	dir = filepath.Join(base, dir)
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".go") {
+			continue
+		}
+		generated, err := isGeneratedFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return err
+		}
+		if !generated {
+			return fmt.Errorf("install package collides with existing package in %s, %s is not generated", dir, e.Name())
+		}
+	}
+	return nil
+}
+
+// isGeneratedFile returns true if the go file has the standard comment of
+// generated files before the package clause.
+func isGeneratedFile(file string) (bool, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "package ") {
+			break
+		}
+		if codeGeneratedRegexp.MatchString(line) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
@@ -0,0 +1,203 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/tools/go/packages"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-tools/pkg/crd"
+	"sigs.k8s.io/controller-tools/pkg/genall"
+	"sigs.k8s.io/controller-tools/pkg/loader"
+	"sigs.k8s.io/controller-tools/pkg/markers"
+)
+
+func Test_validateInstallPackageName(t *testing.T) {
+	assert.NoError(t, validateInstallPackageName("install"))
+	assert.NoError(t, validateInstallPackageName("scheme"))
+	assert.Error(t, validateInstallPackageName("my-scheme"))
+	assert.Error(t, validateInstallPackageName("type"))
+	assert.Error(t, validateInstallPackageName("main"))
+}
+
+func Test_checkInstallPackageCollision(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name, content string) {
+		p := filepath.Join(dir, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+		assert.NoError(t, os.WriteFile(p, []byte(content), 0644))
+	}
+	writeFile("apps/scheme/zz.generated.install.go", "// Copyright 2022 The Authors.\n\n// Code generated by install-gen. DO NOT EDIT.\n\npackage scheme\n")
+	writeFile("apps/scheme/README.md", "scheme\n")
+	writeFile("batch/scheme/scheme.go", "package scheme\n\n// Code generated by hand. DO NOT EDIT.\n")
+
+	rule := genall.OutputToDirectory(dir)
+	assert.NoError(t, checkInstallPackageCollision(rule, "apps/scheme"))
+	assert.NoError(t, checkInstallPackageCollision(rule, "notexist/scheme"))
+	assert.Error(t, checkInstallPackageCollision(rule, "batch/scheme"))
+	assert.Error(t, checkInstallPackageCollision(genall.OutputArtifacts{Config: rule}, "batch/scheme"))
+	// in memory output never collides
+	assert.NoError(t, checkInstallPackageCollision(OutputToMemory{}, "batch/scheme"))
+}
+
+func TestGenerator_generateInstallReturnError(t *testing.T) {
+	metav1Pkg := &loader.Package{Package: &packages.Package{PkgPath: "k8s.io/apimachinery/pkg/apis/meta/v1"}}
+	appsv1Pkg := &loader.Package{Package: &packages.Package{PkgPath: "github.com/example/project/pkg/apis/apps/v1"}}
+	batchv1Pkg := &loader.Package{Package: &packages.Package{PkgPath: "github.com/example/project/pkg/apis/batch/v1"}}
+	output := OutputToMemory{}
+	cw := &codeWriter{
+		headerText: "// Copyright 2022 The Authors.\n",
+		parser: &crd.Parser{
+			GroupVersions: map[*loader.Package]schema.GroupVersion{
+				metav1Pkg:  {Group: "meta.k8s.io", Version: "v1"},
+				appsv1Pkg:  {Group: "apps.example.com", Version: "v1"},
+				batchv1Pkg: {Group: "batch.example.com", Version: "v1"},
+			},
+		},
+		ctx:         &genall.GenerationContext{OutputRule: output},
+		returnError: true,
+	}
+	g := Generator{GenInstall: true, InstallReturnError: true}
+	assert.NoError(t, g.generateGroupInstall(cw, "apps.example.com", "apps"))
+	assert.NoError(t, g.generateSchemeInstall(cw, metav1Pkg))
+	for _, file := range []string{"apps/install/zz.generated.install.go", "install/zz.generated.scheme.go"} {
+		got := output[file].String()
+		// the panicking Install is kept
+		assert.Contains(t, got, "utilruntime.Must(appsv1.AddToScheme(scheme))")
+		assert.Contains(t, got, "func InstallOrError(scheme *runtime.Scheme) error {")
+		assert.Contains(t, got, "return utilerrors.NewAggregate(errs)")
+	}
+
+	// InstallOrError compiles and returns errors of all AddToScheme
+	root := t.TempDir()
+	gomod, err := ioutil.ReadFile("../../../go.mod")
+	assert.NoError(t, err)
+	gosum, err := ioutil.ReadFile("../../../go.sum")
+	assert.NoError(t, err)
+	addToScheme := "package v1\n\nimport (\n\t\"errors\"\n\n\t\"k8s.io/apimachinery/pkg/runtime\"\n)\n\n" +
+		"func AddToScheme(_ *runtime.Scheme) error { return errors.New(\"%s failed\") }\n"
+	files := map[string]string{
+		"go.mod":                           strings.Replace(string(gomod), "module github.com/zoumo/kube-codegen", "module github.com/example/project", 1),
+		"go.sum":                           string(gosum),
+		"pkg/apis/apps/v1/register.go":     fmt.Sprintf(addToScheme, "apps"),
+		"pkg/apis/batch/v1/register.go":    fmt.Sprintf(addToScheme, "batch"),
+		"pkg/apis/install/scheme.go":       output["install/zz.generated.scheme.go"].String(),
+		"pkg/apis/apps/install/install.go": output["apps/install/zz.generated.install.go"].String(),
+		"cmd/check/main.go": "package main\n\nimport (\n\t\"fmt\"\n\n\t\"k8s.io/apimachinery/pkg/runtime\"\n\n" +
+			"\t\"github.com/example/project/pkg/apis/install\"\n)\n\n" +
+			"func main() { fmt.Println(install.InstallOrError(runtime.NewScheme())) }\n",
+	}
+	for name, content := range files {
+		file := filepath.Join(root, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(file), 0755))
+		assert.NoError(t, ioutil.WriteFile(file, []byte(content), 0644))
+	}
+	skipUnlessE2E(t)
+	cmd := exec.Command("go", "run", "./cmd/check")
+	cmd.Dir = root
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod")
+	out, err := cmd.Output()
+	assert.NoError(t, err, exitStderr(err))
+	assert.Equal(t, "[apps failed, batch failed]\n", string(out))
+	build := exec.Command("go", "build", "./pkg/apis/...")
+	build.Dir = root
+	build.Env = cmd.Env
+	out, err = build.CombinedOutput()
+	assert.NoError(t, err, string(out))
+}
+
+func TestGenerator_ConversionPackagesMarker(t *testing.T) {
+	defn := markers.Must(markers.MakeDefinition("crd", markers.DescribesPackage, Generator{}))
+	got, err := defn.Parse(`+crd:headerFile=hack/boilerplate.go.txt,genCRD=false,genInstall=true,conversionPackages={"github.com/example/project/pkg/apis/apps/v1":"github.com/example/project/pkg/apis/apps/v1/conversions"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"github.com/example/project/pkg/apis/apps/v1": "github.com/example/project/pkg/apis/apps/v1/conversions",
+	}, got.(Generator).ConversionPackages)
+}
+
+func TestGenerator_generateInstallConversionPackages(t *testing.T) {
+	metav1Pkg := &loader.Package{Package: &packages.Package{PkgPath: "k8s.io/apimachinery/pkg/apis/meta/v1"}}
+	appsv1Pkg := &loader.Package{Package: &packages.Package{PkgPath: "github.com/example/project/pkg/apis/apps/v1"}}
+	output := OutputToMemory{}
+	cw := &codeWriter{
+		headerText: "// Copyright 2022 The Authors.\n",
+		parser: &crd.Parser{
+			GroupVersions: map[*loader.Package]schema.GroupVersion{
+				metav1Pkg: {Group: "meta.k8s.io", Version: "v1"},
+				appsv1Pkg: {Group: "apps.example.com", Version: "v1"},
+			},
+		},
+		ctx:         &genall.GenerationContext{OutputRule: output},
+		returnError: true,
+		conversions: map[string]string{
+			"github.com/example/project/pkg/apis/apps/v1": "github.com/example/project/pkg/apis/apps/v1/conversions",
+		},
+	}
+	g := Generator{GenInstall: true, InstallReturnError: true}
+	assert.NoError(t, g.generateSchemeInstall(cw, metav1Pkg))
+	got := output["install/zz.generated.scheme.go"].String()
+	assert.Contains(t, got, `appsv1conversions "github.com/example/project/pkg/apis/apps/v1/conversions"`)
+	assert.Contains(t, got, "utilruntime.Must(appsv1conversions.AddToScheme(scheme))")
+	assert.Contains(t, got, "if err := appsv1conversions.AddToScheme(scheme); err != nil {")
+
+	// conversions moved into the subpackage are registered by Install
+	root := t.TempDir()
+	gomod, err := ioutil.ReadFile("../../../go.mod")
+	assert.NoError(t, err)
+	gosum, err := ioutil.ReadFile("../../../go.sum")
+	assert.NoError(t, err)
+	files := map[string]string{
+		"go.mod":                 strings.Replace(string(gomod), "module github.com/zoumo/kube-codegen", "module github.com/example/project", 1),
+		"go.sum":                 string(gosum),
+		"pkg/apis/apps/types.go": "package apps\n\ntype Foo struct {\n\tReplicas int\n}\n",
+		"pkg/apis/apps/v1/types.go": "package v1\n\nimport \"k8s.io/apimachinery/pkg/runtime\"\n\n" +
+			"var (\n\tlocalSchemeBuilder = runtime.NewSchemeBuilder()\n\tAddToScheme        = localSchemeBuilder.AddToScheme\n)\n\n" +
+			"type Foo struct {\n\tReplicas int32\n}\n",
+		// layout of conversions moved by kube-codegen
+		"pkg/apis/apps/v1/conversions/zz_generated.conversion.go": "package conversions\n\nimport (\n" +
+			"\tapps \"github.com/example/project/pkg/apis/apps\"\n\tv1 \"github.com/example/project/pkg/apis/apps/v1\"\n" +
+			"\tconversion \"k8s.io/apimachinery/pkg/conversion\"\n\truntime \"k8s.io/apimachinery/pkg/runtime\"\n)\n\n" +
+			"func RegisterConversions(s *runtime.Scheme) error {\n" +
+			"\treturn s.AddGeneratedConversionFunc((*v1.Foo)(nil), (*apps.Foo)(nil), func(a, b interface{}, scope conversion.Scope) error {\n" +
+			"\t\tb.(*apps.Foo).Replicas = int(a.(*v1.Foo).Replicas)\n\t\treturn nil\n\t})\n}\n\n" +
+			"var (\n\tSchemeBuilder = runtime.NewSchemeBuilder(v1.AddToScheme, RegisterConversions)\n\tAddToScheme   = SchemeBuilder.AddToScheme\n)\n",
+		"pkg/apis/install/scheme.go": got,
+		"cmd/check/main.go": "package main\n\nimport (\n\t\"fmt\"\n\n\t\"k8s.io/apimachinery/pkg/runtime\"\n\n" +
+			"\t\"github.com/example/project/pkg/apis/apps\"\n\tv1 \"github.com/example/project/pkg/apis/apps/v1\"\n" +
+			"\t\"github.com/example/project/pkg/apis/install\"\n)\n\n" +
+			"func main() {\n\tscheme := runtime.NewScheme()\n\tinstall.Install(scheme)\n\tout := &apps.Foo{}\n" +
+			"\tif err := scheme.Convert(&v1.Foo{Replicas: 3}, out, nil); err != nil {\n\t\tpanic(err)\n\t}\n\tfmt.Println(out.Replicas)\n}\n",
+	}
+	for name, content := range files {
+		file := filepath.Join(root, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(file), 0755))
+		assert.NoError(t, ioutil.WriteFile(file, []byte(content), 0644))
+	}
+	skipUnlessE2E(t)
+	cmd := exec.Command("go", "run", "./cmd/check")
+	cmd.Dir = root
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod")
+	out, err := cmd.Output()
+	assert.NoError(t, err, exitStderr(err))
+	assert.Equal(t, "3\n", string(out))
+}
@@ -0,0 +1,113 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crd
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/gobuffalo/flect"
+	apiext "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-tools/pkg/crd"
+)
+
+// checkVersionNames returns error if versions of any kind in crds declare
+// different names by markers, e.g. +kubebuilder:resource:path. NeedCRDFor
+// merges versions of a kind into one CRD, whose names are taken from the
+// last version silently.
+func checkVersionNames(parser *crd.Parser, crds map[schema.GroupKind]apiext.CustomResourceDefinition) error {
+	gks := make([]schema.GroupKind, 0, len(crds))
+	for gk := range crds {
+		gks = append(gks, gk)
+	}
+	sort.Slice(gks, func(i, j int) bool { return gks[i].String() < gks[j].String() })
+
+	errs := []string{}
+	for _, gk := range gks {
+		if err := compareVersionNames(gk, versionNames(parser, gk)); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("conflicting CustomResourceDefinition names across versions: %v", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// versionNames returns names of kind gk declared in each version, defaulted
+// and overridden by markers in the same way as NeedCRDFor.
+func versionNames(parser *crd.Parser, gk schema.GroupKind) map[string]apiext.CustomResourceDefinitionNames {
+	result := map[string]apiext.CustomResourceDefinitionNames{}
+	for pkg, gv := range parser.GroupVersions {
+		if gv.Group != gk.Group {
+			continue
+		}
+		typeInfo := parser.Types[crd.TypeIdent{Package: pkg, Name: gk.Kind}]
+		if typeInfo == nil {
+			continue
+		}
+		spec := apiext.CustomResourceDefinitionSpec{
+			Group: gk.Group,
+			Names: apiext.CustomResourceDefinitionNames{
+				Kind:     gk.Kind,
+				ListKind: gk.Kind + "List",
+				Plural:   strings.ToLower(flect.Pluralize(gk.Kind)),
+				Singular: strings.ToLower(gk.Kind),
+			},
+			Versions: []apiext.CustomResourceDefinitionVersion{{Name: gv.Version}},
+		}
+		for _, markerVals := range typeInfo.Markers {
+			for _, val := range markerVals {
+				if specMarker, ok := val.(crd.SpecMarker); ok {
+					// errors are reported by NeedCRDFor
+					specMarker.ApplyToCRD(&spec, gv.Version) //nolint
+				}
+			}
+		}
+		result[gv.Version] = spec.Names
+	}
+	return result
+}
+
+// compareVersionNames returns error if names of versions are not the same.
+func compareVersionNames(gk schema.GroupKind, names map[string]apiext.CustomResourceDefinitionNames) error {
+	versions := make([]string, 0, len(names))
+	for v := range names {
+		versions = append(versions, v)
+	}
+	sort.Strings(versions)
+	if len(versions) < 2 {
+		return nil
+	}
+
+	first := names[versions[0]]
+	for _, v := range versions[1:] {
+		got := names[v]
+		if reflect.DeepEqual(first, got) {
+			continue
+		}
+		return fmt.Errorf("%v declares %v in %v but %v in %v",
+			gk, describeNames(first), versions[0], describeNames(got), v)
+	}
+	return nil
+}
+
+func describeNames(names apiext.CustomResourceDefinitionNames) string {
+	return fmt.Sprintf("plural=%v,singular=%v,shortNames=%v,categories=%v",
+		names.Plural, names.Singular, names.ShortNames, names.Categories)
+}
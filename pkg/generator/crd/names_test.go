@@ -0,0 +1,71 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/tools/go/packages"
+	apiext "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-tools/pkg/crd"
+	crdmarkers "sigs.k8s.io/controller-tools/pkg/crd/markers"
+	"sigs.k8s.io/controller-tools/pkg/loader"
+	"sigs.k8s.io/controller-tools/pkg/markers"
+)
+
+func Test_checkVersionNames(t *testing.T) {
+	v1Pkg := &loader.Package{Package: &packages.Package{PkgPath: "github.com/example/project/pkg/apis/apps/v1"}}
+	v2Pkg := &loader.Package{Package: &packages.Package{PkgPath: "github.com/example/project/pkg/apis/apps/v2"}}
+	foo := schema.GroupKind{Group: "apps.example.com", Kind: "Foo"}
+	crds := map[schema.GroupKind]apiext.CustomResourceDefinition{foo: {}}
+	newParser := func(v1, v2 markers.MarkerValues) *crd.Parser {
+		return &crd.Parser{
+			GroupVersions: map[*loader.Package]schema.GroupVersion{
+				v1Pkg: {Group: "apps.example.com", Version: "v1"},
+				v2Pkg: {Group: "apps.example.com", Version: "v2"},
+			},
+			Types: map[crd.TypeIdent]*markers.TypeInfo{
+				{Package: v1Pkg, Name: "Foo"}: {Name: "Foo", Markers: v1},
+				{Package: v2Pkg, Name: "Foo"}: {Name: "Foo", Markers: v2},
+			},
+		}
+	}
+
+	// defaulted names
+	assert.NoError(t, checkVersionNames(newParser(nil, nil), crds))
+	// explicit names same as defaulted ones
+	assert.NoError(t, checkVersionNames(newParser(
+		markers.MarkerValues{"kubebuilder:resource": {crdmarkers.Resource{Path: "foos", Singular: "foo"}}},
+		nil,
+	), crds))
+
+	// different plurals
+	err := checkVersionNames(newParser(
+		markers.MarkerValues{"kubebuilder:resource": {crdmarkers.Resource{Path: "foos"}}},
+		markers.MarkerValues{"kubebuilder:resource": {crdmarkers.Resource{Path: "fooes"}}},
+	), crds)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Foo.apps.example.com declares plural=foos,singular=foo,shortNames=[],categories=[] in v1 but plural=fooes,singular=foo,shortNames=[],categories=[] in v2")
+
+	// different short names
+	err = checkVersionNames(newParser(
+		markers.MarkerValues{"kubebuilder:resource": {crdmarkers.Resource{ShortName: []string{"fo"}}}},
+		nil,
+	), crds)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "shortNames=[fo]")
+}
@@ -0,0 +1,44 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crd
+
+import (
+	"bytes"
+	"io"
+
+	"sigs.k8s.io/controller-tools/pkg/genall"
+	"sigs.k8s.io/controller-tools/pkg/loader"
+)
+
+var _ genall.OutputRule = OutputToMemory{}
+
+// OutputToMemory captures each artifact in memory keyed by its item path,
+// regardless of if it's package-associated or not. It is useful to test
+// generation without touching disk.
+type OutputToMemory map[string]*bytes.Buffer
+
+func (o OutputToMemory) Open(_ *loader.Package, itemPath string) (io.WriteCloser, error) {
+	buf := &bytes.Buffer{}
+	o[itemPath] = buf
+	return nopWriteCloser{buf}, nil
+}
+
+type nopWriteCloser struct {
+	*bytes.Buffer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
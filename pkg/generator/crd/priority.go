@@ -0,0 +1,136 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crd
+
+import (
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/dave/jennifer/jen"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-tools/pkg/loader"
+)
+
+var (
+	kubeVersionRegexp = regexp.MustCompile(`^v([1-9][0-9]*)(?:(alpha|beta)([1-9][0-9]*))?$`)
+
+	// defaultVersionPriority prefers stable versions, then beta and alpha.
+	defaultVersionPriority = []string{"stable", "beta", "alpha"}
+)
+
+type kubeVersion struct {
+	major int
+	level string
+	minor int
+}
+
+func parseKubeVersion(v string) (kubeVersion, bool) {
+	submatches := kubeVersionRegexp.FindStringSubmatch(v)
+	if len(submatches) != 4 {
+		return kubeVersion{}, false
+	}
+	major, _ := strconv.Atoi(submatches[1])
+	level := submatches[2]
+	if level == "" {
+		level = "stable"
+	}
+	minor, _ := strconv.Atoi(submatches[3])
+	return kubeVersion{major: major, level: level, minor: minor}, true
+}
+
+// sortGroupVersionsByPriority sorts group versions by group name, and then by
+// version priority within the same group. levels specifies the priority of
+// version levels (stable, beta, alpha), versions with higher major and minor
+// number have higher priority within the same level. Non kube-like versions
+// come last and are sorted lexicographically.
+func sortGroupVersionsByPriority(gvs []schema.GroupVersion, levels []string) {
+	if len(levels) == 0 {
+		levels = defaultVersionPriority
+	}
+	rank := map[string]int{}
+	for i, level := range levels {
+		rank[level] = i
+	}
+	levelRank := func(level string) int {
+		if r, ok := rank[level]; ok {
+			return r
+		}
+		return len(levels)
+	}
+
+	sort.SliceStable(gvs, func(i, j int) bool {
+		if gvs[i].Group != gvs[j].Group {
+			return gvs[i].Group < gvs[j].Group
+		}
+		vi, oki := parseKubeVersion(gvs[i].Version)
+		vj, okj := parseKubeVersion(gvs[j].Version)
+		switch {
+		case oki && !okj:
+			return true
+		case !oki && okj:
+			return false
+		case !oki && !okj:
+			return gvs[i].Version < gvs[j].Version
+		}
+		if ri, rj := levelRank(vi.level), levelRank(vj.level); ri != rj {
+			return ri < rj
+		}
+		if vi.major != vj.major {
+			return vi.major > vj.major
+		}
+		return vi.minor > vj.minor
+	})
+}
+
+// GenerateSchemePriority generates PrioritizedVersionsAllGroups which returns
+// all installed group versions sorted by priority.
+func (cw *codeWriter) GenerateSchemePriority(metav1Pkg *loader.Package, levels []string) error {
+	priorityfile := jen.NewFile(cw.installPackageName())
+	cw.setFileDefault(priorityfile)
+
+	gvs := []schema.GroupVersion{}
+	for pkg, gv := range cw.parser.GroupVersions {
+		if pkg == metav1Pkg {
+			continue
+		}
+		gvs = append(gvs, gv)
+	}
+	sortGroupVersionsByPriority(gvs, levels)
+
+	gvType := jen.Qual("k8s.io/apimachinery/pkg/runtime/schema", "GroupVersion")
+	priorityfile.Line()
+	priorityfile.Comment("PrioritizedVersionsAllGroups returns all installed group versions sorted by group,")
+	priorityfile.Comment("and by version priority within the same group.")
+	priorityfile.Func().Id("PrioritizedVersionsAllGroups").Params().Index().Add(gvType.Clone()).Block(
+		jen.Return(jen.Index().Add(gvType.Clone()).ValuesFunc(func(g *jen.Group) {
+			for _, gv := range gvs {
+				g.Line().Values(jen.Dict{
+					jen.Id("Group"):   jen.Lit(gv.Group),
+					jen.Id("Version"): jen.Lit(gv.Version),
+				})
+			}
+			g.Line()
+		})),
+	)
+
+	w, err := cw.ctx.Open(nil, path.Join(cw.installPackageName(), "zz.generated.priority.go"))
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	return priorityfile.Render(w)
+}
@@ -0,0 +1,50 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func Test_sortGroupVersionsByPriority(t *testing.T) {
+	gvs := []schema.GroupVersion{
+		{Group: "batch.example.com", Version: "v1alpha1"},
+		{Group: "apps.example.com", Version: "v1alpha1"},
+		{Group: "apps.example.com", Version: "v1beta1"},
+		{Group: "apps.example.com", Version: "v1"},
+		{Group: "apps.example.com", Version: "v2beta1"},
+		{Group: "apps.example.com", Version: "v2"},
+		{Group: "batch.example.com", Version: "v1alpha2"},
+	}
+
+	sorted := append([]schema.GroupVersion{}, gvs...)
+	sortGroupVersionsByPriority(sorted, nil)
+	assert.Equal(t, []schema.GroupVersion{
+		{Group: "apps.example.com", Version: "v2"},
+		{Group: "apps.example.com", Version: "v1"},
+		{Group: "apps.example.com", Version: "v2beta1"},
+		{Group: "apps.example.com", Version: "v1beta1"},
+		{Group: "apps.example.com", Version: "v1alpha1"},
+		{Group: "batch.example.com", Version: "v1alpha2"},
+		{Group: "batch.example.com", Version: "v1alpha1"},
+	}, sorted)
+
+	sorted = append([]schema.GroupVersion{}, gvs...)
+	sortGroupVersionsByPriority(sorted, []string{"beta", "stable", "alpha"})
+	assert.Equal(t, schema.GroupVersion{Group: "apps.example.com", Version: "v2beta1"}, sorted[0])
+}
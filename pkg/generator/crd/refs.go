@@ -0,0 +1,114 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crd
+
+import (
+	"path"
+	"sort"
+
+	"github.com/dave/jennifer/jen"
+	"sigs.k8s.io/controller-tools/pkg/loader"
+)
+
+// GenerateGroupRefs generates zz.generated.refs.go in each version package of
+// the group, with RefTo<Kind> and ObjectRefTo<Kind> building references to
+// objects of each kind in the version, whose apiVersion and kind are from
+// SchemeGroupVersion of the package.
+func (cw *codeWriter) GenerateGroupRefs(group string) error {
+	pkgs := []*loader.Package{}
+	for pkg, gv := range cw.parser.GroupVersions {
+		if gv.Group == group {
+			pkgs = append(pkgs, pkg)
+		}
+	}
+	sort.Slice(pkgs, func(i, j int) bool {
+		return pkgs[i].PkgPath < pkgs[j].PkgPath
+	})
+
+	for _, pkg := range pkgs {
+		version := cw.parser.GroupVersions[pkg].Version
+		kinds := []string{}
+		for _, gk := range sortedGroupKinds(cw.parser.CustomResourceDefinitions) {
+			if gk.Group != group {
+				continue
+			}
+			for _, v := range cw.parser.CustomResourceDefinitions[gk].Spec.Versions {
+				if v.Name == version {
+					kinds = append(kinds, gk.Kind)
+					break
+				}
+			}
+		}
+		if len(kinds) == 0 {
+			continue
+		}
+		if err := cw.generateRefs(pkg, kinds); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cw *codeWriter) generateRefs(pkg *loader.Package, kinds []string) error {
+	pkgName := pkg.Name
+	if pkgName == "" {
+		pkgName = path.Base(pkg.PkgPath)
+	}
+	refsfile := jen.NewFile(pkgName)
+	cw.setFileDefault(refsfile)
+	refsfile.ImportAlias("k8s.io/api/core/v1", "corev1")
+
+	const (
+		metav1Pkg = "k8s.io/apimachinery/pkg/apis/meta/v1"
+		corev1Pkg = "k8s.io/api/core/v1"
+	)
+	for _, kind := range kinds {
+		gvk := jen.List(jen.Id("apiVersion"), jen.Id("kind")).Op(":=").Id("SchemeGroupVersion").Dot("WithKind").Call(jen.Lit(kind)).Dot("ToAPIVersionAndKind").Call()
+
+		refsfile.Line()
+		refsfile.Comment("RefTo" + kind + " returns an OwnerReference to obj, its apiVersion and kind are from SchemeGroupVersion.")
+		refsfile.Func().Id("RefTo"+kind).Params(jen.Id("obj").Op("*").Id(kind)).Qual(metav1Pkg, "OwnerReference").Block(
+			gvk.Clone(),
+			jen.Return(jen.Qual(metav1Pkg, "OwnerReference").Values(jen.Dict{
+				jen.Id("APIVersion"): jen.Id("apiVersion"),
+				jen.Id("Kind"):       jen.Id("kind"),
+				jen.Id("Name"):       jen.Id("obj").Dot("Name"),
+				jen.Id("UID"):        jen.Id("obj").Dot("UID"),
+			})),
+		)
+
+		refsfile.Line()
+		refsfile.Comment("ObjectRefTo" + kind + " returns an ObjectReference to obj, its apiVersion and kind are from SchemeGroupVersion.")
+		refsfile.Func().Id("ObjectRefTo"+kind).Params(jen.Id("obj").Op("*").Id(kind)).Qual(corev1Pkg, "ObjectReference").Block(
+			gvk.Clone(),
+			jen.Return(jen.Qual(corev1Pkg, "ObjectReference").Values(jen.Dict{
+				jen.Id("APIVersion"):      jen.Id("apiVersion"),
+				jen.Id("Kind"):            jen.Id("kind"),
+				jen.Id("Namespace"):       jen.Id("obj").Dot("Namespace"),
+				jen.Id("Name"):            jen.Id("obj").Dot("Name"),
+				jen.Id("UID"):             jen.Id("obj").Dot("UID"),
+				jen.Id("ResourceVersion"): jen.Id("obj").Dot("ResourceVersion"),
+			})),
+		)
+	}
+
+	filename := path.Join(path.Base(path.Dir(pkg.PkgPath)), path.Base(pkg.PkgPath), "zz.generated.refs.go")
+	w, err := cw.ctx.Open(nil, filename)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	return refsfile.Render(w)
+}
@@ -0,0 +1,154 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crd
+
+import (
+	"go/format"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/tools/go/packages"
+	apiext "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-tools/pkg/crd"
+	"sigs.k8s.io/controller-tools/pkg/genall"
+	"sigs.k8s.io/controller-tools/pkg/loader"
+	"sigs.k8s.io/controller-tools/pkg/markers"
+)
+
+func Test_codeWriter_GenerateGroupRefs(t *testing.T) {
+	appsv1Pkg := &loader.Package{Package: &packages.Package{Name: "v1", PkgPath: "github.com/example/project/pkg/apis/apps/v1"}}
+	appsv2Pkg := &loader.Package{Package: &packages.Package{Name: "v2", PkgPath: "github.com/example/project/pkg/apis/apps/v2"}}
+	batchv1Pkg := &loader.Package{Package: &packages.Package{Name: "v1", PkgPath: "github.com/example/project/pkg/apis/batch/v1"}}
+	output := OutputToMemory{}
+	cw := &codeWriter{
+		headerText: "// Copyright 2022 The Authors.\n",
+		parser: &crd.Parser{
+			GroupVersions: map[*loader.Package]schema.GroupVersion{
+				appsv1Pkg:  {Group: "apps.example.com", Version: "v1"},
+				appsv2Pkg:  {Group: "apps.example.com", Version: "v2"},
+				batchv1Pkg: {Group: "batch.example.com", Version: "v1"},
+			},
+			CustomResourceDefinitions: map[schema.GroupKind]apiext.CustomResourceDefinition{
+				{Group: "apps.example.com", Kind: "Foo"}: {
+					Spec: apiext.CustomResourceDefinitionSpec{
+						Versions: []apiext.CustomResourceDefinitionVersion{{Name: "v1"}, {Name: "v2"}},
+					},
+				},
+				{Group: "apps.example.com", Kind: "Bar"}: {
+					Spec: apiext.CustomResourceDefinitionSpec{
+						Versions: []apiext.CustomResourceDefinitionVersion{{Name: "v1"}},
+					},
+				},
+				{Group: "batch.example.com", Kind: "Job"}: {
+					Spec: apiext.CustomResourceDefinitionSpec{
+						Versions: []apiext.CustomResourceDefinitionVersion{{Name: "v1"}},
+					},
+				},
+			},
+		},
+		ctx: &genall.GenerationContext{OutputRule: output},
+	}
+	assert.NoError(t, cw.GenerateGroupRefs("apps.example.com"))
+
+	assert.Len(t, output, 2)
+	got := output["apps/v1/zz.generated.refs.go"].String()
+	assert.Contains(t, got, "package v1")
+	assert.Contains(t, got, "func RefToBar(obj *Bar) metav1.OwnerReference {")
+	assert.Contains(t, got, "func ObjectRefToBar(obj *Bar) corev1.ObjectReference {")
+	assert.Contains(t, got, "func RefToFoo(obj *Foo) metav1.OwnerReference {")
+	assert.Contains(t, got, `apiVersion, kind := SchemeGroupVersion.WithKind("Foo").ToAPIVersionAndKind()`)
+	formatted, err := format.Source([]byte(got))
+	assert.NoError(t, err)
+	assert.Equal(t, string(formatted), got)
+
+	got = output["apps/v2/zz.generated.refs.go"].String()
+	assert.Contains(t, got, "package v2")
+	assert.Contains(t, got, "func RefToFoo(obj *Foo) metav1.OwnerReference {")
+	assert.NotContains(t, got, "Bar")
+
+	// the generated refs compile against SchemeGroupVersion of the package
+	root := t.TempDir()
+	gomod, err := ioutil.ReadFile("../../../go.mod")
+	assert.NoError(t, err)
+	gosum, err := ioutil.ReadFile("../../../go.sum")
+	assert.NoError(t, err)
+	files := map[string]string{
+		"go.mod":                                strings.Replace(string(gomod), "module github.com/zoumo/kube-codegen", "module github.com/example/project", 1),
+		"go.sum":                                string(gosum),
+		"pkg/apis/apps/v1/zz.generated.refs.go": output["apps/v1/zz.generated.refs.go"].String(),
+		"pkg/apis/apps/v1/types.go": `package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var SchemeGroupVersion = schema.GroupVersion{Group: "apps.example.com", Version: "v1"}
+
+type Foo struct {
+	metav1.TypeMeta   ` + "`json:\",inline\"`" + `
+	metav1.ObjectMeta ` + "`json:\"metadata,omitempty\"`" + `
+}
+
+type Bar struct {
+	metav1.TypeMeta   ` + "`json:\",inline\"`" + `
+	metav1.ObjectMeta ` + "`json:\"metadata,omitempty\"`" + `
+}
+`,
+		"cmd/check/main.go": `package main
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	v1 "github.com/example/project/pkg/apis/apps/v1"
+)
+
+func main() {
+	foo := &v1.Foo{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "foo", UID: "uid", ResourceVersion: "1"}}
+	ref := v1.RefToFoo(foo)
+	fmt.Println(ref.APIVersion, ref.Kind, ref.Name, ref.UID)
+	objRef := v1.ObjectRefToFoo(foo)
+	fmt.Println(objRef.APIVersion, objRef.Kind, objRef.Namespace, objRef.Name, objRef.UID, objRef.ResourceVersion)
+}
+`,
+	}
+	for name, content := range files {
+		file := filepath.Join(root, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(file), 0755))
+		assert.NoError(t, ioutil.WriteFile(file, []byte(content), 0644))
+	}
+	skipUnlessE2E(t)
+	cmd := exec.Command("go", "run", "./cmd/check")
+	cmd.Dir = root
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod")
+	out, err := cmd.Output()
+	assert.NoError(t, err, exitStderr(err))
+	assert.Equal(t, "apps.example.com/v1 Foo foo uid\napps.example.com/v1 Foo default foo uid 1\n", string(out))
+}
+
+func TestGenerator_GenRefsMarker(t *testing.T) {
+	defn := markers.Must(markers.MakeDefinition("crd", markers.DescribesPackage, Generator{}))
+	got, err := defn.Parse(`+crd:headerFile=hack/boilerplate.go.txt,genCRD=false,genInstall=true,genRefs=true`)
+	assert.NoError(t, err)
+	assert.True(t, got.(Generator).GenRefs)
+}
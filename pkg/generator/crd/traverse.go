@@ -17,6 +17,9 @@ package crd
 import (
 	"encoding/json"
 	"reflect"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/dave/jennifer/jen"
 	"github.com/zoumo/golib/reflection"
@@ -157,9 +160,11 @@ func generateBuiltinLiteralValue(v reflect.Value) *jen.Statement {
 	case reflect.Int32:
 		value = int32(v.Int())
 	case reflect.Int64:
-		value = v.Int()
+		// render typed decimal literal explicitly, e.g. int64(-9223372036854775808),
+		// so it never overflows an untyped constant when converted to a defined type
+		return jen.Int64().Parens(jen.Op(strconv.FormatInt(v.Int(), 10)))
 	case reflect.Uint:
-		value = uint(v.Uint())
+		return jen.Uint().Parens(jen.Op(strconv.FormatUint(v.Uint(), 10)))
 	case reflect.Uint8:
 		value = uint8(v.Uint())
 	case reflect.Uint16:
@@ -167,7 +172,8 @@ func generateBuiltinLiteralValue(v reflect.Value) *jen.Statement {
 	case reflect.Uint32:
 		value = uint32(v.Uint())
 	case reflect.Uint64:
-		value = v.Uint()
+		// e.g. uint64(18446744073709551615)
+		return jen.Uint64().Parens(jen.Op(strconv.FormatUint(v.Uint(), 10)))
 	case reflect.Float32:
 		value = float32(v.Float())
 	case reflect.Float64:
@@ -269,12 +275,9 @@ func generateStructWithUnexportedField(v reflect.Value, ptrResult bool) *jen.Sta
 }
 
 func Capitalize(str string) string {
-	if len(str) < 1 {
-		return ""
+	r, size := utf8.DecodeRuneInString(str)
+	if r == utf8.RuneError {
+		return str
 	}
-	strArry := []rune(str)
-	if strArry[0] >= 97 && strArry[0] <= 122 {
-		strArry[0] -= 32
-	}
-	return string(strArry)
+	return string(unicode.ToUpper(r)) + str[size:]
 }
@@ -0,0 +1,144 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crd
+
+import (
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/tools/go/packages"
+	apiext "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"sigs.k8s.io/controller-tools/pkg/loader"
+	"sigs.k8s.io/controller-tools/pkg/markers"
+)
+
+// typeCheckExpr checks expr compiles when assigned to a variable of typ,
+// typ can be a builtin type or Custom<builtin> defined type.
+func typeCheckExpr(t *testing.T, builtin, typ, expr string) {
+	src := fmt.Sprintf("package p\n\ntype Custom%s %s\n\nvar _ %s = %s\n", builtin, builtin, typ, expr)
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "p.go", src, 0)
+	if !assert.NoError(t, err, src) {
+		return
+	}
+	conf := types.Config{Importer: importer.Default()}
+	_, err = conf.Check("p", fset, []*ast.File{f}, nil)
+	assert.NoError(t, err, src)
+}
+
+func Test_generateBuiltinLiteralValue(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  string
+	}{
+		{int64(math.MinInt64), "int64(-9223372036854775808)"},
+		{int64(math.MaxInt64), "int64(9223372036854775807)"},
+		{uint64(math.MaxUint64), "uint64(18446744073709551615)"},
+		{uint(math.MaxUint64), "uint(18446744073709551615)"},
+		{int32(math.MinInt32), "int32(-2147483648)"},
+	}
+	for _, tt := range tests {
+		v := reflect.ValueOf(tt.value)
+		got := fmt.Sprintf("%#v", generateBuiltinLiteralValue(v))
+		assert.Equal(t, tt.want, got)
+
+		typ := v.Kind().String()
+		typeCheckExpr(t, typ, typ, got)
+		// custom type
+		typeCheckExpr(t, typ, "Custom"+typ, fmt.Sprintf("Custom%s(%s)", typ, got))
+	}
+}
+
+func TestCapitalize(t *testing.T) {
+	tests := []struct {
+		str  string
+		want string
+	}{
+		{"", ""},
+		{"widget", "Widget"},
+		{"Widget", "Widget"},
+		{"iSCSI", "ISCSI"},
+		{"éWidget", "ÉWidget"},
+		{"ÉWidget", "ÉWidget"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, Capitalize(tt.str))
+	}
+}
+
+func TestGenerateValue_crdVersionFields(t *testing.T) {
+	newVersion := func() apiext.CustomResourceDefinitionVersion {
+		return apiext.CustomResourceDefinitionVersion{
+			Name:   "v1",
+			Served: true,
+			AdditionalPrinterColumns: []apiext.CustomResourceColumnDefinition{
+				{Name: "Color", Type: "string", JSONPath: ".spec.color"},
+			},
+		}
+	}
+
+	// slices of structs in versions are reproduced by reflection
+	got := fmt.Sprintf("%#v", GenerateValue(newVersion()))
+	assert.Contains(t, got, "AdditionalPrinterColumns: []v1.CustomResourceColumnDefinition{")
+	assert.Contains(t, got, `JSONPath: ".spec.color"`)
+}
+
+func TestGenerator_selectableFieldMarker(t *testing.T) {
+	src := `package v1
+
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:selectablefield:JSONPath=.spec.color
+type Widget struct {
+	Spec WidgetSpec ` + "`json:\"spec\"`" + `
+}
+
+type WidgetSpec struct {
+	Color string ` + "`json:\"color\"`" + `
+}
+`
+	f, err := parser.ParseFile(token.NewFileSet(), "types.go", src, parser.ParseComments)
+	if !assert.NoError(t, err) {
+		return
+	}
+	pkg := &loader.Package{Package: &packages.Package{
+		ID:      "github.com/example/project/pkg/apis/apps/v1",
+		PkgPath: "github.com/example/project/pkg/apis/apps/v1",
+		Syntax:  []*ast.File{f},
+	}}
+	reg := &markers.Registry{}
+	assert.NoError(t, Generator{}.RegisterMarkers(reg))
+	col := &markers.Collector{Registry: reg}
+
+	var widget markers.MarkerValues
+	assert.NoError(t, markers.EachType(col, pkg, func(info *markers.TypeInfo) {
+		if info.Name == "Widget" {
+			widget = info.Markers
+		}
+	}))
+	assert.NotNil(t, widget.Get("kubebuilder:resource"))
+	// selectableFields is added in kubernetes 1.30, controller-tools v0.5.0 in
+	// use does not define the marker, which is ignored instead of failing the
+	// generation
+	assert.Nil(t, reg.Lookup("+kubebuilder:selectablefield", markers.DescribesType))
+	assert.Nil(t, widget.Get("kubebuilder:selectablefield"))
+}
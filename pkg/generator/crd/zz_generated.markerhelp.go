@@ -47,6 +47,130 @@ func (Generator) Help() *markers.DefinitionHelp {
 				Summary: "specifies the year to substitute for \" YEAR\" in the header file.",
 				Details: "",
 			},
+			"HeaderVars": {
+				Summary: "specifies the values to substitute for {{.<key>}} placeholders in the header file, e.g. {{.Company}}.",
+				Details: "",
+			},
+			"GenYAML": {
+				Summary: "let this generator generate CustomResourceDefinition YAML manifests along with the go constructors. It only takes effect when GenCRD is true.",
+				Details: "",
+			},
+			"AggregateOnly": {
+				Summary: "let this generator only generate NewCustomResourceDefinitions constructing each CustomResourceDefinition inline, and skip the exported New<Kind>CRD constructors. It only takes effect when GenCRD is true.",
+				Details: "",
+			},
+			"ForceConversionNone": {
+				Summary: "let this generator set the conversion strategy of every generated CustomResourceDefinition to None, instead of the strategy inferred by controller-tools, e.g. during initial bring-up of a multi-version API before the conversion webhook is deployed.",
+				Details: "",
+			},
+			"OnlyYAML": {
+				Summary: "let this generator only generate CustomResourceDefinition YAML manifests and skip the go constructors. It only takes effect when GenCRD is true.",
+				Details: "",
+			},
+			"SingleYAMLFile": {
+				Summary: "let this generator write CustomResourceDefinition YAML manifests of all groups into the file relative to the output dir, sorted by group and kind, instead of a file per CRD. It only takes effect with GenYAML or OnlyYAML.",
+				Details: "",
+			},
+			"ServedVersions": {
+				Summary: "overrides served of CustomResourceDefinition versions set by markers, keyed by group/version, e.g. {\"apps.example.com/v1\":false}.",
+				Details: "",
+			},
+			"StorageVersions": {
+				Summary: "overrides storage of CustomResourceDefinition versions set by markers, keyed by group/version, e.g. {\"apps.example.com/v2\":true}. Every overridden CustomResourceDefinition must have exactly one storage version.",
+				Details: "",
+			},
+			"MaxDepth": {
+				Summary: "specifies the maximum nesting depth of OpenAPI v3 schema of every generated CustomResourceDefinition. Deeper subtrees are pruned and replaced by x-kubernetes-preserve-unknown-fields. ",
+				Details: "Left unspecified or 0, the schema is not pruned.",
+			},
+			"PreserveVersionOrder": {
+				Summary: "let this generator reorder versions of every generated CustomResourceDefinition to match the order of input packages, instead of the order sorted by controller-tools.",
+				Details: "",
+			},
+			"CodeGeneratedTemplate": {
+				Summary: "specifies the go template of the \"Code generated\" comment stamped on every generated go file. {{.Generator}}, {{.Date}} and {{.Version}} are available in the template. ",
+				Details: "Left unspecified, the default is \"// Code generated by {{.Generator}}. DO NOT EDIT.\"",
+			},
+			"SourceDateEpoch": {
+				Summary: "specifies the unix timestamp used as the generation date to make generated files reproducible. ",
+				Details: "Left unspecified, the default is now.",
+			},
+			"SkipGroupProtection": {
+				Summary: "let this generator skip annotating CRDs of kubernetes community owned API groups (*.k8s.io and *.kubernetes.io) with api-approved.kubernetes.io, e.g. for internal groups in disconnected clusters.",
+				Details: "",
+			},
+			"VersionAnnotation": {
+				Summary: "specifies the annotation key used to stamp Version on every generated CRD.",
+				Details: "",
+			},
+			"SchemeOnly": {
+				Summary: "let this generator only generate the top-level install package installing all groups, and skip install packages of each group. It only takes effect when GenInstall is true.",
+				Details: "",
+			},
+			"InstallPackageName": {
+				Summary: "specifies the go package name and the directory name of install packages generated by GenInstall, e.g. scheme. ",
+				Details: "Left unspecified, the default is install",
+			},
+			"InstallReturnError": {
+				Summary: "let this generator additionally generate InstallOrError in install packages, which returns errors of AddToScheme instead of panicking. It only takes effect when GenInstall is true.",
+				Details: "",
+			},
+			"GenAPIDocs": {
+				Summary: "let this generator generate types.md for each group listing kinds and their fields, json tags and validation markers, for API documentation.",
+				Details: "",
+			},
+			"SchemeAddMetav1": {
+				Summary: "let this generator add metav1 types (e.g. ListOptions) to each group version by metav1.AddToGroupVersion in install packages, which is required by apiservers serving list and watch. It only takes effect when GenInstall is true.",
+				Details: "",
+			},
+			"ConversionPackages": {
+				Summary: "maps import paths of version packages to the packages their generated conversions are moved into. Install packages add these to scheme instead, whose AddToScheme adds both types and conversions. It only takes effect when GenInstall is true.",
+				Details: "",
+			},
+			"GenEvents": {
+				Summary: "let this generator generate event recorder helper for each group. It only takes effect when GenInstall is true.",
+				Details: "",
+			},
+			"GenRoundTripTests": {
+				Summary: "let this generator generate round trip tests fuzzing serialization of each group against its Install function. It only takes effect when GenInstall is true.",
+				Details: "",
+			},
+			"GenRefs": {
+				Summary: "let this generator generate RefTo<Kind> and ObjectRefTo<Kind> for each kind in version packages of each group, which build OwnerReference and ObjectReference to objects by SchemeGroupVersion of the package. It only takes effect when GenInstall is true.",
+				Details: "",
+			},
+			"GenPriority": {
+				Summary: "let this generator generate PrioritizedVersionsAllGroups in install package. It only takes effect when GenInstall is true.",
+				Details: "",
+			},
+			"GenDynamic": {
+				Summary: "let this generator generate dynamic.go with dynamic informer helpers for the GroupVersionResource of each kind. It is generated into the informers package generated by informer-gen, and GenCRD and GenInstall should be false.",
+				Details: "",
+			},
+			"DynamicPackage": {
+				Summary: "specifies the go package name of dynamic.go generated by GenDynamic. ",
+				Details: "Left unspecified, the default is informers",
+			},
+			"GenUnstructuredAdapter": {
+				Summary: "let this generator generate adapter.go with helpers converting each kind from and to unstructured objects. It is generated into the clientset package generated by client-gen, and GenCRD and GenInstall should be false.",
+				Details: "",
+			},
+			"AdapterPackage": {
+				Summary: "specifies the go package name of adapter.go generated by GenUnstructuredAdapter. ",
+				Details: "Left unspecified, the default is versioned",
+			},
+			"SchemePackage": {
+				Summary: "specifies the import path of scheme package generated by client-gen, it is required by GenUnstructuredAdapter.",
+				Details: "",
+			},
+			"VersionPriority": {
+				Summary: "specifies the priority of version levels used by GenPriority. ",
+				Details: "Left unspecified, the default is stable;beta;alpha",
+			},
+			"Version": {
+				Summary: "specifies the version stamped on every generated CRD with VersionAnnotation.",
+				Details: "",
+			},
 		},
 	}
 }
@@ -0,0 +1,170 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package logging provides logr.Logger implementations used by kube-codegen
+// besides the console logger.
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+const (
+	// FormatText is the human readable console log format.
+	FormatText = "text"
+	// FormatJSON is the log format writing one JSON object per line.
+	FormatJSON = "json"
+)
+
+// Formats are the supported log formats.
+var Formats = []string{FormatText, FormatJSON}
+
+// jsonSink writes lines to w serially.
+type jsonSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// jsonLogger is a logr.Logger writing each entry as a JSON object in one line
+// with ts, level, logger, msg and error fields followed by key/value pairs.
+type jsonLogger struct {
+	sink      *jsonSink
+	verbosity int
+	level     int
+	name      string
+	values    []interface{}
+	now       func() time.Time
+}
+
+var _ logr.Logger = &jsonLogger{}
+
+// NewJSON returns a logr.Logger writing entries with level up to verbosity to w
+// in JSON lines, so that structured consumers can reassemble them by fields,
+// e.g. generator.
+func NewJSON(w io.Writer, verbosity int) logr.Logger {
+	return &jsonLogger{
+		sink:      &jsonSink{w: w},
+		verbosity: verbosity,
+		now:       time.Now,
+	}
+}
+
+func (l *jsonLogger) clone() *jsonLogger {
+	c := *l
+	c.values = append([]interface{}{}, l.values...)
+	return &c
+}
+
+func (l *jsonLogger) Enabled() bool {
+	return l.level <= l.verbosity
+}
+
+func (l *jsonLogger) Info(msg string, keysAndValues ...interface{}) {
+	if !l.Enabled() {
+		return
+	}
+	l.write("info", msg, nil, keysAndValues)
+}
+
+func (l *jsonLogger) Error(err error, msg string, keysAndValues ...interface{}) {
+	l.write("error", msg, err, keysAndValues)
+}
+
+func (l *jsonLogger) V(level int) logr.Logger {
+	c := l.clone()
+	c.level += level
+	return c
+}
+
+func (l *jsonLogger) WithValues(keysAndValues ...interface{}) logr.Logger {
+	c := l.clone()
+	c.values = append(c.values, keysAndValues...)
+	return c
+}
+
+func (l *jsonLogger) WithName(name string) logr.Logger {
+	c := l.clone()
+	if len(c.name) > 0 {
+		c.name += "/"
+	}
+	c.name += name
+	return c
+}
+
+func (l *jsonLogger) write(level, msg string, err error, keysAndValues []interface{}) {
+	buf := &bytes.Buffer{}
+	buf.WriteString("{")
+	writeField(buf, "ts", l.now().Format(time.RFC3339), true)
+	writeField(buf, "level", level, false)
+	if l.level > 0 {
+		writeField(buf, "v", l.level, false)
+	}
+	if len(l.name) > 0 {
+		writeField(buf, "logger", l.name, false)
+	}
+	writeField(buf, "msg", msg, false)
+	if err != nil {
+		writeField(buf, "error", err.Error(), false)
+	}
+	kvs := append(append([]interface{}{}, l.values...), keysAndValues...)
+	for i := 0; i < len(kvs); i += 2 {
+		var value interface{} = "(MISSING)"
+		if i+1 < len(kvs) {
+			value = kvs[i+1]
+		}
+		writeField(buf, fmt.Sprint(kvs[i]), value, false)
+	}
+	buf.WriteString("}\n")
+
+	l.sink.mu.Lock()
+	defer l.sink.mu.Unlock()
+	l.sink.w.Write(buf.Bytes()) //nolint
+}
+
+// writeField writes "key":value to buf, values which can not be marshaled
+// are written as strings.
+func writeField(buf *bytes.Buffer, key string, value interface{}, first bool) {
+	if !first {
+		buf.WriteString(",")
+	}
+	k, _ := json.Marshal(key)
+	buf.Write(k)
+	buf.WriteString(":")
+	if err, ok := value.(error); ok {
+		value = err.Error()
+	}
+	v, err := json.Marshal(value)
+	if err != nil {
+		v, _ = json.Marshal(fmt.Sprintf("%+v", value))
+	}
+	buf.Write(v)
+}
+
+// ValidateFormat returns error if format is not one of Formats.
+func ValidateFormat(format string) error {
+	for _, f := range Formats {
+		if f == format {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported log format %q, must be one of %s", format, strings.Join(Formats, "|"))
+}
@@ -0,0 +1,53 @@
+// Copyright 2022 jim.zoumo@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestJSON(w *bytes.Buffer, verbosity int) *jsonLogger {
+	l := NewJSON(w, verbosity).(*jsonLogger)
+	l.now = func() time.Time { return time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC) }
+	return l
+}
+
+func TestJSON(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := newTestJSON(buf, 1)
+
+	l.WithName("kubegen").WithName("code-gen").WithValues("generator", "client").Info("generating", "args", []string{"--input", "a"}, "dangling")
+	l.V(1).Info("verbose")
+	l.V(2).Info("too verbose")
+	l.V(2).Error(errors.New("boom"), "failed", "err", errors.New("cause"))
+
+	assert.Equal(t, strings.Join([]string{
+		`{"ts":"2022-01-01T00:00:00Z","level":"info","logger":"kubegen/code-gen","msg":"generating","generator":"client","args":["--input","a"],"dangling":"(MISSING)"}`,
+		`{"ts":"2022-01-01T00:00:00Z","level":"info","v":1,"msg":"verbose"}`,
+		`{"ts":"2022-01-01T00:00:00Z","level":"error","v":2,"msg":"failed","error":"boom","err":"cause"}`,
+	}, "\n")+"\n", buf.String())
+}
+
+func TestValidateFormat(t *testing.T) {
+	assert.NoError(t, ValidateFormat(FormatText))
+	assert.NoError(t, ValidateFormat(FormatJSON))
+	assert.Error(t, ValidateFormat("yaml"))
+}